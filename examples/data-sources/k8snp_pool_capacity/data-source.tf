@@ -0,0 +1,25 @@
+# Ensure the replacement node pool has at least the capacity
+# of the node pool it replaces before the old one is drained
+data "k8snp_pool_capacity" "old" {
+  node_selector_value = var.old_node_pool_name
+}
+
+data "k8snp_pool_capacity" "new" {
+  node_selector_value = google_container_node_pool.safe_node_pool.name
+}
+
+resource "k8snp_node_pool" "node_pool" {
+  node_pool_name = google_container_node_pool.safe_node_pool.name
+
+  lifecycle {
+    create_before_destroy = true
+
+    precondition {
+      condition = (
+        data.k8snp_pool_capacity.new.cpu_millicores >= data.k8snp_pool_capacity.old.cpu_millicores &&
+        data.k8snp_pool_capacity.new.memory_bytes >= data.k8snp_pool_capacity.old.memory_bytes
+      )
+      error_message = "The new node pool has less capacity than the old one."
+    }
+  }
+}
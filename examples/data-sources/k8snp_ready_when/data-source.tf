@@ -0,0 +1,19 @@
+# Wait for the nodes of a GKE node pool to be ready and
+# gate another resource on their readiness
+data "k8snp_ready_when" "node_pool" {
+  node_selector_value = google_container_node_pool.safe_node_pool.name
+  min_ready_nodes     = 2
+  timeout             = "600s"
+}
+
+resource "helm_release" "app" {
+  name  = "app"
+  chart = "./charts/app"
+
+  lifecycle {
+    precondition {
+      condition     = data.k8snp_ready_when.node_pool.ready
+      error_message = "The node pool does not have enough ready nodes."
+    }
+  }
+}
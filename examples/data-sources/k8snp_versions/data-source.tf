@@ -0,0 +1,15 @@
+# Require a cluster recent enough to support the policy/v1 eviction API
+data "k8snp_versions" "current" {}
+
+resource "k8snp_node_pool" "node_pool" {
+  node_pool_name = google_container_node_pool.safe_node_pool.name
+
+  lifecycle {
+    create_before_destroy = true
+
+    precondition {
+      condition     = tonumber(trimsuffix(data.k8snp_versions.current.cluster_minor, "+")) >= 22
+      error_message = "The cluster must run kubernetes 1.22 or later."
+    }
+  }
+}
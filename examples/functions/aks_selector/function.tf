@@ -0,0 +1,10 @@
+# Select the nodes of the AKS agent pool mypool
+locals {
+  selector = provider::k8snp::aks_selector("mypool")
+}
+
+resource "k8snp_node_pool" "example" {
+  node_pool_name      = "mypool"
+  node_selector_key   = local.selector.node_selector_key
+  node_selector_value = local.selector.node_selector_value
+}
@@ -0,0 +1,10 @@
+# Select the nodes of the EKS managed node group my-node-group
+locals {
+  selector = provider::k8snp::eks_selector("my-node-group")
+}
+
+resource "k8snp_node_pool" "example" {
+  node_pool_name      = "my-node-group"
+  node_selector_key   = local.selector.node_selector_key
+  node_selector_value = local.selector.node_selector_value
+}
@@ -0,0 +1,10 @@
+# Select the nodes of the GKE node pool my-node-pool
+locals {
+  selector = provider::k8snp::gke_selector("my-node-pool")
+}
+
+resource "k8snp_node_pool" "example" {
+  node_pool_name      = "my-node-pool"
+  node_selector_key   = local.selector.node_selector_key
+  node_selector_value = local.selector.node_selector_value
+}
@@ -0,0 +1,5 @@
+# Require 90% of the 10 nodes of the pool to be ready, i.e. 9 nodes
+resource "k8snp_node_pool" "example" {
+  node_pool_name  = "my-node-pool"
+  min_ready_nodes = provider::k8snp::min_ready_nodes(10, 90)
+}
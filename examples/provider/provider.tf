@@ -98,7 +98,7 @@ resource "google_container_node_pool" "safe_node_pool" {
 # monitor the number of ready nodes in the pool and
 # ensure the resource is not considered created until
 # all the expected nodes are ready.
-resource "k8snp_pool" "node_pool" {
+resource "k8snp_node_pool" "node_pool" {
   node_pool_name  = google_container_node_pool.safe_node_pool.name
   min_ready_nodes = 2
   drain_wait      = "60s"
@@ -0,0 +1,19 @@
+# Label and taint the nodes of a node pool for a dedicated workload,
+# including the nodes added later by the cluster autoscaler
+resource "k8snp_node_bootstrap" "ingress" {
+  node_selector = "cloud.google.com/gke-nodepool=${google_container_node_pool.ingress.name}"
+
+  labels = {
+    "example.com/role" = "ingress"
+  }
+
+  annotations = {
+    "example.com/owner" = "platform"
+  }
+
+  taint {
+    key    = "example.com/role"
+    value  = "ingress"
+    effect = "NoSchedule"
+  }
+}
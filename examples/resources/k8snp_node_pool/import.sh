@@ -0,0 +1,9 @@
+# Adopt an existing node pool selected by the default node_selector_key
+terraform import k8snp_node_pool.example my-node-pool
+
+# Adopt an existing node pool selected by another label
+terraform import k8snp_node_pool.example 'eks.amazonaws.com/nodegroup=blue|my-node-pool'
+
+# Resume an interrupted drain with the progress token
+# reported in the error of the failed destroy
+terraform import k8snp_node_pool.example k8snp-progress:eyJub2RlX3Bvb2xfbmFtZSI6Im15LW5vZGUtcG9vbCIsImRyYWluZWRfbm9kZXMiOlsibm9kZS0xIl19
@@ -0,0 +1,43 @@
+# Drain a group of bare-metal nodes before maintenance. Label the nodes
+# to maintain with maintenance-group=<group> and destroy the resource,
+# e.g. with terraform destroy -target, to cordon and drain them.
+terraform {
+  required_providers {
+    k8snp = {
+      source = "registry.terraform.io/dedalusj/k8snp"
+    }
+  }
+}
+
+variable "kube_host" {
+  type = string
+}
+
+variable "cluster_ca_certificate" {
+  type = string
+}
+
+variable "token" {
+  type      = string
+  sensitive = true
+}
+
+variable "maintenance_group" {
+  type    = string
+  default = "rack-a"
+}
+
+provider "k8snp" {
+  kube_host              = var.kube_host
+  cluster_ca_certificate = var.cluster_ca_certificate
+  token                  = var.token
+}
+
+resource "k8snp_node_pool" "maintenance" {
+  node_pool_name      = "maintenance-${var.maintenance_group}"
+  node_selector_key   = "maintenance-group"
+  node_selector_value = var.maintenance_group
+  min_ready_nodes     = 1
+  drain_timeout       = "900s"
+  drain_wait          = "120s"
+}
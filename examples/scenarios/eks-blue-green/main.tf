@@ -0,0 +1,78 @@
+# Blue/green rotation of EKS managed node groups: switch active_color
+# to create the other node group, wait for its nodes to be ready and
+# then cordon and drain the previous one before it is destroyed.
+terraform {
+  required_providers {
+    k8snp = {
+      source = "registry.terraform.io/dedalusj/k8snp"
+    }
+    aws = {
+      source  = "hashicorp/aws"
+      version = "4.65.0"
+    }
+  }
+}
+
+variable "cluster_name" {
+  type = string
+}
+
+variable "node_role_arn" {
+  type = string
+}
+
+variable "subnet_ids" {
+  type = list(string)
+}
+
+variable "active_color" {
+  type    = string
+  default = "blue"
+
+  validation {
+    condition     = contains(["blue", "green"], var.active_color)
+    error_message = "The active color must be either blue or green."
+  }
+}
+
+data "aws_eks_cluster" "cluster" {
+  name = var.cluster_name
+}
+
+data "aws_eks_cluster_auth" "cluster" {
+  name = var.cluster_name
+}
+
+provider "k8snp" {
+  kube_host              = data.aws_eks_cluster.cluster.endpoint
+  cluster_ca_certificate = base64decode(data.aws_eks_cluster.cluster.certificate_authority.0.data)
+  token                  = data.aws_eks_cluster_auth.cluster.token
+}
+
+resource "aws_eks_node_group" "pool" {
+  cluster_name    = var.cluster_name
+  node_group_name = "pool-${var.active_color}"
+  node_role_arn   = var.node_role_arn
+  subnet_ids      = var.subnet_ids
+
+  scaling_config {
+    desired_size = 3
+    min_size     = 3
+    max_size     = 6
+  }
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
+resource "k8snp_node_pool" "pool" {
+  node_pool_name    = aws_eks_node_group.pool.node_group_name
+  node_selector_key = "eks.amazonaws.com/nodegroup"
+  min_ready_nodes   = aws_eks_node_group.pool.scaling_config.0.desired_size
+  drain_wait        = "30s"
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
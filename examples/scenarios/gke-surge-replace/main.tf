@@ -0,0 +1,92 @@
+# Replace a GKE node pool whenever its configuration changes: the new
+# pool is created and becomes ready before the old one is cordoned,
+# drained and finally destroyed.
+terraform {
+  required_providers {
+    k8snp = {
+      source = "registry.terraform.io/dedalusj/k8snp"
+    }
+    google = {
+      source  = "hashicorp/google"
+      version = "4.61.0"
+    }
+    random = {
+      source  = "hashicorp/random"
+      version = "3.5.1"
+    }
+  }
+}
+
+variable "google_project_id" {
+  type = string
+}
+
+variable "region" {
+  type    = string
+  default = "australia-southeast2"
+}
+
+variable "machine_type" {
+  type    = string
+  default = "n1-standard-1"
+}
+
+provider "google" {
+  project = var.google_project_id
+  region  = var.region
+}
+
+provider "k8snp" {
+  kube_host              = "https://${google_container_cluster.cluster.endpoint}"
+  cluster_ca_certificate = base64decode(google_container_cluster.cluster.master_auth.0.cluster_ca_certificate)
+  token                  = data.google_client_config.current.access_token
+}
+
+data "google_client_config" "current" {}
+
+resource "google_container_cluster" "cluster" {
+  name     = "k8snp-surge-replace"
+  location = var.region
+
+  remove_default_node_pool = true
+  initial_node_count       = 1
+}
+
+# Every property requiring a new node pool must be a keeper
+# so that a change generates a new node pool name
+resource "random_id" "node_pool" {
+  keepers = {
+    machine_type = var.machine_type
+  }
+
+  byte_length = 4
+}
+
+resource "google_container_node_pool" "pool" {
+  name               = "pool-${random_id.node_pool.hex}"
+  location           = var.region
+  cluster            = google_container_cluster.cluster.name
+  initial_node_count = 1
+
+  node_config {
+    machine_type = random_id.node_pool.keepers.machine_type
+  }
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
+resource "k8snp_node_pool" "pool" {
+  node_pool_name  = google_container_node_pool.pool.name
+  min_ready_nodes = 3
+  drain_wait      = "60s"
+
+  timeouts {
+    create = "600s"
+  }
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
@@ -0,0 +1,38 @@
+// Package kube creates the clients of the kubernetes API used by the provider:
+// the REST configuration, its authentication and transport, and the clientsets
+// built from it.
+package kube
+
+import (
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// ClientProvider creates the kubernetes clients used by the
+// resources and data sources of the provider.
+type ClientProvider interface {
+	KubeClient(config *restclient.Config) (kubernetes.Interface, error)
+}
+
+// ClientProviderFunc adapts a function to a ClientProvider.
+type ClientProviderFunc func(config *restclient.Config) (kubernetes.Interface, error)
+
+func (f ClientProviderFunc) KubeClient(config *restclient.Config) (kubernetes.Interface, error) {
+	return f(config)
+}
+
+// DefaultClientProvider returns a ClientProvider creating
+// clientsets connected to the configured kubernetes API.
+func DefaultClientProvider() ClientProvider {
+	return ClientProviderFunc(func(config *restclient.Config) (kubernetes.Interface, error) {
+		return kubernetes.NewForConfig(config)
+	})
+}
+
+// StaticClientProvider returns a ClientProvider always returning
+// the given client, e.g. a fake clientset in tests.
+func StaticClientProvider(client kubernetes.Interface) ClientProvider {
+	return ClientProviderFunc(func(_ *restclient.Config) (kubernetes.Interface, error) {
+		return client, nil
+	})
+}
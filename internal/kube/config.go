@@ -0,0 +1,122 @@
+package kube
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	apimachineryschema "k8s.io/apimachinery/pkg/runtime/schema"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Config describes how to connect and authenticate to the kubernetes API.
+type Config struct {
+	Host                 string
+	ClusterCACertificate string
+	Token                string
+	// ClientCertificate and ClientKey are the paths of the client
+	// certificate and key files
+	ClientCertificate string
+	ClientKey         string
+	UserAgent         string
+	UseProtobuf       bool
+	// ExtraHeaders are set on every request to the kubernetes API
+	ExtraHeaders map[string]string
+	// DryRun makes every request changing objects a server-side dry run
+	DryRun   bool
+	Advanced *AdvancedConfig
+}
+
+// AdvancedConfig tunes the transport to the kubernetes API. Unset fields
+// keep the client-go defaults.
+type AdvancedConfig struct {
+	DisableCompression  bool
+	AcceptContentTypes  string
+	DialTimeout         *time.Duration
+	TLSHandshakeTimeout *time.Duration
+}
+
+// NewRESTConfig returns the REST configuration of the clients of the
+// kubernetes API described by c. It returns nil when c is not a valid
+// configuration, e.g. when no host is known yet during a plan, so that the
+// provider can still be configured and fail only once the API is used.
+func NewRESTConfig(c Config) (*restclient.Config, error) {
+	overrides := &clientcmd.ConfigOverrides{}
+	loader := &clientcmd.ClientConfigLoadingRules{}
+
+	overrides.ClusterInfo.CertificateAuthorityData = bytes.NewBufferString(c.ClusterCACertificate).Bytes()
+
+	host, _, err := restclient.DefaultServerURL(c.Host, "", apimachineryschema.GroupVersion{}, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host: %s", err)
+	}
+	overrides.ClusterInfo.Server = host.String()
+
+	overrides.AuthInfo.Token = c.Token
+
+	// client-go reloads certificates and keys provided as files when they
+	// change, which lets us survive rotations during long drains
+	overrides.AuthInfo.ClientCertificate = c.ClientCertificate
+	overrides.AuthInfo.ClientKey = c.ClientKey
+
+	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loader, overrides)
+	cfg, err := cc.ClientConfig()
+	if err != nil {
+		log.Printf("[WARN] Invalid provider configuration was supplied. Provider operations likely to fail: %v", err)
+		return nil, nil
+	}
+
+	cfg.UserAgent = c.UserAgent
+
+	if c.UseProtobuf {
+		cfg.ContentType = runtime.ContentTypeProtobuf
+		cfg.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	}
+
+	if c.Advanced != nil {
+		applyAdvancedConfig(cfg, c.Advanced)
+	}
+
+	if c.ExtraHeaders != nil {
+		cfg.Wrap(WithHeaders(c.ExtraHeaders))
+	}
+
+	if c.DryRun {
+		cfg.Wrap(WithServerDryRun())
+	}
+
+	return cfg, nil
+}
+
+func applyAdvancedConfig(cfg *restclient.Config, a *AdvancedConfig) {
+	cfg.DisableCompression = a.DisableCompression
+
+	if a.AcceptContentTypes != "" {
+		cfg.AcceptContentTypes = a.AcceptContentTypes
+	}
+
+	if a.DialTimeout != nil {
+		cfg.Dial = (&net.Dialer{
+			Timeout:   *a.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+
+	if a.TLSHandshakeTimeout != nil {
+		tlsHandshakeTimeout := *a.TLSHandshakeTimeout
+		cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			transport, ok := rt.(*http.Transport)
+			if !ok {
+				return rt
+			}
+			transport = transport.Clone()
+			transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+			return transport
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package kube
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestNewRESTConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.WriteFile(file, []byte("pem"), 0o600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	timeout := 10 * time.Second
+
+	tests := map[string]struct {
+		config   Config
+		expected restclient.Config
+		// wrapped and dial are whether the transport is wrapped and
+		// the dialer set, as functions cannot be compared
+		wrapped bool
+		dial    bool
+	}{
+		"token": {
+			config: Config{Host: "https://example.com:6443", ClusterCACertificate: "ca", Token: "token", UserAgent: "k8snp/1.0"},
+			expected: restclient.Config{
+				Host:            "https://example.com:6443",
+				BearerToken:     "token",
+				TLSClientConfig: restclient.TLSClientConfig{CAData: []byte("ca")},
+				UserAgent:       "k8snp/1.0",
+			},
+		},
+		"host without scheme": {
+			config:   Config{Host: "example.com"},
+			expected: restclient.Config{Host: "http://example.com"},
+		},
+		"client certificate": {
+			config: Config{Host: "https://example.com", ClientCertificate: certFile, ClientKey: keyFile},
+			expected: restclient.Config{
+				Host:            "https://example.com",
+				TLSClientConfig: restclient.TLSClientConfig{CertFile: certFile, KeyFile: keyFile},
+			},
+		},
+		"protobuf": {
+			config: Config{Host: "https://example.com", UseProtobuf: true},
+			expected: restclient.Config{
+				Host: "https://example.com",
+				ContentConfig: restclient.ContentConfig{
+					ContentType:        "application/vnd.kubernetes.protobuf",
+					AcceptContentTypes: "application/vnd.kubernetes.protobuf,application/json",
+				},
+			},
+		},
+		"protobuf with accepted content types": {
+			config: Config{Host: "https://example.com", UseProtobuf: true, Advanced: &AdvancedConfig{AcceptContentTypes: "application/json"}},
+			expected: restclient.Config{
+				Host: "https://example.com",
+				ContentConfig: restclient.ContentConfig{
+					ContentType:        "application/vnd.kubernetes.protobuf",
+					AcceptContentTypes: "application/json",
+				},
+			},
+		},
+		"advanced": {
+			config: Config{Host: "https://example.com", Advanced: &AdvancedConfig{DisableCompression: true, DialTimeout: &timeout, TLSHandshakeTimeout: &timeout}},
+			expected: restclient.Config{
+				Host:               "https://example.com",
+				DisableCompression: true,
+			},
+			wrapped: true,
+			dial:    true,
+		},
+		"extra headers": {
+			config:   Config{Host: "https://example.com", ExtraHeaders: map[string]string{"X-Tenant": "team-a"}},
+			expected: restclient.Config{Host: "https://example.com"},
+			wrapped:  true,
+		},
+		"dry run": {
+			config:   Config{Host: "https://example.com", DryRun: true},
+			expected: restclient.Config{Host: "https://example.com"},
+			wrapped:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := NewRESTConfig(test.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (cfg.WrapTransport != nil) != test.wrapped || (cfg.Dial != nil) != test.dial {
+				t.Errorf("expected wrapped transport %v and dialer %v", test.wrapped, test.dial)
+			}
+
+			cfg.WrapTransport, cfg.Dial = nil, nil
+			if !reflect.DeepEqual(*cfg, test.expected) {
+				t.Errorf("expected config %#v, got %#v", test.expected, *cfg)
+			}
+		})
+	}
+}
+
+func TestNewRESTConfigInvalid(t *testing.T) {
+	tests := map[string]struct {
+		config Config
+		fails  bool
+	}{
+		"missing client certificate": {config: Config{Host: "https://example.com", ClientCertificate: "missing.crt", ClientKey: "missing.key"}},
+		"invalid host":               {config: Config{Host: "https://[::1"}, fails: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := NewRESTConfig(test.config)
+			if test.fails != (err != nil) {
+				t.Fatalf("expected failure %v, got %v", test.fails, err)
+			}
+			if cfg != nil {
+				t.Errorf("expected no config, got %#v", cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package kube
+
+import (
+	"log"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/transport"
+)
+
+// headerRoundTripper sets a fixed set of headers on every request
+// before delegating to the wrapped round tripper.
+type headerRoundTripper struct {
+	headers map[string]string
+	rt      http.RoundTripper
+}
+
+func (h *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = utilnet.CloneRequest(req)
+	for key, value := range h.headers {
+		req.Header.Set(key, value)
+	}
+	return h.rt.RoundTrip(req)
+}
+
+func (h *headerRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return h.rt
+}
+
+// WithHeaders returns a transport wrapper adding the given headers
+// to every request made to the kubernetes API.
+func WithHeaders(headers map[string]string) transport.WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &headerRoundTripper{headers: headers, rt: rt}
+	}
+}
+
+// dryRunRoundTripper turns every mutating request into a server-side dry
+// run before delegating to the wrapped round tripper.
+type dryRunRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (d *dryRunRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return d.rt.RoundTrip(req)
+	}
+
+	req = utilnet.CloneRequest(req)
+	// the URL is shared by the cloned request
+	u := *req.URL
+	query := u.Query()
+	query.Set("dryRun", metav1.DryRunAll)
+	u.RawQuery = query.Encode()
+	req.URL = &u
+
+	log.Printf("[INFO] Server-side dry run of %s %s", req.Method, u.Path)
+	return d.rt.RoundTrip(req)
+}
+
+func (d *dryRunRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return d.rt
+}
+
+// WithServerDryRun returns a transport wrapper making every request
+// changing objects in the kubernetes API a server-side dry run.
+func WithServerDryRun() transport.WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &dryRunRoundTripper{rt: rt}
+	}
+}
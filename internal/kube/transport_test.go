@@ -0,0 +1,144 @@
+package kube
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	restclient "k8s.io/client-go/rest"
+)
+
+// request records the method, query and headers of a request.
+type request struct {
+	method string
+	query  url.Values
+	header http.Header
+}
+
+// newRecordingServer returns a server recording the requests it receives.
+func newRecordingServer(t *testing.T) (*httptest.Server, *[]request) {
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, request{method: r.Method, query: r.URL.Query(), header: r.Header.Clone()})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestWithServerDryRun(t *testing.T) {
+	server, requests := newRecordingServer(t)
+	client := &http.Client{Transport: WithServerDryRun()(http.DefaultTransport)}
+
+	methods := []string{
+		http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+	}
+	for _, method := range methods {
+		req, err := http.NewRequest(method, server.URL+"/api/v1/nodes?fieldManager=k8snp", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if req.URL.Query().Has("dryRun") {
+			t.Errorf("expected the %s request not to be changed", method)
+		}
+	}
+
+	for _, r := range *requests {
+		expected := url.Values{"fieldManager": {"k8snp"}}
+		switch r.method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			expected.Set("dryRun", "All")
+		}
+		if !reflect.DeepEqual(r.query, expected) {
+			t.Errorf("expected the query of the %s request to be %v, got %v", r.method, expected, r.query)
+		}
+	}
+	if len(*requests) != len(methods) {
+		t.Errorf("expected %d requests, got %d", len(methods), len(*requests))
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	server, requests := newRecordingServer(t)
+	headers := map[string]string{"X-Tenant": "team-a", "User-Agent": "k8snp"}
+	client := &http.Client{Transport: WithHeaders(headers)(http.DefaultTransport)}
+
+	req, err := http.NewRequest(http.MethodPatch, server.URL+"/api/v1/nodes/node-1", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req.Header.Set("X-Tenant", "team-b")
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(*requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(*requests))
+	}
+	header := (*requests)[0].header
+	for key, value := range map[string]string{"X-Tenant": "team-a", "User-Agent": "k8snp", "Content-Type": "application/merge-patch+json"} {
+		if header.Get(key) != value {
+			t.Errorf("expected header %s to be %q, got %q", key, value, header.Get(key))
+		}
+	}
+	if req.Header.Get("X-Tenant") != "team-b" {
+		t.Errorf("expected the headers of the request not to be changed")
+	}
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	timeout := 7 * time.Second
+	cfg, err := NewRESTConfig(Config{Host: server.URL, ClusterCACertificate: string(ca), Advanced: &AdvancedConfig{TLSHandshakeTimeout: &timeout}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rt, err := restclient.TransportFor(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the server is only trusted when the cloned transport
+	// kept the TLS configuration of the cluster CA
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL + "/version")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	for {
+		wrapper, ok := rt.(utilnet.RoundTripperWrapper)
+		if !ok {
+			break
+		}
+		rt = wrapper.WrappedRoundTripper()
+	}
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected an HTTP transport, got %T", rt)
+	}
+	if transport.TLSHandshakeTimeout != timeout {
+		t.Errorf("expected a TLS handshake timeout of %s, got %s", timeout, transport.TLSHandshakeTimeout)
+	}
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.RootCAs == nil || transport.TLSClientConfig.MinVersion < tls.VersionTLS12 {
+		t.Errorf("expected the TLS configuration of the cluster, got %+v", transport.TLSClientConfig)
+	}
+}
@@ -0,0 +1,137 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	resourcehelper "k8s.io/kubectl/pkg/util/resource"
+)
+
+// CapacityShortfall describes the CPU and memory requested by the pods
+// to evict from a node pool beyond the capacity left on the other nodes.
+type CapacityShortfall struct {
+	requested v1.ResourceList
+	free      v1.ResourceList
+}
+
+func (s CapacityShortfall) String() string {
+	requestedCPU, freeCPU := s.requested[v1.ResourceCPU], s.free[v1.ResourceCPU]
+	requestedMemory, freeMemory := s.requested[v1.ResourceMemory], s.free[v1.ResourceMemory]
+
+	shortCPU, shortMemory := requestedCPU.DeepCopy(), requestedMemory.DeepCopy()
+	shortCPU.Sub(freeCPU)
+	shortMemory.Sub(freeMemory)
+	if shortCPU.Sign() < 0 {
+		shortCPU = resource.Quantity{}
+	}
+	if shortMemory.Sign() < 0 {
+		shortMemory = resource.Quantity{}
+	}
+
+	return fmt.Sprintf("short by %s CPU / %s memory: the pods to evict request %s CPU and %s memory while the other schedulable nodes have %s CPU and %s memory unrequested",
+		shortCPU.String(), shortMemory.String(), requestedCPU.String(), requestedMemory.String(), freeCPU.String(), freeMemory.String())
+}
+
+// CheckCapacity compares the CPU and memory requested by the pods that the
+// drain of nodes would evict with the allocatable capacity not yet requested
+// on the other ready and schedulable nodes. It returns the shortfall, if any.
+// The capacity is compared in aggregate, so pods may still not fit a single
+// node, but pools whose pods cannot fit at all are caught before any node is
+// cordoned.
+func (d *Drainer) CheckCapacity(ctx context.Context, nodes []v1.Node) (*CapacityShortfall, error) {
+	allNodes, err := ListNodes(ctx, d.Client, d.Retry, NodeQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []v1.Pod
+	err = d.Retry.Do(ctx, "listing pods", func() error {
+		podList, err := d.DrainClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		pods = podList.Items
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	poolNodes := map[string]struct{}{}
+	requested := v1.ResourceList{}
+	for _, node := range nodes {
+		poolNodes[node.Name] = struct{}{}
+
+		helper := d.newHelper(ctx, d.DrainClient, node.Name, d.Timeout)
+		var evicted []v1.Pod
+		err := d.Retry.Do(ctx, "listing pods on node "+node.Name, func() error {
+			podsForDeletion, errs := helper.GetPodsForDeletion(node.Name)
+			if len(errs) > 0 {
+				return utilerrors.NewAggregate(errs)
+			}
+			evicted = podsForDeletion.Pods()
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods on node %s: %w", node.Name, err)
+		}
+		for i := range evicted {
+			addRequests(requested, &evicted[i])
+		}
+	}
+
+	// the requests of the pods already running on each node
+	nodeRequests := map[string]v1.ResourceList{}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName == "" || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if nodeRequests[pod.Spec.NodeName] == nil {
+			nodeRequests[pod.Spec.NodeName] = v1.ResourceList{}
+		}
+		addRequests(nodeRequests[pod.Spec.NodeName], pod)
+	}
+
+	free := v1.ResourceList{}
+	for _, node := range allNodes {
+		if _, ok := poolNodes[node.Name]; ok {
+			continue
+		}
+		if RepelsNewPods(node) || !hasCondition(node, v1.NodeReady) {
+			continue
+		}
+
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			available := node.Status.Allocatable[name].DeepCopy()
+			available.Sub(nodeRequests[node.Name][name])
+			if available.Sign() > 0 {
+				total := free[name]
+				total.Add(available)
+				free[name] = total
+			}
+		}
+	}
+
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		if total := requested[name]; total.Cmp(free[name]) > 0 {
+			return &CapacityShortfall{requested: requested, free: free}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// addRequests adds the CPU and memory requests of pod to list.
+func addRequests(list v1.ResourceList, pod *v1.Pod) {
+	requests, _ := resourcehelper.PodRequestsAndLimits(pod)
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		total := list[name]
+		total.Add(requests[name])
+		list[name] = total
+	}
+}
@@ -0,0 +1,118 @@
+package orchestrate
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newRequestingPod returns a running pod on nodeName requesting cpu.
+func newRequestingPod(name, nodeName, cpu string) *v1.Pod {
+	pod := newTestPod(name, nodeName)
+	pod.Status.Phase = v1.PodRunning
+	pod.Spec.Containers = []v1.Container{{
+		Name:      "main",
+		Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)}},
+	}}
+	return pod
+}
+
+func TestCheckCapacity(t *testing.T) {
+	controller := true
+	daemonSetPod := newRequestingPod("agent", "node-1", "3")
+	daemonSetPod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "agent", Controller: &controller}}
+	daemonSet := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"}}
+
+	// target returns the node the pods are evicted to, with 2 CPUs allocatable
+	target := func(change func(node *v1.Node)) *v1.Node {
+		node := newTestNode("node-2", nil, true)
+		if change != nil {
+			change(node)
+		}
+		return node
+	}
+
+	tests := map[string]struct {
+		objects   []runtime.Object
+		shortfall bool
+	}{
+		"fits": {
+			objects: []runtime.Object{target(nil), newRequestingPod("web", "node-1", "1")},
+		},
+		"insufficient allocatable capacity": {
+			objects:   []runtime.Object{target(nil), newRequestingPod("web", "node-1", "3")},
+			shortfall: true,
+		},
+		"capacity requested by the running pods": {
+			objects:   []runtime.Object{target(nil), newRequestingPod("web", "node-1", "1"), newRequestingPod("db", "node-2", "1500m")},
+			shortfall: true,
+		},
+		"completed pods do not request capacity": {
+			objects: []runtime.Object{target(nil), newRequestingPod("web", "node-1", "1"), func() *v1.Pod {
+				pod := newRequestingPod("job", "node-2", "2")
+				pod.Status.Phase = v1.PodSucceeded
+				return pod
+			}()},
+		},
+		"daemonset pods excluded": {
+			objects: []runtime.Object{target(nil), daemonSet, daemonSetPod, newRequestingPod("web", "node-1", "1")},
+		},
+		"unschedulable target": {
+			objects:   []runtime.Object{target(func(node *v1.Node) { node.Spec.Unschedulable = true }), newRequestingPod("web", "node-1", "1")},
+			shortfall: true,
+		},
+		"tainted target": {
+			objects: []runtime.Object{target(func(node *v1.Node) {
+				node.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+			}), newRequestingPod("web", "node-1", "1")},
+			shortfall: true,
+		},
+		"prefer no schedule target": {
+			objects: []runtime.Object{target(func(node *v1.Node) {
+				node.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectPreferNoSchedule}}
+			}), newRequestingPod("web", "node-1", "1")},
+		},
+		"not ready target": {
+			objects:   []runtime.Object{newTestNode("node-2", nil, false), newRequestingPod("web", "node-1", "1")},
+			shortfall: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pool := newTestNode("node-1", map[string]string{"pool": "a"}, true)
+			client := newPodsClient(append(test.objects, pool)...)
+			d := &Drainer{
+				Client:      client,
+				DrainClient: client,
+				Retry:       DefaultRetryPolicy(),
+				Options:     DrainOptions{IgnoreDaemonSets: true, Force: true},
+			}
+
+			shortfall, err := d.CheckCapacity(context.Background(), []v1.Node{*pool})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (shortfall != nil) != test.shortfall {
+				t.Errorf("expected shortfall %v, got %v", test.shortfall, shortfall)
+			}
+		})
+	}
+}
+
+func TestCapacityShortfallString(t *testing.T) {
+	shortfall := CapacityShortfall{
+		requested: v1.ResourceList{v1.ResourceCPU: resource.MustParse("3"), v1.ResourceMemory: resource.MustParse("1Gi")},
+		free:      v1.ResourceList{v1.ResourceCPU: resource.MustParse("2"), v1.ResourceMemory: resource.MustParse("4Gi")},
+	}
+
+	expected := "short by 1 CPU / 0 memory: the pods to evict request 3 CPU and 1Gi memory while the other schedulable nodes have 2 CPU and 4Gi memory unrequested"
+	if s := shortfall.String(); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
@@ -0,0 +1,138 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubectl/pkg/util/podutils"
+)
+
+var (
+	// csiControllerSidecars are the containers provisioning, attaching
+	// and resizing volumes in the controllers of CSI drivers
+	csiControllerSidecars = []string{"csi-provisioner", "csi-attacher", "csi-resizer"}
+	// csiControllerLabels are the labels naming the CSI controllers,
+	// e.g. app=ebs-csi-controller or app=csi-rbdplugin-provisioner
+	csiControllerLabels = []string{"app", "app.kubernetes.io/name", "app.kubernetes.io/component"}
+	// csiControllerInterval is the wait between the checks of
+	// the replicas of the CSI controllers
+	csiControllerInterval = 5 * time.Second
+)
+
+// isCSIController reports whether pod runs the controller of a CSI driver,
+// from its well-known labels or sidecar containers.
+func isCSIController(pod v1.Pod) bool {
+	for _, label := range csiControllerLabels {
+		value := strings.ToLower(pod.Labels[label])
+		if strings.Contains(value, "csi") && (strings.Contains(value, "controller") || strings.Contains(value, "provisioner")) {
+			return true
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		if slices.Contains(csiControllerSidecars, container.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForCSIControllersElsewhere waits until ctx is done for the CSI
+// controllers running on nodeName to have a ready replica on another
+// schedulable node, so that evicting them does not stall the volume
+// operations of the whole cluster.
+func (d *Drainer) waitForCSIControllersElsewhere(ctx context.Context, nodeName string) error {
+	for {
+		unguarded, err := d.unguardedCSIControllers(ctx, nodeName)
+		if err != nil {
+			return err
+		}
+		if len(unguarded) == 0 {
+			return nil
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for CSI controllers %s to have a ready replica outside node %s", strings.Join(unguarded, ", "), nodeName))
+
+		if err := Sleep(ctx, csiControllerInterval); err != nil {
+			return fmt.Errorf("CSI controllers %s have no ready replica outside node %s, evicting them would stall volume operations, run at least 2 replicas of them: %w", strings.Join(unguarded, ", "), nodeName, err)
+		}
+	}
+}
+
+// unguardedCSIControllers returns the controllers, as kind namespace/name, of
+// the CSI controller pods on nodeName without a ready replica elsewhere.
+func (d *Drainer) unguardedCSIControllers(ctx context.Context, nodeName string) ([]string, error) {
+	var unguarded []string
+	err := d.Retry.Do(ctx, "checking the CSI controllers on node "+nodeName, func() error {
+		pods, err := d.DrainClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+		})
+		if err != nil {
+			return err
+		}
+
+		unguarded = nil
+		checked := map[workloadKey]struct{}{}
+		for _, pod := range pods.Items {
+			owner := metav1.GetControllerOf(&pod)
+			if owner == nil || !isCSIController(pod) {
+				continue
+			}
+			key := workloadKey{kind: owner.Kind, namespace: pod.Namespace, name: owner.Name}
+			if _, ok := checked[key]; ok {
+				continue
+			}
+			checked[key] = struct{}{}
+
+			guarded, err := d.hasReplicaElsewhere(ctx, pod, owner.UID, nodeName)
+			if err != nil {
+				return err
+			}
+			if !guarded {
+				unguarded = append(unguarded, fmt.Sprintf("%s %s/%s", key.kind, key.namespace, key.name))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the CSI controllers on node %s: %w", nodeName, err)
+	}
+
+	return unguarded, nil
+}
+
+// hasReplicaElsewhere reports whether the controller ownerUID of pod has
+// another ready pod on a schedulable node other than nodeName.
+func (d *Drainer) hasReplicaElsewhere(ctx context.Context, pod v1.Pod, ownerUID types.UID, nodeName string) (bool, error) {
+	replicas, err := d.DrainClient.CoreV1().Pods(pod.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	for _, replica := range replicas.Items {
+		owner := metav1.GetControllerOf(&replica)
+		if owner == nil || owner.UID != ownerUID || replica.Spec.NodeName == "" || replica.Spec.NodeName == nodeName {
+			continue
+		}
+		if replica.DeletionTimestamp != nil || !podutils.IsPodReady(&replica) {
+			continue
+		}
+
+		node, err := d.Client.CoreV1().Nodes().Get(ctx, replica.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if !node.Spec.Unschedulable {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,195 @@
+package orchestrate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestIsCSIController(t *testing.T) {
+	tests := map[string]struct {
+		labels     map[string]string
+		containers []string
+		expected   bool
+	}{
+		"controller label":  {labels: map[string]string{"app": "ebs-csi-controller"}, expected: true},
+		"provisioner label": {labels: map[string]string{"app.kubernetes.io/name": "csi-rbdplugin-provisioner"}, expected: true},
+		"component label":   {labels: map[string]string{"app.kubernetes.io/component": "CSI-Controller"}, expected: true},
+		"node plugin label": {labels: map[string]string{"app": "ebs-csi-node"}, expected: false},
+		"sidecar":           {containers: []string{"driver", "csi-attacher"}, expected: true},
+		"other":             {labels: map[string]string{"app": "web"}, containers: []string{"web"}, expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: test.labels}}
+			for _, container := range test.containers {
+				pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: container})
+			}
+			if isCSIController(pod) != test.expected {
+				t.Errorf("expected CSI controller %v", test.expected)
+			}
+		})
+	}
+}
+
+// newCSIControllerPod returns a pod of the CSI controller Deployment on
+// nodeName, ready or not.
+func newCSIControllerPod(name, nodeName string, ready bool) *v1.Pod {
+	controller := true
+	pod := newTestPod(name, nodeName)
+	pod.Labels = map[string]string{"app": "ebs-csi-controller"}
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "ebs-csi-controller", UID: types.UID("csi"), Controller: &controller}}
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: status}}
+	return pod
+}
+
+func TestUnguardedCSIControllers(t *testing.T) {
+	unschedulable := newTestNode("node-3", nil, true)
+	unschedulable.Spec.Unschedulable = true
+
+	tests := map[string]struct {
+		objects  []runtime.Object
+		expected []string
+	}{
+		"ready replica elsewhere": {
+			objects: []runtime.Object{newCSIControllerPod("csi-1", "node-1", true), newCSIControllerPod("csi-2", "node-2", true)},
+		},
+		"no replica": {
+			objects:  []runtime.Object{newCSIControllerPod("csi-1", "node-1", true)},
+			expected: []string{"ReplicaSet default/ebs-csi-controller"},
+		},
+		"replica not ready": {
+			objects:  []runtime.Object{newCSIControllerPod("csi-1", "node-1", true), newCSIControllerPod("csi-2", "node-2", false)},
+			expected: []string{"ReplicaSet default/ebs-csi-controller"},
+		},
+		"replica on an unschedulable node": {
+			objects:  []runtime.Object{newCSIControllerPod("csi-1", "node-1", true), newCSIControllerPod("csi-3", "node-3", true)},
+			expected: []string{"ReplicaSet default/ebs-csi-controller"},
+		},
+		"replicas on the same node": {
+			objects:  []runtime.Object{newCSIControllerPod("csi-1", "node-1", true), newCSIControllerPod("csi-2", "node-1", true)},
+			expected: []string{"ReplicaSet default/ebs-csi-controller"},
+		},
+		"not a CSI controller": {
+			objects: []runtime.Object{newTestPod("web", "node-1")},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			objects := append([]runtime.Object{newTestNode("node-1", nil, true), newTestNode("node-2", nil, true), unschedulable}, test.objects...)
+			client := newPodsClient(objects...)
+			d := &Drainer{Client: client, DrainClient: client, Retry: DefaultRetryPolicy()}
+
+			unguarded, err := d.unguardedCSIControllers(context.Background(), "node-1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(unguarded, test.expected) {
+				t.Errorf("expected unguarded controllers %v, got %v", test.expected, unguarded)
+			}
+		})
+	}
+}
+
+func TestWaitForCSIControllersElsewhere(t *testing.T) {
+	defer func(interval time.Duration) { csiControllerInterval = interval }(csiControllerInterval)
+	csiControllerInterval = time.Millisecond
+
+	client := newPodsClient(newTestNode("node-1", nil, true), newTestNode("node-2", nil, true), newCSIControllerPod("csi-1", "node-1", true))
+	d := &Drainer{Client: client, DrainClient: client, Retry: DefaultRetryPolicy()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.waitForCSIControllersElsewhere(ctx, "node-1"); err == nil {
+		t.Fatalf("expected an error while the CSI controller has no replica elsewhere")
+	}
+
+	// a replica scheduled elsewhere guards the controller
+	if err := client.Tracker().Add(newCSIControllerPod("csi-2", "node-2", true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := d.waitForCSIControllersElsewhere(context.Background(), "node-1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// newVolumeAttachment returns the attachment of the persistent
+// volume name to nodeName.
+func newVolumeAttachment(name, nodeName string, attached bool) *storagev1.VolumeAttachment {
+	return &storagev1.VolumeAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "attachment-" + name},
+		Spec: storagev1.VolumeAttachmentSpec{
+			Attacher: "ebs.csi.aws.com",
+			NodeName: nodeName,
+			Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &name},
+		},
+		Status: storagev1.VolumeAttachmentStatus{Attached: attached},
+	}
+}
+
+func TestWaitForVolumesDetached(t *testing.T) {
+	defer func(interval time.Duration) { volumeDetachInterval = interval }(volumeDetachInterval)
+	volumeDetachInterval = time.Millisecond
+
+	tests := map[string]struct {
+		attachments []runtime.Object
+		// detachAfter detaches the volumes after as many lists, never when 0
+		detachAfter int
+		fails       bool
+	}{
+		"no attachments": {},
+		"other nodes and detached volumes": {
+			attachments: []runtime.Object{newVolumeAttachment("pv-1", "node-2", true), newVolumeAttachment("pv-2", "node-1", false)},
+		},
+		"getting detached": {
+			attachments: []runtime.Object{newVolumeAttachment("pv-1", "node-1", true)},
+			detachAfter: 3,
+		},
+		"still attached": {
+			attachments: []runtime.Object{newVolumeAttachment("pv-1", "node-1", true)},
+			fails:       true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := newPodsClient(test.attachments...)
+			lists := 0
+			client.PrependReactor("list", "volumeattachments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if lists++; test.detachAfter > 0 && lists == test.detachAfter {
+					for _, obj := range test.attachments {
+						attachment := obj.(*storagev1.VolumeAttachment).DeepCopy()
+						attachment.Status.Attached = false
+						if err := client.Tracker().Update(storagev1.SchemeGroupVersion.WithResource("volumeattachments"), attachment, ""); err != nil {
+							return true, nil, err
+						}
+					}
+				}
+				return false, nil, nil
+			})
+			d := &Drainer{Client: client, DrainClient: client, Retry: DefaultRetryPolicy()}
+
+			err := d.waitForVolumesDetached(context.Background(), "node-1", time.Now(), 100*time.Millisecond)
+			if test.fails != (err != nil) {
+				t.Fatalf("expected failure %v, got %v", test.fails, err)
+			}
+			if test.detachAfter > 0 && lists != test.detachAfter {
+				t.Errorf("expected %d lists, got %d", test.detachAfter, lists)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WaitForDaemonSetPods waits until each of daemonSets, given as namespace/name,
+// has a ready pod on every node matching query that is
+// accepted by include and ready as defined by criteria, or ctx is done.
+func WaitForDaemonSetPods(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, query NodeQuery, include func(v1.Node) bool, criteria ReadinessCriteria, daemonSets []string) error {
+	for {
+		nodes, err := ListNodes(ctx, client, retry, query)
+		if err != nil {
+			return err
+		}
+
+		var nodeNames []string
+		for _, node := range nodes {
+			if include(node) && criteria.isReady(node) {
+				nodeNames = append(nodeNames, node.Name)
+			}
+		}
+
+		var pending []string
+		for _, daemonSet := range daemonSets {
+			ready, err := isDaemonSetReadyOnNodes(ctx, client, retry, daemonSet, nodeNames)
+			if err != nil {
+				return err
+			}
+			if !ready {
+				pending = append(pending, daemonSet)
+			}
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for DaemonSets to have a ready pod on every node matching %s: %s", query, strings.Join(pending, ", ")))
+
+		if err := Sleep(ctx, 2*time.Second); err != nil {
+			return fmt.Errorf("DaemonSets %s did not have a ready pod on every node: %w", strings.Join(pending, ", "), err)
+		}
+	}
+}
+
+// isDaemonSetReadyOnNodes reports whether the DaemonSet, given as
+// namespace/name, has a ready pod on each of nodeNames.
+func isDaemonSetReadyOnNodes(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, daemonSet string, nodeNames []string) (bool, error) {
+	// the format is ensured by the validator of the argument in the schema definition
+	namespace, name, _ := strings.Cut(daemonSet, "/")
+
+	readyNodes := map[string]bool{}
+	err := retry.Do(ctx, fmt.Sprintf("listing pods of DaemonSet %s", daemonSet), func() error {
+		ds, err := client.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+		if err != nil {
+			return err
+		}
+
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return err
+		}
+
+		for _, pod := range pods.Items {
+			if isPodReady(pod) {
+				readyNodes[pod.Spec.NodeName] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get pods of DaemonSet %s: %w", daemonSet, err)
+	}
+
+	for _, nodeName := range nodeNames {
+		if !readyNodes[nodeName] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// isPodReady reports whether pod has a true Ready condition.
+func isPodReady(pod v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
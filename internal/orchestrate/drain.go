@@ -0,0 +1,718 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+// Drainer cordons and drains the nodes of a node pool. The drain of each node
+// can be extended with gates, steps and checks, e.g. to wait for external
+// systems or to clean up the cloud instances of the drained nodes.
+type Drainer struct {
+	// Client is used to cordon the nodes
+	Client kubernetes.Interface
+	// DrainClient is used to list and evict the pods of the nodes,
+	// usually an EvictionClient
+	DrainClient kubernetes.Interface
+
+	Retry   RetryPolicy
+	Metrics *Metrics
+
+	// Timeout is the maximum duration of the drain of a single node,
+	// including retries and the wait for volumes to be detached
+	Timeout time.Duration
+	// EvictionTimeout is how long the drain helper waits for the
+	// evicted pods to be deleted, the node timeout when 0
+	EvictionTimeout time.Duration
+	// EvictionRequestTimeout is the timeout of each eviction
+	// request, zero for none
+	EvictionRequestTimeout time.Duration
+	// WaitForVolumeDetach makes drains wait for the volumes attached
+	// to the node to be detached
+	WaitForVolumeDetach bool
+	// DeleteDrained deletes the Node object of each drained node
+	DeleteDrained bool
+	// Options tune how the pods are evicted
+	Options DrainOptions
+	// FlapTolerance is how long cordons and drains are paused,
+	// rather than failed, while the API server is unavailable
+	FlapTolerance time.Duration
+	// PDBRetryInterval is the initial backoff between evictions
+	// rejected because of a pod disruption budget
+	PDBRetryInterval time.Duration
+	// PDBBlockTimeout is how long the eviction of a pod can be
+	// blocked by a pod disruption budget before the drain fails
+	PDBBlockTimeout time.Duration
+	// OrphanedPods is how pods whose DaemonSet no longer
+	// exists are handled, one of the OrphanedPods constants
+	OrphanedPods string
+	// EvictionGroupOrder lists the applications, by their
+	// app.kubernetes.io/part-of label, whose pods are evicted
+	// together and before the other pods, in this order
+	EvictionGroupOrder []string
+	// RotationTaint, when set, replaces the eviction of the pods
+	// with a NoExecute taint on the nodes
+	RotationTaint *RotationTaint
+
+	// AnnotateWorkloads makes the drain annotate the Deployments and
+	// StatefulSets of the evicted pods with the time and node pool
+	// of the drain
+	AnnotateWorkloads bool
+	PoolName          string
+	// AnnotateNodes makes the drain annotate each node with the
+	// start and completion of its drain and with DrainedBy
+	AnnotateNodes bool
+	DrainedBy     string
+	// WaitRescheduled makes the drain of each node wait for its
+	// evicted pods to be ready elsewhere before the next node
+	WaitRescheduled bool
+	// GuardCSI makes the drain of each node wait for its CSI
+	// controllers to have a ready replica on another node
+	GuardCSI bool
+	// DryRun makes the drain skip the waits for the pods to be gone,
+	// and the steps, as the changes to the cluster are server-side
+	// dry runs
+	DryRun bool
+
+	// Gates hold the drain of each node, before its timeout starts
+	Gates []Gate
+	// PreDrain and PostDrain run, in order, before the pods of each
+	// node are evicted and once they are gone
+	PreDrain  []Step
+	PostDrain []Step
+	// Evicter, when set, replaces the eviction of the pods of the nodes
+	Evicter Evicter
+	// Checks run after each node, or batch of nodes, is drained
+	Checks []Check
+	// Instances, when set, let the drain skip the nodes whose cloud
+	// instance no longer exists, deleting them instead
+	Instances InstanceChecker
+	// Observer, when set, is told about the progress of the drain
+	Observer Observer
+
+	// evictedOwners collects the controllers of the pods evicted
+	// since the last call to waitForEvictedWorkloads
+	mu            sync.Mutex
+	evictedOwners map[workloadKey]struct{}
+	// drainedNodes collects the nodes drained successfully
+	drainedNodes []string
+	// totalNodes and drainStart are the number of nodes to drain
+	// and the start of their drain, see ReportProgress
+	totalNodes int
+	drainStart time.Time
+	// cordonedNodes collects the nodes cordoned successfully
+	cordonedNodes []string
+	// taintedNodes collects the nodes with the rotation taint
+	taintedNodes []string
+	// annotatedOwners collects the workloads annotated, once per drain
+	annotatedOwners map[workloadKey]struct{}
+}
+
+// lastDrainAnnotation is set on the workloads whose pods were evicted.
+const lastDrainAnnotation = "k8snp.io/last-drain"
+
+// DrainOptions are the settings of the kubectl drain helper.
+type DrainOptions struct {
+	IgnoreDaemonSets   bool
+	DeleteEmptyDirData bool
+	Force              bool
+	GracePeriodSeconds int
+	// SkipWaitForDeleteTimeout skips waiting for the deletion of pods
+	// whose deletion timestamp is older than this, 0 never skips
+	SkipWaitForDeleteTimeout time.Duration
+	DisableEviction          bool
+	// EvictionVersion is the eviction API version, e.g.
+	// policy/v1, discovered from the server when empty
+	EvictionVersion string
+	// PodSelector restricts the drain to the pods matching
+	// this label selector, all pods are evicted when empty
+	PodSelector string
+	// IncludeNamespaces restricts the drain to the pods in these
+	// namespaces, all namespaces are drained when empty
+	IncludeNamespaces []string
+	// ExcludeNamespaces are the namespaces whose pods are not evicted
+	ExcludeNamespaces []string
+	// UnsafeToEvict handles the pods annotated as not safe to evict
+	// for the cluster autoscaler, which are evicted when empty, one
+	// of the UnsafeToEvict constants
+	UnsafeToEvict string
+}
+
+// namespaceFilter skips the pods outside of IncludeNamespaces,
+// when set, and those in ExcludeNamespaces.
+func (o DrainOptions) namespaceFilter(pod v1.Pod) drain.PodDeleteStatus {
+	if len(o.IncludeNamespaces) > 0 && !slices.Contains(o.IncludeNamespaces, pod.Namespace) {
+		return drain.MakePodDeleteStatusSkip()
+	}
+	if slices.Contains(o.ExcludeNamespaces, pod.Namespace) {
+		return drain.MakePodDeleteStatusSkip()
+	}
+	return drain.MakePodDeleteStatusOkay()
+}
+
+// skipsDeleted reports whether pod has been terminating for longer than
+// SkipWaitForDeleteTimeout, mirroring the filter of the kubectl drain helper.
+func (o DrainOptions) skipsDeleted(pod v1.Pod) bool {
+	if o.SkipWaitForDeleteTimeout <= 0 || pod.DeletionTimestamp.IsZero() {
+		return false
+	}
+	return time.Since(pod.DeletionTimestamp.Time) > o.SkipWaitForDeleteTimeout
+}
+
+// DefaultDrainOptions returns the options of kubectl drain with the pods
+// using emptyDir volumes evicted and the DaemonSet pods left running.
+func DefaultDrainOptions() DrainOptions {
+	return DrainOptions{
+		IgnoreDaemonSets:   true,
+		DeleteEmptyDirData: true,
+		GracePeriodSeconds: -1,
+	}
+}
+
+// workloadKey identifies the controller of an evicted pod.
+type workloadKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (d *Drainer) newHelper(ctx context.Context, client kubernetes.Interface, nodeName string, timeout time.Duration) *drain.Helper {
+	helper := &drain.Helper{
+		Ctx:                 ctx,
+		Client:              client,
+		IgnoreAllDaemonSets: d.Options.IgnoreDaemonSets,
+		DeleteEmptyDirData:  d.Options.DeleteEmptyDirData,
+		Force:               d.Options.Force,
+		GracePeriodSeconds:  d.Options.GracePeriodSeconds,
+		Timeout:             timeout,
+		DisableEviction:     d.Options.DisableEviction,
+		PodSelector:         d.Options.PodSelector,
+		AdditionalFilters:   []drain.PodFilter{d.Options.namespaceFilter, d.Options.safeToEvictFilter},
+
+		SkipWaitForDeleteTimeoutSeconds: int(d.Options.SkipWaitForDeleteTimeout.Seconds()),
+		OnPodDeletedOrEvicted: func(pod *v1.Pod, usingEviction bool) {
+			tflog.Debug(ctx, fmt.Sprintf("evicted pod %s from node %s", pod.Name, nodeName))
+		},
+		Out:    drainerWriter{ctx: ctx, nodeName: nodeName},
+		ErrOut: drainerWriter{ctx: ctx, nodeName: nodeName, isErrOut: true},
+	}
+	if d.DryRun {
+		helper.DryRunStrategy = cmdutil.DryRunServer
+	}
+	return helper
+}
+
+// do runs the kubernetes API call fn, retrying it on transient errors and,
+// up to FlapTolerance, while the API server is unavailable.
+func (d *Drainer) do(ctx context.Context, operation string, fn func() error) error {
+	return d.Retry.DoTolerating(ctx, operation, d.FlapTolerance, fn)
+}
+
+// observer returns the Observer of the drain, one ignoring it when not set.
+func (d *Drainer) observer() Observer {
+	if d.Observer == nil {
+		return nopObserver{}
+	}
+	return d.Observer
+}
+
+// Cordon marks node as unschedulable. Only the nodes cordoned by this call,
+// not those already unschedulable, are recorded to be uncordoned on failure.
+func (d *Drainer) Cordon(ctx context.Context, node v1.Node) error {
+	ctx, span := startSpan(ctx, "cordon node", attribute.String("node", node.Name))
+
+	helper := d.newHelper(ctx, d.Client, node.Name, d.Timeout)
+
+	tflog.Debug(ctx, fmt.Sprintf("cordoning node %s", node.Name))
+	cordoned := false
+	err := d.do(ctx, "cordoning node "+node.Name, func() error {
+		// the node is read again as it may have been cordoned since it was listed
+		current, err := d.Client.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if current.Spec.Unschedulable {
+			return nil
+		}
+		cordoned = true
+		return drain.RunCordonOrUncordon(helper, current, true)
+	})
+	endSpan(span, err)
+
+	if err == nil && !cordoned {
+		tflog.Debug(ctx, fmt.Sprintf("node %s was already cordoned", node.Name))
+	}
+	if err == nil && cordoned {
+		d.observer().NodeCordoned(ctx, node)
+
+		d.mu.Lock()
+		d.cordonedNodes = append(d.cordonedNodes, node.Name)
+		d.mu.Unlock()
+	}
+
+	return err
+}
+
+// UncordonAll marks the nodes cordoned by the drainer as schedulable again,
+// e.g. to roll back a failed drain. It tries all the nodes and returns the
+// errors of those that could not be uncordoned.
+func (d *Drainer) UncordonAll(ctx context.Context) error {
+	var errs []error
+	for _, nodeName := range d.cordonedNodes {
+		tflog.Debug(ctx, fmt.Sprintf("uncordoning node %s", nodeName))
+		err := d.Retry.Do(ctx, "uncordoning node "+nodeName, func() error {
+			// the node is read again as the cordon helper
+			// compares the desired state with the given one
+			node, err := d.Client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			return drain.RunCordonOrUncordon(d.newHelper(ctx, d.Client, nodeName, d.Timeout), node, false)
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to uncordon node %s: %w", nodeName, err))
+		}
+	}
+	d.cordonedNodes = nil
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// CordonedNodes returns the nodes cordoned so far.
+func (d *Drainer) CordonedNodes() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.cordonedNodes...)
+}
+
+// DrainedNodes returns the nodes drained so far.
+func (d *Drainer) DrainedNodes() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.drainedNodes...)
+}
+
+// Drain evicts all the pods from node, except those managed by DaemonSets.
+func (d *Drainer) Drain(ctx context.Context, node v1.Node) error {
+	return d.drainWithin(ctx, node, d.Timeout)
+}
+
+// drainWithin drains node like Drain but with the given timeout.
+func (d *Drainer) drainWithin(ctx context.Context, node v1.Node, timeout time.Duration) error {
+	if d.skipGoneInstance(ctx, node) {
+		return nil
+	}
+
+	// e.g. the maintenance window may have closed while draining
+	// the previous nodes, the waits are not part of the node timeout
+	for _, gate := range d.Gates {
+		if err := gate.Wait(ctx, node); err != nil {
+			d.observer().NodeDrainFailed(ctx, node, err)
+			return err
+		}
+	}
+
+	ctx, span := startSpan(ctx, "drain node", attribute.String("node", node.Name))
+	drainStart := time.Now()
+
+	// the remaining pods are still described after the node timeout
+	describeCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if d.GuardCSI {
+		if err := d.waitForCSIControllersElsewhere(ctx, node.Name); err != nil {
+			endSpan(span, err)
+			d.observer().NodeDrainFailed(ctx, node, err)
+			return err
+		}
+	}
+
+	if err := d.runSteps(ctx, d.PreDrain, node); err != nil {
+		endSpan(span, err)
+		d.observer().NodeDrainFailed(ctx, node, err)
+		return err
+	}
+
+	evictionTimeout := timeout
+	if d.EvictionTimeout > 0 {
+		evictionTimeout = d.EvictionTimeout
+	}
+
+	helper := d.newHelper(ctx, d.DrainClient, node.Name, evictionTimeout)
+	helper.OnPodDeletedOrEvicted = func(pod *v1.Pod, usingEviction bool) {
+		tflog.Debug(ctx, fmt.Sprintf("evicted pod %s from node %s", pod.Name, node.Name))
+		d.Metrics.podsEvicted.Inc()
+		d.observer().PodEvicted(ctx, node, pod)
+		d.recordEvictedOwner(pod)
+		if d.AnnotateWorkloads {
+			d.annotateOwner(ctx, pod)
+		}
+
+		// pods are evicted concurrently when the drain starts, so the eviction
+		// span covers the time from then until the pod is gone from the node
+		_, podSpan := otel.Tracer(tracerName).Start(ctx, "evict pod", trace.WithTimestamp(drainStart), trace.WithAttributes(
+			attribute.String("node", node.Name),
+			attribute.String("pod", pod.Name),
+			attribute.String("namespace", pod.Namespace),
+			attribute.Bool("using_eviction", usingEviction),
+		))
+		podSpan.End()
+	}
+
+	tflog.Debug(ctx, fmt.Sprintf("draining node %s", node.Name))
+	d.observer().NodeDrainStarted(ctx, node)
+	d.annotateDrainStarted(ctx, node.Name)
+	// the API calls of the drain are retried, not the drain as a whole,
+	// so that the pods already evicted are not listed and evicted again
+	var err error
+	switch {
+	case d.Evicter != nil:
+		err = d.Evicter.Evict(ctx, node)
+	case d.RotationTaint != nil:
+		err = d.drainWithTaint(ctx, node.Name)
+	default:
+		err = d.runNodeDrain(ctx, helper, node.Name)
+	}
+	if err != nil {
+		describeHelper := d.newHelper(describeCtx, d.DrainClient, node.Name, evictionTimeout)
+		if remaining := d.describeRemainingPods(describeCtx, describeHelper, node.Name); remaining != "" {
+			err = fmt.Errorf("%w\n%s", err, remaining)
+		}
+	}
+	if err == nil && d.WaitForVolumeDetach && !d.DryRun {
+		err = d.waitForVolumesDetached(ctx, node.Name, drainStart, timeout)
+	}
+	if err == nil {
+		err = d.runSteps(ctx, d.PostDrain, node)
+	}
+	endSpan(span, err)
+	d.Metrics.drainDuration.Observe(time.Since(drainStart).Seconds())
+
+	if err != nil {
+		d.observer().NodeDrainFailed(ctx, node, err)
+	}
+	if err == nil {
+		d.Metrics.nodesDrained.Inc()
+		d.Metrics.Push(ctx)
+		d.observer().NodeDrained(ctx, node, time.Since(drainStart))
+		d.annotateDrainCompleted(ctx, node.Name)
+
+		d.mu.Lock()
+		d.drainedNodes = append(d.drainedNodes, node.Name)
+		d.mu.Unlock()
+		d.logProgress(ctx)
+
+		// the node is drained even when its deletion fails
+		if d.DeleteDrained {
+			tflog.Debug(ctx, fmt.Sprintf("deleting drained node %s", node.Name))
+			if err := DeleteNode(ctx, d.Client, d.Retry, node.Name); err != nil {
+				tflog.Warn(ctx, err.Error())
+			}
+		}
+	}
+
+	return err
+}
+
+// runSteps runs steps on node in order, stopping at the first failure. The
+// steps are skipped in dry runs as they act outside of the kubernetes API.
+func (d *Drainer) runSteps(ctx context.Context, steps []Step, node v1.Node) error {
+	if d.DryRun {
+		return nil
+	}
+	for _, step := range steps {
+		if err := step.Run(ctx, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipGoneInstance deletes node, without draining it, when its cloud instance
+// no longer exists, and reports whether it did. The pods of such a node are
+// already gone and evicting them would only wait for the drain timeout.
+// Failing to check the instance is not fatal, the node is drained instead.
+func (d *Drainer) skipGoneInstance(ctx context.Context, node v1.Node) bool {
+	if d.Instances == nil {
+		return false
+	}
+
+	gone, err := d.Instances.InstanceGone(ctx, node)
+	if err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("draining node %s as its instance could not be checked: %s", node.Name, err))
+		return false
+	}
+	if !gone {
+		return false
+	}
+
+	tflog.Info(ctx, fmt.Sprintf("deleting node %s without draining it as its instance %s no longer exists", node.Name, node.Spec.ProviderID))
+	if err := DeleteNode(ctx, d.Client, d.Retry, node.Name); err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("draining node %s as it could not be deleted: %s", node.Name, err))
+		return false
+	}
+
+	d.observer().NodeDeleted(ctx, node, "instance no longer exists, node deleted")
+	d.mu.Lock()
+	d.drainedNodes = append(d.drainedNodes, node.Name)
+	d.mu.Unlock()
+	d.logProgress(ctx)
+
+	return true
+}
+
+// DeleteNode deletes the Node object nodeName, if it still exists.
+func DeleteNode(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, nodeName string) error {
+	err := retry.Do(ctx, "deleting node "+nodeName, func() error {
+		return client.CoreV1().Nodes().Delete(ctx, nodeName, metav1.DeleteOptions{})
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete node %s: %w", nodeName, err)
+	}
+	return nil
+}
+
+// volumeDetachInterval is the wait between the checks
+// of the volumes attached to a drained node.
+var volumeDetachInterval = 2 * time.Second
+
+// waitForVolumesDetached waits for all the persistent volumes attached to
+// the node to be detached, within the timeout of the drain started at drainStart.
+// Some CSI drivers corrupt data when a machine is deleted with attached disks.
+func (d *Drainer) waitForVolumesDetached(ctx context.Context, nodeName string, drainStart time.Time, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, drainStart.Add(timeout))
+		defer cancel()
+	}
+
+	for {
+		var attachments *storagev1.VolumeAttachmentList
+		err := d.Retry.Do(ctx, "listing volume attachments", func() error {
+			var err error
+			attachments, err = d.DrainClient.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list volume attachments: %w", err)
+		}
+
+		var attached []string
+		for _, attachment := range attachments.Items {
+			if attachment.Spec.NodeName == nodeName && attachment.Spec.Source.PersistentVolumeName != nil && attachment.Status.Attached {
+				attached = append(attached, *attachment.Spec.Source.PersistentVolumeName)
+			}
+		}
+
+		if len(attached) == 0 {
+			return nil
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for volumes %s to be detached from node %s", strings.Join(attached, ", "), nodeName))
+
+		if err := Sleep(ctx, volumeDetachInterval); err != nil {
+			return fmt.Errorf("volumes %s were not detached from node %s: %w", strings.Join(attached, ", "), nodeName, err)
+		}
+	}
+}
+
+func (d *Drainer) recordEvictedOwner(pod *v1.Pod) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.evictedOwners == nil {
+		d.evictedOwners = map[workloadKey]struct{}{}
+	}
+	d.evictedOwners[workloadKey{kind: owner.Kind, namespace: pod.Namespace, name: owner.Name}] = struct{}{}
+}
+
+// annotateOwner annotates the Deployment or StatefulSet managing pod, once
+// per drain, so that its restarts can be correlated with the drain. Failures
+// are only logged as the annotation is not required by the drain.
+func (d *Drainer) annotateOwner(ctx context.Context, pod *v1.Pod) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return
+	}
+
+	key := workloadKey{kind: owner.Kind, namespace: pod.Namespace, name: owner.Name}
+	d.mu.Lock()
+	_, annotated := d.annotatedOwners[key]
+	if d.annotatedOwners == nil {
+		d.annotatedOwners = map[workloadKey]struct{}{}
+	}
+	d.annotatedOwners[key] = struct{}{}
+	d.mu.Unlock()
+	if annotated {
+		return
+	}
+
+	value := fmt.Sprintf("%s,%s", time.Now().UTC().Format(time.RFC3339), d.PoolName)
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, lastDrainAnnotation, value))
+
+	err := d.Retry.Do(ctx, fmt.Sprintf("annotating workload of pod %s/%s", pod.Namespace, pod.Name), func() error {
+		switch owner.Kind {
+		case "ReplicaSet":
+			rs, err := d.Client.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			deployment := metav1.GetControllerOf(rs)
+			if deployment == nil || deployment.Kind != "Deployment" {
+				return nil
+			}
+			_, err = d.Client.AppsV1().Deployments(pod.Namespace).Patch(ctx, deployment.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+			return err
+		case "StatefulSet":
+			_, err := d.Client.AppsV1().StatefulSets(pod.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+			return err
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to annotate workload of evicted pod %s/%s: %s", pod.Namespace, pod.Name, err.Error()))
+	}
+}
+
+// waitForEvictedWorkloads waits, up to the drain timeout, for the ReplicaSets
+// and StatefulSets whose pods were evicted to have all their replicas ready
+// again, i.e. for the evicted pods to be rescheduled and ready elsewhere.
+func (d *Drainer) waitForEvictedWorkloads(ctx context.Context) error {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	d.mu.Lock()
+	pending := d.evictedOwners
+	d.evictedOwners = nil
+	d.mu.Unlock()
+
+	for len(pending) > 0 {
+		for key := range pending {
+			ready, err := d.isWorkloadReady(ctx, key)
+			if err != nil {
+				return err
+			}
+			if ready {
+				delete(pending, key)
+			}
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		var names []string
+		for key := range pending {
+			names = append(names, fmt.Sprintf("%s %s/%s", key.kind, key.namespace, key.name))
+		}
+		tflog.Debug(ctx, fmt.Sprintf("waiting for evicted workloads to be ready: %s", strings.Join(names, ", ")))
+
+		if err := Sleep(ctx, 2*time.Second); err != nil {
+			return fmt.Errorf("evicted workloads %s were not ready again: %w", strings.Join(names, ", "), err)
+		}
+	}
+
+	return nil
+}
+
+// waitForRescheduledPods waits like waitForEvictedWorkloads when the drain
+// of each node waits for its evicted pods to be rescheduled.
+func (d *Drainer) waitForRescheduledPods(ctx context.Context) error {
+	if !d.WaitRescheduled {
+		return nil
+	}
+	return d.waitForEvictedWorkloads(ctx)
+}
+
+func (d *Drainer) isWorkloadReady(ctx context.Context, key workloadKey) (bool, error) {
+	var ready bool
+	err := d.Retry.Do(ctx, fmt.Sprintf("getting %s %s/%s", key.kind, key.namespace, key.name), func() error {
+		switch key.kind {
+		case "ReplicaSet":
+			rs, err := d.Client.AppsV1().ReplicaSets(key.namespace).Get(ctx, key.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			ready = rs.Spec.Replicas == nil || rs.Status.ReadyReplicas >= *rs.Spec.Replicas
+		case "StatefulSet":
+			sts, err := d.Client.AppsV1().StatefulSets(key.namespace).Get(ctx, key.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			ready = sts.Spec.Replicas == nil || sts.Status.ReadyReplicas >= *sts.Spec.Replicas
+		default:
+			// other controllers, e.g. Jobs, have no notion of ready replicas
+			ready = true
+		}
+		return nil
+	})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get %s %s/%s: %w", key.kind, key.namespace, key.name, err)
+	}
+	return ready, nil
+}
+
+// CountPodsToEvict returns the number of pods that a drain would evict from the node.
+func (d *Drainer) CountPodsToEvict(ctx context.Context, nodeName string) (int, error) {
+	helper := d.newHelper(ctx, d.DrainClient, nodeName, d.Timeout)
+
+	pods, _, err := d.podsForDeletion(ctx, helper, nodeName)
+	return len(pods), err
+}
+
+type drainerWriter struct {
+	ctx      context.Context
+	nodeName string
+	isErrOut bool
+}
+
+func (d drainerWriter) Write(p []byte) (n int, err error) {
+	var msg strings.Builder
+	msg.WriteString("drainer - ")
+
+	if d.isErrOut {
+		msg.WriteString("ERROUT - ")
+	}
+
+	msg.WriteString("node: " + d.nodeName + " - ")
+
+	msg.Write(p)
+
+	tflog.Debug(d.ctx, msg.String())
+
+	return len(p), nil
+}
@@ -0,0 +1,204 @@
+package orchestrate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCordonRecordsOnlyCordonedNodes(t *testing.T) {
+	ctx := context.Background()
+	cordoned := newTestNode("cordoned", nil, true)
+	cordoned.Spec.Unschedulable = true
+	schedulable := newTestNode("schedulable", nil, true)
+	client := newTestClient(cordoned, schedulable)
+
+	d := &Drainer{Client: client, DrainClient: client, Retry: DefaultRetryPolicy()}
+	for _, node := range []*v1.Node{cordoned, schedulable} {
+		if err := d.Cordon(ctx, *node); err != nil {
+			t.Fatalf("unexpected error cordoning node %s: %v", node.Name, err)
+		}
+	}
+
+	if expected := []string{"schedulable"}; !reflect.DeepEqual(d.cordonedNodes, expected) {
+		t.Errorf("expected cordoned nodes %v, got %v", expected, d.cordonedNodes)
+	}
+
+	if err := d.UncordonAll(ctx); err != nil {
+		t.Fatalf("unexpected error uncordoning: %v", err)
+	}
+	for name, unschedulable := range map[string]bool{"cordoned": true, "schedulable": false} {
+		node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error getting node %s: %v", name, err)
+		}
+		if node.Spec.Unschedulable != unschedulable {
+			t.Errorf("expected node %s to be unschedulable %t after the rollback", name, unschedulable)
+		}
+	}
+}
+
+func TestPodsForDeletionOrphanedDaemonSetPods(t *testing.T) {
+	ctx := context.Background()
+	controller := true
+	newOwnedPod := func(name, kind, owner string, labels map[string]string) *v1.Pod {
+		pod := newTestPod(name, "node-1")
+		pod.Labels = labels
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: owner, Controller: &controller}}
+		return pod
+	}
+	app := map[string]string{"app": "web"}
+	client := newTestClient(
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"}},
+		newOwnedPod("agent", "DaemonSet", "agent", app),
+		newOwnedPod("orphan", "DaemonSet", "deleted", app),
+		newOwnedPod("unselected-orphan", "DaemonSet", "deleted", nil),
+		newOwnedPod("web", "ReplicaSet", "web", app),
+	)
+
+	tests := map[string]struct {
+		orphanedPods string
+		expected     []string
+		fails        bool
+	}{
+		"fail":   {orphanedPods: OrphanedPodsFail, fails: true},
+		"delete": {orphanedPods: OrphanedPodsDelete, expected: []string{"orphan", "web"}},
+		"skip":   {orphanedPods: OrphanedPodsSkip, expected: []string{"web"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &Drainer{
+				Client:       client,
+				DrainClient:  client,
+				Retry:        DefaultRetryPolicy(),
+				OrphanedPods: test.orphanedPods,
+				Options:      DrainOptions{IgnoreDaemonSets: true, PodSelector: "app=web"},
+			}
+			helper := d.newHelper(ctx, client, "node-1", 0)
+
+			pods, _, err := d.podsForDeletion(ctx, helper, "node-1")
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, pod := range pods {
+				names = append(names, pod.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected pods %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestSetRotationTaintRecordsOnlyAddedTaints(t *testing.T) {
+	ctx := context.Background()
+	rotation := &RotationTaint{Key: "k8snp.io/rotation"}
+	tainted := newTestNode("tainted", nil, true)
+	tainted.Spec.Taints = []v1.Taint{rotation.taint()}
+	untainted := newTestNode("untainted", nil, true)
+	client := newTestClient(tainted, untainted)
+
+	d := &Drainer{Client: client, DrainClient: client, Retry: DefaultRetryPolicy(), RotationTaint: rotation}
+	for _, node := range []*v1.Node{tainted, untainted} {
+		if err := d.setRotationTaint(ctx, node.Name); err != nil {
+			t.Fatalf("unexpected error tainting node %s: %v", node.Name, err)
+		}
+	}
+
+	if expected := []string{"untainted"}; !reflect.DeepEqual(d.taintedNodes, expected) {
+		t.Errorf("expected tainted nodes %v, got %v", expected, d.taintedNodes)
+	}
+}
+
+func TestDrainRunsSteps(t *testing.T) {
+	tests := map[string]struct {
+		// failing is the step that fails, if any
+		failing string
+		ran     []string
+		evicted bool
+		fails   bool
+	}{
+		"steps succeeded": {
+			ran:     []string{"pre-drain", "post-drain"},
+			evicted: true,
+		},
+		"pre-drain step failed": {
+			failing: "pre-drain",
+			ran:     []string{"pre-drain"},
+			fails:   true,
+		},
+		"post-drain step failed": {
+			failing: "post-drain",
+			ran:     []string{"pre-drain", "post-drain"},
+			evicted: true,
+			fails:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, evicted := newEvictionClient(func(string) error { return nil }, newTestNode("node-1", nil, true), newTestPod("web", "node-1"))
+			// whether the pod was still on the node when each step ran
+			var ran []string
+			podPresent := map[string]bool{}
+			newStep := func(name string) Step {
+				return StepFunc(func(context.Context, v1.Node) error {
+					ran = append(ran, name)
+					_, err := client.Tracker().Get(v1.SchemeGroupVersion.WithResource("pods"), "default", "web")
+					podPresent[name] = err == nil
+					if name == test.failing {
+						return errors.New(name + " failed")
+					}
+					return nil
+				})
+			}
+			d := &Drainer{
+				Client:      client,
+				DrainClient: client,
+				Retry:       DefaultRetryPolicy(),
+				Metrics:     NewMetrics("", "pool"),
+				Options:     DrainOptions{IgnoreDaemonSets: true, Force: true},
+				PoolName:    "pool",
+				Timeout:     10 * time.Second,
+				PreDrain:    []Step{newStep("pre-drain")},
+				PostDrain:   []Step{newStep("post-drain")},
+			}
+
+			err := d.Drain(context.Background(), *newTestNode("node-1", nil, true))
+			if test.fails != (err != nil) {
+				t.Fatalf("expected failure %v, got %v", test.fails, err)
+			}
+			if !reflect.DeepEqual(ran, test.ran) {
+				t.Errorf("expected steps %v, got %v", test.ran, ran)
+			}
+			if (len(*evicted) > 0) != test.evicted {
+				t.Errorf("expected eviction %v, got %v", test.evicted, *evicted)
+			}
+			// the pre-drain steps run before the pods are evicted
+			// and the post-drain steps once they are
+			if !podPresent["pre-drain"] {
+				t.Errorf("expected the pre-drain step to run before the eviction")
+			}
+			if present, ran := podPresent["post-drain"]; ran && present {
+				t.Errorf("expected the post-drain step to run after the eviction")
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// DryRunReport describes what the drain of nodes would do, without cordoning
+// or evicting anything: the order in which the nodes are drained and the pods
+// evicted from each of them, with the pod disruption budgets currently
+// blocking their eviction, or why a node cannot be drained.
+func (d *Drainer) DryRunReport(ctx context.Context, nodes []v1.Node) string {
+	var sections []string
+	for i, node := range nodes {
+		helper := d.newHelper(ctx, d.DrainClient, node.Name, d.Timeout)
+
+		var pods []v1.Pod
+		err := d.Retry.Do(ctx, "listing pods on node "+node.Name, func() error {
+			podList, errs := helper.GetPodsForDeletion(node.Name)
+			if len(errs) > 0 {
+				return utilerrors.NewAggregate(errs)
+			}
+			pods = podList.Pods()
+			return nil
+		})
+		if err != nil {
+			sections = append(sections, fmt.Sprintf("%d. node %s cannot be drained: %s", i+1, node.Name, err.Error()))
+			continue
+		}
+
+		section := fmt.Sprintf("%d. node %s, %d pods to evict", i+1, node.Name, len(pods))
+		if len(pods) > 0 {
+			section += ":\n" + d.describePods(ctx, pods)
+		}
+		sections = append(sections, section)
+	}
+
+	return strings.Join(sections, "\n")
+}
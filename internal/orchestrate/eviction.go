@@ -0,0 +1,346 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+const (
+	// EvictionVersionAuto discovers the eviction API version from the server
+	EvictionVersionAuto    = "auto"
+	EvictionVersionV1      = "policy/v1"
+	EvictionVersionV1beta1 = "policy/v1beta1"
+)
+
+// EvictionClient is a kubernetes client whose discovery reports the eviction
+// subresource of pods in the eviction API version to use, which the kubectl
+// drain helper sends the evictions with.
+type EvictionClient struct {
+	kubernetes.Interface
+	// Version is the eviction API version, e.g. policy/v1, or
+	// empty to use the version discovered from the server
+	Version string
+}
+
+func (c EvictionClient) Discovery() discovery.DiscoveryInterface {
+	return evictionDiscovery{DiscoveryInterface: c.Interface.Discovery(), version: c.Version}
+}
+
+// evictionDiscovery reports the eviction subresource of pods in version.
+type evictionDiscovery struct {
+	discovery.DiscoveryInterface
+	version string
+}
+
+// ServerResourcesForGroupVersion returns the resources of groupVersion, with
+// the eviction subresource of pods in the core group reported in the eviction
+// API version, as read by drain.CheckEvictionSupport.
+func (d evictionDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	resources, err := d.DiscoveryInterface.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil || groupVersion != "v1" {
+		return resources, err
+	}
+
+	version := d.version
+	if version == "" {
+		version, err = d.subresourceVersion(resources)
+		if err != nil {
+			return nil, err
+		}
+		// the pods are deleted when evictions are not supported
+		if version == "" {
+			return resources, nil
+		}
+	}
+	gv, err := schema.ParseGroupVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	resources = resources.DeepCopy()
+	apiResources := resources.APIResources[:0]
+	for _, resource := range resources.APIResources {
+		if resource.Name != drain.EvictionSubresource {
+			apiResources = append(apiResources, resource)
+		}
+	}
+	resources.APIResources = append(apiResources, metav1.APIResource{
+		Name:    drain.EvictionSubresource,
+		Kind:    drain.EvictionKind,
+		Group:   gv.Group,
+		Version: gv.Version,
+	})
+	return resources, nil
+}
+
+// subresourceVersion returns the version of the eviction subresource of pods in
+// resources, the core group resources, falling back to the preferred eviction
+// API version served when it is not reported. It returns an empty string
+// when the server does not support evictions.
+func (d evictionDiscovery) subresourceVersion(resources *metav1.APIResourceList) (string, error) {
+	supported := false
+	for _, resource := range resources.APIResources {
+		if resource.Name != drain.EvictionSubresource {
+			continue
+		}
+		if resource.Group != "" && resource.Version != "" {
+			return resource.Group + "/" + resource.Version, nil
+		}
+		supported = true
+	}
+	if !supported {
+		return "", nil
+	}
+
+	// older servers do not report the version of the subresource
+	return servedEvictionVersion(d.DiscoveryInterface)
+}
+
+// servedEvictionVersion returns the preferred eviction API version served,
+// policy/v1 over policy/v1beta1, or an empty string when neither is served.
+func servedEvictionVersion(client discovery.DiscoveryInterface) (string, error) {
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return "", err
+	}
+
+	for _, version := range []string{EvictionVersionV1, EvictionVersionV1beta1} {
+		for _, group := range groups.Groups {
+			if group.Name != policyv1.GroupName {
+				continue
+			}
+			for _, served := range group.Versions {
+				if served.GroupVersion == version {
+					return version, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// CheckEvictionVersion fails when the server does not serve the eviction API
+// version, as the evictions would otherwise be mistaken for pods already
+// gone.
+func CheckEvictionVersion(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, version string) error {
+	var groups *metav1.APIGroupList
+	err := retry.Do(ctx, "discovering the API groups", func() error {
+		var err error
+		groups, err = client.Discovery().ServerGroups()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to discover the API groups: %w", err)
+	}
+
+	for _, group := range groups.Groups {
+		for _, served := range group.Versions {
+			if served.GroupVersion == version {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("the cluster does not serve the eviction API version %s", version)
+}
+
+// evictionRetryInterval is the interval between the evictions of a pod
+// rejected by a pod disruption budget, as kubectl drain does.
+const evictionRetryInterval = 5 * time.Second
+
+// deleteOrEvictPods evicts pods concurrently, or deletes them when evictions
+// are disabled or not supported, and waits for them to be gone. Each API call
+// is retried on its own, so that the failure of a call does not evict the
+// pods again.
+func (d *Drainer) deleteOrEvictPods(ctx context.Context, helper *drain.Helper, pods []v1.Pod) error {
+	if len(pods) == 0 {
+		return nil
+	}
+
+	var gv schema.GroupVersion
+	if !helper.DisableEviction {
+		err := d.do(ctx, "checking the eviction support", func() error {
+			var err error
+			gv, err = drain.CheckEvictionSupport(helper.Client)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if helper.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, helper.Timeout)
+		defer cancel()
+	}
+
+	errs := make([]error, len(pods))
+	var wg sync.WaitGroup
+	for i := range pods {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = d.deleteOrEvictPod(ctx, helper, pods[i], gv)
+		}(i)
+	}
+	wg.Wait()
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// deleteOrEvictPod evicts pod with the eviction API version gv, or deletes it
+// when gv is empty, and waits for it to be gone.
+func (d *Drainer) deleteOrEvictPod(ctx context.Context, helper *drain.Helper, pod v1.Pod, gv schema.GroupVersion) error {
+	// the helper sends its requests with its own context
+	h := *helper
+	h.Ctx = ctx
+
+	usingEviction := !gv.Empty()
+	if usingEviction {
+		if err := d.evictPod(ctx, &h, pod, gv); err != nil {
+			return err
+		}
+	} else {
+		err := d.do(ctx, fmt.Sprintf("deleting pod %s/%s", pod.Namespace, pod.Name), func() error {
+			return h.DeletePod(pod)
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error when deleting pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+	}
+
+	// the pods are not deleted in a server side dry run
+	if h.DryRunStrategy == cmdutil.DryRunServer {
+		return nil
+	}
+	return d.waitForPodDeleted(ctx, &h, pod, usingEviction)
+}
+
+// evictPod evicts pod, retrying while a pod disruption budget rejects the
+// eviction. The pods are evicted concurrently, so only the evictions of
+// the blocked pods are retried. When the drainer is PDB aware they are
+// retried with an exponential backoff starting at PDBRetryInterval, logging
+// the blocking budgets, and fail once the pod has been blocked for longer
+// than PDBBlockTimeout.
+func (d *Drainer) evictPod(ctx context.Context, helper *drain.Helper, pod v1.Pod, gv schema.GroupVersion) error {
+	interval := evictionRetryInterval
+	if d.PDBRetryInterval > 0 {
+		interval = d.PDBRetryInterval
+	}
+	var blockedSince time.Time
+	var budgets []string
+
+	attempts := 0
+	for {
+		err := d.do(ctx, fmt.Sprintf("evicting pod %s/%s", pod.Namespace, pod.Name), func() error {
+			if attempts > 0 {
+				d.Metrics.evictionRetries.Inc()
+			}
+			attempts++
+			return d.evict(ctx, helper, pod, gv)
+		})
+		switch {
+		case err == nil, apierrors.IsNotFound(err):
+			return nil
+		case isDisruptionBudgetError(err) && !d.pdbAware():
+			tflog.Debug(ctx, fmt.Sprintf("eviction of pod %s/%s rejected by a pod disruption budget, retrying in %s", pod.Namespace, pod.Name, interval))
+		case isDisruptionBudgetError(err):
+			if blockedSince.IsZero() {
+				blockedSince = time.Now()
+			}
+			budgets = d.blockingDisruptionBudgets(ctx, pod)
+			if len(budgets) == 0 {
+				budgets = []string{"unknown"}
+			}
+
+			if d.PDBBlockTimeout > 0 && time.Since(blockedSince) >= d.PDBBlockTimeout {
+				return fmt.Errorf("eviction of pod %s/%s blocked by pod disruption budgets %s for more than %s", pod.Namespace, pod.Name, strings.Join(budgets, ", "), d.PDBBlockTimeout)
+			}
+
+			tflog.Info(ctx, fmt.Sprintf("eviction of pod %s/%s blocked by pod disruption budgets %s...retrying in %s", pod.Namespace, pod.Name, strings.Join(budgets, ", "), interval))
+		case apierrors.IsForbidden(err) && apierrors.HasStatusCause(err, v1.NamespaceTerminatingCause):
+			// the pods of a terminating namespace are deleted with it
+			if pod.DeletionTimestamp != nil {
+				return nil
+			}
+		default:
+			return fmt.Errorf("error when evicting pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+
+		if err := Sleep(ctx, interval); err != nil {
+			if budgets != nil {
+				return fmt.Errorf("eviction of pod %s/%s blocked by pod disruption budgets %s until the drain timeout: %w", pod.Namespace, pod.Name, strings.Join(budgets, ", "), err)
+			}
+			return fmt.Errorf("%w while evicting pod %s/%s", err, pod.Namespace, pod.Name)
+		}
+
+		if d.pdbAware() {
+			interval *= 2
+			if interval > maxPollInterval {
+				interval = maxPollInterval
+			}
+		}
+	}
+}
+
+// evict sends the eviction of pod, with the eviction request timeout.
+func (d *Drainer) evict(ctx context.Context, helper *drain.Helper, pod v1.Pod, gv schema.GroupVersion) error {
+	if d.EvictionRequestTimeout <= 0 {
+		return helper.EvictPod(pod, gv)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.EvictionRequestTimeout)
+	defer cancel()
+
+	h := *helper
+	h.Ctx = ctx
+	return h.EvictPod(pod, gv)
+}
+
+// waitForPodDeleted waits for pod to be gone, or replaced by a pod with the
+// same name, skipping the pods deleted for longer than the skip wait timeout
+// of helper.
+func (d *Drainer) waitForPodDeleted(ctx context.Context, helper *drain.Helper, pod v1.Pod, usingEviction bool) error {
+	for {
+		var current *v1.Pod
+		err := d.do(ctx, fmt.Sprintf("getting pod %s/%s", pod.Namespace, pod.Name), func() error {
+			var err error
+			current, err = helper.Client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) || (err == nil && current.UID != pod.UID) {
+			if helper.OnPodDeletedOrEvicted != nil {
+				helper.OnPodDeletedOrEvicted(&pod, usingEviction)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error when waiting for pod %s/%s to terminate: %w", pod.Namespace, pod.Name, err)
+		}
+
+		if skip := time.Duration(helper.SkipWaitForDeleteTimeoutSeconds) * time.Second; skip > 0 &&
+			current.DeletionTimestamp != nil && time.Since(current.DeletionTimestamp.Time) > skip {
+			tflog.Debug(ctx, fmt.Sprintf("pod %s/%s deleted for more than %s, not waiting for it", pod.Namespace, pod.Name, skip))
+			return nil
+		}
+
+		if err := Sleep(ctx, time.Second); err != nil {
+			return fmt.Errorf("%w while waiting for pod %s/%s to terminate", err, pod.Namespace, pod.Name)
+		}
+	}
+}
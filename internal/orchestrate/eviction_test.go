@@ -0,0 +1,152 @@
+package orchestrate
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+func newTestPod(name, nodeName string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name)},
+		Spec:       v1.PodSpec{NodeName: nodeName},
+	}
+}
+
+// newEvictionClient returns a fake clientset serving policy/v1 evictions,
+// which delete the evicted pods unless blocked returns an error for them.
+func newEvictionClient(blocked func(pod string) error, objects ...runtime.Object) (*fake.Clientset, *[]string) {
+	client := fake.NewSimpleClientset(objects...)
+	client.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "pods"},
+			{Name: drain.EvictionSubresource, Kind: drain.EvictionKind, Group: "policy", Version: "v1"},
+		},
+	}}
+
+	var mu sync.Mutex
+	var evicted []string
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		if err := blocked(eviction.Name); err != nil {
+			return true, nil, err
+		}
+
+		mu.Lock()
+		evicted = append(evicted, eviction.Name)
+		mu.Unlock()
+		return true, nil, client.Tracker().Delete(v1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name)
+	})
+	return client, &evicted
+}
+
+func disruptionBudgetError() error {
+	err := apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+	err.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: policyv1.DisruptionBudgetCause}}
+	return err
+}
+
+func TestDeleteOrEvictPodsRetriesBlockedPods(t *testing.T) {
+	pods := []v1.Pod{*newTestPod("blocked", "node-1"), *newTestPod("free", "node-1")}
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	client, evicted := newEvictionClient(func(pod string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[pod]++
+		if pod == "blocked" && attempts[pod] < 3 {
+			return disruptionBudgetError()
+		}
+		return nil
+	}, &pods[0], &pods[1])
+
+	d := &Drainer{
+		Client:           client,
+		DrainClient:      client,
+		Retry:            DefaultRetryPolicy(),
+		Metrics:          NewMetrics("", "pool"),
+		PDBRetryInterval: 10 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	helper := &drain.Helper{Ctx: ctx, Client: client, Out: io.Discard, ErrOut: io.Discard}
+
+	if err := d.deleteOrEvictPods(ctx, helper, pods); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the free pod is not held back by the blocked one, nor evicted again
+	if expected := []string{"free", "blocked"}; !reflect.DeepEqual(*evicted, expected) {
+		t.Errorf("expected the pods to be evicted in order %v, got %v", expected, *evicted)
+	}
+	if expected := map[string]int{"blocked": 3, "free": 1}; !reflect.DeepEqual(attempts, expected) {
+		t.Errorf("expected eviction attempts %v, got %v", expected, attempts)
+	}
+}
+
+func TestDeleteOrEvictPodsBlockTimeout(t *testing.T) {
+	pods := []v1.Pod{*newTestPod("blocked", "node-1")}
+	client, _ := newEvictionClient(func(pod string) error {
+		return disruptionBudgetError()
+	}, &pods[0])
+
+	d := &Drainer{
+		Client:           client,
+		DrainClient:      client,
+		Retry:            DefaultRetryPolicy(),
+		Metrics:          NewMetrics("", "pool"),
+		PDBRetryInterval: 10 * time.Millisecond,
+		PDBBlockTimeout:  50 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	helper := &drain.Helper{Ctx: ctx, Client: client, Out: io.Discard, ErrOut: io.Discard}
+
+	err := d.deleteOrEvictPods(ctx, helper, pods)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if ctx.Err() != nil {
+		t.Errorf("expected the eviction to fail before the drain timeout")
+	}
+}
+
+func TestDeleteOrEvictPodsDeletesWithoutEvictions(t *testing.T) {
+	pods := []v1.Pod{*newTestPod("app", "node-1")}
+	client := fake.NewSimpleClientset(&pods[0])
+
+	d := &Drainer{
+		Client:      client,
+		DrainClient: client,
+		Retry:       DefaultRetryPolicy(),
+		Metrics:     NewMetrics("", "pool"),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	helper := &drain.Helper{Ctx: ctx, Client: client, DisableEviction: true, Out: io.Discard, ErrOut: io.Discard}
+
+	if err := d.deleteOrEvictPods(ctx, helper, pods); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.CoreV1().Pods("default").Get(ctx, "app", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the pod to be deleted, got %v", err)
+	}
+}
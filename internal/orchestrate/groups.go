@@ -0,0 +1,37 @@
+package orchestrate
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// partOfLabel groups the pods of the components of an application.
+const partOfLabel = "app.kubernetes.io/part-of"
+
+// evictionGroups splits pods into the groups evicted one after the other:
+// the pods part of each of the applications in EvictionGroupOrder, in that
+// order, then all the other pods. Empty groups are omitted.
+func (d *Drainer) evictionGroups(pods []v1.Pod) [][]v1.Pod {
+	if len(d.EvictionGroupOrder) == 0 {
+		return [][]v1.Pod{pods}
+	}
+
+	groups := make([][]v1.Pod, len(d.EvictionGroupOrder)+1)
+	for _, pod := range pods {
+		group := len(d.EvictionGroupOrder)
+		for i, partOf := range d.EvictionGroupOrder {
+			if pod.Labels[partOfLabel] == partOf {
+				group = i
+				break
+			}
+		}
+		groups[group] = append(groups[group], pod)
+	}
+
+	var nonEmpty [][]v1.Pod
+	for _, group := range groups {
+		if len(group) > 0 {
+			nonEmpty = append(nonEmpty, group)
+		}
+	}
+	return nonEmpty
+}
@@ -0,0 +1,75 @@
+package orchestrate
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Gate holds the drain of a node until it can start, e.g. until a
+// maintenance window opens, or fails it when it cannot.
+type Gate interface {
+	Wait(ctx context.Context, node v1.Node) error
+}
+
+// GateFunc adapts a function to a Gate.
+type GateFunc func(ctx context.Context, node v1.Node) error
+
+func (f GateFunc) Wait(ctx context.Context, node v1.Node) error {
+	return f(ctx, node)
+}
+
+// Step runs around the eviction of the pods of a node, e.g. a Job on the node
+// or the deletion of its cloud instance, failing the drain of the node when
+// it fails.
+type Step interface {
+	Run(ctx context.Context, node v1.Node) error
+}
+
+// StepFunc adapts a function to a Step.
+type StepFunc func(ctx context.Context, node v1.Node) error
+
+func (f StepFunc) Run(ctx context.Context, node v1.Node) error {
+	return f(ctx, node)
+}
+
+// Evicter empties a node in place of the eviction of its pods, e.g. by
+// letting the controller of the node terminate it.
+type Evicter interface {
+	Evict(ctx context.Context, node v1.Node) error
+}
+
+// Check verifies that the cluster is still healthy after a node, or a batch
+// of nodes, was drained, waiting for it to recover if needed.
+type Check interface {
+	Check(ctx context.Context) error
+}
+
+// InstanceChecker reports whether the cloud instance backing a node is gone.
+type InstanceChecker interface {
+	InstanceGone(ctx context.Context, node v1.Node) (bool, error)
+}
+
+// Observer is told about the progress of a drain, e.g. to report it outside
+// of the cluster. Its methods must not block nor fail the drain.
+type Observer interface {
+	NodeCordoned(ctx context.Context, node v1.Node)
+	NodeDrainStarted(ctx context.Context, node v1.Node)
+	PodEvicted(ctx context.Context, node v1.Node, pod *v1.Pod)
+	NodeDrained(ctx context.Context, node v1.Node, took time.Duration)
+	// NodeDeleted is called for the nodes deleted without a drain,
+	// with the reason why
+	NodeDeleted(ctx context.Context, node v1.Node, reason string)
+	NodeDrainFailed(ctx context.Context, node v1.Node, err error)
+}
+
+// nopObserver ignores the progress of a drain.
+type nopObserver struct{}
+
+func (nopObserver) NodeCordoned(context.Context, v1.Node)               {}
+func (nopObserver) NodeDrainStarted(context.Context, v1.Node)           {}
+func (nopObserver) PodEvicted(context.Context, v1.Node, *v1.Pod)        {}
+func (nopObserver) NodeDrained(context.Context, v1.Node, time.Duration) {}
+func (nopObserver) NodeDeleted(context.Context, v1.Node, string)        {}
+func (nopObserver) NodeDrainFailed(context.Context, v1.Node, error)     {}
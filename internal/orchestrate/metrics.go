@@ -0,0 +1,70 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const metricsJobName = "terraform_provider_k8snp"
+
+// Metrics collects the metrics of a single node pool drain and pushes
+// them to a Prometheus Pushgateway, if one is configured.
+type Metrics struct {
+	pusher *push.Pusher
+
+	nodesDrained    prometheus.Counter
+	podsEvicted     prometheus.Counter
+	evictionRetries prometheus.Counter
+	drainDuration   prometheus.Histogram
+}
+
+// NewMetrics returns the metrics of the drain of node pool nodePoolName,
+// pushed to pushgatewayURL unless it is empty.
+func NewMetrics(pushgatewayURL, nodePoolName string) *Metrics {
+	m := &Metrics{
+		nodesDrained: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "k8snp_nodes_drained_total",
+			Help: "Number of nodes drained.",
+		}),
+		podsEvicted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "k8snp_pods_evicted_total",
+			Help: "Number of pods evicted or deleted while draining nodes.",
+		}),
+		evictionRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "k8snp_eviction_retries_total",
+			Help: "Number of pod evictions retried after a transient error or a pod disruption budget rejection.",
+		}),
+		drainDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "k8snp_node_drain_duration_seconds",
+			Help:    "Duration of the drain of a single node.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		}),
+	}
+
+	if pushgatewayURL != "" {
+		m.pusher = push.New(pushgatewayURL, metricsJobName).
+			Grouping("node_pool", nodePoolName).
+			Collector(m.nodesDrained).
+			Collector(m.podsEvicted).
+			Collector(m.evictionRetries).
+			Collector(m.drainDuration)
+	}
+
+	return m
+}
+
+// Push sends the current value of the metrics to the Pushgateway. Failures
+// are only logged as metrics must never fail a drain.
+func (m *Metrics) Push(ctx context.Context) {
+	if m.pusher == nil {
+		return
+	}
+
+	if err := m.pusher.Push(); err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to push metrics to the Pushgateway: %s", err.Error()))
+	}
+}
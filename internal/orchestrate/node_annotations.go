@@ -0,0 +1,79 @@
+package orchestrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// DrainStartedAnnotation and DrainCompletedAnnotation are set on the
+	// drained nodes to the time of the drain and the node pool name
+	DrainStartedAnnotation   = "k8snp.io/drain-started"
+	DrainCompletedAnnotation = "k8snp.io/drain-completed"
+	// DrainedByAnnotation is set on the drained nodes to the
+	// DrainedBy setting of the drainer
+	DrainedByAnnotation = "k8snp.io/drained-by"
+)
+
+// annotateDrainStarted annotates node with the start of its drain, clearing
+// the completion of an earlier drain.
+func (d *Drainer) annotateDrainStarted(ctx context.Context, nodeName string) {
+	d.annotateNode(ctx, nodeName, map[string]*string{
+		DrainStartedAnnotation:   ptr(d.drainAnnotationValue()),
+		DrainCompletedAnnotation: nil,
+		DrainedByAnnotation:      ptr(d.DrainedBy),
+	})
+}
+
+// annotateDrainCompleted annotates node with the completion of its drain.
+func (d *Drainer) annotateDrainCompleted(ctx context.Context, nodeName string) {
+	d.annotateNode(ctx, nodeName, map[string]*string{
+		DrainCompletedAnnotation: ptr(d.drainAnnotationValue()),
+	})
+}
+
+func (d *Drainer) drainAnnotationValue() string {
+	return fmt.Sprintf("%s,%s", time.Now().UTC().Format(time.RFC3339), d.PoolName)
+}
+
+// annotateNode sets, or removes when nil, the annotations of node. Failures
+// are only logged as the annotations are not required by the drain.
+func (d *Drainer) annotateNode(ctx context.Context, nodeName string, annotations map[string]*string) {
+	if !d.AnnotateNodes {
+		return
+	}
+
+	// marshalling a map of strings cannot fail
+	patch, _ := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": annotations}})
+	err := d.Retry.Do(ctx, "annotating node "+nodeName, func() error {
+		_, err := d.Client.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+	if err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to annotate node %s: %s", nodeName, err.Error()))
+	}
+}
+
+// DrainCompletedBy reports whether node is still cordoned after a drain of
+// node pool poolName completed, e.g. by an earlier destroy interrupted before
+// its progress was saved, so that its drain can be skipped.
+func DrainCompletedBy(node v1.Node, poolName string) bool {
+	value, ok := node.Annotations[DrainCompletedAnnotation]
+	if !ok || !node.Spec.Unschedulable {
+		return false
+	}
+	_, pool, _ := strings.Cut(value, ",")
+	return pool == poolName
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
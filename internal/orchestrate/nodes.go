@@ -0,0 +1,354 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"go.opentelemetry.io/otel/attribute"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// NodeQuery selects nodes by label, or as the machines of a Cluster API
+// MachineDeployment, and, optionally, by field.
+type NodeQuery struct {
+	LabelSelector string
+	FieldSelector string
+	// MachineDeployment, when set, is the namespace/name of the Cluster
+	// API MachineDeployment whose machines are the nodes, in NodeNames,
+	// instead of those matching LabelSelector
+	MachineDeployment string
+	// NodeNames, when not nil, restricts the nodes to those named
+	NodeNames []string
+}
+
+func (q NodeQuery) String() string {
+	selector := q.LabelSelector
+	if q.MachineDeployment != "" {
+		selector = "the machines of MachineDeployment " + q.MachineDeployment
+	}
+	if q.FieldSelector == "" {
+		return selector
+	}
+	return selector + " and " + q.FieldSelector
+}
+
+// matches reports whether node is one of the NodeNames of the query, when
+// set, or of the machines of its MachineDeployment, none until they are
+// found. The nodes are otherwise selected by the API server.
+func (q NodeQuery) matches(node v1.Node) bool {
+	if q.NodeNames == nil && q.MachineDeployment == "" {
+		return true
+	}
+	return slices.Contains(q.NodeNames, node.Name)
+}
+
+// ListNodes returns the nodes matching query.
+func ListNodes(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, query NodeQuery) ([]v1.Node, error) {
+	ctx, span := startSpan(ctx, "list nodes", attribute.String("label_selector", query.LabelSelector), attribute.String("field_selector", query.FieldSelector))
+
+	var nodeList *v1.NodeList
+	err := retry.Do(ctx, "listing nodes", func() error {
+		var err error
+		nodeList, err = client.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+			LabelSelector: query.LabelSelector,
+			FieldSelector: query.FieldSelector,
+		})
+		return err
+	})
+	endSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	return FilterNodes(nodeList.Items, query.matches), nil
+}
+
+// WaitForReadyNodes watches the nodes matching query until at least
+// minReadyNodes of those accepted by include are ready, as defined by
+// criteria, or ctx is done. It returns the number of ready nodes last
+// observed. It fails as soon as the nodes cannot be listed or watched
+// because the provider is not authorized to.
+func WaitForReadyNodes(ctx context.Context, client kubernetes.Interface, query NodeQuery, minReadyNodes int64, include func(v1.Node) bool, criteria ReadinessCriteria) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the informer retries every failed list and watch, stop
+	// it on the errors that retrying cannot fix
+	var authErr error
+	var authErrMu sync.Mutex
+	failFast := func(err error) error {
+		if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) {
+			authErrMu.Lock()
+			if authErr == nil {
+				authErr = err
+			}
+			authErrMu.Unlock()
+			cancel()
+		}
+		return err
+	}
+
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = query.LabelSelector
+			options.FieldSelector = query.FieldSelector
+			list, err := client.CoreV1().Nodes().List(ctx, options)
+			return list, failFast(err)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = query.LabelSelector
+			options.FieldSelector = query.FieldSelector
+			w, err := client.CoreV1().Nodes().Watch(ctx, options)
+			return w, failFast(err)
+		},
+	}
+
+	readyNodes := map[string]bool{}
+	countReady := func() int64 {
+		var numReadyNodes int64
+		for _, ready := range readyNodes {
+			if ready {
+				numReadyNodes++
+			}
+		}
+		return numReadyNodes
+	}
+
+	_, err := watchtools.UntilWithSync(ctx, lw, &v1.Node{}, nil, func(event watch.Event) (bool, error) {
+		node, ok := event.Object.(*v1.Node)
+		if !ok {
+			return false, nil
+		}
+
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			if query.matches(*node) && include(*node) {
+				readyNodes[node.Name] = criteria.isReady(*node)
+			}
+		case watch.Deleted:
+			delete(readyNodes, node.Name)
+		}
+
+		numReadyNodes := countReady()
+		tflog.Debug(ctx, fmt.Sprintf("found %d ready nodes matching %s", numReadyNodes, query))
+
+		return numReadyNodes >= minReadyNodes, nil
+	})
+
+	authErrMu.Lock()
+	defer authErrMu.Unlock()
+	if authErr != nil {
+		return countReady(), fmt.Errorf("failed to watch nodes: %w", authErr)
+	}
+	return countReady(), err
+}
+
+const maxPollInterval = time.Minute
+
+// PollForReadyNodes lists the nodes matching query every interval until at
+// least minReadyNodes of those accepted by include are ready, as defined by
+// criteria, or ctx is done. When backoff is set the interval doubles after
+// each attempt, up to a minute, and is jittered to spread the API load. It
+// returns the number of ready nodes last observed.
+func PollForReadyNodes(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, query NodeQuery, minReadyNodes int64, include func(v1.Node) bool, criteria ReadinessCriteria, interval time.Duration, backoff bool) (int64, error) {
+	var numReadyNodes int64
+	for {
+		nodes, err := ListNodes(ctx, client, retry, query)
+		if err != nil {
+			return numReadyNodes, err
+		}
+
+		numReadyNodes = CountReadyNodes(FilterNodes(nodes, include), criteria)
+		if numReadyNodes >= minReadyNodes {
+			return numReadyNodes, nil
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("found %d ready nodes matching %s...waiting %s", numReadyNodes, query, interval))
+
+		if err := Sleep(ctx, interval); err != nil {
+			return numReadyNodes, err
+		}
+
+		if backoff {
+			interval = wait.Jitter(interval*2, 0.2)
+			if interval > maxPollInterval {
+				interval = maxPollInterval
+			}
+		}
+	}
+}
+
+// startupTaints are the taints set on nodes that are still initializing,
+// e.g. until the cloud provider or the network plugin has set them up.
+var startupTaints = []string{
+	"node.cloudprovider.kubernetes.io/uninitialized",
+	"node.kubernetes.io/network-unavailable",
+	"node.cilium.io/agent-not-ready",
+}
+
+// ReadinessCriteria describes the checks, on top of a true NodeReady
+// condition, a node must pass to be considered ready.
+type ReadinessCriteria struct {
+	NoMemoryPressure bool
+	NoDiskPressure   bool
+	NoPIDPressure    bool
+	Schedulable      bool
+	NoStartupTaints  bool
+	// HeartbeatStaleness, when set, is the age past which the last
+	// heartbeat of the NodeReady condition is too old to be trusted
+	HeartbeatStaleness time.Duration
+}
+
+// isReady reports whether node has a true NodeReady condition and
+// passes all the checks enabled in c.
+func (c ReadinessCriteria) isReady(node v1.Node) bool {
+	if !hasCondition(node, v1.NodeReady) {
+		return false
+	}
+
+	if (c.NoMemoryPressure && hasCondition(node, v1.NodeMemoryPressure)) ||
+		(c.NoDiskPressure && hasCondition(node, v1.NodeDiskPressure)) ||
+		(c.NoPIDPressure && hasCondition(node, v1.NodePIDPressure)) {
+		return false
+	}
+
+	if c.Schedulable && node.Spec.Unschedulable {
+		return false
+	}
+
+	// a wedged kubelet leaves the last Ready condition it reported
+	if c.HeartbeatStaleness > 0 && time.Since(readyHeartbeat(node)) > c.HeartbeatStaleness {
+		return false
+	}
+
+	if c.NoStartupTaints {
+		for _, taint := range node.Spec.Taints {
+			for _, key := range startupTaints {
+				if taint.Key == key {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+// hasCondition reports whether node has a true condition of the given type.
+func hasCondition(node v1.Node, conditionType v1.NodeConditionType) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// readyHeartbeat returns the last heartbeat of the NodeReady condition of
+// node, or the zero time when it has none.
+func readyHeartbeat(node v1.Node) time.Time {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.LastHeartbeatTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+// FilterNodes returns the nodes accepted by include.
+func FilterNodes(nodes []v1.Node, include func(v1.Node) bool) []v1.Node {
+	var included []v1.Node
+	for _, node := range nodes {
+		if include(node) {
+			included = append(included, node)
+		}
+	}
+	return included
+}
+
+// CountReadyNodes returns the number of nodes that are ready as defined by criteria.
+func CountReadyNodes(nodes []v1.Node, criteria ReadinessCriteria) int64 {
+	var numReadyNodes int64
+	for _, node := range nodes {
+		if criteria.isReady(node) {
+			numReadyNodes += 1
+		}
+	}
+	return numReadyNodes
+}
+
+// RepelsNewPods reports whether node is unschedulable or has a NoSchedule or
+// NoExecute taint, keeping away the pods that do not tolerate it.
+func RepelsNewPods(node v1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == v1.TaintEffectNoSchedule || taint.Effect == v1.TaintEffectNoExecute {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsControlPlaneNode reports whether node runs the kubernetes control plane.
+func IsControlPlaneNode(node v1.Node) bool {
+	_, controlPlane := node.Labels["node-role.kubernetes.io/control-plane"]
+	_, master := node.Labels["node-role.kubernetes.io/master"]
+	return controlPlane || master
+}
+
+// IsVirtualNode reports whether node is backed by a virtual kubelet,
+// e.g. EKS Fargate, rather than by a real machine that can be drained.
+func IsVirtualNode(node v1.Node) bool {
+	if node.Labels["type"] == "virtual-kubelet" || node.Labels["eks.amazonaws.com/compute-type"] == "fargate" {
+		return true
+	}
+
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == "virtual-kubelet.io/provider" || taint.Key == "eks.amazonaws.com/compute-type" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExcludeVirtualNodes splits nodes into physical nodes and virtual ones.
+func ExcludeVirtualNodes(nodes []v1.Node) ([]v1.Node, []v1.Node) {
+	var physical, virtual []v1.Node
+	for _, node := range nodes {
+		if IsVirtualNode(node) {
+			virtual = append(virtual, node)
+		} else {
+			physical = append(physical, node)
+		}
+	}
+	return physical, virtual
+}
+
+// InstanceID returns the ID of the machine backing node in its cloud provider,
+// i.e. the last segment of its provider ID, e.g. i-0123456789abcdef0 for
+// aws:///us-east-1a/i-0123456789abcdef0, or an empty string when not set.
+func InstanceID(node v1.Node) string {
+	providerID := strings.TrimRight(node.Spec.ProviderID, "/")
+	if providerID == "" {
+		return ""
+	}
+	return providerID[strings.LastIndex(providerID, "/")+1:]
+}
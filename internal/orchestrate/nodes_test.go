@@ -0,0 +1,79 @@
+package orchestrate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestNode(name string, labels map[string]string, ready bool) *v1.Node {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}},
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("2"),
+				v1.ResourceMemory: resource.MustParse("4Gi"),
+				v1.ResourcePods:   resource.MustParse("110"),
+			},
+		},
+	}
+}
+
+func newTestClient(objects ...runtime.Object) kubernetes.Interface {
+	return fake.NewSimpleClientset(objects...)
+}
+
+func TestWaitForReadyNodes(t *testing.T) {
+	pool := map[string]string{"pool": "a"}
+	client := newTestClient(
+		newTestNode("node-1", pool, true),
+		newTestNode("node-2", pool, false),
+		newTestNode("node-3", pool, true),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	include := func(node v1.Node) bool { return true }
+	ready, err := WaitForReadyNodes(ctx, client, NodeQuery{LabelSelector: "pool=a"}, 2, include, ReadinessCriteria{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ready != 2 {
+		t.Errorf("expected 2 ready nodes, got %d", ready)
+	}
+}
+
+func TestWaitForReadyNodesForbidden(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "", nil)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	include := func(node v1.Node) bool { return true }
+	_, err := WaitForReadyNodes(ctx, client, NodeQuery{LabelSelector: "pool=a"}, 1, include, ReadinessCriteria{})
+	if !apierrors.IsForbidden(err) {
+		t.Fatalf("expected a forbidden error, got %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("expected the wait to fail before its timeout")
+	}
+}
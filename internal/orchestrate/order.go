@@ -0,0 +1,85 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DrainOrderName            = "name"
+	DrainOrderOldestFirst     = "oldest_first"
+	DrainOrderNewestFirst     = "newest_first"
+	DrainOrderFewestPodsFirst = "fewest_pods_first"
+)
+
+// SortNodesForDrain returns nodes sorted in the given drain order. Nodes
+// that compare equal keep their order by name.
+func SortNodesForDrain(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, nodes []v1.Node, order string) ([]v1.Node, error) {
+	sorted := make([]v1.Node, len(nodes))
+	copy(sorted, nodes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	switch order {
+	case DrainOrderOldestFirst:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].CreationTimestamp.Before(&sorted[j].CreationTimestamp)
+		})
+	case DrainOrderNewestFirst:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+		})
+	case DrainOrderFewestPodsFirst:
+		pods := map[string]int{}
+		for _, node := range sorted {
+			count, err := countPodsToEvict(ctx, client, retry, node.Name)
+			if err != nil {
+				return nil, err
+			}
+			pods[node.Name] = count
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return pods[sorted[i].Name] < pods[sorted[j].Name]
+		})
+	}
+
+	return sorted, nil
+}
+
+// countPodsToEvict returns the number of running pods on nodeName, except
+// those managed by DaemonSets which are not evicted.
+func countPodsToEvict(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, nodeName string) (int, error) {
+	var count int
+	err := retry.Do(ctx, "listing pods on node "+nodeName, func() error {
+		pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+		})
+		if err != nil {
+			return err
+		}
+
+		count = 0
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+				continue
+			}
+			if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+				continue
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pods on node %s: %w", nodeName, err)
+	}
+
+	return count, nil
+}
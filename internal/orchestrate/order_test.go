@@ -0,0 +1,103 @@
+package orchestrate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newPodsClient returns a fake clientset whose pod lists honour the
+// spec.nodeName field selector, ignored by the fake object tracker.
+func newPodsClient(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	selectPodsByNode(client)
+	return client
+}
+
+// selectPodsByNode makes the pod lists of client honour the
+// spec.nodeName field selector.
+func selectPodsByNode(client *fake.Clientset) {
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+		if selector == nil || selector.Empty() {
+			return false, nil, nil
+		}
+
+		obj, err := client.Tracker().List(v1.SchemeGroupVersion.WithResource("pods"), v1.SchemeGroupVersion.WithKind("Pod"), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		pods := obj.(*v1.PodList)
+		filtered := &v1.PodList{}
+		for _, pod := range pods.Items {
+			if selector.Matches(fields.Set{"spec.nodeName": pod.Spec.NodeName}) {
+				filtered.Items = append(filtered.Items, pod)
+			}
+		}
+		return true, filtered, nil
+	})
+}
+
+func TestSortNodesForDrain(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	node := func(name string, age time.Duration) v1.Node {
+		return v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created.Add(-age))}}
+	}
+	// node-b and node-c are as old and run as many pods, their ties are
+	// broken by name
+	nodes := []v1.Node{node("node-c", time.Hour), node("node-a", 2*time.Hour), node("node-d", 0), node("node-b", time.Hour)}
+
+	controller := true
+	daemonSetPod := newTestPod("daemon", "node-a")
+	daemonSetPod.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "daemon", Controller: &controller}}
+	completedPod := newTestPod("completed", "node-a")
+	completedPod.Status.Phase = v1.PodSucceeded
+	failedPod := newTestPod("failed", "node-a")
+	failedPod.Status.Phase = v1.PodFailed
+	objects := []runtime.Object{
+		newTestPod("pod-1", "node-d"), newTestPod("pod-2", "node-d"), newTestPod("pod-3", "node-d"),
+		newTestPod("pod-4", "node-b"), newTestPod("pod-5", "node-c"),
+		// the DaemonSet and completed pods of node-a are not counted
+		newTestPod("pod-6", "node-a"), newTestPod("pod-7", "node-a"),
+		daemonSetPod, completedPod, failedPod,
+	}
+
+	tests := map[string]struct {
+		order    string
+		expected []string
+	}{
+		"name":              {order: DrainOrderName, expected: []string{"node-a", "node-b", "node-c", "node-d"}},
+		"default":           {order: "", expected: []string{"node-a", "node-b", "node-c", "node-d"}},
+		"oldest first":      {order: DrainOrderOldestFirst, expected: []string{"node-a", "node-b", "node-c", "node-d"}},
+		"newest first":      {order: DrainOrderNewestFirst, expected: []string{"node-d", "node-b", "node-c", "node-a"}},
+		"fewest pods first": {order: DrainOrderFewestPodsFirst, expected: []string{"node-b", "node-c", "node-a", "node-d"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sorted, err := SortNodesForDrain(context.Background(), newPodsClient(objects...), DefaultRetryPolicy(), nodes, test.order)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, node := range sorted {
+				names = append(names, node.Name)
+			}
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected order %v, got %v", test.expected, names)
+			}
+			if nodes[0].Name != "node-c" {
+				t.Errorf("expected the nodes to be left unsorted")
+			}
+		})
+	}
+}
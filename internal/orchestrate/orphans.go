@@ -0,0 +1,113 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+const (
+	// OrphanedPodsFail fails the drain of nodes running orphaned DaemonSet pods
+	OrphanedPodsFail = "fail"
+	// OrphanedPodsDelete evicts the orphaned DaemonSet pods with the other pods
+	OrphanedPodsDelete = "delete"
+	// OrphanedPodsSkip leaves the orphaned DaemonSet pods on the nodes
+	OrphanedPodsSkip = "skip"
+)
+
+// runNodeDrain evicts the pods from nodeName like drain.RunNodeDrain, but
+// handles the pods whose DaemonSet no longer exists as configured by the
+// OrphanedPods setting of the drainer instead of failing with a DaemonSet
+// not found error.
+func (d *Drainer) runNodeDrain(ctx context.Context, helper *drain.Helper, nodeName string) error {
+	pods, warnings, err := d.podsForDeletion(ctx, helper, nodeName)
+	if err != nil {
+		return err
+	}
+	if warnings != "" {
+		fmt.Fprintf(helper.ErrOut, "WARNING: %s\n", warnings)
+	}
+
+	for _, group := range d.evictionGroups(pods) {
+		if err := d.deleteOrEvictPods(ctx, helper, group); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// podsForDeletion returns the pods to evict from nodeName, those selected by
+// the drain helper plus the orphaned DaemonSet pods when the drainer deletes
+// them, and the warnings of the drain helper about them.
+func (d *Drainer) podsForDeletion(ctx context.Context, helper *drain.Helper, nodeName string) ([]v1.Pod, string, error) {
+	// the drain helper fails on the orphaned DaemonSet pods unless forced, in
+	// which case it lists them for deletion together with the unmanaged pods,
+	// so we force it and then apply our own policies to both
+	forced := *helper
+	forced.Force = true
+
+	var list *drain.PodDeleteList
+	err := d.do(ctx, "listing pods on node "+nodeName, func() error {
+		var errs []error
+		list, errs = forced.GetPodsForDeletion(nodeName)
+		return utilerrors.NewAggregate(errs)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var pods, orphans, unmanaged []v1.Pod
+	for _, pod := range list.Pods() {
+		owner := metav1.GetControllerOf(&pod)
+		finished := pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+		switch {
+		case finished:
+			pods = append(pods, pod)
+		case owner == nil:
+			unmanaged = append(unmanaged, pod)
+		case owner.Kind == "DaemonSet":
+			// the drain helper skips or fails on the pods of existing
+			// DaemonSets, the DaemonSet pods it lists are orphaned
+			orphans = append(orphans, pod)
+		default:
+			pods = append(pods, pod)
+		}
+	}
+
+	if len(unmanaged) > 0 && !d.Options.Force {
+		return nil, "", fmt.Errorf("cannot delete pods %s on node %s as they declare no controller, set force to delete them", podNames(unmanaged), nodeName)
+	}
+	pods = append(pods, unmanaged...)
+
+	// like kubectl, the drain helper deletes orphaned pods when forced
+	if len(orphans) > 0 && !d.Options.Force {
+		switch d.OrphanedPods {
+		case OrphanedPodsDelete:
+			tflog.Warn(ctx, fmt.Sprintf("evicting pods %s from node %s as their DaemonSets no longer exist", podNames(orphans), nodeName))
+		case OrphanedPodsSkip:
+			tflog.Warn(ctx, fmt.Sprintf("leaving pods %s on node %s as their DaemonSets no longer exist", podNames(orphans), nodeName))
+			orphans = nil
+		default:
+			return nil, "", fmt.Errorf("pods %s on node %s are managed by DaemonSets that no longer exist, delete them or set orphaned_daemonset_pods to delete or skip them", podNames(orphans), nodeName)
+		}
+	}
+	pods = append(pods, orphans...)
+
+	return pods, list.Warnings(), nil
+}
+
+// podNames returns the namespaced names of pods separated by commas.
+func podNames(pods []v1.Pod) string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Namespace+"/"+pod.Name)
+	}
+	return strings.Join(names, ", ")
+}
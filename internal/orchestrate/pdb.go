@@ -0,0 +1,85 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+// pdbAware reports whether evictions blocked by pod disruption budgets
+// are retried with a backoff, reporting the blocking budgets, rather than
+// every 5 seconds like kubectl drain.
+func (d *Drainer) pdbAware() bool {
+	return (d.PDBRetryInterval > 0 || d.PDBBlockTimeout > 0) && !d.Options.DisableEviction
+}
+
+// blockingDisruptionBudgets returns the names of the pod disruption budgets
+// selecting pod that do not allow any disruption.
+func (d *Drainer) blockingDisruptionBudgets(ctx context.Context, pod v1.Pod) []string {
+	budgets, err := d.DrainClient.PolicyV1().PodDisruptionBudgets(pod.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		tflog.Debug(ctx, fmt.Sprintf("failed to list pod disruption budgets in namespace %s: %s", pod.Namespace, err.Error()))
+		return nil
+	}
+
+	var names []string
+	for _, budget := range budgets.Items {
+		selector, err := metav1.LabelSelectorAsSelector(budget.Spec.Selector)
+		if err != nil || selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if budget.Status.DisruptionsAllowed == 0 {
+			names = append(names, budget.Namespace+"/"+budget.Name)
+		}
+	}
+
+	return names
+}
+
+// maxReportedPods bounds the number of pods described when a drain fails.
+const maxReportedPods = 20
+
+// describeRemainingPods describes the pods still to be evicted from nodeName,
+// with their controllers and the pod disruption budgets blocking their
+// eviction, to explain why its drain failed.
+func (d *Drainer) describeRemainingPods(ctx context.Context, helper *drain.Helper, nodeName string) string {
+	if ctx.Err() != nil {
+		return ""
+	}
+
+	podList, _ := helper.GetPodsForDeletion(nodeName)
+	if podList == nil || len(podList.Pods()) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("pods remaining on node %s:\n%s", nodeName, d.describePods(ctx, podList.Pods()))
+}
+
+// describePods describes pods, one per line, with their controllers and the
+// pod disruption budgets blocking their eviction.
+func (d *Drainer) describePods(ctx context.Context, pods []v1.Pod) string {
+	var lines []string
+	for i, pod := range pods {
+		if i == maxReportedPods {
+			lines = append(lines, fmt.Sprintf("  ...and %d more", len(pods)-maxReportedPods))
+			break
+		}
+
+		line := fmt.Sprintf("  - %s/%s", pod.Namespace, pod.Name)
+		if owner := metav1.GetControllerOf(&pod); owner != nil {
+			line += fmt.Sprintf(", managed by %s %s", owner.Kind, owner.Name)
+		}
+		if budgets := d.blockingDisruptionBudgets(ctx, pod); len(budgets) > 0 {
+			line += fmt.Sprintf(", blocked by pod disruption budgets %s", strings.Join(budgets, ", "))
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
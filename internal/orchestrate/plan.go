@@ -0,0 +1,218 @@
+package orchestrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Plan describes how the cordoned nodes of a node pool are drained.
+type Plan struct {
+	// Budget, when set, is shared among the nodes, drained one at a
+	// time, see drainWithinBudget
+	Budget time.Duration
+	// BatchSize, when set, drains the nodes in batches of this many
+	// nodes, see drainInBatches
+	BatchSize int
+	// Concurrency is how many nodes are drained at the same time
+	// otherwise, one when not set
+	Concurrency int
+	// Wait is the pause after each node, or batch of nodes, drained
+	Wait WaitSchedule
+}
+
+// DrainNodes drains nodes as planned, waiting after each node, or batch of
+// nodes, for the checks of the drainer to pass.
+func (d *Drainer) DrainNodes(ctx context.Context, nodes []v1.Node, plan Plan) error {
+	switch {
+	case plan.Budget > 0:
+		return d.drainWithinBudget(ctx, nodes, plan.Budget, plan.Wait)
+	case plan.BatchSize > 0:
+		return d.drainInBatches(ctx, nodes, plan.BatchSize, plan.Wait)
+	default:
+		var drained atomic.Int64
+		return forEachNode(ctx, nodes, max(plan.Concurrency, 1), func(ctx context.Context, node v1.Node) error {
+			if err := d.Drain(ctx, node); err != nil {
+				return fmt.Errorf("unexpected error draining node %s: %w", node.Name, err)
+			}
+			if err := d.waitForRescheduledPods(ctx); err != nil {
+				return fmt.Errorf("unexpected error waiting for the pods evicted from node %s to be ready: %w", node.Name, err)
+			}
+			if err := d.runChecks(ctx); err != nil {
+				return fmt.Errorf("unexpected error after draining node %s: %w", node.Name, err)
+			}
+
+			tflog.Debug(ctx, fmt.Sprintf("sleeping after draining node %s", node.Name))
+			if err := Sleep(ctx, plan.Wait.after(int(drained.Add(1)-1), len(nodes))); err != nil {
+				return fmt.Errorf("the operation was cancelled after draining node %s", node.Name)
+			}
+
+			return nil
+		})
+	}
+}
+
+// runChecks runs the checks of the drainer in order, stopping at the first
+// failure.
+func (d *Drainer) runChecks(ctx context.Context) error {
+	for _, check := range d.Checks {
+		if err := check.Check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drainInBatches drains nodes in batches of batchSize nodes. The nodes of a
+// batch are drained at the same time and the next batch is started only once
+// the evicted pods are ready again elsewhere and wait elapsed.
+func (d *Drainer) drainInBatches(ctx context.Context, nodes []v1.Node, batchSize int, wait WaitSchedule) error {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	batches := (len(nodes) + batchSize - 1) / batchSize
+	for start := 0; start < len(nodes); start += batchSize {
+		end := start + batchSize
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		batch := nodes[start:end]
+
+		err := forEachNode(ctx, batch, len(batch), func(ctx context.Context, node v1.Node) error {
+			if err := d.Drain(ctx, node); err != nil {
+				return fmt.Errorf("unexpected error draining node %s: %w", node.Name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := d.waitForEvictedWorkloads(ctx); err != nil {
+			return fmt.Errorf("unexpected error waiting for evicted pods to be ready: %w", err)
+		}
+		if err := d.runChecks(ctx); err != nil {
+			return fmt.Errorf("unexpected error after draining a batch of nodes: %w", err)
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("sleeping after draining batch of %d nodes", len(batch)))
+		if err := Sleep(ctx, wait.after(start/batchSize, batches)); err != nil {
+			return errors.New("the operation was cancelled after draining a batch of nodes")
+		}
+	}
+
+	return nil
+}
+
+// drainWithinBudget drains nodes one at a time sharing budget among them
+// proportionally to the number of pods to evict from each node. Any time
+// left unused by a drain is rolled forward to the following nodes.
+func (d *Drainer) drainWithinBudget(ctx context.Context, nodes []v1.Node, budget time.Duration, wait WaitSchedule) error {
+	podCounts := make([]int, len(nodes))
+	remainingPods := 0
+	for i, node := range nodes {
+		count, err := d.CountPodsToEvict(ctx, node.Name)
+		if err != nil {
+			return fmt.Errorf("unexpected error listing pods on node %s: %w", node.Name, err)
+		}
+		podCounts[i] = count
+		remainingPods += count
+	}
+
+	remainingBudget := budget
+	for i, node := range nodes {
+		if remainingBudget <= 0 {
+			return fmt.Errorf("the total drain budget of %s was exhausted before draining node %s", budget, node.Name)
+		}
+
+		// nodes without pods to evict are given an equal share of the
+		// budget, as the drain may still need to wait for terminating pods
+		timeout := remainingBudget / time.Duration(len(nodes)-i)
+		if remainingPods > 0 {
+			timeout = time.Duration(int64(remainingBudget) * int64(podCounts[i]) / int64(remainingPods))
+		}
+		// the drain of a node without pods still needs a moment, but
+		// never more than what is left of the budget
+		if timeout < time.Second {
+			timeout = time.Second
+		}
+		if timeout > remainingBudget {
+			timeout = remainingBudget
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("draining node %s with %d pods within %s of the remaining %s budget", node.Name, podCounts[i], timeout, remainingBudget))
+
+		drainStart := time.Now()
+		if err := d.drainWithin(ctx, node, timeout); err != nil {
+			return fmt.Errorf("unexpected error draining node %s: %w", node.Name, err)
+		}
+		remainingBudget -= time.Since(drainStart)
+		remainingPods -= podCounts[i]
+
+		if err := d.waitForRescheduledPods(ctx); err != nil {
+			return fmt.Errorf("unexpected error waiting for the pods evicted from node %s to be ready: %w", node.Name, err)
+		}
+		if err := d.runChecks(ctx); err != nil {
+			return fmt.Errorf("unexpected error after draining node %s: %w", node.Name, err)
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("sleeping after draining node %s", node.Name))
+		if err := Sleep(ctx, wait.after(i, len(nodes))); err != nil {
+			return fmt.Errorf("the operation was cancelled after draining node %s", node.Name)
+		}
+	}
+
+	return nil
+}
+
+// forEachNode calls fn for every node running at most concurrency calls
+// at the same time. It stops starting new calls after the first failure,
+// which is returned once all running calls completed.
+func forEachNode(ctx context.Context, nodes []v1.Node, concurrency int, fn func(ctx context.Context, node v1.Node) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	semaphore := make(chan struct{}, concurrency)
+
+	for _, node := range nodes {
+		select {
+		case <-ctx.Done():
+		case semaphore <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(node v1.Node) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			if err := fn(ctx, node); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(node)
+	}
+
+	wg.Wait()
+
+	if firstErr == nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
@@ -0,0 +1,133 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// crashLoopBackOff is the reason of the waiting containers
+// restarted with a back off after failing repeatedly
+const crashLoopBackOff = "CrashLoopBackOff"
+
+// PodRequirement describes a minimum number of ready pods, matching a label
+// selector in a namespace, that must run on the nodes of a pool.
+type PodRequirement struct {
+	Namespace     string
+	LabelSelector string
+	MinReady      int64
+}
+
+func (p PodRequirement) String() string {
+	return fmt.Sprintf("%s/%s", p.Namespace, p.LabelSelector)
+}
+
+// WaitForPods waits until each of requirements is met by the pods running on
+// the nodes matching query, or ctx is done.
+func WaitForPods(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, query NodeQuery, requirements []PodRequirement) error {
+	for {
+		nodes, err := ListNodes(ctx, client, retry, query)
+		if err != nil {
+			return err
+		}
+
+		nodeNames := map[string]bool{}
+		for _, node := range nodes {
+			nodeNames[node.Name] = true
+		}
+
+		var pending []string
+		for _, requirement := range requirements {
+			numReadyPods, err := countReadyPodsOnNodes(ctx, client, retry, requirement, nodeNames)
+			if err != nil {
+				return err
+			}
+			if numReadyPods < requirement.MinReady {
+				pending = append(pending, fmt.Sprintf("%s (%d of %d ready)", requirement, numReadyPods, requirement.MinReady))
+			}
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for pods to be ready on nodes matching %s: %s", query, strings.Join(pending, ", ")))
+
+		if err := Sleep(ctx, 2*time.Second); err != nil {
+			return fmt.Errorf("pods %s were not ready: %w", strings.Join(pending, ", "), err)
+		}
+	}
+}
+
+// countReadyPodsOnNodes returns the number of ready pods matching requirement
+// that are running on one of nodeNames.
+func countReadyPodsOnNodes(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, requirement PodRequirement, nodeNames map[string]bool) (int64, error) {
+	var numReadyPods int64
+	err := retry.Do(ctx, fmt.Sprintf("listing pods %s", requirement), func() error {
+		pods, err := client.CoreV1().Pods(requirement.Namespace).List(ctx, metav1.ListOptions{LabelSelector: requirement.LabelSelector})
+		if err != nil {
+			return err
+		}
+
+		numReadyPods = 0
+		for _, pod := range pods.Items {
+			if nodeNames[pod.Spec.NodeName] && isPodReady(pod) {
+				numReadyPods++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pods %s: %w", requirement, err)
+	}
+
+	return numReadyPods, nil
+}
+
+// CrashLoopingPods returns the pods running on nodes with a container in
+// CrashLoopBackOff, a sign that the nodes are not actually usable.
+func CrashLoopingPods(ctx context.Context, client kubernetes.Interface, retry RetryPolicy, nodes []v1.Node) ([]string, error) {
+	var crashLooping []string
+	for _, node := range nodes {
+		err := retry.Do(ctx, "listing pods on node "+node.Name, func() error {
+			pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+				FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": node.Name}).String(),
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, pod := range pods.Items {
+				if isCrashLooping(pod) {
+					crashLooping = append(crashLooping, pod.Namespace+"/"+pod.Name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods on node %s: %w", node.Name, err)
+		}
+	}
+
+	return crashLooping, nil
+}
+
+// isCrashLooping reports whether a container, or init container, of pod is
+// in CrashLoopBackOff.
+func isCrashLooping(pod v1.Pod) bool {
+	for _, statuses := range [][]v1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting != nil && status.State.Waiting.Reason == crashLoopBackOff {
+				return true
+			}
+		}
+	}
+	return false
+}
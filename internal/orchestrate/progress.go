@@ -0,0 +1,51 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// ReportProgress logs the progress of the drain of the total nodes of the
+// pool every interval, on top of the log of each drained node, until the
+// returned function is called.
+func (d *Drainer) ReportProgress(ctx context.Context, total int, interval time.Duration) func() {
+	d.mu.Lock()
+	d.totalNodes = total
+	d.drainStart = time.Now()
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.logProgress(ctx)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// logProgress logs the number and percentage of the nodes of the pool
+// drained so far. It does nothing before ReportProgress is called.
+func (d *Drainer) logProgress(ctx context.Context) {
+	d.mu.Lock()
+	drained, total, start := len(d.drainedNodes), d.totalNodes, d.drainStart
+	d.mu.Unlock()
+	if total == 0 {
+		return
+	}
+
+	tflog.Info(ctx, fmt.Sprintf("drained %d/%d nodes of node pool %s (%d%%) in %s", drained, total, d.PoolName, drained*100/total, time.Since(start).Round(time.Second)))
+}
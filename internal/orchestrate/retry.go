@@ -0,0 +1,170 @@
+package orchestrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	defaultMaxApiRetries   = 5
+	defaultApiRetryBackoff = time.Second
+)
+
+// controlPlaneFlapInterval is the pause between attempts
+// while the API server is unavailable
+var controlPlaneFlapInterval = 5 * time.Second
+
+// RetryPolicy describes how transient kubernetes API errors are retried.
+type RetryPolicy struct {
+	MaxRetries int64
+	Backoff    time.Duration
+}
+
+// DefaultRetryPolicy retries the API calls up to 5 times, backing off from a
+// second.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: defaultMaxApiRetries,
+		Backoff:    defaultApiRetryBackoff,
+	}
+}
+
+// Do runs fn and retries it with an exponential backoff as long as
+// it fails with a transient error and the retry budget is not exhausted.
+// When ctx is done while backing off, the context error is returned,
+// wrapping the last error of fn.
+func (p RetryPolicy) Do(ctx context.Context, operation string, fn func() error) error {
+	return p.DoRetrying(ctx, operation, isRetryableError, fn)
+}
+
+// DoRetrying runs fn like Do, retrying the errors for which retryable
+// returns true, e.g. those of a cloud API rather than of kubernetes.
+func (p RetryPolicy) DoRetrying(ctx context.Context, operation string, retryable func(error) bool, fn func() error) error {
+	var err error
+	backoff := p.Backoff
+
+	for attempt := int64(0); ; attempt++ {
+		err = fn()
+		if err == nil || !retryable(err) || attempt >= p.MaxRetries {
+			return err
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("transient error while %s, retrying in %s (attempt %d of %d): %s", operation, backoff, attempt+1, p.MaxRetries, err.Error()))
+
+		if ctxErr := Sleep(ctx, backoff); ctxErr != nil {
+			return fmt.Errorf("%w while %s, last error: %w", ctxErr, operation, err)
+		}
+
+		backoff *= 2
+	}
+}
+
+// DoTolerating runs fn like Do but, when the API server is unavailable,
+// e.g. while the control plane is upgraded, keeps retrying for up to
+// tolerance instead of failing.
+func (p RetryPolicy) DoTolerating(ctx context.Context, operation string, tolerance time.Duration, fn func() error) error {
+	var unavailableSince time.Time
+	for {
+		err := p.Do(ctx, operation, fn)
+		if err == nil || tolerance <= 0 || !isAPIServerUnavailable(err) {
+			return err
+		}
+
+		if unavailableSince.IsZero() {
+			unavailableSince = time.Now()
+			tflog.Warn(ctx, fmt.Sprintf("kubernetes API server unavailable while %s, possibly because of a control plane upgrade...pausing for up to %s: %s", operation, tolerance, err.Error()))
+		}
+
+		if time.Since(unavailableSince) >= tolerance {
+			return fmt.Errorf("kubernetes API server unavailable for more than %s: %w", tolerance, err)
+		}
+
+		if ctxErr := Sleep(ctx, controlPlaneFlapInterval); ctxErr != nil {
+			return fmt.Errorf("%w while %s, last error: %w", ctxErr, operation, err)
+		}
+	}
+}
+
+// Sleep pauses for d or until ctx is done, in which case
+// it returns the context error.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isRetryableError reports whether err is a transient failure of the
+// kubernetes API that is worth retrying, e.g. throttling, server errors
+// or an etcd leader change.
+func isRetryableError(err error) bool {
+	// evictions rejected by a pod disruption budget are retried by the drain
+	if isDisruptionBudgetError(err) {
+		return false
+	}
+
+	if apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsUnexpectedServerError(err) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "etcdserver: leader changed") ||
+		strings.Contains(msg, "etcdserver: request timed out") ||
+		strings.Contains(msg, "connection reset by peer")
+}
+
+// isDisruptionBudgetError reports whether err is the rejection of an
+// eviction because of a pod disruption budget, rather than throttling.
+func isDisruptionBudgetError(err error) bool {
+	if !apierrors.IsTooManyRequests(err) {
+		return false
+	}
+	// servers older than 1.26 do not set the cause
+	return apierrors.HasStatusCause(err, policyv1.DisruptionBudgetCause) ||
+		strings.Contains(err.Error(), "disruption budget")
+}
+
+// isAPIServerUnavailable reports whether err is caused by the kubernetes
+// API server not accepting requests, as happens while its instances are
+// restarted during a control plane upgrade.
+func isAPIServerUnavailable(err error) bool {
+	if apierrors.IsServiceUnavailable(err) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// drain errors are aggregated as strings, losing the error types
+	msg := err.Error()
+	return strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "connection reset by peer") ||
+		strings.Contains(msg, "server sent GOAWAY") ||
+		strings.Contains(msg, "unexpected EOF")
+}
@@ -0,0 +1,159 @@
+package orchestrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var testResource = schema.GroupResource{Resource: "pods"}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"too many requests":       {err: apierrors.NewTooManyRequests("throttled", 1), expected: true},
+		"disruption budget":       {err: disruptionBudgetError(), expected: false},
+		"disruption budget, old":  {err: apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0), expected: false},
+		"server timeout":          {err: apierrors.NewServerTimeout(testResource, "get", 1), expected: true},
+		"timeout":                 {err: apierrors.NewTimeoutError("timeout", 1), expected: true},
+		"internal error":          {err: apierrors.NewInternalError(errors.New("boom")), expected: true},
+		"service unavailable":     {err: apierrors.NewServiceUnavailable("unavailable"), expected: true},
+		"unexpected server error": {err: apierrors.NewGenericServerResponse(502, "get", testResource, "pod", "", 0, true), expected: true},
+		"network timeout":         {err: &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, expected: true},
+		"leader changed":          {err: errors.New("etcdserver: leader changed"), expected: true},
+		"etcd timeout":            {err: fmt.Errorf("wrapped: %w", errors.New("etcdserver: request timed out")), expected: true},
+		"connection reset":        {err: errors.New("read tcp: connection reset by peer"), expected: true},
+		"not found":               {err: apierrors.NewNotFound(testResource, "pod"), expected: false},
+		"forbidden":               {err: apierrors.NewForbidden(testResource, "pod", errors.New("denied")), expected: false},
+		"conflict":                {err: apierrors.NewConflict(testResource, "pod", errors.New("modified")), expected: false},
+		"other":                   {err: errors.New("boom"), expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if retryable := isRetryableError(test.err); retryable != test.expected {
+				t.Errorf("expected retryable %v, got %v", test.expected, retryable)
+			}
+		})
+	}
+}
+
+func TestIsAPIServerUnavailable(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"service unavailable": {err: apierrors.NewServiceUnavailable("unavailable"), expected: true},
+		"connection refused":  {err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, expected: true},
+		"connection reset":    {err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, expected: true},
+		"eof":                 {err: fmt.Errorf("get: %w", io.EOF), expected: true},
+		"unexpected eof":      {err: io.ErrUnexpectedEOF, expected: true},
+		"aggregated refused":  {err: errors.New("error when evicting pods: dial tcp 10.0.0.1:443: connect: connection refused"), expected: true},
+		"aggregated reset":    {err: errors.New("read tcp: connection reset by peer"), expected: true},
+		"goaway":              {err: errors.New("http2: server sent GOAWAY and closed the connection"), expected: true},
+		"aggregated eof":      {err: errors.New("Get \"https://api\": unexpected EOF"), expected: true},
+		"too many requests":   {err: apierrors.NewTooManyRequests("throttled", 1), expected: false},
+		"internal error":      {err: apierrors.NewInternalError(errors.New("boom")), expected: false},
+		"not found":           {err: apierrors.NewNotFound(testResource, "pod"), expected: false},
+		"other":               {err: errors.New("boom"), expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if unavailable := isAPIServerUnavailable(test.err); unavailable != test.expected {
+				t.Errorf("expected unavailable %v, got %v", test.expected, unavailable)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	retryable := apierrors.NewTooManyRequests("throttled", 1)
+	tests := map[string]struct {
+		errs             []error
+		maxRetries       int64
+		expectedErr      error
+		expectedAttempts int
+	}{
+		"success":           {errs: []error{nil}, maxRetries: 3, expectedAttempts: 1},
+		"retried":           {errs: []error{retryable, retryable, nil}, maxRetries: 3, expectedAttempts: 3},
+		"exhausted":         {errs: []error{retryable, retryable, retryable}, maxRetries: 2, expectedErr: retryable, expectedAttempts: 3},
+		"not retryable":     {errs: []error{apierrors.NewNotFound(testResource, "pod")}, maxRetries: 3, expectedErr: apierrors.NewNotFound(testResource, "pod"), expectedAttempts: 1},
+		"disruption budget": {errs: []error{disruptionBudgetError()}, maxRetries: 3, expectedErr: disruptionBudgetError(), expectedAttempts: 1},
+		"no retries":        {errs: []error{retryable}, maxRetries: 0, expectedErr: retryable, expectedAttempts: 1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			err := RetryPolicy{MaxRetries: test.maxRetries, Backoff: time.Millisecond}.Do(context.Background(), "testing", func() error {
+				err := test.errs[attempts]
+				attempts++
+				return err
+			})
+			if fmt.Sprint(err) != fmt.Sprint(test.expectedErr) {
+				t.Errorf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if attempts != test.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d", test.expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	retryable := apierrors.NewTooManyRequests("throttled", 1)
+	err := RetryPolicy{MaxRetries: 3, Backoff: time.Hour}.Do(ctx, "testing", func() error { return retryable })
+	if !errors.Is(err, context.Canceled) || !apierrors.IsTooManyRequests(err) {
+		t.Errorf("expected the context error wrapping the last error, got %v", err)
+	}
+}
+
+func TestRetryPolicyDoTolerating(t *testing.T) {
+	defer func(interval time.Duration) { controlPlaneFlapInterval = interval }(controlPlaneFlapInterval)
+	controlPlaneFlapInterval = time.Millisecond
+
+	unavailable := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	tests := map[string]struct {
+		errs             []error
+		tolerance        time.Duration
+		expectedErr      bool
+		expectedAttempts int
+	}{
+		"recovers":           {errs: []error{unavailable, unavailable, nil}, tolerance: time.Minute, expectedAttempts: 3},
+		"not tolerated":      {errs: []error{unavailable}, tolerance: 0, expectedErr: true, expectedAttempts: 1},
+		"other error":        {errs: []error{apierrors.NewNotFound(testResource, "pod")}, tolerance: time.Minute, expectedErr: true, expectedAttempts: 1},
+		"tolerance exceeded": {errs: []error{unavailable, unavailable, unavailable}, tolerance: time.Nanosecond, expectedErr: true, expectedAttempts: 1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			err := RetryPolicy{Backoff: time.Millisecond}.DoTolerating(context.Background(), "testing", test.tolerance, func() error {
+				err := test.errs[attempts]
+				attempts++
+				return err
+			})
+			if (err != nil) != test.expectedErr {
+				t.Errorf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if attempts != test.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d", test.expectedAttempts, attempts)
+			}
+		})
+	}
+}
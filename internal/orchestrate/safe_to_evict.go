@@ -0,0 +1,80 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+const (
+	// SafeToEvictAnnotation set to "false" marks the pods that the
+	// cluster autoscaler never evicts to scale down a node
+	SafeToEvictAnnotation = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+	// UnsafeToEvictSkip leaves the pods not safe to evict on the nodes
+	UnsafeToEvictSkip = "skip"
+	// UnsafeToEvictFail fails the drain of nodes running pods not safe to evict
+	UnsafeToEvictFail = "fail"
+)
+
+// unsafeToEvict reports whether pod is annotated as not safe to evict.
+func unsafeToEvict(pod v1.Pod) bool {
+	return pod.Annotations[SafeToEvictAnnotation] == "false"
+}
+
+// safeToEvictFilter skips, with a warning, or fails on the pods annotated as
+// not safe to evict, as set by UnsafeToEvict, or evicts them when not set.
+func (o DrainOptions) safeToEvictFilter(pod v1.Pod) drain.PodDeleteStatus {
+	if o.UnsafeToEvict == "" || !unsafeToEvict(pod) {
+		return drain.MakePodDeleteStatusOkay()
+	}
+	// the drain helper appends the names of the pods to the messages
+	if o.UnsafeToEvict == UnsafeToEvictFail {
+		return drain.MakePodDeleteStatusWithError("pods annotated " + SafeToEvictAnnotation + "=false")
+	}
+	return drain.MakePodDeleteStatusWithWarning(false, "leaving pods annotated "+SafeToEvictAnnotation+"=false")
+}
+
+// checkSafeToEvictByTaint fails when the rotation taint would evict pods
+// annotated as not safe to evict from nodeName. Unlike evictions, the taint
+// cannot leave them on the node, so they fail the drain even when
+// UnsafeToEvict is set to skip them.
+func (d *Drainer) checkSafeToEvictByTaint(ctx context.Context, nodeName string) error {
+	if d.Options.UnsafeToEvict == "" {
+		return nil
+	}
+
+	var unsafe []string
+	err := d.do(ctx, "listing pods on node "+nodeName, func() error {
+		pods, err := d.DrainClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+		})
+		if err != nil {
+			return err
+		}
+
+		unsafe = nil
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+				continue
+			}
+			if unsafeToEvict(pod) && d.RotationTaint.isEvicted(pod) {
+				unsafe = append(unsafe, pod.Namespace+"/"+pod.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods on node %s: %w", nodeName, err)
+	}
+
+	if len(unsafe) > 0 {
+		return fmt.Errorf("pods %s on node %s are annotated %s=false and would be evicted by the rotation taint", strings.Join(unsafe, ", "), nodeName, SafeToEvictAnnotation)
+	}
+	return nil
+}
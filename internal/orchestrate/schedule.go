@@ -0,0 +1,37 @@
+package orchestrate
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// WaitFixed pauses for the base wait after every node or batch
+	WaitFixed = "fixed"
+	// WaitLinearRampdown shrinks the pause linearly from the base wait
+	// after the first node or batch to nothing after the last one
+	WaitLinearRampdown = "linear-rampdown"
+)
+
+// WaitSchedule computes the pause after each node or batch of nodes drained,
+// giving the scheduler time to place the evicted pods.
+type WaitSchedule struct {
+	Base time.Duration
+	// Strategy is one of the Wait constants, WaitFixed when empty
+	Strategy string
+	// Jitter is the maximum random duration added to each pause
+	Jitter time.Duration
+}
+
+// after returns the pause after the step-th, starting from 0, of steps
+// nodes or batches of nodes drained.
+func (s WaitSchedule) after(step, steps int) time.Duration {
+	wait := s.Base
+	if s.Strategy == WaitLinearRampdown && steps > 1 {
+		wait = s.Base * time.Duration(steps-1-step) / time.Duration(steps-1)
+	}
+	if s.Jitter > 0 {
+		wait += rand.N(s.Jitter + 1)
+	}
+	return wait
+}
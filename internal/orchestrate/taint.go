@@ -0,0 +1,197 @@
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// RotationTaint configures the taint based eviction of the pods of a node.
+type RotationTaint struct {
+	Key   string
+	Value string
+	// TolerationSeconds is the longest tolerationSeconds of the pods
+	// tolerating the taint that are waited for to be evicted
+	TolerationSeconds int64
+}
+
+func (t RotationTaint) taint() v1.Taint {
+	return v1.Taint{Key: t.Key, Value: t.Value, Effect: v1.TaintEffectNoExecute}
+}
+
+// isEvicted reports whether pod is evicted from a node with the taint,
+// immediately or after tolerating it for at most TolerationSeconds.
+func (t RotationTaint) isEvicted(pod v1.Pod) bool {
+	taint := t.taint()
+	for _, toleration := range pod.Spec.Tolerations {
+		if toleration.ToleratesTaint(&taint) {
+			return toleration.TolerationSeconds != nil && *toleration.TolerationSeconds <= t.TolerationSeconds
+		}
+	}
+	return true
+}
+
+// drainWithTaint sets the rotation taint on nodeName and waits until ctx is
+// done for the pods evicted because of it to be gone from the node.
+func (d *Drainer) drainWithTaint(ctx context.Context, nodeName string) error {
+	if err := d.checkSafeToEvictByTaint(ctx, nodeName); err != nil {
+		return err
+	}
+	if err := d.setRotationTaint(ctx, nodeName); err != nil {
+		return err
+	}
+	if d.DryRun {
+		return nil
+	}
+
+	for {
+		remaining, err := d.podsEvictedByTaint(ctx, nodeName)
+		if err != nil {
+			return err
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for pods %s to be evicted from tainted node %s", strings.Join(remaining, ", "), nodeName))
+
+		if err := Sleep(ctx, 2*time.Second); err != nil {
+			return fmt.Errorf("pods %s were not evicted from tainted node %s: %w", strings.Join(remaining, ", "), nodeName, err)
+		}
+	}
+}
+
+// podsEvictedByTaint returns the pods on nodeName that the rotation taint
+// evicts and that are not gone yet. DaemonSet and static pods tolerate the
+// taint, or are recreated, so are ignored, as are the pods terminating for
+// longer than the SkipWaitForDeleteTimeout of the drain options.
+func (d *Drainer) podsEvictedByTaint(ctx context.Context, nodeName string) ([]string, error) {
+	var remaining []string
+	err := d.do(ctx, "listing pods on node "+nodeName, func() error {
+		pods, err := d.DrainClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+		})
+		if err != nil {
+			return err
+		}
+
+		remaining = nil
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+				continue
+			}
+			if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+				continue
+			}
+			if _, static := pod.Annotations[v1.MirrorPodAnnotationKey]; static {
+				continue
+			}
+			if d.Options.skipsDeleted(pod) {
+				continue
+			}
+			if d.RotationTaint.isEvicted(pod) {
+				remaining = append(remaining, pod.Namespace+"/"+pod.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods on node %s: %w", nodeName, err)
+	}
+
+	return remaining, nil
+}
+
+// setRotationTaint adds the rotation taint to nodeName, unless already set.
+// Only the taints added by this call are recorded to be removed on failure.
+func (d *Drainer) setRotationTaint(ctx context.Context, nodeName string) error {
+	taint := d.RotationTaint.taint()
+
+	tflog.Debug(ctx, fmt.Sprintf("tainting node %s with %s", nodeName, taint.ToString()))
+	tainted := false
+	err := d.do(ctx, "tainting node "+nodeName, func() error {
+		node, err := d.Client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for _, existing := range node.Spec.Taints {
+			if existing.MatchTaint(&taint) {
+				return nil
+			}
+		}
+
+		now := metav1.Now()
+		taint.TimeAdded = &now
+		node.Spec.Taints = append(node.Spec.Taints, taint)
+		if _, err = d.Client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		tainted = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to taint node %s: %w", nodeName, err)
+	}
+	if !tainted {
+		tflog.Debug(ctx, fmt.Sprintf("node %s was already tainted with %s", nodeName, taint.ToString()))
+		return nil
+	}
+
+	d.mu.Lock()
+	if !slices.Contains(d.taintedNodes, nodeName) {
+		d.taintedNodes = append(d.taintedNodes, nodeName)
+	}
+	d.mu.Unlock()
+
+	return nil
+}
+
+// UntaintAll removes the rotation taint from the nodes tainted by the
+// drainer, e.g. to roll back a failed drain. It tries all the nodes and
+// returns the errors of those whose taint could not be removed.
+func (d *Drainer) UntaintAll(ctx context.Context) error {
+	if d.RotationTaint == nil {
+		return nil
+	}
+	taint := d.RotationTaint.taint()
+
+	var errs []error
+	for _, nodeName := range d.taintedNodes {
+		tflog.Debug(ctx, fmt.Sprintf("removing taint %s from node %s", taint.ToString(), nodeName))
+		err := d.Retry.Do(ctx, "untainting node "+nodeName, func() error {
+			node, err := d.Client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+
+			var taints []v1.Taint
+			for _, existing := range node.Spec.Taints {
+				if !existing.MatchTaint(&taint) {
+					taints = append(taints, existing)
+				}
+			}
+			if len(taints) == len(node.Spec.Taints) {
+				return nil
+			}
+
+			node.Spec.Taints = taints
+			_, err = d.Client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+			return err
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to remove taint from node %s: %w", nodeName, err))
+		}
+	}
+	d.taintedNodes = nil
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// findUnavailableWebhooks returns the admission webhooks that intercept pod
+// evictions, reject requests when they fail and are served by a service
+// without any ready endpoint. Such webhooks make every eviction fail and
+// would stall a drain until its timeout.
+func findUnavailableWebhooks(ctx context.Context, client kubernetes.Interface) ([]string, error) {
+	var webhooks []string
+
+	validating, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list validating webhook configurations: %w", err)
+	}
+	for _, configuration := range validating.Items {
+		for _, webhook := range configuration.Webhooks {
+			unavailable, err := isUnavailableEvictionWebhook(ctx, client, webhook.FailurePolicy, webhook.Rules, webhook.ClientConfig)
+			if err != nil {
+				return nil, err
+			}
+			if unavailable {
+				webhooks = append(webhooks, fmt.Sprintf("validating webhook %s in %s", webhook.Name, configuration.Name))
+			}
+		}
+	}
+
+	mutating, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mutating webhook configurations: %w", err)
+	}
+	for _, configuration := range mutating.Items {
+		for _, webhook := range configuration.Webhooks {
+			unavailable, err := isUnavailableEvictionWebhook(ctx, client, webhook.FailurePolicy, webhook.Rules, webhook.ClientConfig)
+			if err != nil {
+				return nil, err
+			}
+			if unavailable {
+				webhooks = append(webhooks, fmt.Sprintf("mutating webhook %s in %s", webhook.Name, configuration.Name))
+			}
+		}
+	}
+
+	return webhooks, nil
+}
+
+func isUnavailableEvictionWebhook(
+	ctx context.Context,
+	client kubernetes.Interface,
+	failurePolicy *admissionregistrationv1.FailurePolicyType,
+	rules []admissionregistrationv1.RuleWithOperations,
+	clientConfig admissionregistrationv1.WebhookClientConfig,
+) (bool, error) {
+	// the default failure policy for v1 webhooks is Fail
+	if failurePolicy != nil && *failurePolicy != admissionregistrationv1.Fail {
+		return false, nil
+	}
+
+	// webhooks served by an URL cannot be checked without calling them
+	if clientConfig.Service == nil || !interceptsEvictions(rules) {
+		return false, nil
+	}
+
+	endpoints, err := client.CoreV1().Endpoints(clientConfig.Service.Namespace).Get(ctx, clientConfig.Service.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get endpoints of webhook service %s/%s: %w", clientConfig.Service.Namespace, clientConfig.Service.Name, err)
+	}
+
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// interceptsEvictions reports whether any of the rules matches the
+// creation of a pods/eviction subresource in the core API group.
+func interceptsEvictions(rules []admissionregistrationv1.RuleWithOperations) bool {
+	for _, rule := range rules {
+		if containsAny(rule.APIGroups, "", "*") &&
+			containsAny(rule.Resources, "pods/eviction", "pods/*", "*/eviction", "*/*") &&
+			containsAny(operationsAsStrings(rule.Operations), string(admissionregistrationv1.Create), string(admissionregistrationv1.OperationAll)) {
+			return true
+		}
+	}
+	return false
+}
+
+func operationsAsStrings(operations []admissionregistrationv1.OperationType) []string {
+	values := make([]string, 0, len(operations))
+	for _, operation := range operations {
+		values = append(values, string(operation))
+	}
+	return values
+}
+
+func containsAny(values []string, candidates ...string) bool {
+	for _, value := range values {
+		for _, candidate := range candidates {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func evictionWebhook(name, service string, failurePolicy admissionregistrationv1.FailurePolicyType) admissionregistrationv1.ValidatingWebhook {
+	return admissionregistrationv1.ValidatingWebhook{
+		Name:          name,
+		FailurePolicy: &failurePolicy,
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			Service: &admissionregistrationv1.ServiceReference{Namespace: "webhooks", Name: service},
+		},
+		Rules: []admissionregistrationv1.RuleWithOperations{{
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups: []string{""},
+				Resources: []string{"pods/eviction"},
+			},
+		}},
+	}
+}
+
+func TestFindUnavailableWebhooks(t *testing.T) {
+	client := newTestClient(
+		&admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "policies"},
+			Webhooks: []admissionregistrationv1.ValidatingWebhook{
+				evictionWebhook("available.example.com", "available", admissionregistrationv1.Fail),
+				evictionWebhook("unavailable.example.com", "unavailable", admissionregistrationv1.Fail),
+				evictionWebhook("missing.example.com", "missing", admissionregistrationv1.Fail),
+				evictionWebhook("ignored.example.com", "missing", admissionregistrationv1.Ignore),
+			},
+		},
+		&v1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "webhooks", Name: "available"},
+			Subsets:    []v1.EndpointSubset{{Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}}}},
+		},
+		&v1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "webhooks", Name: "unavailable"},
+			Subsets:    []v1.EndpointSubset{{NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.2"}}}},
+		},
+	)
+
+	webhooks, err := findUnavailableWebhooks(context.Background(), client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"validating webhook unavailable.example.com in policies",
+		"validating webhook missing.example.com in policies",
+	}
+	if !reflect.DeepEqual(webhooks, expected) {
+		t.Errorf("expected %v, got %v", expected, webhooks)
+	}
+}
+
+func TestInterceptsEvictions(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     admissionregistrationv1.RuleWithOperations
+		expected bool
+	}{
+		{
+			name: "eviction subresource",
+			rule: admissionregistrationv1.RuleWithOperations{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+				Rule:       admissionregistrationv1.Rule{APIGroups: []string{""}, Resources: []string{"pods/eviction"}},
+			},
+			expected: true,
+		},
+		{
+			name: "all resources and operations",
+			rule: admissionregistrationv1.RuleWithOperations{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.OperationAll},
+				Rule:       admissionregistrationv1.Rule{APIGroups: []string{"*"}, Resources: []string{"*/*"}},
+			},
+			expected: true,
+		},
+		{
+			name: "pods only",
+			rule: admissionregistrationv1.RuleWithOperations{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+				Rule:       admissionregistrationv1.Rule{APIGroups: []string{""}, Resources: []string{"pods"}},
+			},
+		},
+		{
+			name: "updates only",
+			rule: admissionregistrationv1.RuleWithOperations{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Update},
+				Rule:       admissionregistrationv1.Rule{APIGroups: []string{""}, Resources: []string{"pods/eviction"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := interceptsEvictions([]admissionregistrationv1.RuleWithOperations{test.rule}); got != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, got)
+			}
+		})
+	}
+}
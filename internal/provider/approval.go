@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	defaultApprovalPollInterval = 30 * time.Second
+	defaultApprovalTimeout      = time.Hour
+	// maxApprovalBackoff caps the backoff of the polls
+	// throttled by the approval endpoint
+	maxApprovalBackoff = 5 * time.Minute
+)
+
+// approvalStatus is the answer of the approval endpoint to a poll.
+type approvalStatus int
+
+const (
+	approvalPending approvalStatus = iota
+	approvalApproved
+	// approvalThrottled asks to poll less often
+	approvalThrottled
+)
+
+// destroyApproval gates the destroy of a node pool on an external HTTP
+// endpoint, e.g. a chat bot asking a human to approve it. The endpoint is
+// polled with GET requests, with the node pool name and the number of nodes
+// to drain in the query, and answers with:
+//   - 200 when the destroy is approved
+//   - 202 while the approval is pending
+//   - 408 or 429 when the endpoint is overloaded, the polls backing off
+//     exponentially, or for the time in the Retry-After header
+//   - any other 4xx status when the destroy is rejected, the body
+//     giving the reason
+//
+// Other statuses and network errors are retried until the timeout.
+type destroyApproval struct {
+	url          string
+	pollInterval time.Duration
+	timeout      time.Duration
+	client       *http.Client
+}
+
+// waitForApproval polls the approval endpoint until the destroy of the node
+// pool poolName, draining nodeCount nodes, is approved or rejected, or the
+// timeout of the approval is reached.
+func (a *destroyApproval) waitForApproval(ctx context.Context, poolName string, nodeCount int) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	u, err := url.Parse(a.url)
+	if err != nil {
+		return fmt.Errorf("invalid approval URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("node_pool", poolName)
+	query.Set("nodes", strconv.Itoa(nodeCount))
+	u.RawQuery = query.Encode()
+
+	client := a.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	backoff := a.pollInterval
+	for {
+		status, retryAfter, err := a.poll(ctx, client, u.String())
+		if err != nil {
+			return err
+		}
+
+		wait := a.pollInterval
+		switch status {
+		case approvalApproved:
+			return nil
+		case approvalThrottled:
+			wait = max(backoff, retryAfter)
+			backoff = min(2*backoff, maxApprovalBackoff)
+			tflog.Warn(ctx, fmt.Sprintf("the destroy approval is throttled, polling again in %s", wait))
+		default:
+			backoff = a.pollInterval
+		}
+
+		if err := orchestrate.Sleep(ctx, wait); err != nil {
+			return fmt.Errorf("the destroy was not approved by %s: %w", u.Redacted(), err)
+		}
+	}
+}
+
+// poll makes one request to the approval endpoint. It returns an error only
+// when the destroy is rejected, logging the errors to retry, and the delay of
+// the Retry-After header of throttled polls.
+func (a *destroyApproval) poll(ctx context.Context, client *http.Client, endpoint string) (approvalStatus, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return approvalPending, 0, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to poll the destroy approval: %s", err.Error()))
+		return approvalPending, 0, nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		tflog.Info(ctx, "the destroy was approved")
+		return approvalApproved, 0, nil
+	case resp.StatusCode == http.StatusAccepted:
+		tflog.Info(ctx, "waiting for the destroy to be approved")
+		return approvalPending, 0, nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests:
+		return approvalThrottled, retryAfter(resp.Header.Get("Retry-After"), time.Now()), nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		reason := strings.TrimSpace(string(body))
+		if reason == "" {
+			reason = resp.Status
+		}
+		return approvalPending, 0, fmt.Errorf("the destroy was rejected: %s", reason)
+	default:
+		tflog.Warn(ctx, fmt.Sprintf("unexpected status %s polling the destroy approval", resp.Status))
+		return approvalPending, 0, nil
+	}
+}
+
+// retryAfter returns the delay of a Retry-After header, in seconds or an
+// HTTP date, and 0 when it is not set or invalid.
+func retryAfter(header string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
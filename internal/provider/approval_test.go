@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitForApprovalRetriesThrottledPolls(t *testing.T) {
+	statuses := []int{http.StatusTooManyRequests, http.StatusRequestTimeout, http.StatusAccepted, http.StatusOK}
+	var polls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("node_pool") != "pool" || r.URL.Query().Get("nodes") != "3" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(statuses[polls.Add(1)-1])
+	}))
+	defer server.Close()
+
+	approval := &destroyApproval{url: server.URL, pollInterval: time.Millisecond, timeout: 10 * time.Second}
+	if err := approval.waitForApproval(context.Background(), "pool", 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if polls.Load() != int64(len(statuses)) {
+		t.Errorf("expected %d polls, got %d", len(statuses), polls.Load())
+	}
+}
+
+func TestWaitForApprovalRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("not during the freeze"))
+	}))
+	defer server.Close()
+
+	approval := &destroyApproval{url: server.URL, pollInterval: time.Millisecond, timeout: 10 * time.Second}
+	err := approval.waitForApproval(context.Background(), "pool", 3)
+	if err == nil || err.Error() != "the destroy was rejected: not during the freeze" {
+		t.Errorf("expected the destroy to be rejected, got %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"invalid":                       0,
+		"-1":                            0,
+		"120":                           2 * time.Minute,
+		"Mon, 01 Jan 2024 12:00:30 GMT": 30 * time.Second,
+		"Mon, 01 Jan 2024 11:00:00 GMT": 0,
+	}
+
+	for header, expected := range tests {
+		if delay := retryAfter(header, now); delay != expected {
+			t.Errorf("expected a delay of %s for %q, got %s", expected, header, delay)
+		}
+	}
+}
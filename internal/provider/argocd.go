@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultArgoCDNamespace = "argocd"
+
+	// argoCDTrackingAnnotation and argoCDInstanceLabel are set by ArgoCD
+	// on the resources of an application, depending on its tracking method
+	argoCDTrackingAnnotation = "argocd.argoproj.io/tracking-id"
+	argoCDInstanceLabel      = "app.kubernetes.io/instance"
+)
+
+var argoCDApplications = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+
+// argoCDSyncInterval is the wait between the checks of the
+// sync operations of the applications.
+var argoCDSyncInterval = 5 * time.Second
+
+// argoCDSync delays the drain of nodes while ArgoCD syncs the applications
+// running on them, so that evictions do not race with re-deployments.
+type argoCDSync struct {
+	client dynamic.Interface
+	// namespace is where the applications are, unless
+	// their tracking ID says otherwise
+	namespace string
+	// maxWait is how long a drain waits for the syncs to end
+	maxWait time.Duration
+}
+
+// argoCDApplication identifies an ArgoCD Application.
+type argoCDApplication struct {
+	namespace string
+	name      string
+}
+
+// applicationOf returns the ArgoCD application managing the resources of pod,
+// from their tracking ID or instance label, and whether there is one.
+func (s *argoCDSync) applicationOf(pod metav1.Object) (argoCDApplication, bool) {
+	if trackingID, ok := pod.GetAnnotations()[argoCDTrackingAnnotation]; ok {
+		// the tracking ID is <application>:<group>/<kind>:<namespace>/<name>
+		// with the application prefixed by its namespace, and an underscore,
+		// when applications are allowed in any namespace
+		application, _, _ := strings.Cut(trackingID, ":")
+		if namespace, name, ok := strings.Cut(application, "_"); ok {
+			return argoCDApplication{namespace: namespace, name: name}, true
+		}
+		return argoCDApplication{namespace: s.namespace, name: application}, application != ""
+	}
+
+	if name, ok := pod.GetLabels()[argoCDInstanceLabel]; ok && name != "" {
+		return argoCDApplication{namespace: s.namespace, name: name}, true
+	}
+
+	return argoCDApplication{}, false
+}
+
+// waitForSyncs waits, up to maxWait, for the ArgoCD applications of the pods
+// on nodeName to have no sync operation in progress.
+func (s *argoCDSync) waitForSyncs(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, nodeName string) error {
+	applications := map[argoCDApplication]struct{}{}
+	err := retry.Do(ctx, "listing pods on node "+nodeName, func() error {
+		pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+		})
+		if err != nil {
+			return err
+		}
+		for i := range pods.Items {
+			if application, ok := s.applicationOf(&pods.Items[i]); ok {
+				applications[application] = struct{}{}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods on node %s: %w", nodeName, err)
+	}
+	if len(applications) == 0 {
+		return nil
+	}
+
+	if s.maxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.maxWait)
+		defer cancel()
+	}
+
+	for {
+		var syncing []string
+		for application := range applications {
+			running, err := s.isSyncing(ctx, retry, application)
+			if err != nil {
+				return err
+			}
+			if running {
+				syncing = append(syncing, application.namespace+"/"+application.name)
+			}
+		}
+
+		if len(syncing) == 0 {
+			return nil
+		}
+		sort.Strings(syncing)
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for the sync of ArgoCD applications %s to end before draining node %s", strings.Join(syncing, ", "), nodeName))
+
+		if err := orchestrate.Sleep(ctx, argoCDSyncInterval); err != nil {
+			return fmt.Errorf("ArgoCD applications %s with pods on node %s were still syncing: %w", strings.Join(syncing, ", "), nodeName, err)
+		}
+	}
+}
+
+// isSyncing reports whether a sync operation of application is in progress.
+// Applications that do not exist, e.g. because the instance label was not
+// set by ArgoCD, are never syncing.
+func (s *argoCDSync) isSyncing(ctx context.Context, retry orchestrate.RetryPolicy, application argoCDApplication) (bool, error) {
+	var phase string
+	err := retry.Do(ctx, "reading ArgoCD application "+application.name, func() error {
+		obj, err := s.client.Resource(argoCDApplications).Namespace(application.namespace).Get(ctx, application.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		phase, _, err = unstructured.NestedString(obj.Object, "status", "operationState", "phase")
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read ArgoCD application %s/%s: %w", application.namespace, application.name, err)
+	}
+
+	return phase == "Running", nil
+}
@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestApplicationOf(t *testing.T) {
+	tests := map[string]struct {
+		annotations map[string]string
+		labels      map[string]string
+		expected    argoCDApplication
+		ok          bool
+	}{
+		"tracking ID": {
+			annotations: map[string]string{argoCDTrackingAnnotation: "web:apps/Deployment:default/web"},
+			expected:    argoCDApplication{namespace: "argocd", name: "web"},
+			ok:          true,
+		},
+		"tracking ID with namespace": {
+			annotations: map[string]string{argoCDTrackingAnnotation: "team_web:apps/Deployment:default/web"},
+			expected:    argoCDApplication{namespace: "team", name: "web"},
+			ok:          true,
+		},
+		"tracking ID before instance label": {
+			annotations: map[string]string{argoCDTrackingAnnotation: "web:apps/Deployment:default/web"},
+			labels:      map[string]string{argoCDInstanceLabel: "other"},
+			expected:    argoCDApplication{namespace: "argocd", name: "web"},
+			ok:          true,
+		},
+		"empty tracking ID": {
+			annotations: map[string]string{argoCDTrackingAnnotation: ""},
+			expected:    argoCDApplication{namespace: "argocd"},
+		},
+		"instance label": {
+			labels:   map[string]string{argoCDInstanceLabel: "web"},
+			expected: argoCDApplication{namespace: "argocd", name: "web"},
+			ok:       true,
+		},
+		"empty instance label": {
+			labels: map[string]string{argoCDInstanceLabel: ""},
+		},
+		"not managed": {},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &argoCDSync{namespace: "argocd"}
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations, Labels: test.labels}}
+
+			application, ok := s.applicationOf(pod)
+			if ok != test.ok || application != test.expected {
+				t.Errorf("expected application %+v (%v), got %+v (%v)", test.expected, test.ok, application, ok)
+			}
+		})
+	}
+}
+
+// newTestApplication returns the ArgoCD Application name with a sync
+// operation in phase, none when empty.
+func newTestApplication(name, phase string) *unstructured.Unstructured {
+	application := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": argoCDApplications.GroupVersion().String(),
+		"kind":       "Application",
+		"metadata":   map[string]any{"namespace": "argocd", "name": name},
+	}}
+	if phase != "" {
+		application.Object["status"] = map[string]any{"operationState": map[string]any{"phase": phase}}
+	}
+	return application
+}
+
+// newApplicationPod returns a pod on nodeName of the ArgoCD application.
+func newApplicationPod(name, nodeName, application string) *v1.Pod {
+	pod := newTestPod(name, nodeName)
+	pod.Labels = map[string]string{argoCDInstanceLabel: application}
+	return pod
+}
+
+func TestWaitForSyncs(t *testing.T) {
+	defer func(interval time.Duration) { argoCDSyncInterval = interval }(argoCDSyncInterval)
+	argoCDSyncInterval = time.Millisecond
+
+	tests := map[string]struct {
+		pods         []runtime.Object
+		applications []runtime.Object
+		// syncedAfter ends the sync operations after as many reads,
+		// never when 0
+		syncedAfter int
+		fails       bool
+	}{
+		"no applications": {
+			pods: []runtime.Object{newTestPod("web", "node-1")},
+		},
+		"not syncing": {
+			pods:         []runtime.Object{newApplicationPod("web", "node-1", "web")},
+			applications: []runtime.Object{newTestApplication("web", "Succeeded")},
+		},
+		"never synced": {
+			pods:         []runtime.Object{newApplicationPod("web", "node-1", "web")},
+			applications: []runtime.Object{newTestApplication("web", "")},
+		},
+		"application not found": {
+			pods: []runtime.Object{newApplicationPod("web", "node-1", "web")},
+		},
+		"syncing on another node": {
+			pods:         []runtime.Object{newApplicationPod("web", "node-2", "web")},
+			applications: []runtime.Object{newTestApplication("web", "Running")},
+		},
+		"sync ending": {
+			pods:         []runtime.Object{newApplicationPod("web", "node-1", "web")},
+			applications: []runtime.Object{newTestApplication("web", "Running")},
+			syncedAfter:  3,
+		},
+		"still syncing": {
+			pods:         []runtime.Object{newApplicationPod("web", "node-1", "web")},
+			applications: []runtime.Object{newTestApplication("web", "Running")},
+			fails:        true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				argoCDApplications: "ApplicationList",
+			}, test.applications...)
+			reads := 0
+			client.PrependReactor("get", "applications", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if reads++; test.syncedAfter > 0 && reads == test.syncedAfter {
+					return true, newTestApplication(action.(k8stesting.GetAction).GetName(), "Succeeded"), nil
+				}
+				return false, nil, nil
+			})
+			s := &argoCDSync{client: client, namespace: "argocd", maxWait: 50 * time.Millisecond}
+
+			err := s.waitForSyncs(context.Background(), newPodsClient(test.pods...), orchestrate.DefaultRetryPolicy(), "node-1")
+			if test.fails != (err != nil) {
+				t.Fatalf("expected failure %v, got %v", test.fails, err)
+			}
+			if test.syncedAfter > 0 && reads != test.syncedAfter {
+				t.Errorf("expected %d reads, got %d", test.syncedAfter, reads)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// asyncDestroyLabel marks the ConfigMaps recording the
+	// asynchronous destroys of node pools
+	asyncDestroyLabel = "k8snp.io/async-destroy"
+	// asyncDestroyKey is the ConfigMap key holding the destroy
+	asyncDestroyKey = "destroy"
+)
+
+// asyncDestroy records the progress of a node pool destroyed without waiting
+// for all its nodes to be drained. The nodes are drained like those of the
+// other destroys, by the destroy and then by the next creates and destroys
+// of node pools, each draining them for up to the budget.
+type asyncDestroy struct {
+	NodePoolName string `json:"node_pool_name"`
+	// Nodes are the nodes left to drain, in the drain order
+	Nodes        []string           `json:"nodes"`
+	DrainedNodes []string           `json:"drained_nodes,omitempty"`
+	Drain        asyncDrainSettings `json:"drain"`
+	StartedAt    time.Time          `json:"started_at"`
+	// ClaimedUntil is when the operation draining the nodes stops,
+	// the other operations leave the destroy alone until then
+	ClaimedUntil time.Time `json:"claimed_until"`
+}
+
+// asyncDrainSettings are the settings of the drain of the destroyed node
+// pool, kept to drain its nodes the same way once its resource is gone.
+type asyncDrainSettings struct {
+	IgnoreDaemonSets         bool          `json:"ignore_daemonsets"`
+	DeleteEmptyDirData       bool          `json:"delete_emptydir_data"`
+	Force                    bool          `json:"force"`
+	GracePeriodSeconds       int           `json:"grace_period_seconds"`
+	SkipWaitForDeleteTimeout time.Duration `json:"skip_wait_for_delete_timeout,omitempty"`
+	DisableEviction          bool          `json:"disable_eviction,omitempty"`
+	EvictionVersion          string        `json:"eviction_version,omitempty"`
+	PodSelector              string        `json:"pod_selector,omitempty"`
+	IncludeNamespaces        []string      `json:"include_namespaces,omitempty"`
+	ExcludeNamespaces        []string      `json:"exclude_namespaces,omitempty"`
+	UnsafeToEvict            string        `json:"unsafe_to_evict,omitempty"`
+	DrainTimeout             time.Duration `json:"drain_timeout,omitempty"`
+	PDBRetryInterval         time.Duration `json:"pdb_retry_interval,omitempty"`
+	DeleteDrained            bool          `json:"delete_drained,omitempty"`
+	// Budget is how long each operation drains the nodes
+	Budget time.Duration `json:"budget"`
+}
+
+// newAsyncDrainSettings returns the settings of the drains of drainer.
+func newAsyncDrainSettings(drainer *orchestrate.Drainer, budget time.Duration) asyncDrainSettings {
+	return asyncDrainSettings{
+		IgnoreDaemonSets:         drainer.Options.IgnoreDaemonSets,
+		DeleteEmptyDirData:       drainer.Options.DeleteEmptyDirData,
+		Force:                    drainer.Options.Force,
+		GracePeriodSeconds:       drainer.Options.GracePeriodSeconds,
+		SkipWaitForDeleteTimeout: drainer.Options.SkipWaitForDeleteTimeout,
+		DisableEviction:          drainer.Options.DisableEviction,
+		EvictionVersion:          drainer.Options.EvictionVersion,
+		PodSelector:              drainer.Options.PodSelector,
+		IncludeNamespaces:        drainer.Options.IncludeNamespaces,
+		ExcludeNamespaces:        drainer.Options.ExcludeNamespaces,
+		UnsafeToEvict:            drainer.Options.UnsafeToEvict,
+		DrainTimeout:             drainer.Timeout,
+		PDBRetryInterval:         drainer.PDBRetryInterval,
+		DeleteDrained:            drainer.DeleteDrained,
+		Budget:                   budget,
+	}
+}
+
+// drainer returns a drainer of the nodes of the node pool poolName
+// evicting their pods like the destroy did.
+func (s asyncDrainSettings) drainer(client kubernetes.Interface, retry orchestrate.RetryPolicy, metrics *orchestrate.Metrics, poolName string) *orchestrate.Drainer {
+	return &orchestrate.Drainer{
+		Client:      client,
+		DrainClient: orchestrate.EvictionClient{Interface: client, Version: s.EvictionVersion},
+		Retry:       retry,
+		Metrics:     metrics,
+		Timeout:     s.DrainTimeout,
+		Options: orchestrate.DrainOptions{
+			IgnoreDaemonSets:         s.IgnoreDaemonSets,
+			DeleteEmptyDirData:       s.DeleteEmptyDirData,
+			Force:                    s.Force,
+			GracePeriodSeconds:       s.GracePeriodSeconds,
+			SkipWaitForDeleteTimeout: s.SkipWaitForDeleteTimeout,
+			DisableEviction:          s.DisableEviction,
+			EvictionVersion:          s.EvictionVersion,
+			PodSelector:              s.PodSelector,
+			IncludeNamespaces:        s.IncludeNamespaces,
+			ExcludeNamespaces:        s.ExcludeNamespaces,
+			UnsafeToEvict:            s.UnsafeToEvict,
+		},
+		PDBRetryInterval: s.PDBRetryInterval,
+		DeleteDrained:    s.DeleteDrained,
+		PoolName:         poolName,
+	}
+}
+
+// configMapName returns the name of the ConfigMap recording the destroy. Node
+// pool names are hashed as they can be GKE node pool IDs.
+func (a asyncDestroy) configMapName() string {
+	sum := sha256.Sum256([]byte(a.NodePoolName))
+	return "k8snp-async-destroy-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// startAsyncDestroy records the destroy of the cordoned nodes and drains them
+// for up to async_drain_budget, leaving the nodes not drained by then to the
+// next creates and destroys of node pools.
+func (r *NodePoolResource) startAsyncDestroy(ctx context.Context, data *NodePoolResourceModel, drainer *orchestrate.Drainer, nodes []v1.Node, diags *diag.Diagnostics) {
+	// we ignore the error as the validator for the argument in the
+	// schema definition ensures its validity
+	budget, _ := time.ParseDuration(data.AsyncDrainBudget.ValueString())
+
+	now := time.Now().UTC()
+	destroy := asyncDestroy{
+		NodePoolName: data.NodePoolName.ValueString(),
+		Nodes:        nodeNames(nodes),
+		Drain:        newAsyncDrainSettings(drainer, budget),
+		StartedAt:    now,
+		ClaimedUntil: now.Add(budget),
+	}
+	configMap, err := recordAsyncDestroy(ctx, r.k8sClient, r.retry, destroy)
+	if err != nil {
+		diags.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool %s, the nodes were cordoned but the destroy could not be recorded: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+		return
+	}
+
+	diags.Append(continueAsyncDestroy(ctx, r.k8sClient, r.retry, drainer, configMap, destroy)...)
+}
+
+// resumeAsyncDestroysOnce resumes the asynchronous destroys in progress,
+// once per run by its first create or destroy of a node pool.
+func (r *NodePoolResource) resumeAsyncDestroysOnce(ctx context.Context, diags *diag.Diagnostics) {
+	// the evictions of server-side dry runs never end
+	if r.k8sClient == nil || r.dryRun || !r.asyncDestroysResumed.CompareAndSwap(false, true) {
+		return
+	}
+	diags.Append(resumeAsyncDestroys(ctx, r.k8sClient, r.retry, r.pushgatewayURL)...)
+}
+
+// resumeAsyncDestroys drains the nodes left by the recorded asynchronous
+// destroys, each for up to its budget, skipping those being drained by
+// another operation. The nodes uncordoned since are cordoned again.
+func resumeAsyncDestroys(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, pushgatewayURL string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	configMaps, err := listAsyncDestroys(ctx, client, retry)
+	if err != nil {
+		diags.AddWarning(
+			"Unable to resume node pool destroys",
+			fmt.Sprintf("Could not list the asynchronous destroys of node pools: %s", err.Error()),
+		)
+		return diags
+	}
+
+	for i := range configMaps {
+		destroy, err := decodeAsyncDestroy(configMaps[i])
+		if err != nil {
+			diags.AddWarning(
+				"Unable to resume node pool destroy",
+				fmt.Sprintf("Could not decode the asynchronous destroy recorded in ConfigMap %s/%s: %s", configMaps[i].Namespace, configMaps[i].Name, err.Error()),
+			)
+			continue
+		}
+		if time.Now().Before(destroy.ClaimedUntil) {
+			tflog.Debug(ctx, fmt.Sprintf("the asynchronous destroy of node pool %s is being resumed by another operation", destroy.NodePoolName))
+			continue
+		}
+
+		// the claim fails on a conflict when another
+		// operation claimed the destroy since it was listed
+		destroy.ClaimedUntil = time.Now().UTC().Add(destroy.Drain.Budget)
+		configMap, err := saveAsyncDestroy(ctx, client, retry, &configMaps[i], destroy)
+		if apierrors.IsConflict(err) {
+			tflog.Debug(ctx, fmt.Sprintf("the asynchronous destroy of node pool %s was resumed by another operation", destroy.NodePoolName))
+			continue
+		}
+		if err != nil {
+			diags.AddWarning(
+				"Unable to resume node pool destroy",
+				fmt.Sprintf("Could not resume the asynchronous destroy of node pool %s: %s", destroy.NodePoolName, err.Error()),
+			)
+			continue
+		}
+
+		tflog.Info(ctx, fmt.Sprintf("resuming the asynchronous destroy of node pool %s, %d nodes left to drain", destroy.NodePoolName, len(destroy.Nodes)))
+		drainer := destroy.Drain.drainer(client, retry, orchestrate.NewMetrics(pushgatewayURL, destroy.NodePoolName), destroy.NodePoolName)
+		for _, nodeName := range destroy.Nodes {
+			err := drainer.Cordon(ctx, v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}})
+			if err != nil && !apierrors.IsNotFound(err) {
+				tflog.Warn(ctx, fmt.Sprintf("failed to cordon node %s of the asynchronous destroy of node pool %s again: %s", nodeName, destroy.NodePoolName, err.Error()))
+			}
+		}
+		diags.Append(continueAsyncDestroy(ctx, client, retry, drainer, configMap, destroy)...)
+		drainer.Metrics.Push(ctx)
+	}
+
+	return diags
+}
+
+// continueAsyncDestroy drains the nodes left by destroy, recorded in
+// configMap, one at a time until its claim expires, saving its progress
+// after each node. The destroy is forgotten once all the nodes are drained.
+func continueAsyncDestroy(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, drainer *orchestrate.Drainer, configMap *v1.ConfigMap, destroy asyncDestroy) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	drainCtx, cancel := context.WithDeadline(ctx, destroy.ClaimedUntil)
+	defer cancel()
+
+	var drainErr error
+	for len(destroy.Nodes) > 0 {
+		nodeName := destroy.Nodes[0]
+
+		var node *v1.Node
+		err := retry.Do(drainCtx, "getting node "+nodeName, func() error {
+			var err error
+			node, err = client.CoreV1().Nodes().Get(drainCtx, nodeName, metav1.GetOptions{})
+			return err
+		})
+		switch {
+		case apierrors.IsNotFound(err):
+			tflog.Debug(ctx, fmt.Sprintf("node %s of node pool %s is gone", nodeName, destroy.NodePoolName))
+		case err == nil:
+			err = drainer.Drain(drainCtx, *node)
+		}
+		// the drain interrupted by the end of the budget is resumed later
+		if drainCtx.Err() != nil {
+			break
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			drainErr = fmt.Errorf("failed to drain node %s: %w", nodeName, err)
+			break
+		}
+
+		destroy.Nodes = destroy.Nodes[1:]
+		destroy.DrainedNodes = append(destroy.DrainedNodes, nodeName)
+		if len(destroy.Nodes) == 0 {
+			break
+		}
+		configMap, err = saveAsyncDestroy(ctx, client, retry, configMap, destroy)
+		if err != nil {
+			diags.AddWarning(
+				"Unable to record node pool destroy",
+				fmt.Sprintf("Could not record the progress of the asynchronous destroy of node pool %s, the nodes drained since it was last recorded are drained again when it resumes: %s", destroy.NodePoolName, err.Error()),
+			)
+			return diags
+		}
+	}
+
+	// the progress is recorded even when the operation was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	if len(destroy.Nodes) == 0 {
+		tflog.Info(ctx, fmt.Sprintf("the asynchronous destroy of node pool %s is complete", destroy.NodePoolName))
+		err := retry.Do(ctx, "forgetting the destroy of node pool "+destroy.NodePoolName, func() error {
+			return client.CoreV1().ConfigMaps(configMap.Namespace).Delete(ctx, configMap.Name, metav1.DeleteOptions{})
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			tflog.Warn(ctx, fmt.Sprintf("failed to delete ConfigMap %s/%s of the completed destroy of node pool %s: %s", configMap.Namespace, configMap.Name, destroy.NodePoolName, err.Error()))
+		}
+		return diags
+	}
+
+	// the next operation can resume the destroy right away
+	destroy.ClaimedUntil = time.Now().UTC()
+	if _, err := saveAsyncDestroy(ctx, client, retry, configMap, destroy); err != nil {
+		diags.AddWarning(
+			"Unable to record node pool destroy",
+			fmt.Sprintf("Could not record the progress of the asynchronous destroy of node pool %s, the nodes drained since it was last recorded are drained again when it resumes: %s", destroy.NodePoolName, err.Error()),
+		)
+		return diags
+	}
+
+	detail := fmt.Sprintf("The asynchronous destroy of node pool %s started at %s drained %d of its %d nodes, the drain of nodes %s resumes with the next create or destroy of a node pool.",
+		destroy.NodePoolName, destroy.StartedAt.Format(time.RFC3339), len(destroy.DrainedNodes), len(destroy.DrainedNodes)+len(destroy.Nodes), strings.Join(destroy.Nodes, ", "))
+	if drainErr != nil {
+		detail += " The drain stopped early: " + drainErr.Error()
+	}
+	diags.AddWarning("Node pool destroy in progress", detail)
+	return diags
+}
+
+// reportAsyncDestroys warns about the asynchronous destroys in progress, with
+// the pods left on their nodes and the nodes uncordoned since. It only reads
+// the cluster as it runs on refresh, the destroys are resumed by the creates
+// and destroys of node pools.
+func reportAsyncDestroys(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	configMaps, err := listAsyncDestroys(ctx, client, retry)
+	if err != nil {
+		diags.AddWarning(
+			"Unable to verify node pool destroys",
+			fmt.Sprintf("Could not list the asynchronous destroys of node pools: %s", err.Error()),
+		)
+		return diags
+	}
+
+	for _, configMap := range configMaps {
+		destroy, err := decodeAsyncDestroy(configMap)
+		if err != nil {
+			diags.AddWarning(
+				"Unable to verify node pool destroy",
+				fmt.Sprintf("Could not decode the asynchronous destroy recorded in ConfigMap %s/%s: %s", configMap.Namespace, configMap.Name, err.Error()),
+			)
+			continue
+		}
+
+		remaining, uncordoned, err := destroy.progress(ctx, client, retry)
+		if err != nil {
+			diags.AddWarning(
+				"Unable to verify node pool destroy",
+				fmt.Sprintf("Could not verify the asynchronous destroy of node pool %s: %s", destroy.NodePoolName, err.Error()),
+			)
+			continue
+		}
+
+		if len(uncordoned) > 0 {
+			diags.AddWarning(
+				"Node pool destroy reverted",
+				fmt.Sprintf("The nodes left to drain by the asynchronous destroy of node pool %s were uncordoned since and may receive new pods: %s. They are cordoned again when the destroy resumes.", destroy.NodePoolName, strings.Join(uncordoned, ", ")),
+			)
+		}
+		diags.AddWarning(
+			"Node pool destroy in progress",
+			fmt.Sprintf("The asynchronous destroy of node pool %s started at %s has %d nodes left to drain: %s. It resumes with the next create or destroy of a node pool.",
+				destroy.NodePoolName, destroy.StartedAt.Format(time.RFC3339), len(destroy.Nodes), strings.Join(remaining, ", ")),
+		)
+	}
+
+	return diags
+}
+
+// progress counts the pods left to evict on the nodes of the destroy that
+// still exist, one entry per node, and returns the nodes no longer cordoned.
+func (a asyncDestroy) progress(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy) (remaining []string, uncordoned []string, err error) {
+	drainer := a.Drain.drainer(client, retry, nil, a.NodePoolName)
+
+	for _, nodeName := range a.Nodes {
+		var node *v1.Node
+		err := retry.Do(ctx, "getting node "+nodeName, func() error {
+			var err error
+			node, err = client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+		}
+		if !node.Spec.Unschedulable {
+			uncordoned = append(uncordoned, nodeName)
+		}
+
+		count, err := drainer.CountPodsToEvict(ctx, nodeName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list pods on node %s: %w", nodeName, err)
+		}
+		remaining = append(remaining, fmt.Sprintf("%s (%d pods)", nodeName, count))
+	}
+
+	return remaining, uncordoned, nil
+}
+
+// recordAsyncDestroy creates, or replaces, the ConfigMap recording destroy.
+func recordAsyncDestroy(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, destroy asyncDestroy) (*v1.ConfigMap, error) {
+	// marshalling a struct of strings, numbers and times cannot fail
+	b, _ := json.Marshal(destroy)
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      destroy.configMapName(),
+			Namespace: metav1.NamespaceSystem,
+			Labels:    map[string]string{asyncDestroyLabel: "true"},
+		},
+		Data: map[string]string{asyncDestroyKey: string(b)},
+	}
+
+	var recorded *v1.ConfigMap
+	err := retry.Do(ctx, "recording the destroy of node pool "+destroy.NodePoolName, func() error {
+		var err error
+		recorded, err = client.CoreV1().ConfigMaps(metav1.NamespaceSystem).Create(ctx, configMap, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			recorded, err = client.CoreV1().ConfigMaps(metav1.NamespaceSystem).Update(ctx, configMap, metav1.UpdateOptions{})
+		}
+		return err
+	})
+	return recorded, err
+}
+
+// saveAsyncDestroy updates configMap with destroy. The update fails with a
+// conflict when configMap was changed since it was read.
+func saveAsyncDestroy(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, configMap *v1.ConfigMap, destroy asyncDestroy) (*v1.ConfigMap, error) {
+	// marshalling a struct of strings, numbers and times cannot fail
+	b, _ := json.Marshal(destroy)
+	updated := configMap.DeepCopy()
+	updated.Data = map[string]string{asyncDestroyKey: string(b)}
+
+	var saved *v1.ConfigMap
+	err := retry.Do(ctx, "recording the destroy of node pool "+destroy.NodePoolName, func() error {
+		var err error
+		saved, err = client.CoreV1().ConfigMaps(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		return err
+	})
+	return saved, err
+}
+
+// listAsyncDestroys returns the ConfigMaps recording asynchronous destroys.
+func listAsyncDestroys(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy) ([]v1.ConfigMap, error) {
+	var configMaps []v1.ConfigMap
+	err := retry.Do(ctx, "listing asynchronous destroys", func() error {
+		list, err := client.CoreV1().ConfigMaps(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.Set{asyncDestroyLabel: "true"}.String(),
+		})
+		if err != nil {
+			return err
+		}
+		configMaps = list.Items
+		return nil
+	})
+	return configMaps, err
+}
+
+// decodeAsyncDestroy returns the destroy recorded in configMap.
+func decodeAsyncDestroy(configMap v1.ConfigMap) (asyncDestroy, error) {
+	var destroy asyncDestroy
+	err := json.Unmarshal([]byte(configMap.Data[asyncDestroyKey]), &destroy)
+	return destroy, err
+}
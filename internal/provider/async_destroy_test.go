@@ -0,0 +1,208 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newAsyncDestroy returns the destroy of node pool pool with nodes left to
+// drain, draining them for up to budget once the claim expires.
+func newAsyncDestroy(nodes []string, claimedUntil time.Time, budget time.Duration) asyncDestroy {
+	return asyncDestroy{
+		NodePoolName: "pool",
+		Nodes:        nodes,
+		Drain: asyncDrainSettings{
+			IgnoreDaemonSets:   true,
+			DeleteEmptyDirData: true,
+			Force:              true,
+			GracePeriodSeconds: -1,
+			PDBRetryInterval:   10 * time.Millisecond,
+			Budget:             budget,
+		},
+		StartedAt:    time.Now().UTC(),
+		ClaimedUntil: claimedUntil,
+	}
+}
+
+// recordedAsyncDestroy returns the destroy recorded for node pool pool,
+// and whether there is one.
+func recordedAsyncDestroy(t *testing.T, client *fake.Clientset) (asyncDestroy, bool) {
+	t.Helper()
+
+	configMap, err := client.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(context.Background(), asyncDestroy{NodePoolName: "pool"}.configMapName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return asyncDestroy{}, false
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	destroy, err := decodeAsyncDestroy(*configMap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return destroy, true
+}
+
+func TestResumeAsyncDestroys(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	uncordoned := newTestNode("node-1", nil, true)
+	cordoned := newTestNode("node-2", nil, true)
+	cordoned.Spec.Unschedulable = true
+
+	tests := map[string]struct {
+		destroy asyncDestroy
+		// blocked pods are never evicted, as if a pod disruption
+		// budget rejected their evictions
+		blocked  []string
+		evicted  []string
+		drained  []string
+		left     []string
+		complete bool
+		warnings int
+	}{
+		"all drained": {
+			destroy:  newAsyncDestroy([]string{"node-1", "node-2", "deleted"}, expired, time.Minute),
+			evicted:  []string{"web-1", "web-2"},
+			complete: true,
+		},
+		"blocked by a disruption budget": {
+			destroy:  newAsyncDestroy([]string{"node-1", "node-2"}, expired, 100*time.Millisecond),
+			blocked:  []string{"web-2"},
+			evicted:  []string{"web-1"},
+			drained:  []string{"node-1"},
+			left:     []string{"node-2"},
+			warnings: 1,
+		},
+		"claimed by another operation": {
+			destroy: newAsyncDestroy([]string{"node-1", "node-2"}, time.Now().Add(time.Minute), time.Minute),
+			left:    []string{"node-1", "node-2"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client, evicted := newEvictionClient(func(pod string) error {
+				if containsAny(test.blocked, pod) {
+					return disruptionBudgetError()
+				}
+				return nil
+			}, uncordoned.DeepCopy(), cordoned.DeepCopy(), newTestPod("web-1", "node-1"), newTestPod("web-2", "node-2"))
+			selectPodsByNode(client)
+			if _, err := recordAsyncDestroy(ctx, client, orchestrate.DefaultRetryPolicy(), test.destroy); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			diags := resumeAsyncDestroys(ctx, client, orchestrate.DefaultRetryPolicy(), "")
+			if diags.HasError() || diags.WarningsCount() != test.warnings {
+				t.Errorf("expected %d warnings, got %v", test.warnings, diags)
+			}
+			if !reflect.DeepEqual(*evicted, test.evicted) {
+				t.Errorf("expected the pods %v to be evicted, got %v", test.evicted, *evicted)
+			}
+
+			destroy, recorded := recordedAsyncDestroy(t, client)
+			if recorded == test.complete {
+				t.Fatalf("expected the destroy to be forgotten %v once complete", test.complete)
+			}
+			if test.complete {
+				return
+			}
+			if !reflect.DeepEqual(destroy.DrainedNodes, test.drained) || !reflect.DeepEqual(destroy.Nodes, test.left) {
+				t.Errorf("expected drained nodes %v and nodes %v left, got %v and %v", test.drained, test.left, destroy.DrainedNodes, destroy.Nodes)
+			}
+
+			// the nodes of the destroys resumed are cordoned again
+			node, err := client.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resumed := len(test.drained) > 0; node.Spec.Unschedulable != resumed {
+				t.Errorf("expected node-1 to be cordoned %v", resumed)
+			}
+			if len(test.drained) > 0 && destroy.ClaimedUntil.After(time.Now()) {
+				t.Errorf("expected the claim to be released, got %s", destroy.ClaimedUntil)
+			}
+		})
+	}
+}
+
+func TestResumeAsyncDestroysOnce(t *testing.T) {
+	tests := map[string]struct {
+		dryRun bool
+		lists  int
+	}{
+		"resumed by the first operation": {lists: 1},
+		"dry run":                        {dryRun: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			lists := 0
+			client.PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				lists++
+				return false, nil, nil
+			})
+			r := &NodePoolResource{k8sClient: client, retry: orchestrate.DefaultRetryPolicy(), dryRun: test.dryRun, asyncDestroysResumed: &atomic.Bool{}}
+
+			var diags diag.Diagnostics
+			r.resumeAsyncDestroysOnce(context.Background(), &diags)
+			r.resumeAsyncDestroysOnce(context.Background(), &diags)
+			if lists != test.lists {
+				t.Errorf("expected %d lists of the destroys, got %d", test.lists, lists)
+			}
+		})
+	}
+}
+
+func TestReportAsyncDestroysDoesNotChangeCluster(t *testing.T) {
+	ctx := context.Background()
+	cordoned := newTestNode("cordoned", nil, true)
+	cordoned.Spec.Unschedulable = true
+	uncordoned := newTestNode("uncordoned", nil, true)
+	client := newPodsClient(cordoned, uncordoned, newTestPod("app", "cordoned"))
+
+	destroy := newAsyncDestroy([]string{"cordoned", "uncordoned", "deleted"}, time.Time{}, time.Minute)
+	if _, err := recordAsyncDestroy(ctx, client, orchestrate.DefaultRetryPolicy(), destroy); err != nil {
+		t.Fatalf("unexpected error recording the destroy: %v", err)
+	}
+	client.ClearActions()
+
+	diags := reportAsyncDestroys(ctx, client, orchestrate.DefaultRetryPolicy())
+	if diags.HasError() || diags.WarningsCount() != 2 {
+		t.Errorf("expected a warning for the uncordoned node and the destroy in progress, got %v", diags)
+	}
+	for _, action := range client.Actions() {
+		if verb := action.GetVerb(); verb != "get" && verb != "list" {
+			t.Errorf("expected the cluster to be only read, got %s %s", verb, action.GetResource().Resource)
+		}
+	}
+	if _, recorded := recordedAsyncDestroy(t, client); !recorded {
+		t.Errorf("expected the destroy in progress to be kept")
+	}
+}
+
+func TestReportAsyncDestroysUndecodable(t *testing.T) {
+	client := newTestClient(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: "k8snp-async-destroy-0", Labels: map[string]string{asyncDestroyLabel: "true"}},
+		Data:       map[string]string{asyncDestroyKey: "{"},
+	})
+
+	diags := reportAsyncDestroys(context.Background(), client, orchestrate.DefaultRetryPolicy())
+	if diags.HasError() || diags.WarningsCount() != 1 {
+		t.Errorf("expected a warning for the undecodable destroy, got %v", diags)
+	}
+}
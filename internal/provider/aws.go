@@ -0,0 +1,221 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsretry "github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// asgTerminate terminates the instances of the drained nodes
+	asgTerminate = "terminate"
+	// asgDetach detaches the instances of the drained nodes from their
+	// group, leaving them running
+	asgDetach = "detach"
+)
+
+// awsZoneRegionPattern matches the region at the start of the availability
+// zones, e.g. us-west-2a, and of the Local and Wavelength Zones, e.g.
+// us-west-2-lax-1a and us-east-1-wl1-bos-wlz-1.
+var awsZoneRegionPattern = regexp.MustCompile(`^[a-z]{2}(?:-[a-z]+)+-[0-9]+`)
+
+// awsZoneRegion returns the region of an availability, Local or Wavelength
+// zone and reports whether zone is one.
+func awsZoneRegion(zone string) (string, bool) {
+	region := awsZoneRegionPattern.FindString(zone)
+	return region, region != "" && region != zone
+}
+
+// awsConfigLoader loads the configuration of the AWS clients once, with the
+// first request, so that the provider configuration does not depend on the
+// credentials being available.
+type awsConfigLoader struct {
+	// accessKeyID, secretAccessKey and sessionToken are static credentials
+	// used instead of those of the default credential chain when set
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	// httpClient, when set, replaces the HTTP client of the SDK
+	httpClient aws.HTTPClient
+
+	mu  sync.Mutex
+	cfg *aws.Config
+}
+
+// load returns the configuration of the AWS clients, with the static
+// credentials or, when not set, those of the default credential chain: the
+// environment, the shared config and credentials files with their profiles,
+// SSO and credential_process, the web identity, e.g. of an EKS service
+// account, the ECS task role and the EC2 instance profile.
+func (l *awsConfigLoader) load(ctx context.Context) (aws.Config, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg == nil {
+		var options []func(*config.LoadOptions) error
+		if l.accessKeyID != "" {
+			options = append(options, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(l.accessKeyID, l.secretAccessKey, l.sessionToken)))
+		}
+		if l.httpClient != nil {
+			options = append(options, config.WithHTTPClient(l.httpClient))
+		}
+
+		cfg, err := config.LoadDefaultConfig(ctx, options...)
+		if err != nil {
+			return aws.Config{}, fmt.Errorf("failed to load the AWS configuration: %w", err)
+		}
+		l.cfg = &cfg
+	}
+	return *l.cfg, nil
+}
+
+// isAWSRetryableError reports whether err is a transient failure of an AWS
+// API, e.g. throttling or a server error, as the SDK retries them.
+func isAWSRetryableError(err error) bool {
+	return awsretry.IsErrorRetryables(awsretry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// asgInstanceRemover removes the EC2 instances of the drained nodes from
+// their auto scaling group, with the Auto Scaling API, so that the drained
+// capacity is not left running.
+type asgInstanceRemover struct {
+	config *awsConfigLoader
+	// region overrides the region of the availability
+	// zone of the provider IDs when not empty
+	region string
+	// action is asgTerminate or asgDetach
+	action string
+	// decrement decrements the desired capacity of the group
+	// so that the removed instances are not replaced
+	decrement bool
+}
+
+// newASGInstanceRemover returns a remover terminating the instances and
+// decrementing the desired capacity of their groups, authenticated with the
+// given static credentials or, when empty, with the default credential
+// chain, see awsConfigLoader.
+func newASGInstanceRemover(accessKeyID, secretAccessKey, sessionToken, region string) *asgInstanceRemover {
+	return &asgInstanceRemover{
+		config:    &awsConfigLoader{accessKeyID: accessKeyID, secretAccessKey: secretAccessKey, sessionToken: sessionToken},
+		region:    region,
+		action:    asgTerminate,
+		decrement: true,
+	}
+}
+
+// asgInstance is the auto scaling group of an instance, empty when the
+// instance is in none, and its lifecycle state in the group.
+type asgInstance struct {
+	group          string
+	lifecycleState string
+}
+
+// removing reports whether the instance is leaving its group, or has left
+// it, by being terminated or detached.
+func (i asgInstance) removing() bool {
+	return i.group == "" ||
+		strings.HasPrefix(i.lifecycleState, "Terminat") ||
+		strings.HasPrefix(i.lifecycleState, "Detach")
+}
+
+// removeInstance terminates or detaches the EC2 instance of node. Instances
+// no longer in an auto scaling group are skipped.
+func (a *asgInstanceRemover) removeInstance(ctx context.Context, retry orchestrate.RetryPolicy, node v1.Node) error {
+	scheme, id, _ := strings.Cut(node.Spec.ProviderID, "://")
+	zone, instanceID, ok := strings.Cut(strings.TrimPrefix(id, "/"), "/")
+	if scheme != "aws" || !ok || instanceID == "" {
+		return fmt.Errorf("node %s is not an EC2 instance, its provider ID is %q", node.Name, node.Spec.ProviderID)
+	}
+	region := a.region
+	if region == "" {
+		region, ok = awsZoneRegion(zone)
+		if !ok {
+			return fmt.Errorf("the region of node %s cannot be found in its availability zone %q, set the region", node.Name, zone)
+		}
+	}
+
+	cfg, err := a.config.load(ctx)
+	if err != nil {
+		return err
+	}
+	client := autoscaling.NewFromConfig(cfg, func(o *autoscaling.Options) { o.Region = region })
+
+	instance, err := a.describe(ctx, client, instanceID)
+	if err != nil {
+		return fmt.Errorf("failed to describe the instance %s of node %s: %w", instanceID, node.Name, err)
+	}
+	if instance.group == "" {
+		tflog.Debug(ctx, fmt.Sprintf("instance %s of node %s is not in an auto scaling group", instanceID, node.Name))
+		return nil
+	}
+
+	tflog.Debug(ctx, fmt.Sprintf("removing (%s) instance %s of node %s from auto scaling group %s", a.action, instanceID, node.Name, instance.group))
+	attempts := 0
+	err = retry.DoRetrying(ctx, "removing the instance of node "+node.Name, isAWSRetryableError, func() error {
+		// a failed call, e.g. timed out, may have removed the instance and
+		// calling again would decrement the desired capacity once more
+		if attempts++; attempts > 1 {
+			instance, err := a.describe(ctx, client, instanceID)
+			if err != nil {
+				return err
+			}
+			if instance.removing() {
+				tflog.Debug(ctx, fmt.Sprintf("instance %s of node %s is %s after the failed call", instanceID, node.Name, instance.lifecycleState))
+				return nil
+			}
+		}
+		return a.remove(ctx, client, instance.group, instanceID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to %s the instance %s of node %s: %w", a.action, instanceID, node.Name, err)
+	}
+	return nil
+}
+
+// describe returns the auto scaling group of instanceID and its state in it.
+func (a *asgInstanceRemover) describe(ctx context.Context, client *autoscaling.Client, instanceID string) (asgInstance, error) {
+	out, err := client.DescribeAutoScalingInstances(ctx, &autoscaling.DescribeAutoScalingInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		return asgInstance{}, err
+	}
+	if len(out.AutoScalingInstances) == 0 {
+		return asgInstance{}, nil
+	}
+	return asgInstance{
+		group:          aws.ToString(out.AutoScalingInstances[0].AutoScalingGroupName),
+		lifecycleState: aws.ToString(out.AutoScalingInstances[0].LifecycleState),
+	}, nil
+}
+
+// remove terminates or detaches instanceID from group, once, without the
+// retries of the SDK as the call is not idempotent.
+func (a *asgInstanceRemover) remove(ctx context.Context, client *autoscaling.Client, group, instanceID string) error {
+	once := func(o *autoscaling.Options) { o.Retryer = aws.NopRetryer{} }
+	if a.action == asgDetach {
+		_, err := client.DetachInstances(ctx, &autoscaling.DetachInstancesInput{
+			AutoScalingGroupName:           aws.String(group),
+			InstanceIds:                    []string{instanceID},
+			ShouldDecrementDesiredCapacity: aws.Bool(a.decrement),
+		}, once)
+		return err
+	}
+
+	_, err := client.TerminateInstanceInAutoScalingGroup(ctx, &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+		InstanceId:                     aws.String(instanceID),
+		ShouldDecrementDesiredCapacity: aws.Bool(a.decrement),
+	}, once)
+	return err
+}
@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAWSZoneRegion(t *testing.T) {
+	tests := map[string]struct {
+		zone     string
+		expected string
+		ok       bool
+	}{
+		"availability zone": {zone: "us-west-2a", expected: "us-west-2", ok: true},
+		"govcloud zone":     {zone: "us-gov-west-1b", expected: "us-gov-west-1", ok: true},
+		"local zone":        {zone: "us-west-2-lax-1a", expected: "us-west-2", ok: true},
+		"wavelength zone":   {zone: "us-east-1-wl1-bos-wlz-1", expected: "us-east-1", ok: true},
+		"region":            {zone: "us-west-2"},
+		"empty":             {zone: ""},
+		"not a zone":        {zone: "a"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			region, ok := awsZoneRegion(test.zone)
+			if ok != test.ok {
+				t.Fatalf("expected ok %t, got %t", test.ok, ok)
+			}
+			if ok && region != test.expected {
+				t.Errorf("expected region %s, got %s", test.expected, region)
+			}
+		})
+	}
+}
+
+// asgDescribeResponse is the DescribeAutoScalingInstances response
+// for an instance in group with the given lifecycle state.
+func asgDescribeResponse(group, state string) string {
+	return fmt.Sprintf("<DescribeAutoScalingInstancesResponse><DescribeAutoScalingInstancesResult><AutoScalingInstances><member><InstanceId>i-123</InstanceId><AutoScalingGroupName>%s</AutoScalingGroupName><LifecycleState>%s</LifecycleState></member></AutoScalingInstances></DescribeAutoScalingInstancesResult></DescribeAutoScalingInstancesResponse>", group, state)
+}
+
+// asgInternalFailure writes a retryable error of the Auto Scaling API.
+func asgInternalFailure(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprint(w, "<ErrorResponse><Error><Type>Receiver</Type><Code>InternalFailure</Code><Message>internal failure</Message></Error><RequestId>1</RequestId></ErrorResponse>")
+}
+
+func TestASGInstanceRemoverDefaultCredentials(t *testing.T) {
+	clearAWSEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "ENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+
+	var actions []string
+	remover := newASGInstanceRemover("", "", "", "")
+	remover.config.httpClient = newRewriteClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if host := r.Header.Get("X-Original-Host"); host != "autoscaling.us-west-2.amazonaws.com" {
+			t.Errorf("unexpected host %s", host)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ENV/") {
+			t.Errorf("expected a request signed with the environment credentials, got %q", r.Header.Get("Authorization"))
+		}
+
+		_ = r.ParseForm()
+		action := r.Form.Get("Action")
+		actions = append(actions, action)
+		if action == "DescribeAutoScalingInstances" {
+			fmt.Fprint(w, asgDescribeResponse("group", "InService"))
+		}
+	})
+
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: v1.NodeSpec{ProviderID: "aws:///us-west-2-lax-1a/i-123"}}
+	if err := remover.removeInstance(context.Background(), orchestrate.DefaultRetryPolicy(), node); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(actions, ",") != "DescribeAutoScalingInstances,TerminateInstanceInAutoScalingGroup" {
+		t.Errorf("unexpected actions %v", actions)
+	}
+}
+
+func TestASGInstanceRemoverRetry(t *testing.T) {
+	tests := map[string]struct {
+		action string
+		// state is the lifecycle state of the instance after the failed call
+		state    string
+		expected string
+	}{
+		"terminating": {
+			action:   asgTerminate,
+			state:    "Terminating",
+			expected: "DescribeAutoScalingInstances,TerminateInstanceInAutoScalingGroup,DescribeAutoScalingInstances",
+		},
+		"detaching": {
+			action:   asgDetach,
+			state:    "Detaching",
+			expected: "DescribeAutoScalingInstances,DetachInstances,DescribeAutoScalingInstances",
+		},
+		"in service": {
+			action:   asgTerminate,
+			state:    "InService",
+			expected: "DescribeAutoScalingInstances,TerminateInstanceInAutoScalingGroup,DescribeAutoScalingInstances,TerminateInstanceInAutoScalingGroup",
+		},
+		"left the group": {
+			action:   asgTerminate,
+			expected: "DescribeAutoScalingInstances,TerminateInstanceInAutoScalingGroup,DescribeAutoScalingInstances",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			clearAWSEnv(t)
+
+			var actions []string
+			removals := 0
+			remover := newASGInstanceRemover("AKID", "SECRET", "", "")
+			remover.action = test.action
+			remover.config.httpClient = newRewriteClient(t, func(w http.ResponseWriter, r *http.Request) {
+				_ = r.ParseForm()
+				action := r.Form.Get("Action")
+				actions = append(actions, action)
+				switch {
+				case action != "DescribeAutoScalingInstances":
+					// the first removal fails, e.g. times out after being applied
+					if removals++; removals == 1 {
+						asgInternalFailure(w)
+					}
+				case removals == 0:
+					fmt.Fprint(w, asgDescribeResponse("group", "InService"))
+				case test.state == "":
+					fmt.Fprint(w, "<DescribeAutoScalingInstancesResponse><DescribeAutoScalingInstancesResult><AutoScalingInstances></AutoScalingInstances></DescribeAutoScalingInstancesResult></DescribeAutoScalingInstancesResponse>")
+				default:
+					fmt.Fprint(w, asgDescribeResponse("group", test.state))
+				}
+			})
+
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: v1.NodeSpec{ProviderID: "aws:///us-west-2a/i-123"}}
+			retry := orchestrate.RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond}
+			if err := remover.removeInstance(context.Background(), retry, node); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(actions, ",") != test.expected {
+				t.Errorf("unexpected actions %v", actions)
+			}
+		})
+	}
+}
+
+func TestASGInstanceRemoverNotInGroup(t *testing.T) {
+	clearAWSEnv(t)
+
+	var actions []string
+	remover := newASGInstanceRemover("AKID", "SECRET", "", "")
+	remover.config.httpClient = newRewriteClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		actions = append(actions, r.Form.Get("Action"))
+		fmt.Fprint(w, "<DescribeAutoScalingInstancesResponse><DescribeAutoScalingInstancesResult><AutoScalingInstances></AutoScalingInstances></DescribeAutoScalingInstancesResult></DescribeAutoScalingInstancesResponse>")
+	})
+
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: v1.NodeSpec{ProviderID: "aws:///us-west-2a/i-123"}}
+	if err := remover.removeInstance(context.Background(), orchestrate.DefaultRetryPolicy(), node); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(actions, ",") != "DescribeAutoScalingInstances" {
+		t.Errorf("expected the instance to be skipped, got actions %v", actions)
+	}
+}
+
+func TestASGInstanceRemoverUnknownRegion(t *testing.T) {
+	remover := newASGInstanceRemover("AKID", "SECRET", "", "")
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: v1.NodeSpec{ProviderID: "aws:///a/i-123"}}
+	if err := remover.removeInstance(context.Background(), orchestrate.DefaultRetryPolicy(), node); err == nil {
+		t.Errorf("expected an error for a zone without region")
+	}
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// machineDeploymentNameLabel is set by Cluster API on the
+	// machines of a MachineDeployment to its name
+	machineDeploymentNameLabel = "cluster.x-k8s.io/deployment-name"
+
+	defaultMachineDeploymentNamespace = metav1.NamespaceDefault
+	defaultMachinePollInterval        = 10 * time.Second
+)
+
+var (
+	machineDeploymentResource = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machinedeployments"}
+	machineResource           = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"}
+)
+
+// clusterAPIPool is a node pool managed by a Cluster API MachineDeployment,
+// whose machines are its nodes and whose status tells the machines still
+// provisioning apart from the ready ones.
+type clusterAPIPool struct {
+	client    dynamic.Interface
+	namespace string
+	name      string
+}
+
+func (p clusterAPIPool) String() string {
+	return p.namespace + "/" + p.name
+}
+
+// nodeNames returns the names of the nodes of the machines of the
+// MachineDeployment, leaving out the machines without a node yet.
+func (p clusterAPIPool) nodeNames(ctx context.Context, retry orchestrate.RetryPolicy) ([]string, error) {
+	var machines *unstructured.UnstructuredList
+	err := retry.Do(ctx, "listing the machines of MachineDeployment "+p.String(), func() error {
+		var err error
+		machines, err = p.client.Resource(machineResource).Namespace(p.namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.Set{machineDeploymentNameLabel: p.name}.String(),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the machines of MachineDeployment %s: %w", p, err)
+	}
+
+	names := []string{}
+	for _, machine := range machines.Items {
+		if name, _, _ := unstructured.NestedString(machine.Object, "status", "nodeRef", "name"); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// waitForReadyMachines polls the status of the MachineDeployment every
+// interval until at least minReadyMachines of its machines are ready or ctx
+// is done. It returns the number of ready machines last observed.
+func (p clusterAPIPool) waitForReadyMachines(ctx context.Context, retry orchestrate.RetryPolicy, minReadyMachines int64, interval time.Duration) (int64, error) {
+	var readyMachines int64
+	for {
+		var replicas int64
+		err := retry.Do(ctx, "getting MachineDeployment "+p.String(), func() error {
+			deployment, err := p.client.Resource(machineDeploymentResource).Namespace(p.namespace).Get(ctx, p.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			replicas, _, _ = unstructured.NestedInt64(deployment.Object, "status", "replicas")
+			readyMachines, _, _ = unstructured.NestedInt64(deployment.Object, "status", "readyReplicas")
+			return nil
+		})
+		if err != nil {
+			return readyMachines, fmt.Errorf("failed to get MachineDeployment %s: %w", p, err)
+		}
+
+		if readyMachines >= minReadyMachines {
+			return readyMachines, nil
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("found %d ready machines and %d provisioning in MachineDeployment %s...waiting %s", readyMachines, replicas-readyMachines, p, interval))
+
+		if err := orchestrate.Sleep(ctx, interval); err != nil {
+			return readyMachines, err
+		}
+	}
+}
+
+// findMachineNodes restricts query, of a node pool managed by Cluster API, to
+// the nodes of the machines of its MachineDeployment. Other queries are left
+// untouched.
+func (r *NodePoolResource) findMachineNodes(ctx context.Context, query *orchestrate.NodeQuery) error {
+	if query.MachineDeployment == "" {
+		return nil
+	}
+
+	client, err := dynamic.NewForConfig(r.config)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client for Cluster API objects: %w", err)
+	}
+	namespace, name, _ := strings.Cut(query.MachineDeployment, "/")
+	query.NodeNames, err = clusterAPIPool{client: client, namespace: namespace, name: name}.nodeNames(ctx, r.retry)
+	return err
+}
+
+// waitForReadyMachines waits for minReadyMachines machines of the
+// cluster_api MachineDeployment of data to be ready, polling its status every
+// poll_interval, and then restricts query to the nodes of its machines. It
+// returns the number of ready machines last observed.
+func (r *NodePoolResource) waitForReadyMachines(ctx context.Context, data *NodePoolResourceModel, query *orchestrate.NodeQuery, minReadyMachines int64) (int64, error) {
+	client, err := dynamic.NewForConfig(r.config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create kubernetes client for Cluster API objects: %w", err)
+	}
+	pool := data.ClusterAPI.pool(client)
+
+	interval := defaultMachinePollInterval
+	if !data.PollInterval.IsNull() {
+		// we ignore the error as the validator for the argument in the
+		// schema definition will ensure its validity
+		interval, _ = time.ParseDuration(data.PollInterval.ValueString())
+	}
+
+	readyMachines, err := pool.waitForReadyMachines(ctx, r.retry, minReadyMachines, interval)
+	if err != nil {
+		return readyMachines, err
+	}
+
+	query.NodeNames, err = pool.nodeNames(ctx, r.retry)
+	return readyMachines, err
+}
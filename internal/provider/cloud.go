@@ -0,0 +1,338 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	v1 "k8s.io/api/core/v1"
+)
+
+// instanceChecker verifies whether the cloud instance backing a node exists.
+type instanceChecker interface {
+	// instanceExists reports whether the instance with the given provider ID,
+	// stripped of its scheme, exists
+	instanceExists(ctx context.Context, id string) (bool, error)
+}
+
+// instanceCheckers maps the schemes of node provider IDs, e.g. gce, to the
+// checker of the instances of that cloud.
+type instanceCheckers map[string]instanceChecker
+
+// instanceGoneChecks is how many consecutive times an instance must be
+// found missing before it is considered gone, and instanceGoneInterval the
+// wait between the checks. A single not found response is not trusted, as
+// cloud APIs are eventually consistent and a node deleted without draining
+// loses its pods.
+var (
+	instanceGoneChecks   = 3
+	instanceGoneInterval = 5 * time.Second
+)
+
+// instanceGone reports whether the cloud instance backing node no longer
+// exists, confirmed by instanceGoneChecks consecutive checks. Nodes whose
+// provider ID is not handled by a checker are never gone.
+func (c instanceCheckers) instanceGone(ctx context.Context, retry orchestrate.RetryPolicy, node v1.Node) (bool, error) {
+	scheme, id, ok := strings.Cut(node.Spec.ProviderID, "://")
+	if !ok {
+		return false, nil
+	}
+	checker, ok := c[scheme]
+	if !ok {
+		return false, nil
+	}
+
+	for i := 0; i < instanceGoneChecks; i++ {
+		if i > 0 {
+			if err := orchestrate.Sleep(ctx, instanceGoneInterval); err != nil {
+				return false, err
+			}
+		}
+
+		var exists bool
+		err := retry.Do(ctx, "checking the instance of node "+node.Name, func() error {
+			var err error
+			exists, err = checker.instanceExists(ctx, id)
+			return err
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to check the instance %s of node %s: %w", node.Spec.ProviderID, node.Name, err)
+		}
+		if exists {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// goneInstances checks the instances of the drained nodes, letting the
+// drainer delete the nodes whose instance is gone without draining them.
+type goneInstances struct {
+	checkers instanceCheckers
+	retry    orchestrate.RetryPolicy
+}
+
+func (g goneInstances) InstanceGone(ctx context.Context, node v1.Node) (bool, error) {
+	return g.checkers.instanceGone(ctx, g.retry, node)
+}
+
+// cloudAPIError is an unexpected response of a cloud API.
+type cloudAPIError struct {
+	statusCode int
+	body       string
+}
+
+func (e *cloudAPIError) Error() string {
+	return fmt.Sprintf("unexpected response %d: %s", e.statusCode, e.body)
+}
+
+// getCloudAPI sends req with client and returns the body of the response,
+// or nil when the resource does not exist.
+func getCloudAPI(ctx context.Context, client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &cloudAPIError{statusCode: resp.StatusCode, body: string(body)}
+	}
+
+	return body, nil
+}
+
+// googleCloudPlatformScope is the OAuth scope of the Google Cloud APIs.
+const googleCloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// googleClient authenticates the requests to the Google Cloud APIs with an
+// access token or, when empty, with the application default credentials,
+// found with the first request.
+type googleClient struct {
+	accessToken string
+	// base, when set, sends the requests, including those
+	// getting the tokens, instead of the default client
+	base *http.Client
+
+	mu     sync.Mutex
+	client *http.Client
+}
+
+func newGoogleClient(accessToken string) *googleClient {
+	return &googleClient{accessToken: accessToken}
+}
+
+// get returns the authenticated client. The application default credentials
+// are those of the Google Cloud SDKs: the credentials file set in
+// GOOGLE_APPLICATION_CREDENTIALS, of a service account, an authorized user or
+// an external account, e.g. of a workload identity federation, then the one
+// written by `gcloud auth application-default login` and finally the service
+// account of the GCE instance the provider runs on.
+func (g *googleClient) get(ctx context.Context) (*http.Client, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.client == nil {
+		// the tokens are refreshed with this context after the request is done
+		ctx := context.WithoutCancel(ctx)
+		if g.base != nil {
+			ctx = context.WithValue(ctx, oauth2.HTTPClient, g.base)
+		}
+
+		tokens := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: g.accessToken})
+		if g.accessToken == "" {
+			creds, err := google.FindDefaultCredentials(ctx, googleCloudPlatformScope)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find the Google application default credentials: %w", err)
+			}
+			tokens = creds.TokenSource
+		}
+		g.client = oauth2.NewClient(ctx, tokens)
+	}
+	return g.client, nil
+}
+
+// gceInstanceChecker checks the GCE instances of provider IDs of the form
+// gce://project/zone/name.
+type gceInstanceChecker struct {
+	google *googleClient
+}
+
+func newGCEInstanceChecker(accessToken string) *gceInstanceChecker {
+	return &gceInstanceChecker{google: newGoogleClient(accessToken)}
+}
+
+func (c *gceInstanceChecker) instanceExists(ctx context.Context, id string) (bool, error) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 3 {
+		return false, fmt.Errorf("%q is not a GCE instance, expected project/zone/name", id)
+	}
+
+	client, err := c.google.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://compute.googleapis.com/compute/v1/projects/%s/zones/%s/instances/%s", parts[0], parts[1], parts[2]), nil)
+	if err != nil {
+		return false, err
+	}
+	body, err := getCloudAPI(ctx, client, req)
+	return body != nil, err
+}
+
+// ec2InstanceChecker checks the EC2 instances of provider IDs of the form
+// aws:///availability-zone/instance-id.
+type ec2InstanceChecker struct {
+	config *awsConfigLoader
+	// region overrides the region of the availability
+	// zone of the provider IDs when not empty
+	region string
+}
+
+// newEC2InstanceChecker returns a checker authenticated with the given static
+// credentials or, when empty, with the default credential chain, see
+// awsConfigLoader.
+func newEC2InstanceChecker(accessKeyID, secretAccessKey, sessionToken, region string) *ec2InstanceChecker {
+	return &ec2InstanceChecker{
+		config: &awsConfigLoader{accessKeyID: accessKeyID, secretAccessKey: secretAccessKey, sessionToken: sessionToken},
+		region: region,
+	}
+}
+
+func (c *ec2InstanceChecker) instanceExists(ctx context.Context, id string) (bool, error) {
+	zone, instanceID, ok := strings.Cut(strings.TrimPrefix(id, "/"), "/")
+	if !ok || instanceID == "" {
+		return false, fmt.Errorf("%q is not an EC2 instance, expected /availability-zone/instance-id", id)
+	}
+	region := c.region
+	if region == "" {
+		region, ok = awsZoneRegion(zone)
+		if !ok {
+			return false, fmt.Errorf("the region of the EC2 instance %q cannot be found in its availability zone, set the region", id)
+		}
+	}
+
+	cfg, err := c.config.load(ctx)
+	if err != nil {
+		return false, err
+	}
+	client := ec2.NewFromConfig(cfg, func(o *ec2.Options) { o.Region = region })
+
+	out, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidInstanceID.NotFound" {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, reservation := range out.Reservations {
+		for _, instance := range reservation.Instances {
+			// terminated instances are still described for a while
+			if instance.State != nil && instance.State.Name != ec2types.InstanceStateNameShuttingDown && instance.State.Name != ec2types.InstanceStateNameTerminated {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// azureManagementScope is the OAuth scope of the Azure Resource Manager.
+const azureManagementScope = "https://management.azure.com/.default"
+
+// azureInstanceChecker checks the Azure virtual machines, including those of
+// scale sets, of provider IDs of the form azure:///subscriptions/.../name.
+type azureInstanceChecker struct {
+	client *http.Client
+	cred   azcore.TokenCredential
+}
+
+// newAzureInstanceChecker returns a checker authenticated with the client
+// secret of a service principal when set. Otherwise clientID selects the
+// workload or user-assigned managed identity and, when empty too, the
+// credentials are those of the default credential chain of the Azure SDKs:
+// the service principal in the AZURE_TENANT_ID, AZURE_CLIENT_ID and
+// AZURE_CLIENT_SECRET environment variables, the workload identity in
+// AZURE_FEDERATED_TOKEN_FILE, the managed identity of the virtual machine the
+// provider runs on and the Azure CLI.
+func newAzureInstanceChecker(tenantID, clientID, clientSecret string) (*azureInstanceChecker, error) {
+	var cred azcore.TokenCredential
+	var err error
+	switch {
+	case clientSecret != "":
+		cred, err = azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, nil)
+	case clientID != "":
+		cred, err = newAzureIdentityCredential(tenantID, clientID)
+	default:
+		cred, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{TenantID: tenantID})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the Azure credentials: %w", err)
+	}
+
+	return &azureInstanceChecker{client: http.DefaultClient, cred: cred}, nil
+}
+
+// newAzureIdentityCredential returns the credentials of the workload identity,
+// when AZURE_FEDERATED_TOKEN_FILE is set, then of the user-assigned managed
+// identity clientID. The default credential chain only takes their client ID
+// from AZURE_CLIENT_ID.
+func newAzureIdentityCredential(tenantID, clientID string) (azcore.TokenCredential, error) {
+	var chain []azcore.TokenCredential
+	if os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "" {
+		workload, err := azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{ClientID: clientID, TenantID: tenantID})
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, workload)
+	}
+
+	managed, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ID: azidentity.ClientID(clientID)})
+	if err != nil {
+		return nil, err
+	}
+	return azidentity.NewChainedTokenCredential(append(chain, managed), nil)
+}
+
+func (c *azureInstanceChecker) instanceExists(ctx context.Context, id string) (bool, error) {
+	if !strings.HasPrefix(id, "/subscriptions/") {
+		return false, fmt.Errorf("%q is not an Azure virtual machine, expected /subscriptions/...", id)
+	}
+
+	token, err := c.cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{azureManagementScope}})
+	if err != nil {
+		return false, fmt.Errorf("failed to get an Azure token: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://management.azure.com"+id+"?api-version=2023-03-01", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	body, err := getCloudAPI(ctx, c.client, req)
+	return body != nil, err
+}
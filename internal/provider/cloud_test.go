@@ -0,0 +1,315 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// rewriteTransport sends every request to server, whatever its URL, so that
+// the fixed endpoints of the cloud APIs can be served by a test server.
+type rewriteTransport struct {
+	server *httptest.Server
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(t.server.URL)
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Original-Host", req.URL.Host)
+	req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newRewriteClient(t *testing.T, handler http.HandlerFunc) *http.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &http.Client{Transport: rewriteTransport{server: server}}
+}
+
+// sequenceChecker answers the instance checks with exists in order.
+type sequenceChecker struct {
+	exists []bool
+	checks int
+}
+
+func (c *sequenceChecker) instanceExists(context.Context, string) (bool, error) {
+	exists := c.exists[c.checks]
+	c.checks++
+	return exists, nil
+}
+
+func TestInstanceGoneRequiresConsecutiveChecks(t *testing.T) {
+	defer func(interval time.Duration) { instanceGoneInterval = interval }(instanceGoneInterval)
+	instanceGoneInterval = time.Millisecond
+
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: v1.NodeSpec{ProviderID: "gce://project/zone/node-1"}}
+	tests := map[string]struct {
+		exists         []bool
+		expectedGone   bool
+		expectedChecks int
+	}{
+		"exists":              {exists: []bool{true}, expectedGone: false, expectedChecks: 1},
+		"missing once":        {exists: []bool{false, true}, expectedGone: false, expectedChecks: 2},
+		"missing then exists": {exists: []bool{false, false, true}, expectedGone: false, expectedChecks: 3},
+		"missing":             {exists: []bool{false, false, false}, expectedGone: true, expectedChecks: 3},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			checker := &sequenceChecker{exists: test.exists}
+			gone, err := instanceCheckers{"gce": checker}.instanceGone(context.Background(), orchestrate.DefaultRetryPolicy(), node)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gone != test.expectedGone {
+				t.Errorf("expected gone %v, got %v", test.expectedGone, gone)
+			}
+			if checker.checks != test.expectedChecks {
+				t.Errorf("expected %d checks, got %d", test.expectedChecks, checker.checks)
+			}
+		})
+	}
+}
+
+func TestEC2InstanceExists(t *testing.T) {
+	tests := map[string]struct {
+		status   int
+		body     string
+		expected bool
+	}{
+		"running":    {status: http.StatusOK, body: "<DescribeInstancesResponse><reservationSet><item><instancesSet><item><instanceState><name>running</name></instanceState></item></instancesSet></item></reservationSet></DescribeInstancesResponse>", expected: true},
+		"terminated": {status: http.StatusOK, body: "<DescribeInstancesResponse><reservationSet><item><instancesSet><item><instanceState><name>terminated</name></instanceState></item></instancesSet></item></reservationSet></DescribeInstancesResponse>", expected: false},
+		"not found":  {status: http.StatusBadRequest, body: "<Response><Errors><Error><Code>InvalidInstanceID.NotFound</Code></Error></Errors></Response>", expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			clearAWSEnv(t)
+
+			checker := newEC2InstanceChecker("AKID", "SECRET", "", "")
+			checker.config.httpClient = newRewriteClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if host := r.Header.Get("X-Original-Host"); host != "ec2.eu-west-1.amazonaws.com" {
+					t.Errorf("unexpected host %s", host)
+				}
+				if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+					t.Errorf("expected a signed request, got %q", r.Header.Get("Authorization"))
+				}
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, test.body)
+			})
+
+			exists, err := checker.instanceExists(context.Background(), "/eu-west-1a/i-123")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if exists != test.expected {
+				t.Errorf("expected exists %v, got %v", test.expected, exists)
+			}
+		})
+	}
+}
+
+func TestEC2InstanceExistsLocalZone(t *testing.T) {
+	clearAWSEnv(t)
+
+	checker := newEC2InstanceChecker("AKID", "SECRET", "", "")
+	checker.config.httpClient = newRewriteClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if host := r.Header.Get("X-Original-Host"); host != "ec2.us-west-2.amazonaws.com" {
+			t.Errorf("unexpected host %s", host)
+		}
+		fmt.Fprint(w, "<DescribeInstancesResponse><reservationSet><item><instancesSet><item><instanceState><name>running</name></instanceState></item></instancesSet></item></reservationSet></DescribeInstancesResponse>")
+	})
+
+	exists, err := checker.instanceExists(context.Background(), "/us-west-2-lax-1a/i-123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exists {
+		t.Errorf("expected the instance to exist")
+	}
+}
+
+func TestEC2InstanceExistsError(t *testing.T) {
+	clearAWSEnv(t)
+
+	checker := newEC2InstanceChecker("AKID", "SECRET", "", "")
+	checker.config.httpClient = newRewriteClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Response><Errors><Error><Code>UnauthorizedOperation</Code></Error></Errors></Response>")
+	})
+
+	if _, err := checker.instanceExists(context.Background(), "/eu-west-1a/i-123"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+// clearAWSEnv unsets the environment variables of the AWS credential chain.
+func clearAWSEnv(t *testing.T) {
+	t.Helper()
+
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_CA_BUNDLE"} {
+		t.Setenv(name, "")
+	}
+	// the shared files of the user running the tests are not read
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func TestGCEInstanceExists(t *testing.T) {
+	tests := map[string]struct {
+		status   int
+		expected bool
+	}{
+		"exists":    {status: http.StatusOK, expected: true},
+		"not found": {status: http.StatusNotFound, expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			checker := newGCEInstanceChecker("token")
+			checker.google.base = newRewriteClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/compute/v1/projects/project/zones/zone/instances/node-1" {
+					t.Errorf("unexpected path %s", r.URL.Path)
+				}
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("expected the access token, got %q", r.Header.Get("Authorization"))
+				}
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, "{}")
+			})
+
+			exists, err := checker.instanceExists(context.Background(), "project/zone/node-1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if exists != test.expected {
+				t.Errorf("expected exists %v, got %v", test.expected, exists)
+			}
+		})
+	}
+}
+
+func TestGoogleClientDefaultCredentials(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "credentials.json")
+	content := `{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "refresh"}`
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", file)
+
+	google := newGoogleClient("")
+	google.base = newRewriteClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Original-Host") == "oauth2.googleapis.com" {
+			if err := r.ParseForm(); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if r.Form.Get("refresh_token") != "refresh" {
+				t.Errorf("unexpected refresh token %q", r.Form.Get("refresh_token"))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token": "access", "token_type": "Bearer", "expires_in": 3600}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer access" {
+			t.Errorf("expected the token of the credentials file, got %q", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, "{}")
+	})
+
+	checker := &gceInstanceChecker{google: google}
+	exists, err := checker.instanceExists(context.Background(), "project/zone/node-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exists {
+		t.Errorf("expected the instance to exist")
+	}
+}
+
+// fakeAzureCredential returns token for the scope of the Azure Resource Manager.
+type fakeAzureCredential struct {
+	token string
+}
+
+func (c fakeAzureCredential) GetToken(_ context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if len(options.Scopes) != 1 || options.Scopes[0] != azureManagementScope {
+		return azcore.AccessToken{}, fmt.Errorf("unexpected scopes %v", options.Scopes)
+	}
+	return azcore.AccessToken{Token: c.token, ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestAzureInstanceExists(t *testing.T) {
+	id := "/subscriptions/sub/resourceGroups/group/providers/Microsoft.Compute/virtualMachines/vm"
+	tests := map[string]struct {
+		status   int
+		expected bool
+	}{
+		"exists":    {status: http.StatusOK, expected: true},
+		"not found": {status: http.StatusNotFound, expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			checker := &azureInstanceChecker{cred: fakeAzureCredential{token: "token"}, client: newRewriteClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if host := r.Header.Get("X-Original-Host"); host != "management.azure.com" || r.URL.Path != id {
+					t.Errorf("unexpected URL %s%s", host, r.URL.Path)
+				}
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("expected the token of the credentials, got %q", r.Header.Get("Authorization"))
+				}
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, "{}")
+			})}
+
+			exists, err := checker.instanceExists(context.Background(), id)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if exists != test.expected {
+				t.Errorf("expected exists %v, got %v", test.expected, exists)
+			}
+		})
+	}
+}
+
+func TestNewAzureInstanceChecker(t *testing.T) {
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+
+	tests := map[string]struct {
+		tenantID     string
+		clientID     string
+		clientSecret string
+		valid        bool
+	}{
+		"client secret":            {tenantID: "tenant", clientID: "client", clientSecret: "secret", valid: true},
+		"invalid tenant":           {tenantID: "not a tenant", clientID: "client", clientSecret: "secret", valid: false},
+		"managed identity":         {clientID: "client", valid: true},
+		"default credential chain": {valid: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := newAzureInstanceChecker(test.tenantID, test.clientID, test.clientSecret)
+			if (err == nil) != test.valid {
+				t.Errorf("expected valid %v, got error %v", test.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// The names of the diagnostics whose severity can be set with
+// diagnostic_overrides.
+const (
+	diagReadyTimeout         = "ready_timeout"
+	diagDaemonSetsTimeout    = "daemonsets_timeout"
+	diagPodsTimeout          = "pods_timeout"
+	diagCrashLoopingPods     = "crashlooping_pods"
+	diagNodePoolNotReady     = "node_pool_not_ready"
+	diagOverlappingNodePools = "overlapping_node_pools"
+	diagControlPlaneNodes    = "control_plane_nodes"
+	diagVirtualNodes         = "virtual_nodes"
+	diagExcludedNodes        = "excluded_nodes"
+)
+
+// overridableDiagnostics are the names of the diagnostics whose severity can
+// be set with diagnostic_overrides.
+var overridableDiagnostics = []string{
+	diagReadyTimeout,
+	diagDaemonSetsTimeout,
+	diagPodsTimeout,
+	diagCrashLoopingPods,
+	diagNodePoolNotReady,
+	diagOverlappingNodePools,
+	diagControlPlaneNodes,
+	diagVirtualNodes,
+	diagExcludedNodes,
+}
+
+// overridableDiagnosticNames returns the sorted names of the diagnostics
+// whose severity can be overridden.
+func overridableDiagnosticNames() []string {
+	names := append([]string(nil), overridableDiagnostics...)
+	sort.Strings(names)
+	return names
+}
+
+// namedDiagnostic is a diagnostic whose severity can be overridden, found by
+// its name rather than by its summary, which is free to change.
+type namedDiagnostic struct {
+	diag.Diagnostic
+	name string
+}
+
+// newNamedError returns an error diagnostic named name.
+func newNamedError(name, summary, detail string) diag.Diagnostic {
+	return namedDiagnostic{Diagnostic: diag.NewErrorDiagnostic(summary, detail), name: name}
+}
+
+// newNamedWarning returns a warning diagnostic named name.
+func newNamedWarning(name, summary, detail string) diag.Diagnostic {
+	return namedDiagnostic{Diagnostic: diag.NewWarningDiagnostic(summary, detail), name: name}
+}
+
+// overrideDiagnostics returns diags with the severity of the diagnostics
+// named in diagnostic_overrides replaced. The other diagnostics, and all of
+// them while diagnostic_overrides is unknown, are left untouched.
+func (m *NodePoolResourceModel) overrideDiagnostics(ctx context.Context, diags diag.Diagnostics) diag.Diagnostics {
+	if m == nil || m.DiagOverrides.IsNull() || m.DiagOverrides.IsUnknown() {
+		return diags
+	}
+
+	var overrides map[string]string
+	if d := m.DiagOverrides.ElementsAs(ctx, &overrides, false); d.HasError() {
+		return append(diags, d...)
+	}
+
+	overridden := make(diag.Diagnostics, 0, len(diags))
+	for _, d := range diags {
+		if named, ok := d.(namedDiagnostic); ok {
+			d = withSeverity(named, overrides[named.name])
+		}
+		overridden = append(overridden, d)
+	}
+	return overridden
+}
+
+// withSeverity returns d with the severity, error or warning, keeping its
+// name. d is returned as is when severity is empty.
+func withSeverity(d namedDiagnostic, severity string) diag.Diagnostic {
+	switch {
+	case severity == severityWarning && d.Severity() == diag.SeverityError:
+		return newNamedWarning(d.name, d.Summary(), d.Detail())
+	case severity == severityError && d.Severity() == diag.SeverityWarning:
+		return newNamedError(d.name, d.Summary(), d.Detail())
+	default:
+		return d
+	}
+}
@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestOverrideDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	data := &NodePoolResourceModel{DiagOverrides: types.MapValueMust(types.StringType, map[string]attr.Value{
+		diagVirtualNodes: types.StringValue(severityError),
+		diagReadyTimeout: types.StringValue(severityWarning),
+	})}
+
+	diags := diag.Diagnostics{
+		newNamedWarning(diagVirtualNodes, "Skipping virtual node", "node-1"),
+		newNamedError(diagReadyTimeout, "Error waiting for nodes to be ready", "pool"),
+		newNamedWarning(diagExcludedNodes, "Skipping excluded nodes", "node-2"),
+		// diagnostics are overridden by name, not by summary
+		diag.NewWarningDiagnostic("Skipping virtual node", "node-3"),
+	}
+
+	overridden := data.overrideDiagnostics(ctx, diags)
+	expected := []diag.Severity{diag.SeverityError, diag.SeverityWarning, diag.SeverityWarning, diag.SeverityWarning}
+	for i, d := range overridden {
+		if d.Severity() != expected[i] {
+			t.Errorf("expected diagnostic %q with detail %q to have severity %s, got %s", d.Summary(), d.Detail(), expected[i], d.Severity())
+		}
+		if d.Detail() != diags[i].Detail() {
+			t.Errorf("expected the diagnostics to keep their order, got %q at %d", d.Detail(), i)
+		}
+	}
+
+	// overridden diagnostics keep their name
+	if named, ok := overridden[0].(namedDiagnostic); !ok || named.name != diagVirtualNodes {
+		t.Errorf("expected the overridden diagnostic to keep its name, got %#v", overridden[0])
+	}
+}
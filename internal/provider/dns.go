@@ -0,0 +1,149 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultDNSNamespace  = "kube-system"
+	defaultDNSDeployment = "coredns"
+	defaultDNSService    = "kube-dns"
+	defaultDNSTimeout    = 5 * time.Minute
+	// defaultDNSProbeName is resolved with the search domains of the
+	// probe pod, whatever the domain of the cluster
+	defaultDNSProbeName  = "kubernetes.default"
+	defaultDNSProbeImage = "busybox:1.36"
+	// dnsProbeTimeout bounds each resolution by the probe pod
+	dnsProbeTimeout = time.Minute
+
+	// maxDNSCheckBackoff caps the exponential backoff between checks
+	maxDNSCheckBackoff = 30 * time.Second
+)
+
+// dnsHealthCheck verifies that the cluster DNS survives the drain: its
+// Deployment is fully available, its Service has ready endpoints and it
+// resolves names.
+type dnsHealthCheck struct {
+	client     kubernetes.Interface
+	retry      orchestrate.RetryPolicy
+	namespace  string
+	deployment string
+	service    string
+	// name is resolved with resolver, when set, once the
+	// Deployment and the Service are healthy
+	name     string
+	resolver dnsResolver
+	// timeout is how long the cluster DNS can be unhealthy
+	// before the drain fails
+	timeout time.Duration
+}
+
+// dnsResolver resolves names with the cluster DNS.
+type dnsResolver interface {
+	resolve(ctx context.Context, name string) error
+}
+
+// probeDNSResolver resolves names from a probe pod, the provider usually
+// running outside of the cluster: a Job running nslookup in the namespace of
+// the cluster DNS.
+type probeDNSResolver struct {
+	client    kubernetes.Interface
+	retry     orchestrate.RetryPolicy
+	namespace string
+	image     string
+	poolName  string
+}
+
+func (r probeDNSResolver) resolve(ctx context.Context, name string) error {
+	probe := nodeJob{
+		name:      "dns-probe",
+		namespace: r.namespace,
+		image:     r.image,
+		command:   []string{"nslookup", name},
+		timeout:   dnsProbeTimeout,
+	}
+	return runJob(ctx, r.client, r.retry, probe.name, probe.job("", r.poolName), probe.timeout, "the resolution of "+name)
+}
+
+// Check waits, with an exponential backoff and up to the timeout of the
+// check, for the cluster DNS to be healthy.
+func (check *dnsHealthCheck) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, check.timeout)
+	defer cancel()
+
+	backoff := time.Second
+	for {
+		problem, err := check.problem(ctx)
+		if err != nil {
+			return err
+		}
+		if problem == "" {
+			return nil
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for the cluster DNS to be healthy: %s", problem))
+
+		if err := orchestrate.Sleep(ctx, backoff); err != nil {
+			return fmt.Errorf("the cluster DNS is unhealthy, %s: %w", problem, err)
+		}
+		backoff = min(2*backoff, maxDNSCheckBackoff)
+	}
+}
+
+// problem describes why the cluster DNS is unhealthy, or returns an empty
+// string when it is healthy.
+func (check *dnsHealthCheck) problem(ctx context.Context) (string, error) {
+	var problem string
+	err := check.retry.Do(ctx, "checking the cluster DNS", func() error {
+		deployment, err := check.client.AppsV1().Deployments(check.namespace).Get(ctx, check.deployment, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		if deployment.Status.AvailableReplicas < replicas {
+			problem = fmt.Sprintf("Deployment %s/%s has %d of %d replicas available", check.namespace, check.deployment, deployment.Status.AvailableReplicas, replicas)
+			return nil
+		}
+
+		slices, err := check.client.DiscoveryV1().EndpointSlices(check.namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.Set{discoveryv1.LabelServiceName: check.service}.String(),
+		})
+		if err != nil {
+			return err
+		}
+		for _, slice := range slices.Items {
+			for _, endpoint := range slice.Endpoints {
+				// a nil ready condition is interpreted as ready
+				if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+					return nil
+				}
+			}
+		}
+		problem = fmt.Sprintf("Service %s/%s has no ready endpoints", check.namespace, check.service)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to check the cluster DNS: %w", err)
+	}
+	if problem != "" || check.resolver == nil {
+		return problem, nil
+	}
+
+	// failed resolutions are retried until the timeout of the check
+	if err := check.resolver.resolve(ctx, check.name); err != nil {
+		return fmt.Sprintf("%s could not be resolved: %s", check.name, err), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeDNSResolver fails the resolutions with err and records the names.
+type fakeDNSResolver struct {
+	err   error
+	names []string
+}
+
+func (r *fakeDNSResolver) resolve(_ context.Context, name string) error {
+	r.names = append(r.names, name)
+	return r.err
+}
+
+// newDNSObjects returns the Deployment of the cluster DNS, with available
+// of its 2 replicas, and the EndpointSlice of its Service, ready or not.
+func newDNSObjects(available int32, ready bool) []runtime.Object {
+	replicas := int32(2)
+	return []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: defaultDNSNamespace, Name: defaultDNSDeployment},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{AvailableReplicas: available},
+		},
+		&discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Namespace: defaultDNSNamespace, Name: "kube-dns-1", Labels: map[string]string{discoveryv1.LabelServiceName: defaultDNSService}},
+			Endpoints:  []discoveryv1.Endpoint{{Addresses: []string{"10.0.0.10"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}}},
+		},
+	}
+}
+
+func TestDNSProblem(t *testing.T) {
+	tests := map[string]struct {
+		objects  []runtime.Object
+		resolver *fakeDNSResolver
+		problem  string
+		resolved []string
+	}{
+		"healthy": {
+			objects:  newDNSObjects(2, true),
+			resolver: &fakeDNSResolver{},
+			resolved: []string{"kubernetes.default"},
+		},
+		"without resolver": {
+			objects: newDNSObjects(2, true),
+		},
+		"resolution failed": {
+			objects:  newDNSObjects(2, true),
+			resolver: &fakeDNSResolver{err: errors.New("NXDOMAIN")},
+			problem:  "kubernetes.default could not be resolved: NXDOMAIN",
+			resolved: []string{"kubernetes.default"},
+		},
+		"unavailable replicas": {
+			objects:  newDNSObjects(1, true),
+			resolver: &fakeDNSResolver{},
+			problem:  "Deployment kube-system/coredns has 1 of 2 replicas available",
+		},
+		"no ready endpoints": {
+			objects:  newDNSObjects(2, false),
+			resolver: &fakeDNSResolver{},
+			problem:  "Service kube-system/kube-dns has no ready endpoints",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			check := &dnsHealthCheck{client: newTestClient(test.objects...), retry: orchestrate.DefaultRetryPolicy(), namespace: defaultDNSNamespace, deployment: defaultDNSDeployment, service: defaultDNSService, name: defaultDNSProbeName, timeout: time.Minute}
+			if test.resolver != nil {
+				check.resolver = test.resolver
+			}
+
+			problem, err := check.problem(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if problem != test.problem {
+				t.Errorf("expected problem %q, got %q", test.problem, problem)
+			}
+			if test.resolver != nil && !reflect.DeepEqual(test.resolver.names, test.resolved) {
+				t.Errorf("expected resolved names %v, got %v", test.resolved, test.resolver.names)
+			}
+		})
+	}
+}
+
+func TestDNSHealthCheck(t *testing.T) {
+	tests := map[string]struct {
+		resolver *fakeDNSResolver
+		fails    bool
+	}{
+		"resolved":   {resolver: &fakeDNSResolver{}},
+		"unresolved": {resolver: &fakeDNSResolver{err: errors.New("NXDOMAIN")}, fails: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			check := &dnsHealthCheck{client: newTestClient(newDNSObjects(2, true)...), retry: orchestrate.DefaultRetryPolicy(), namespace: defaultDNSNamespace, deployment: defaultDNSDeployment, service: defaultDNSService, name: defaultDNSProbeName, resolver: test.resolver, timeout: 50 * time.Millisecond}
+
+			err := check.Check(context.Background())
+			if test.fails != (err != nil) {
+				t.Fatalf("expected failure %v, got %v", test.fails, err)
+			}
+			if test.fails && !strings.Contains(err.Error(), "kubernetes.default could not be resolved") {
+				t.Errorf("expected the resolution to be reported, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProbeDNSResolver(t *testing.T) {
+	defer func(interval time.Duration) { jobInterval = interval }(jobInterval)
+	jobInterval = time.Millisecond
+
+	tests := map[string]struct {
+		status batchv1.JobStatus
+		fails  bool
+	}{
+		"resolved":   {status: batchv1.JobStatus{Succeeded: 1}},
+		"unresolved": {status: batchv1.JobStatus{Failed: 1}, fails: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			var created *batchv1.Job
+			client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				created = action.(k8stesting.CreateAction).GetObject().(*batchv1.Job).DeepCopy()
+				created.Name = "probe"
+				created.Status = test.status
+				return true, created, client.Tracker().Add(created)
+			})
+
+			resolver := probeDNSResolver{client: client, retry: orchestrate.DefaultRetryPolicy(), namespace: defaultDNSNamespace, image: defaultDNSProbeImage, poolName: "pool"}
+			err := resolver.resolve(context.Background(), "kubernetes.default")
+			if test.fails != (err != nil) {
+				t.Fatalf("expected failure %v, got %v", test.fails, err)
+			}
+
+			container := created.Spec.Template.Spec.Containers[0]
+			if created.Namespace != defaultDNSNamespace || container.Image != defaultDNSProbeImage || !reflect.DeepEqual(container.Command, []string{"nslookup", "kubernetes.default"}) {
+				t.Errorf("unexpected probe job %+v", created)
+			}
+			if _, ok := created.Annotations["k8snp.io/node"]; ok || len(container.Env) != 0 {
+				t.Errorf("expected a probe job for no node, got %+v", created)
+			}
+			if _, err := client.BatchV1().Jobs(defaultDNSNamespace).Get(context.Background(), "probe", metav1.GetOptions{}); err == nil {
+				t.Errorf("expected the probe job to be deleted")
+			}
+		})
+	}
+}
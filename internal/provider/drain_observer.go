@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// drainObserver reports the progress of the drain of a node pool to the event
+// stream, the notification webhook and the Events of the nodes, each of them
+// optional.
+type drainObserver struct {
+	poolName   string
+	events     *eventStream
+	notifier   *rotationNotifier
+	nodeEvents *nodeEventRecorder
+}
+
+func (o *drainObserver) NodeCordoned(ctx context.Context, node v1.Node) {
+	o.nodeEvents.record(ctx, node, reasonCordoned, "Node cordoned to destroy node pool "+o.poolName)
+}
+
+func (o *drainObserver) NodeDrainStarted(ctx context.Context, node v1.Node) {
+	o.nodeEvents.record(ctx, node, reasonDrainStarted, "Draining node to destroy node pool "+o.poolName)
+}
+
+func (o *drainObserver) PodEvicted(ctx context.Context, node v1.Node, pod *v1.Pod) {
+	o.events.emit(ctx, event{Type: eventPodEvicted, Node: node.Name, Pod: pod.Namespace + "/" + pod.Name})
+}
+
+func (o *drainObserver) NodeDrained(ctx context.Context, node v1.Node, took time.Duration) {
+	o.events.emit(ctx, event{Type: eventNodeDrained, Node: node.Name})
+	o.notifier.nodeDrained(ctx, node.Name, took)
+	o.nodeEvents.record(ctx, node, reasonDrainCompleted, "Node drained to destroy node pool "+o.poolName)
+}
+
+func (o *drainObserver) NodeDeleted(ctx context.Context, node v1.Node, reason string) {
+	o.events.emit(ctx, event{Type: eventNodeDrained, Node: node.Name, Message: reason})
+}
+
+func (o *drainObserver) NodeDrainFailed(ctx context.Context, node v1.Node, err error) {
+	o.events.failure(ctx, node.Name, err)
+}
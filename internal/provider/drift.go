@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// plannedNodesKey is the private state key holding the nodes
+// of the pool listed when the destroy was planned.
+const plannedNodesKey = "planned_nodes"
+
+// nodeNames returns the names of nodes.
+func nodeNames(nodes []v1.Node) []string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+// diffNodeSets returns the nodes that were added to and removed from the
+// pool since the planned nodes were listed, sorted by name.
+func diffNodeSets(planned []string, nodes []v1.Node) ([]string, []string) {
+	current := nodeNames(nodes)
+
+	var added, removed []string
+	for _, name := range current {
+		if !containsAny(planned, name) {
+			added = append(added, name)
+		}
+	}
+	for _, name := range planned {
+		if !containsAny(current, name) {
+			removed = append(removed, name)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
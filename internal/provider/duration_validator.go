@@ -57,7 +57,7 @@ func (v durationValidator) ValidateString(_ context.Context, request validator.S
 			diag.NewAttributeErrorDiagnostic(
 				request.Path,
 				"Invalid Attribute Format",
-				fmt.Sprintf("Attribute %s is greater than maximum allowed duration %s, got: %s", request.Path, v.minDuration.String(), value),
+				fmt.Sprintf("Attribute %s is greater than maximum allowed duration %s, got: %s", request.Path, v.maxDuration.String(), value),
 			),
 		)
 		return
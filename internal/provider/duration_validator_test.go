@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// validateString runs v on value and returns its diagnostics.
+func validateString(v validator.String, value string) diag.Diagnostics {
+	response := &validator.StringResponse{}
+	v.ValidateString(context.Background(), validator.StringRequest{Path: path.Root("test"), ConfigValue: types.StringValue(value)}, response)
+	return response.Diagnostics
+}
+
+func FuzzMinDuration(f *testing.F) {
+	for _, seed := range []string{"1m", "59s", "1h30m", "-1s", "0", "", "1", "1.5m", "9223372036854775807ns", "1e3s", "µs"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		diags := validateString(MinDuration(time.Minute), value)
+
+		parsed, err := time.ParseDuration(value)
+		if expected := err != nil || parsed < time.Minute; diags.HasError() != expected {
+			t.Errorf("expected an error %v for %q, got %v", expected, value, diags)
+		}
+	})
+}
+
+func FuzzMaxDuration(f *testing.F) {
+	for _, seed := range []string{"1h", "61m", "0s", "-1h", "", "1", "2562047h47m16.854775807s", "1e3s"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		diags := validateString(MaxDuration(time.Hour), value)
+
+		parsed, err := time.ParseDuration(value)
+		if expected := err != nil || parsed > time.Hour; diags.HasError() != expected {
+			t.Errorf("expected an error %v for %q, got %v", expected, value, diags)
+		}
+	})
+}
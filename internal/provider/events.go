@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	eventPhase       = "phase"
+	eventNodeDrained = "node_drained"
+	eventPodEvicted  = "pod_evicted"
+	eventError       = "error"
+
+	phaseFailed    = "failed"
+	phaseCompleted = "completed"
+)
+
+// eventStreamMu serializes the writes of the node pools to the event
+// stream file, as they are created and destroyed concurrently.
+var eventStreamMu sync.Mutex
+
+// eventStream appends the events of the operations on a node pool to a
+// file as JSON lines, so that they can be followed by external tools.
+type eventStream struct {
+	path         string
+	nodePoolName string
+}
+
+// event is a line of the event stream.
+type event struct {
+	Time     time.Time `json:"time"`
+	NodePool string    `json:"node_pool"`
+	Type     string    `json:"type"`
+	Phase    string    `json:"phase,omitempty"`
+	Node     string    `json:"node,omitempty"`
+	Pod      string    `json:"pod,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
+
+func newEventStream(path, nodePoolName string) *eventStream {
+	return &eventStream{path: path, nodePoolName: nodePoolName}
+}
+
+// phase records the transition of the operation to a new phase.
+func (s *eventStream) phase(ctx context.Context, phase string) {
+	s.emit(ctx, event{Type: eventPhase, Phase: phase})
+}
+
+// failure records an error of the operation, on node when not empty.
+func (s *eventStream) failure(ctx context.Context, node string, err error) {
+	s.emit(ctx, event{Type: eventError, Node: node, Message: err.Error()})
+}
+
+// finish records the errors in diags, if any, and the end of the operation.
+func (s *eventStream) finish(ctx context.Context, diags *diag.Diagnostics) {
+	if !diags.HasError() {
+		s.phase(ctx, phaseCompleted)
+		return
+	}
+
+	for _, d := range diags.Errors() {
+		s.emit(ctx, event{Type: eventError, Message: d.Detail()})
+	}
+	s.phase(ctx, phaseFailed)
+}
+
+// emit appends e to the file. The file is opened for each event so that it
+// can be rotated, and failures are only logged as events must never fail
+// an operation.
+func (s *eventStream) emit(ctx context.Context, e event) {
+	if s == nil || s.path == "" {
+		return
+	}
+
+	e.Time = time.Now().UTC()
+	e.NodePool = s.nodePoolName
+	// marshalling a struct of strings and times cannot fail
+	line, _ := json.Marshal(e)
+
+	eventStreamMu.Lock()
+	defer eventStreamMu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to open event stream %s: %s", s.path, err.Error()))
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to write to event stream %s: %s", s.path, err.Error()))
+	}
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// failureDumpTimeout bounds the collection of a failure dump, which
+// happens after the operation may already have timed out.
+const failureDumpTimeout = time.Minute
+
+// failureDump is a snapshot of the nodes of a pool taken when waiting for
+// them to be ready or draining them fails, for post-mortems.
+type failureDump struct {
+	Time     time.Time `json:"time"`
+	NodePool string    `json:"node_pool"`
+	Selector string    `json:"selector"`
+	Error    string    `json:"error"`
+	Nodes    []v1.Node `json:"nodes"`
+	// Events are the recent events of the nodes
+	Events []v1.Event `json:"events"`
+	// PendingEvictions are the pods still to be evicted
+	// from the nodes that were not drained
+	PendingEvictions []v1.Pod `json:"pending_evictions,omitempty"`
+}
+
+// collectFailureDump takes a snapshot of the nodes matching query, their
+// events and the pods still running on the undrained nodes. Snapshot parts
+// that cannot be read are logged and left out, as the operation already failed.
+func collectFailureDump(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, nodePoolName string, query orchestrate.NodeQuery, cause string, undrained []string) failureDump {
+	// the snapshot is mostly needed when the operation timed out
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), failureDumpTimeout)
+	defer cancel()
+
+	dump := failureDump{
+		Time:     time.Now().UTC(),
+		NodePool: nodePoolName,
+		Selector: query.String(),
+		Error:    cause,
+	}
+
+	nodes, err := orchestrate.ListNodes(ctx, client, retry, query)
+	if err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to collect the nodes of node pool %s after the failure: %s", nodePoolName, err.Error()))
+	}
+	dump.Nodes = nodes
+
+	for _, node := range nodes {
+		err := retry.Do(ctx, "listing events of node "+node.Name, func() error {
+			events, err := client.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+				FieldSelector: fields.SelectorFromSet(fields.Set{"involvedObject.kind": "Node", "involvedObject.name": node.Name}).String(),
+			})
+			if err != nil {
+				return err
+			}
+			dump.Events = append(dump.Events, events.Items...)
+			return nil
+		})
+		if err != nil {
+			tflog.Warn(ctx, fmt.Sprintf("failed to collect the events of node %s after the failure: %s", node.Name, err.Error()))
+		}
+	}
+
+	for _, nodeName := range undrained {
+		err := retry.Do(ctx, "listing pods on node "+nodeName, func() error {
+			pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+				FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+			})
+			if err != nil {
+				return err
+			}
+			for _, pod := range pods.Items {
+				if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+					continue
+				}
+				if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+					continue
+				}
+				dump.PendingEvictions = append(dump.PendingEvictions, pod)
+			}
+			return nil
+		})
+		if err != nil {
+			tflog.Warn(ctx, fmt.Sprintf("failed to collect the pods on node %s after the failure: %s", nodeName, err.Error()))
+		}
+	}
+
+	return dump
+}
+
+// report logs the dump and, when path is not empty, writes it to path as JSON.
+func (d failureDump) report(ctx context.Context, path string) {
+	// marshalling kubernetes objects cannot fail
+	b, _ := json.MarshalIndent(d, "", "  ")
+
+	tflog.Info(ctx, fmt.Sprintf("collected %d nodes, %d events and %d pods pending eviction after the failure of node pool %s", len(d.Nodes), len(d.Events), len(d.PendingEvictions), d.NodePool))
+	tflog.Debug(ctx, "failure dump of node pool "+d.NodePool, map[string]interface{}{"dump": string(b)})
+
+	if path == "" {
+		return
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to write the failure dump of node pool %s to %s: %s", d.NodePool, path, err.Error()))
+	}
+}
+
+// diagnosticsDetail joins the details of the errors in diags.
+func diagnosticsDetail(diags diag.Diagnostics) string {
+	var details []string
+	for _, d := range diags.Errors() {
+		details = append(details, d.Detail())
+	}
+	return strings.Join(details, "\n")
+}
@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+type fieldSelectorValidator struct{}
+
+func (v fieldSelectorValidator) Description(_ context.Context) string {
+	return "string must be a valid kubernetes field selector, e.g. spec.unschedulable=false"
+}
+
+func (v fieldSelectorValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v fieldSelectorValidator) ValidateString(_ context.Context, request validator.StringRequest, response *validator.StringResponse) {
+	if request.ConfigValue.IsNull() || request.ConfigValue.IsUnknown() {
+		return
+	}
+
+	value := request.ConfigValue.ValueString()
+	if _, err := fields.ParseSelector(value); err != nil {
+		response.Diagnostics.Append(
+			diag.NewAttributeErrorDiagnostic(
+				request.Path,
+				"Invalid Attribute Format",
+				fmt.Sprintf("Attribute %s is not a valid field selector, got: %s: %s", request.Path, value, err.Error()),
+			),
+		)
+	}
+}
+
+// FieldSelector returns a validator which ensures that any configured
+// attribute value is a valid kubernetes field selector.
+func FieldSelector() validator.String {
+	return fieldSelectorValidator{}
+}
@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	fluxKindKustomization = "Kustomization"
+	fluxKindHelmRelease   = "HelmRelease"
+)
+
+// fluxResources maps the kinds of the Flux objects that can be
+// suspended to their resource.
+var fluxResources = map[string]schema.GroupVersionResource{
+	fluxKindKustomization: {Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Resource: "kustomizations"},
+	fluxKindHelmRelease:   {Group: "helm.toolkit.fluxcd.io", Version: "v2", Resource: "helmreleases"},
+}
+
+// suspendedByAnnotation is set on the Flux objects suspended during a
+// drain to the name of the node pool being drained.
+const suspendedByAnnotation = "k8snp.io/suspended-by"
+
+// fluxObject identifies a Flux Kustomization or HelmRelease.
+type fluxObject struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (o fluxObject) String() string {
+	return fmt.Sprintf("%s %s/%s", o.kind, o.namespace, o.name)
+}
+
+// suspendFlux suspends the reconciliation of objects, so that Flux does not
+// fight the placement of the pods evicted by the drain of nodePoolName. It
+// returns the objects it suspended, leaving out those already suspended,
+// which must not be resumed after the drain.
+func suspendFlux(ctx context.Context, client dynamic.Interface, retry orchestrate.RetryPolicy, nodePoolName string, objects []fluxObject) ([]fluxObject, error) {
+	var suspended []fluxObject
+	for _, object := range objects {
+		resource := client.Resource(fluxResources[object.kind]).Namespace(object.namespace)
+
+		var alreadySuspended bool
+		err := retry.Do(ctx, "reading "+object.String(), func() error {
+			obj, err := resource.Get(ctx, object.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			alreadySuspended, _, err = unstructured.NestedBool(obj.Object, "spec", "suspend")
+			return err
+		})
+		if err != nil {
+			return suspended, fmt.Errorf("failed to read %s: %w", object, err)
+		}
+		if alreadySuspended {
+			tflog.Debug(ctx, fmt.Sprintf("%s is already suspended", object))
+			continue
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("suspending %s", object))
+		patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}},"spec":{"suspend":true}}`, suspendedByAnnotation, nodePoolName))
+		err = retry.Do(ctx, "suspending "+object.String(), func() error {
+			_, err := resource.Patch(ctx, object.name, types.MergePatchType, patch, metav1.PatchOptions{})
+			return err
+		})
+		if err != nil {
+			return suspended, fmt.Errorf("failed to suspend %s: %w", object, err)
+		}
+		suspended = append(suspended, object)
+	}
+
+	return suspended, nil
+}
+
+// resumeFlux resumes the reconciliation of the objects suspended by
+// suspendFlux. It tries all the objects and returns the errors of those
+// that could not be resumed.
+func resumeFlux(ctx context.Context, client dynamic.Interface, retry orchestrate.RetryPolicy, objects []fluxObject) error {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:null}},"spec":{"suspend":false}}`, suspendedByAnnotation))
+
+	var errs []error
+	for _, object := range objects {
+		tflog.Debug(ctx, fmt.Sprintf("resuming %s", object))
+		err := retry.Do(ctx, "resuming "+object.String(), func() error {
+			_, err := client.Resource(fluxResources[object.kind]).Namespace(object.namespace).Patch(ctx, object.name, types.MergePatchType, patch, metav1.PatchOptions{})
+			return err
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to resume %s: %w", object, err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
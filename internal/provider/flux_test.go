@@ -0,0 +1,210 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestFluxObject(kind, name string, suspended bool) *unstructured.Unstructured {
+	resource := fluxResources[kind]
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": resource.GroupVersion().String(),
+		"kind":       kind,
+		"metadata":   map[string]any{"namespace": "flux-system", "name": name},
+		"spec":       map[string]any{"suspend": suspended},
+	}}
+}
+
+func newFluxClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		fluxResources[fluxKindKustomization]: "KustomizationList",
+		fluxResources[fluxKindHelmRelease]:   "HelmReleaseList",
+	}, objects...)
+}
+
+// fluxState returns whether object is suspended and the node pool
+// that suspended it, if any.
+func fluxState(t *testing.T, client *dynamicfake.FakeDynamicClient, object fluxObject) (bool, string) {
+	t.Helper()
+
+	obj, err := client.Resource(fluxResources[object.kind]).Namespace(object.namespace).Get(context.Background(), object.name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	suspended, _, _ := unstructured.NestedBool(obj.Object, "spec", "suspend")
+	return suspended, obj.GetAnnotations()[suspendedByAnnotation]
+}
+
+func TestSuspendFlux(t *testing.T) {
+	ctx := context.Background()
+	apps := fluxObject{kind: fluxKindKustomization, namespace: "flux-system", name: "apps"}
+	ingress := fluxObject{kind: fluxKindHelmRelease, namespace: "flux-system", name: "ingress"}
+	paused := fluxObject{kind: fluxKindKustomization, namespace: "flux-system", name: "paused"}
+	client := newFluxClient(
+		newTestFluxObject(fluxKindKustomization, "apps", false),
+		newTestFluxObject(fluxKindHelmRelease, "ingress", false),
+		newTestFluxObject(fluxKindKustomization, "paused", true),
+	)
+
+	suspended, err := suspendFlux(ctx, client, orchestrate.DefaultRetryPolicy(), "pool", []fluxObject{apps, ingress, paused})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(suspended, []fluxObject{apps, ingress}) {
+		t.Errorf("expected the objects not already suspended to be suspended, got %v", suspended)
+	}
+	for _, object := range []fluxObject{apps, ingress} {
+		if isSuspended, by := fluxState(t, client, object); !isSuspended || by != "pool" {
+			t.Errorf("expected %s to be suspended by the node pool, got suspended %v by %q", object, isSuspended, by)
+		}
+	}
+	if _, by := fluxState(t, client, paused); by != "" {
+		t.Errorf("expected %s already suspended to be left alone, got suspended by %q", paused, by)
+	}
+
+	// the drain fails, the objects suspended are resumed anyway
+	if err := resumeFlux(ctx, client, orchestrate.DefaultRetryPolicy(), suspended); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, object := range []fluxObject{apps, ingress} {
+		if isSuspended, by := fluxState(t, client, object); isSuspended || by != "" {
+			t.Errorf("expected %s to be resumed, got suspended %v by %q", object, isSuspended, by)
+		}
+	}
+	if isSuspended, _ := fluxState(t, client, paused); !isSuspended {
+		t.Errorf("expected %s suspended before the drain to stay suspended", paused)
+	}
+}
+
+func TestSuspendFluxPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	apps := fluxObject{kind: fluxKindKustomization, namespace: "flux-system", name: "apps"}
+	missing := fluxObject{kind: fluxKindKustomization, namespace: "flux-system", name: "missing"}
+	ingress := fluxObject{kind: fluxKindHelmRelease, namespace: "flux-system", name: "ingress"}
+	client := newFluxClient(
+		newTestFluxObject(fluxKindKustomization, "apps", false),
+		newTestFluxObject(fluxKindHelmRelease, "ingress", false),
+	)
+
+	suspended, err := suspendFlux(ctx, client, orchestrate.DefaultRetryPolicy(), "pool", []fluxObject{apps, missing, ingress})
+	if err == nil {
+		t.Fatalf("expected an error for the missing object")
+	}
+	if !reflect.DeepEqual(suspended, []fluxObject{apps}) {
+		t.Fatalf("expected the objects suspended before the failure, got %v", suspended)
+	}
+
+	if err := resumeFlux(ctx, client, orchestrate.DefaultRetryPolicy(), suspended); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if isSuspended, _ := fluxState(t, client, apps); isSuspended {
+		t.Errorf("expected %s to be resumed", apps)
+	}
+	if isSuspended, _ := fluxState(t, client, ingress); isSuspended {
+		t.Errorf("expected %s never suspended to be left alone", ingress)
+	}
+}
+
+func TestResumeFluxErrors(t *testing.T) {
+	ctx := context.Background()
+	apps := fluxObject{kind: fluxKindKustomization, namespace: "flux-system", name: "apps"}
+	deleted := fluxObject{kind: fluxKindKustomization, namespace: "flux-system", name: "deleted"}
+	ingress := fluxObject{kind: fluxKindHelmRelease, namespace: "flux-system", name: "ingress"}
+	client := newFluxClient(
+		newTestFluxObject(fluxKindKustomization, "apps", true),
+		newTestFluxObject(fluxKindHelmRelease, "ingress", true),
+	)
+	client.PrependReactor("patch", "kustomizations", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.PatchAction).GetName() == "apps" {
+			return true, nil, apierrors.NewForbidden(fluxResources[fluxKindKustomization].GroupResource(), "apps", errors.New("denied"))
+		}
+		return false, nil, nil
+	})
+
+	// the objects deleted during the drain are skipped and the others
+	// are resumed even when one of them cannot be
+	err := resumeFlux(ctx, client, orchestrate.DefaultRetryPolicy(), []fluxObject{apps, deleted, ingress})
+	expected := "failed to resume Kustomization flux-system/apps: kustomizations.kustomize.toolkit.fluxcd.io \"apps\" is forbidden: denied"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+	if isSuspended, _ := fluxState(t, client, ingress); isSuspended {
+		t.Errorf("expected %s to be resumed", ingress)
+	}
+}
+
+func TestPauseFluxResumesAfterFailedDrain(t *testing.T) {
+	apps := fluxObject{kind: fluxKindKustomization, namespace: "flux-system", name: "apps"}
+	ingress := fluxObject{kind: fluxKindHelmRelease, namespace: "flux-system", name: "ingress"}
+
+	tests := map[string]struct {
+		objects []runtime.Object
+		// suspendFails when one of the objects cannot be suspended
+		suspendFails bool
+	}{
+		"all suspended": {
+			objects: []runtime.Object{newTestFluxObject(fluxKindKustomization, "apps", false), newTestFluxObject(fluxKindHelmRelease, "ingress", false)},
+		},
+		"suspend failed": {
+			objects:      []runtime.Object{newTestFluxObject(fluxKindKustomization, "apps", false)},
+			suspendFails: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := newFluxClient(test.objects...)
+			r := &NodePoolResource{retry: orchestrate.DefaultRetryPolicy()}
+			data := &NodePoolResourceModel{
+				NodePoolName: types.StringValue("pool"),
+				SuspendFlux: []NodePoolSuspendFluxModel{
+					{Kind: types.StringValue(apps.kind), Namespace: types.StringValue(apps.namespace), Name: types.StringValue(apps.name)},
+					{Kind: types.StringValue(ingress.kind), Namespace: types.StringValue(ingress.namespace), Name: types.StringValue(ingress.name)},
+				},
+			}
+
+			var diags diag.Diagnostics
+			func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				resume := r.pauseFluxWith(ctx, client, data, &diags)
+				defer resume()
+				if diags.HasError() != test.suspendFails {
+					t.Fatalf("expected suspend failure %v, got %v", test.suspendFails, diags)
+				}
+				if isSuspended, by := fluxState(t, client, apps); !isSuspended || by != "pool" {
+					t.Fatalf("expected %s to be suspended by the node pool, got suspended %v by %q", apps, isSuspended, by)
+				}
+
+				// the drain fails and cancels its context before the
+				// objects are resumed
+				diags.AddError("Error deleting safe node pool", "drain failed")
+				cancel()
+			}()
+
+			if isSuspended, by := fluxState(t, client, apps); isSuspended || by != "" {
+				t.Errorf("expected %s to be resumed, got suspended %v by %q", apps, isSuspended, by)
+			}
+			if !test.suspendFails {
+				if isSuspended, _ := fluxState(t, client, ingress); isSuspended {
+					t.Errorf("expected %s to be resumed", ingress)
+				}
+			}
+			if diags.WarningsCount() != 0 {
+				t.Errorf("expected no warning resuming the objects, got %v", diags.Warnings())
+			}
+		})
+	}
+}
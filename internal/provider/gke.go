@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+)
+
+// gkeNodePoolIDPattern matches GKE node pool IDs and self-links, e.g.
+// projects/my-project/locations/us-central1/clusters/my-cluster/nodePools/my-pool
+// or https://container.googleapis.com/v1/projects/my-project/zones/us-central1-a/clusters/my-cluster/nodePools/my-pool.
+var gkeNodePoolIDPattern = regexp.MustCompile(`^(?:https://container\.googleapis\.com/v1(?:beta1)?/)?projects/([^/]+)/(?:locations|zones)/([^/]+)/clusters/([^/]+)/nodePools/([^/]+)$`)
+
+// gkeNodePoolID is a GKE node pool ID split into its components.
+type gkeNodePoolID struct {
+	project  string
+	location string
+	cluster  string
+	nodePool string
+}
+
+// parseGKENodePoolID parses a GKE node pool ID or self-link and reports
+// whether id is one.
+func parseGKENodePoolID(id string) (gkeNodePoolID, bool) {
+	matches := gkeNodePoolIDPattern.FindStringSubmatch(id)
+	if matches == nil {
+		return gkeNodePoolID{}, false
+	}
+
+	return gkeNodePoolID{
+		project:  matches[1],
+		location: matches[2],
+		cluster:  matches[3],
+		nodePool: matches[4],
+	}, true
+}
+
+func (id gkeNodePoolID) String() string {
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s/nodePools/%s", id.project, id.location, id.cluster, id.nodePool)
+}
+
+// gkeInstanceDeleter deletes the GCE instances of the drained nodes of a GKE
+// node pool from its managed instance groups, shrinking the node pool, so
+// that the whole rotation is driven by the provider.
+type gkeInstanceDeleter struct {
+	nodePool gkeNodePoolID
+	google   *googleClient
+
+	mu sync.Mutex
+	// instanceGroups are the URLs of the instance group managers of
+	// the node pool, fetched from the GKE API with the first deletion
+	instanceGroups []string
+}
+
+func newGKEInstanceDeleter(nodePool gkeNodePoolID, accessToken string) *gkeInstanceDeleter {
+	return &gkeInstanceDeleter{nodePool: nodePool, google: newGoogleClient(accessToken)}
+}
+
+// deleteInstance deletes the GCE instance of node from the managed instance
+// group of the node pool in its zone and waits for the deletion to be
+// scheduled. Instances already deleted are skipped.
+func (g *gkeInstanceDeleter) deleteInstance(ctx context.Context, retry orchestrate.RetryPolicy, node v1.Node) error {
+	scheme, id, _ := strings.Cut(node.Spec.ProviderID, "://")
+	parts := strings.Split(id, "/")
+	if scheme != "gce" || len(parts) != 3 {
+		return fmt.Errorf("node %s is not a GCE instance, its provider ID is %q", node.Name, node.Spec.ProviderID)
+	}
+	zone, name := parts[1], parts[2]
+	client, err := g.google.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	var operation *gceOperation
+	err = retry.Do(ctx, "deleting the instance of node "+node.Name, func() error {
+		instanceGroup, err := g.instanceGroup(ctx, zone)
+		if err != nil {
+			return err
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("deleting instance %s of node %s from instance group %s", name, node.Name, instanceGroup))
+		body, _ := json.Marshal(map[string]any{
+			"instances":                      []string{"zones/" + zone + "/instances/" + name},
+			"skipInstancesOnValidationError": true,
+		})
+		req, err := http.NewRequest(http.MethodPost, instanceGroup+"/deleteInstances", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		operation, err = getGCEOperation(ctx, client, req)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete the instance %s of node %s: %w", name, node.Name, err)
+	}
+
+	for operation.Status != "DONE" {
+		if err := orchestrate.Sleep(ctx, 2*time.Second); err != nil {
+			return fmt.Errorf("the deletion of the instance %s of node %s did not complete: %w", name, node.Name, err)
+		}
+
+		err := retry.Do(ctx, "getting operation "+operation.Name, func() error {
+			req, err := http.NewRequest(http.MethodGet, operation.SelfLink, nil)
+			if err != nil {
+				return err
+			}
+			operation, err = getGCEOperation(ctx, client, req)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get the deletion of the instance %s of node %s: %w", name, node.Name, err)
+		}
+	}
+
+	if operation.Error != nil && len(operation.Error.Errors) > 0 {
+		return fmt.Errorf("failed to delete the instance %s of node %s: %s", name, node.Name, operation.Error.Errors[0].Message)
+	}
+	return nil
+}
+
+// instanceGroup returns the URL of the managed instance group of the node
+// pool in zone.
+func (g *gkeInstanceDeleter) instanceGroup(ctx context.Context, zone string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.instanceGroups == nil {
+		req, err := http.NewRequest(http.MethodGet, "https://container.googleapis.com/v1/"+g.nodePool.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		client, err := g.google.get(ctx)
+		if err != nil {
+			return "", err
+		}
+		body, err := getCloudAPI(ctx, client, req)
+		if err != nil {
+			return "", fmt.Errorf("failed to get GKE node pool %s: %w", g.nodePool, err)
+		}
+		if body == nil {
+			return "", fmt.Errorf("GKE node pool %s does not exist", g.nodePool)
+		}
+
+		var nodePool struct {
+			InstanceGroupURLs []string `json:"instanceGroupUrls"`
+		}
+		if err := json.Unmarshal(body, &nodePool); err != nil {
+			return "", fmt.Errorf("failed to parse GKE node pool %s: %w", g.nodePool, err)
+		}
+		g.instanceGroups = nodePool.InstanceGroupURLs
+	}
+
+	for _, instanceGroup := range g.instanceGroups {
+		if strings.Contains(instanceGroup, "/zones/"+zone+"/") {
+			return instanceGroup, nil
+		}
+	}
+	return "", fmt.Errorf("GKE node pool %s has no instance group in zone %s", g.nodePool, zone)
+}
+
+// gceOperation is the part of a GCE operation needed to wait for it.
+type gceOperation struct {
+	Name     string `json:"name"`
+	SelfLink string `json:"selfLink"`
+	Status   string `json:"status"`
+	Error    *struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+// getGCEOperation sends req with client and returns the GCE operation of
+// the response.
+func getGCEOperation(ctx context.Context, client *http.Client, req *http.Request) (*gceOperation, error) {
+	body, err := getCloudAPI(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, fmt.Errorf("%s does not exist", req.URL.Redacted())
+	}
+
+	var operation gceOperation
+	if err := json.Unmarshal(body, &operation); err != nil {
+		return nil, fmt.Errorf("failed to parse the GCE operation: %w", err)
+	}
+	return &operation, nil
+}
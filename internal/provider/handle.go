@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+)
+
+// readyHandlePrefix distinguishes ready handles from other strings.
+const readyHandlePrefix = "k8snp-ready:"
+
+// readyHandle identifies a node pool found ready on creation, and how its
+// readiness was defined, so that other node pools can wait for it.
+type readyHandle struct {
+	NodePoolName string `json:"node_pool_name"`
+	NodeSelector string `json:"node_selector"`
+	NodeFields   string `json:"node_field_selector,omitempty"`
+	// MachineDeployment is the namespace/name of the Cluster API
+	// MachineDeployment whose machines are the nodes of the node pool
+	MachineDeployment string `json:"machine_deployment,omitempty"`
+	// NodeNames are the nodes of the node pools managed by Cluster
+	// API in the handles created by earlier versions of the provider
+	NodeNames     []string `json:"node_names,omitempty"`
+	MinReadyNodes int64    `json:"min_ready_nodes"`
+}
+
+// query returns the query of the nodes of the node pool. The nodes of node
+// pools managed by Cluster API are those of the machines of their
+// MachineDeployment, to be found when waiting for them, see findMachineNodes.
+func (h readyHandle) query() orchestrate.NodeQuery {
+	return orchestrate.NodeQuery{LabelSelector: h.NodeSelector, FieldSelector: h.NodeFields, MachineDeployment: h.MachineDeployment, NodeNames: h.NodeNames}
+}
+
+// token serializes the handle into an opaque string.
+func (h readyHandle) token() string {
+	// marshalling a struct of strings and numbers cannot fail
+	b, _ := json.Marshal(h)
+	return readyHandlePrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parseReadyHandle parses a token created by readyHandle.token.
+func parseReadyHandle(token string) (readyHandle, error) {
+	encoded, ok := strings.CutPrefix(token, readyHandlePrefix)
+	if !ok {
+		return readyHandle{}, fmt.Errorf("%q is not the ready_handle of a node pool", token)
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return readyHandle{}, fmt.Errorf("failed to decode ready handle: %w", err)
+	}
+
+	var handle readyHandle
+	if err := json.Unmarshal(b, &handle); err != nil {
+		return readyHandle{}, fmt.Errorf("failed to decode ready handle: %w", err)
+	}
+	if handle.NodeSelector == "" && handle.MachineDeployment == "" && handle.NodeNames == nil {
+		return readyHandle{}, fmt.Errorf("ready handle has no node selector")
+	}
+
+	return handle, nil
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+)
+
+// queryMatches reports whether query lists the node nodeName.
+func queryMatches(t *testing.T, query orchestrate.NodeQuery, nodeName string) bool {
+	t.Helper()
+
+	nodes, err := orchestrate.ListNodes(context.Background(), newTestClient(newTestNode(nodeName, nil, true)), orchestrate.DefaultRetryPolicy(), query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return len(nodes) == 1
+}
+
+func TestReadyHandleMachineDeployment(t *testing.T) {
+	handle, err := parseReadyHandle(readyHandle{NodePoolName: "pool", MachineDeployment: "capi/workers", MinReadyNodes: 2}.token())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the nodes are those of the machines found when waiting
+	query := handle.query()
+	if query.MachineDeployment != "capi/workers" || query.NodeNames != nil {
+		t.Errorf("expected the query of the machines of MachineDeployment capi/workers, got %+v", query)
+	}
+	if queryMatches(t, query, "node-1") {
+		t.Errorf("expected no node to match before the machines are found")
+	}
+}
+
+func TestParseReadyHandleCompatibility(t *testing.T) {
+	// handles of Cluster API node pools created by earlier versions
+	token := readyHandlePrefix + base64.RawURLEncoding.EncodeToString([]byte(`{"node_pool_name":"pool","node_selector":"","node_names":["node-1"],"min_ready_nodes":1}`))
+
+	handle, err := parseReadyHandle(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !queryMatches(t, handle.query(), "node-1") {
+		t.Errorf("expected the nodes of the handle to match")
+	}
+}
+
+func TestParseReadyHandleErrors(t *testing.T) {
+	for name, token := range map[string]string{
+		"no prefix":   "pool",
+		"invalid":     readyHandlePrefix + "!",
+		"no selector": readyHandle{NodePoolName: "pool"}.token(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseReadyHandle(token); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
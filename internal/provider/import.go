@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/defaults"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+)
+
+// nodePoolImportID is an import ID of the form pool_name or
+// label_key=label_value|pool_name.
+type nodePoolImportID struct {
+	nodePoolName string
+	// labelKey and labelValue are empty when the
+	// node selector is not part of the ID
+	labelKey   string
+	labelValue string
+}
+
+// parseNodePoolImportID parses an import ID of the form pool_name or
+// label_key=label_value|pool_name.
+func parseNodePoolImportID(id string) (nodePoolImportID, error) {
+	selector, nodePoolName, ok := strings.Cut(id, "|")
+	if !ok {
+		if id == "" {
+			return nodePoolImportID{}, fmt.Errorf("the import ID is empty, expected pool_name or label_key=label_value|pool_name")
+		}
+		return nodePoolImportID{nodePoolName: id}, nil
+	}
+
+	labelKey, labelValue, ok := strings.Cut(selector, "=")
+	if !ok || labelKey == "" || labelValue == "" || nodePoolName == "" {
+		return nodePoolImportID{}, fmt.Errorf("%q is not a valid import ID, expected pool_name or label_key=label_value|pool_name", id)
+	}
+
+	return nodePoolImportID{nodePoolName: nodePoolName, labelKey: labelKey, labelValue: labelValue}, nil
+}
+
+// setDefaults sets the attributes of s with a default value to that value
+// in state, as defaults are not applied to imported resources.
+func setDefaults(ctx context.Context, s schema.Schema, state *tfsdk.State) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	for name, attribute := range s.Attributes {
+		attributePath := path.Root(name)
+
+		switch a := attribute.(type) {
+		case schema.StringAttribute:
+			if a.Default == nil {
+				continue
+			}
+			var resp defaults.StringResponse
+			a.Default.DefaultString(ctx, defaults.StringRequest{Path: attributePath}, &resp)
+			diags.Append(resp.Diagnostics...)
+			diags.Append(state.SetAttribute(ctx, attributePath, resp.PlanValue)...)
+		case schema.BoolAttribute:
+			if a.Default == nil {
+				continue
+			}
+			var resp defaults.BoolResponse
+			a.Default.DefaultBool(ctx, defaults.BoolRequest{Path: attributePath}, &resp)
+			diags.Append(resp.Diagnostics...)
+			diags.Append(state.SetAttribute(ctx, attributePath, resp.PlanValue)...)
+		case schema.Int64Attribute:
+			if a.Default == nil {
+				continue
+			}
+			var resp defaults.Int64Response
+			a.Default.DefaultInt64(ctx, defaults.Int64Request{Path: attributePath}, &resp)
+			diags.Append(resp.Diagnostics...)
+			diags.Append(state.SetAttribute(ctx, attributePath, resp.PlanValue)...)
+		}
+	}
+
+	return diags
+}
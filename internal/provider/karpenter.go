@@ -0,0 +1,195 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// managedByKarpenter hands the termination of the
+	// nodes over to Karpenter instead of draining them
+	managedByKarpenter = "karpenter"
+
+	defaultKarpenterPollInterval = 5 * time.Second
+)
+
+// karpenterNodePoolLabel is the label with the name of the Karpenter
+// NodePool of the nodes and of their NodeClaims.
+const karpenterNodePoolLabel = "karpenter.sh/nodepool"
+
+var nodeClaimResource = schema.GroupVersionResource{Group: "karpenter.sh", Version: "v1", Resource: "nodeclaims"}
+
+// karpenterNodes terminates the nodes provisioned by Karpenter by deleting
+// their NodeClaims, letting Karpenter taint and drain the nodes, respecting
+// the pod disruption budgets, and delete their instances.
+type karpenterNodes struct {
+	client       dynamic.Interface
+	nodes        kubernetes.Interface
+	retry        orchestrate.RetryPolicy
+	pollInterval time.Duration
+	// flapTolerance is how long the node deletions are paused, rather
+	// than failed, while the API server is unavailable
+	flapTolerance time.Duration
+	dryRun        bool
+
+	mu sync.Mutex
+	// nodeClaims are the names of the NodeClaims by the name of their node,
+	// listed once for all the nodes of the node pool
+	nodeClaims map[string]string
+}
+
+// Evict deletes the NodeClaim of node, or the node itself when it has none,
+// and waits for the node to be gone and for the replacements launched by
+// Karpenter in its NodePool to be ready.
+func (k *karpenterNodes) Evict(ctx context.Context, node v1.Node) error {
+	nodeName := node.Name
+	nodeClaim, err := k.nodeClaim(ctx, k.retry, nodeName)
+	if err != nil {
+		return err
+	}
+
+	if k.dryRun {
+		tflog.Info(ctx, fmt.Sprintf("would delete NodeClaim %q of node %s", nodeClaim, nodeName))
+		return nil
+	}
+
+	// the replacements are the NodeClaims created from now on, the
+	// creation timestamps having a precision of a second
+	deleted := metav1.NewTime(time.Now().Truncate(time.Second))
+	if nodeClaim == "" {
+		// Karpenter also terminates the nodes deleted directly
+		tflog.Debug(ctx, fmt.Sprintf("deleting node %s as it has no NodeClaim", nodeName))
+		if err := orchestrate.DeleteNode(ctx, k.nodes, k.retry, nodeName); err != nil {
+			return err
+		}
+	} else {
+		tflog.Debug(ctx, fmt.Sprintf("deleting NodeClaim %s of node %s", nodeClaim, nodeName))
+		err := k.retry.DoTolerating(ctx, "deleting NodeClaim "+nodeClaim, k.flapTolerance, func() error {
+			return k.client.Resource(nodeClaimResource).Delete(ctx, nodeClaim, metav1.DeleteOptions{})
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete NodeClaim %s of node %s: %w", nodeClaim, nodeName, err)
+		}
+	}
+
+	for {
+		var gone bool
+		err := k.retry.DoTolerating(ctx, "getting node "+nodeName, k.flapTolerance, func() error {
+			_, err := k.nodes.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+			gone = apierrors.IsNotFound(err)
+			if gone {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get node %s: %w", nodeName, err)
+		}
+		if gone {
+			break
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for Karpenter to terminate node %s", nodeName))
+		if err := orchestrate.Sleep(ctx, k.pollInterval); err != nil {
+			return fmt.Errorf("node %s was not terminated by Karpenter: %w", nodeName, err)
+		}
+	}
+
+	nodePool := node.Labels[karpenterNodePoolLabel]
+	if nodePool == "" {
+		tflog.Debug(ctx, fmt.Sprintf("not waiting for the replacements of node %s as it has no %s label", nodeName, karpenterNodePoolLabel))
+		return nil
+	}
+	return k.waitForReplacements(ctx, k.retry, nodePool, deleted)
+}
+
+// nodeClaim returns the name of the NodeClaim of nodeName, or an empty string
+// when it has none. The NodeClaims are listed on the first call only as the
+// nodes of the node pool, and so their NodeClaims, are known when the drain
+// starts.
+func (k *karpenterNodes) nodeClaim(ctx context.Context, retry orchestrate.RetryPolicy, nodeName string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.nodeClaims == nil {
+		var nodeClaims *unstructured.UnstructuredList
+		err := retry.Do(ctx, "listing NodeClaims", func() error {
+			var err error
+			nodeClaims, err = k.client.Resource(nodeClaimResource).List(ctx, metav1.ListOptions{})
+			return err
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to list NodeClaims: %w", err)
+		}
+
+		k.nodeClaims = make(map[string]string, len(nodeClaims.Items))
+		for _, nodeClaim := range nodeClaims.Items {
+			if name, _, _ := unstructured.NestedString(nodeClaim.Object, "status", "nodeName"); name != "" {
+				k.nodeClaims[name] = nodeClaim.GetName()
+			}
+		}
+	}
+	return k.nodeClaims[nodeName], nil
+}
+
+// waitForReplacements waits for the NodeClaims of nodePool created since
+// the deletion of a node and not being deleted, those launched by Karpenter
+// for the pods of the node, to be ready.
+func (k *karpenterNodes) waitForReplacements(ctx context.Context, retry orchestrate.RetryPolicy, nodePool string, deleted metav1.Time) error {
+	selector := labels.Set{karpenterNodePoolLabel: nodePool}.String()
+	for {
+		var pending []string
+		err := retry.Do(ctx, "listing NodeClaims", func() error {
+			nodeClaims, err := k.client.Resource(nodeClaimResource).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return err
+			}
+
+			pending = nil
+			for _, nodeClaim := range nodeClaims.Items {
+				created := nodeClaim.GetCreationTimestamp()
+				if !created.Before(&deleted) && nodeClaim.GetDeletionTimestamp() == nil && !isNodeClaimReady(nodeClaim) {
+					pending = append(pending, nodeClaim.GetName())
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list NodeClaims: %w", err)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for NodeClaims %s to be ready", strings.Join(pending, ", ")))
+		if err := orchestrate.Sleep(ctx, k.pollInterval); err != nil {
+			return fmt.Errorf("NodeClaims %s were not ready: %w", strings.Join(pending, ", "), err)
+		}
+	}
+}
+
+// isNodeClaimReady reports whether the Ready condition of nodeClaim is true.
+func isNodeClaimReady(nodeClaim unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(nodeClaim.Object, "status", "conditions")
+	for _, condition := range conditions {
+		condition, ok := condition.(map[string]any)
+		if ok && condition["type"] == "Ready" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTestNodeClaim(name, nodePool, nodeName string, created time.Time, ready bool) *unstructured.Unstructured {
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	nodeClaim := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "karpenter.sh/v1",
+		"kind":       "NodeClaim",
+		"metadata": map[string]any{
+			"name":   name,
+			"labels": map[string]any{karpenterNodePoolLabel: nodePool},
+		},
+		"status": map[string]any{
+			"nodeName":   nodeName,
+			"conditions": []any{map[string]any{"type": "Ready", "status": status}},
+		},
+	}}
+	nodeClaim.SetCreationTimestamp(metav1.NewTime(created))
+	return nodeClaim
+}
+
+func newKarpenterClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{nodeClaimResource: "NodeClaimList"}, objects...)
+}
+
+func TestKarpenterNodeClaimListsOnce(t *testing.T) {
+	ctx := context.Background()
+	client := newKarpenterClient(
+		newTestNodeClaim("claim-1", "pool", "node-1", time.Now(), true),
+		newTestNodeClaim("claim-2", "pool", "node-2", time.Now(), true),
+	)
+	k := &karpenterNodes{client: client}
+
+	for node, expected := range map[string]string{"node-1": "claim-1", "node-2": "claim-2", "node-3": ""} {
+		nodeClaim, err := k.nodeClaim(ctx, orchestrate.DefaultRetryPolicy(), node)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if nodeClaim != expected {
+			t.Errorf("expected NodeClaim %q of node %s, got %q", expected, node, nodeClaim)
+		}
+	}
+	if lists := len(client.Actions()); lists != 1 {
+		t.Errorf("expected the NodeClaims to be listed once, got %d lists", lists)
+	}
+}
+
+func TestKarpenterWaitForReplacements(t *testing.T) {
+	deleted := time.Now().Truncate(time.Second)
+	tests := map[string]struct {
+		nodeClaims []runtime.Object
+		pending    string
+	}{
+		"replacement ready": {
+			nodeClaims: []runtime.Object{newTestNodeClaim("replacement", "pool", "", deleted.Add(time.Second), true)},
+		},
+		"replacement not ready": {
+			nodeClaims: []runtime.Object{newTestNodeClaim("replacement", "pool", "", deleted.Add(time.Second), false)},
+			pending:    "replacement",
+		},
+		"other node pool not ready": {
+			nodeClaims: []runtime.Object{newTestNodeClaim("other", "other-pool", "", deleted.Add(time.Second), false)},
+		},
+		"created before the deletion not ready": {
+			nodeClaims: []runtime.Object{newTestNodeClaim("earlier", "pool", "", deleted.Add(-time.Minute), false)},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			k := &karpenterNodes{client: newKarpenterClient(test.nodeClaims...), pollInterval: time.Millisecond}
+			err := k.waitForReplacements(ctx, orchestrate.DefaultRetryPolicy(), "pool", metav1.NewTime(deleted))
+			if test.pending == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.pending) {
+				t.Errorf("expected NodeClaim %s to be pending, got %v", test.pending, err)
+			}
+		})
+	}
+}
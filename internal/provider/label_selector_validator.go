@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type labelSelectorValidator struct{}
+
+func (v labelSelectorValidator) Description(_ context.Context) string {
+	return "string must be a valid kubernetes label selector, e.g. app=nginx,tier!=cache"
+}
+
+func (v labelSelectorValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v labelSelectorValidator) ValidateString(_ context.Context, request validator.StringRequest, response *validator.StringResponse) {
+	if request.ConfigValue.IsNull() || request.ConfigValue.IsUnknown() {
+		return
+	}
+
+	value := request.ConfigValue.ValueString()
+	if _, err := labels.Parse(value); err != nil {
+		response.Diagnostics.Append(
+			diag.NewAttributeErrorDiagnostic(
+				request.Path,
+				"Invalid Attribute Format",
+				fmt.Sprintf("Attribute %s is not a valid label selector, got: %s: %s", request.Path, value, err.Error()),
+			),
+		)
+	}
+}
+
+// LabelSelector returns a validator which ensures that any configured
+// attribute value is a valid kubernetes label selector.
+func LabelSelector() validator.String {
+	return labelSelectorValidator{}
+}
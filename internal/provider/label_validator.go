@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+type labelValidator struct {
+	// key validates label keys rather than label values
+	key bool
+}
+
+func (v labelValidator) Description(_ context.Context) string {
+	if v.key {
+		return "string must be a valid kubernetes label key, e.g. cloud.google.com/gke-nodepool"
+	}
+	return "string must be a valid kubernetes label value, e.g. default-pool"
+}
+
+func (v labelValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v labelValidator) ValidateString(_ context.Context, request validator.StringRequest, response *validator.StringResponse) {
+	if request.ConfigValue.IsNull() || request.ConfigValue.IsUnknown() {
+		return
+	}
+
+	value := request.ConfigValue.ValueString()
+	kind, errs := "label value", validation.IsValidLabelValue(value)
+	if v.key {
+		kind, errs = "label key", validation.IsQualifiedName(value)
+	}
+	if len(errs) > 0 {
+		response.Diagnostics.Append(
+			diag.NewAttributeErrorDiagnostic(
+				request.Path,
+				"Invalid Attribute Format",
+				fmt.Sprintf("Attribute %s is not a valid %s, got: %s: %s", request.Path, kind, value, strings.Join(errs, "; ")),
+			),
+		)
+	}
+}
+
+// LabelKey returns a validator which ensures that any configured
+// attribute value is a valid kubernetes label key.
+func LabelKey() validator.String {
+	return labelValidator{key: true}
+}
+
+// LabelValue returns a validator which ensures that any configured
+// attribute value is a valid kubernetes label value.
+func LabelValue() validator.String {
+	return labelValidator{}
+}
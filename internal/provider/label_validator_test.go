@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+func FuzzLabelKey(f *testing.F) {
+	for _, seed := range []string{"cloud.google.com/gke-nodepool", "pool", "a/b/c", "/pool", "example.com/", "-pool", "pool-", "Pool_1.a", "poöl", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, key string) {
+		if validateString(LabelKey(), key).HasError() {
+			return
+		}
+
+		// accepted keys must select nodes, otherwise the node listing fails
+		if _, err := labels.NewRequirement(key, selection.Exists, nil); err != nil {
+			t.Errorf("accepted label key %q, which is not a valid selector: %v", key, err)
+		}
+	})
+}
+
+func FuzzLabelValue(f *testing.F) {
+	for _, seed := range []string{"default-pool", "", "a.b_c-d", "-pool", "pool-", "poöl", "a,b", "a=b", "(a)"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		if validateString(LabelValue(), value).HasError() {
+			return
+		}
+
+		// accepted values must round trip through the label selectors
+		selector := labels.Set{"pool": value}.AsSelector()
+		parsed, err := labels.Parse(selector.String())
+		if err != nil {
+			t.Fatalf("accepted label value %q, which is not a valid selector: %v", value, err)
+		}
+		if !parsed.Matches(labels.Set{"pool": value}) {
+			t.Errorf("accepted label value %q, whose selector %q does not match it", value, selector)
+		}
+	})
+}
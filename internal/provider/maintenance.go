@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	// embed the time zone database for the maintenance window time zones
+	// on machines without one, e.g. Windows
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	_ "time/tzdata"
+)
+
+// weekdays maps the abbreviated day names accepted in the
+// maintenance window to their weekday.
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// maintenanceWindow is a daily period, on some days of the week, during which
+// nodes can be drained. A window ending before it starts ends the next day.
+type maintenanceWindow struct {
+	// days the window starts on, every day when empty
+	days []time.Weekday
+	// start and end are the minutes since midnight
+	start, end int
+	location   *time.Location
+}
+
+// clockRegexp matches a time of the day in the HH:MM format.
+var clockRegexp = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// parseClock parses a time of the day in the HH:MM format into the minutes
+// since midnight.
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of the day %q: %w", value, err)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// opensOn reports whether the window starts on the given day.
+func (w maintenanceWindow) opensOn(day time.Weekday) bool {
+	if len(w.days) == 0 {
+		return true
+	}
+	for _, d := range w.days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// bounds returns the start and end of the window opening offset days after
+// the day of t.
+func (w maintenanceWindow) bounds(t time.Time, offset int) (time.Time, time.Time) {
+	year, month, day := t.Date()
+	start := time.Date(year, month, day+offset, 0, w.start, 0, 0, w.location)
+	endDay := day + offset
+	if w.end <= w.start {
+		endDay++
+	}
+	end := time.Date(year, month, endDay, 0, w.end, 0, 0, w.location)
+	return start, end
+}
+
+// contains reports whether t is within the window.
+func (w maintenanceWindow) contains(t time.Time) bool {
+	t = t.In(w.location)
+	// a window opened the day before may still be open
+	for _, offset := range []int{-1, 0} {
+		start, end := w.bounds(t, offset)
+		if w.opensOn(start.Weekday()) && !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOpening returns the start of the first window after t.
+func (w maintenanceWindow) nextOpening(t time.Time) time.Time {
+	t = t.In(w.location)
+	for offset := 0; offset <= 7; offset++ {
+		start, _ := w.bounds(t, offset)
+		if w.opensOn(start.Weekday()) && start.After(t) {
+			return start
+		}
+	}
+	// unreachable as the window opens at least once a week
+	return t
+}
+
+// maintenanceGate holds the drain of the nodes while the maintenance window is
+// closed, or fails it when the window does not open soon enough.
+type maintenanceGate struct {
+	window maintenanceWindow
+	// canWait allows waiting for the window to open within maxWait,
+	// otherwise the gate fails as soon as the window is closed
+	canWait bool
+	maxWait time.Duration
+}
+
+// wait returns once the window is open, waiting for it to open when allowed.
+func (g *maintenanceGate) wait(ctx context.Context) error {
+	now := time.Now()
+	if g.window.contains(now) {
+		return nil
+	}
+
+	opening := g.window.nextOpening(now)
+	if !g.canWait || opening.Sub(now) > g.maxWait {
+		return fmt.Errorf("the maintenance window is closed, the next window opens at %s", opening.Format(time.RFC3339))
+	}
+
+	tflog.Info(ctx, fmt.Sprintf("waiting for the maintenance window to open at %s", opening.Format(time.RFC3339)))
+	if err := orchestrate.Sleep(ctx, opening.Sub(now)); err != nil {
+		return fmt.Errorf("the operation was cancelled while waiting for the maintenance window to open at %s", opening.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	// Sat 02:00 to Sun 01:00, the window ending before it starts
+	window := maintenanceWindow{days: []time.Weekday{time.Saturday}, start: 2 * 60, end: 60, location: time.UTC}
+
+	tests := []struct {
+		now         time.Time
+		contains    bool
+		nextOpening time.Time
+	}{
+		{
+			now:         time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), // Fri
+			nextOpening: time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			now:         time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC), // Sat
+			contains:    true,
+			nextOpening: time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			now:         time.Date(2026, 10, 18, 0, 30, 0, 0, time.UTC), // Sun
+			contains:    true,
+			nextOpening: time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			now:         time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC), // Sun
+			nextOpening: time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.now.Format(time.RFC3339), func(t *testing.T) {
+			if got := window.contains(test.now); got != test.contains {
+				t.Errorf("expected contains to be %t, got %t", test.contains, got)
+			}
+			if got := window.nextOpening(test.now); !got.Equal(test.nextOpening) {
+				t.Errorf("expected the next opening at %s, got %s", test.nextOpening, got)
+			}
+		})
+	}
+}
+
+func TestMaintenanceGateWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// a window opening a few hours from now, whatever the time of the day
+	now := time.Now().UTC()
+	opening := (now.Hour()*60 + now.Minute() + 3*60) % (24 * 60)
+	closed := maintenanceWindow{start: opening, end: (opening + 60) % (24 * 60), location: time.UTC}
+
+	tests := map[string]struct {
+		gate  maintenanceGate
+		fails bool
+	}{
+		"open": {
+			// a window ending when it starts is open all day
+			gate: maintenanceGate{window: maintenanceWindow{location: time.UTC}},
+		},
+		"closed": {
+			gate:  maintenanceGate{window: closed},
+			fails: true,
+		},
+		"opening after max wait": {
+			gate:  maintenanceGate{window: closed, canWait: true, maxWait: time.Hour},
+			fails: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.gate.wait(ctx)
+			if test.fails != (err != nil) {
+				t.Errorf("expected the wait to fail %t, got %v", test.fails, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/function"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ function.Function = &MinReadyNodesFunction{}
+
+func NewMinReadyNodesFunction() function.Function {
+	return &MinReadyNodesFunction{}
+}
+
+// MinReadyNodesFunction defines the function implementation.
+type MinReadyNodesFunction struct{}
+
+func (f *MinReadyNodesFunction) Metadata(_ context.Context, _ function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "min_ready_nodes"
+}
+
+func (f *MinReadyNodesFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:             "Minimum number of ready nodes for a percentage of a node pool",
+		MarkdownDescription: "Returns the number of nodes, rounded up, corresponding to `percentage` percent of `expected_nodes`, e.g. to compute `min_ready_nodes` from the size of a node pool.",
+		Parameters: []function.Parameter{
+			function.Int64Parameter{
+				Name:                "expected_nodes",
+				MarkdownDescription: "Expected number of nodes in the node pool.",
+			},
+			function.Int64Parameter{
+				Name:                "percentage",
+				MarkdownDescription: "Percentage of the expected nodes, between 1 and 100.",
+			},
+		},
+		Return: function.Int64Return{},
+	}
+}
+
+func (f *MinReadyNodesFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var expectedNodes, percentage int64
+
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &expectedNodes, &percentage))
+	if resp.Error != nil {
+		return
+	}
+
+	if expectedNodes < 0 {
+		resp.Error = function.NewArgumentFuncError(0, fmt.Sprintf("expected_nodes must not be negative, got: %d", expectedNodes))
+		return
+	}
+
+	if percentage < 1 || percentage > 100 {
+		resp.Error = function.NewArgumentFuncError(1, fmt.Sprintf("percentage must be between 1 and 100, got: %d", percentage))
+		return
+	}
+
+	resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, minReadyNodesForPercentage(expectedNodes, percentage)))
+}
+
+// minReadyNodesForPercentage returns percentage percent of expectedNodes
+// rounded up, so that e.g. 90% of 5 nodes requires all 5 to be ready.
+func minReadyNodesForPercentage(expectedNodes, percentage int64) int64 {
+	return (expectedNodes*percentage + 99) / 100
+}
@@ -0,0 +1,392 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework-validators/mapvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ resource.Resource = &NodeBootstrapResource{}
+var _ resource.ResourceWithModifyPlan = &NodeBootstrapResource{}
+
+func NewNodeBootstrapResource() resource.Resource {
+	return &NodeBootstrapResource{}
+}
+
+// NodeBootstrapResource defines the resource implementation.
+type NodeBootstrapResource struct {
+	k8sClient   kubernetes.Interface
+	retry       orchestrate.RetryPolicy
+	rbacProfile string
+}
+
+// NodeBootstrapResourceModel describes the resource data model.
+type NodeBootstrapResourceModel struct {
+	NodeSelector types.String              `tfsdk:"node_selector"`
+	Labels       types.Map                 `tfsdk:"labels"`
+	Annotations  types.Map                 `tfsdk:"annotations"`
+	Nodes        types.List                `tfsdk:"nodes"`
+	Taints       []NodeBootstrapTaintModel `tfsdk:"taint"`
+}
+
+// NodeBootstrapTaintModel describes the taint block data model.
+type NodeBootstrapTaintModel struct {
+	Key    types.String `tfsdk:"key"`
+	Value  types.String `tfsdk:"value"`
+	Effect types.String `tfsdk:"effect"`
+}
+
+// metadata returns the metadata applied to the nodes.
+func (m *NodeBootstrapResourceModel) metadata(ctx context.Context) (nodeMetadata, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	metadata := nodeMetadata{}
+
+	if !m.Labels.IsNull() {
+		diags.Append(m.Labels.ElementsAs(ctx, &metadata.labels, false)...)
+	}
+	if !m.Annotations.IsNull() {
+		diags.Append(m.Annotations.ElementsAs(ctx, &metadata.annotations, false)...)
+	}
+	for _, taint := range m.Taints {
+		metadata.taints = append(metadata.taints, v1.Taint{
+			Key:    taint.Key.ValueString(),
+			Value:  taint.Value.ValueString(),
+			Effect: v1.TaintEffect(taint.Effect.ValueString()),
+		})
+	}
+
+	return metadata, diags
+}
+
+// isKnown reports whether the selector and the metadata are known.
+func (m *NodeBootstrapResourceModel) isKnown() bool {
+	if m.NodeSelector.IsUnknown() || m.Labels.IsUnknown() || m.Annotations.IsUnknown() {
+		return false
+	}
+	for _, taint := range m.Taints {
+		if taint.Key.IsUnknown() || taint.Value.IsUnknown() || taint.Effect.IsUnknown() {
+			return false
+		}
+	}
+	return true
+}
+
+// removedMetadata returns the metadata of prior that is no longer in m, to
+// be removed from the nodes.
+func (m *NodeBootstrapResourceModel) removedMetadata(ctx context.Context, prior *NodeBootstrapResourceModel) (nodeMetadata, diag.Diagnostics) {
+	current, diags := m.metadata(ctx)
+	previous, d := prior.metadata(ctx)
+	diags.Append(d...)
+
+	removed := nodeMetadata{labels: map[string]string{}, annotations: map[string]string{}}
+	for key, value := range previous.labels {
+		if _, ok := current.labels[key]; !ok {
+			removed.labels[key] = value
+		}
+	}
+	for key, value := range previous.annotations {
+		if _, ok := current.annotations[key]; !ok {
+			removed.annotations[key] = value
+		}
+	}
+	for _, taint := range previous.taints {
+		if findTaint(current.taints, taint) == nil {
+			removed.taints = append(removed.taints, taint)
+		}
+	}
+
+	return removed, diags
+}
+
+func (r *NodeBootstrapResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_node_bootstrap"
+}
+
+func (r *NodeBootstrapResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "Labels, annotations and taints applied to every node matching a label selector, for the metadata that the node templates of some platforms cannot express. " +
+			"The nodes joining the selector after the creation are found by the refresh, which plans an update applying the metadata to them. " +
+			"The metadata is removed from the nodes when removed from the configuration or when the resource is destroyed, except for the labels, annotations and taints whose value was changed on a node since it was applied.",
+
+		Attributes: map[string]schema.Attribute{
+			"node_selector": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "Label selector of the nodes, e.g. `cloud.google.com/gke-nodepool=pool-green`. Changing it replaces the resource, removing the metadata from the nodes selected before.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+					LabelSelector(),
+				},
+			},
+			"labels": schema.MapAttribute{
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Labels set on the nodes.",
+				Validators: []validator.Map{
+					mapvalidator.KeysAre(LabelKey()),
+					mapvalidator.ValueStringsAre(LabelValue()),
+				},
+			},
+			"annotations": schema.MapAttribute{
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Annotations set on the nodes.",
+			},
+			"nodes": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Names of the nodes matching `node_selector` that carry the metadata, when last read.",
+			},
+		},
+
+		Blocks: map[string]schema.Block{
+			"taint": schema.ListNestedBlock{
+				MarkdownDescription: "Taint set on the nodes. A taint of the nodes with the same key and effect but another value is replaced.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"key": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Key of the taint.",
+							Validators:          []validator.String{LabelKey()},
+						},
+						"value": schema.StringAttribute{
+							Optional:            true,
+							MarkdownDescription: "Value of the taint. Defaults to an empty value.",
+						},
+						"effect": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Effect of the taint: `NoSchedule`, `PreferNoSchedule` or `NoExecute`.",
+							Validators: []validator.String{
+								stringvalidator.OneOf(string(v1.TaintEffectNoSchedule), string(v1.TaintEffectPreferNoSchedule), string(v1.TaintEffectNoExecute)),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (r *NodeBootstrapResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*K8sNpProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unable to get kubernetes config",
+			"Unexpected error while fetching kubernetes config",
+		)
+		return
+	}
+	r.retry = providerData.retry
+	r.rbacProfile = providerData.rbacProfile
+
+	k8sClient, err := providerData.clients.KubeClient(providerData.config)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to create kubernetes client",
+			"Unexpected error while creating kubernetes client: "+err.Error(),
+		)
+		return
+	}
+	r.k8sClient = k8sClient
+}
+
+// ModifyPlan plans an update when nodes matching the selector, e.g. nodes
+// that joined it since the last apply, do not carry the metadata.
+func (r *NodeBootstrapResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.Plan.Raw.IsNull() || req.State.Raw.IsNull() || r.k8sClient == nil {
+		return
+	}
+
+	var data *NodeBootstrapResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() || !data.isKnown() {
+		return
+	}
+
+	metadata, diags := data.metadata(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// nodes that cannot be listed are bootstrapped by the next plan
+	nodes, err := orchestrate.ListNodes(ctx, r.k8sClient, r.retry, orchestrate.NodeQuery{LabelSelector: data.NodeSelector.ValueString()})
+	if err != nil {
+		return
+	}
+	for _, node := range nodes {
+		if !metadata.appliedTo(node) {
+			resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("nodes"), types.ListUnknown(types.StringType))...)
+			return
+		}
+	}
+}
+
+func (r *NodeBootstrapResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data *NodeBootstrapResourceModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.apply(ctx, data, nodeMetadata{}, "Error creating node bootstrap", &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *NodeBootstrapResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data *NodeBootstrapResourceModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	metadata, diags := data.metadata(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	nodes, err := orchestrate.ListNodes(ctx, r.k8sClient, r.retry, orchestrate.NodeQuery{LabelSelector: data.NodeSelector.ValueString()})
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Error reading node bootstrap",
+			fmt.Sprintf("Could not read node bootstrap, unexpected error listing nodes with selector %s: %s", data.NodeSelector.ValueString(), err.Error()),
+		)
+		return
+	}
+
+	bootstrapped := []string{}
+	for _, node := range nodes {
+		if metadata.appliedTo(node) {
+			bootstrapped = append(bootstrapped, node.Name)
+		}
+	}
+	sort.Strings(bootstrapped)
+	data.Nodes, diags = types.ListValueFrom(ctx, types.StringType, bootstrapped)
+	resp.Diagnostics.Append(diags...)
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *NodeBootstrapResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data, prior *NodeBootstrapResourceModel
+
+	// Read Terraform plan and prior state data into the models
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &prior)...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	removed, diags := data.removedMetadata(ctx, prior)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.apply(ctx, data, removed, "Error updating node bootstrap", &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *NodeBootstrapResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data *NodeBootstrapResourceModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	removed, diags := data.metadata(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if r.rbacProfile == rbacProfileEvictOnly {
+		resp.Diagnostics.AddError(
+			"Error deleting node bootstrap",
+			fmt.Sprintf("Could not delete node bootstrap %s, nodes cannot be updated with the evict_only RBAC profile. Grant the provider the update permission on nodes.", data.NodeSelector.ValueString()),
+		)
+		return
+	}
+
+	if _, err := applyNodeMetadata(ctx, r.k8sClient, r.retry, data.NodeSelector.ValueString(), nodeMetadata{}, removed); err != nil {
+		resp.Diagnostics.AddError(
+			"Error deleting node bootstrap",
+			fmt.Sprintf("Could not delete node bootstrap %s, unexpected error removing the metadata from the nodes: %s", data.NodeSelector.ValueString(), err.Error()),
+		)
+	}
+}
+
+// apply applies the metadata of data to the nodes, removing removed first,
+// and sets the nodes of data.
+func (r *NodeBootstrapResource) apply(ctx context.Context, data *NodeBootstrapResourceModel, removed nodeMetadata, summary string, diags *diag.Diagnostics) {
+	metadata, d := data.metadata(ctx)
+	diags.Append(d...)
+	if diags.HasError() {
+		return
+	}
+
+	if r.rbacProfile == rbacProfileEvictOnly {
+		diags.AddError(
+			summary,
+			fmt.Sprintf("Could not bootstrap the nodes matching %s, nodes cannot be updated with the evict_only RBAC profile. Grant the provider the update permission on nodes.", data.NodeSelector.ValueString()),
+		)
+		return
+	}
+
+	nodes, err := applyNodeMetadata(ctx, r.k8sClient, r.retry, data.NodeSelector.ValueString(), metadata, removed)
+	if err != nil {
+		diags.AddError(
+			summary,
+			fmt.Sprintf("Could not bootstrap the nodes matching %s, unexpected error applying the metadata: %s", data.NodeSelector.ValueString(), err.Error()),
+		)
+		return
+	}
+
+	sort.Strings(nodes)
+	data.Nodes, d = types.ListValueFrom(ctx, types.StringType, nodes)
+	diags.Append(d...)
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// nodeEventComponent is the source of the Events created on the nodes
+	nodeEventComponent = "k8snp"
+
+	reasonCordoned       = "CordonedByTerraform"
+	reasonDrainStarted   = "DrainStartedByTerraform"
+	reasonDrainCompleted = "DrainCompleted"
+)
+
+// runIDEnvVar is the environment variable holding the ID of the run
+// in HCP Terraform, used as the default run_id of the provider.
+const runIDEnvVar = "TFC_RUN_ID"
+
+// nodeEventRecorder creates Events on the nodes of a node pool as they are
+// cordoned and drained, so that the disruptions seen with `kubectl get
+// events` can be correlated with the terraform run causing them.
+type nodeEventRecorder struct {
+	client kubernetes.Interface
+	runID  string
+}
+
+// record creates an Event with reason and message on node. Failures are only
+// logged as Events must never fail an operation.
+func (r *nodeEventRecorder) record(ctx context.Context, node v1.Node, reason, message string) {
+	if r == nil {
+		return
+	}
+
+	if r.runID != "" {
+		message += " in terraform run " + r.runID
+	}
+
+	now := metav1.NewTime(time.Now())
+	e := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: node.Name + ".",
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       node.Name,
+			UID:        node.UID,
+		},
+		Reason:              reason,
+		Message:             message,
+		Type:                v1.EventTypeNormal,
+		Source:              v1.EventSource{Component: nodeEventComponent},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: nodeEventComponent,
+	}
+
+	if _, err := r.client.CoreV1().Events(metav1.NamespaceDefault).Create(ctx, e, metav1.CreateOptions{}); err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to create %s event on node %s: %s", reason, node.Name, err.Error()))
+	}
+}
@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultNodeJobNamespace = metav1.NamespaceDefault
+	defaultNodeJobTimeout   = 5 * time.Minute
+
+	// nodeJobTTL is how long the finished node Jobs are kept,
+	// should their deletion fail
+	nodeJobTTL = int32(3600)
+
+	// nodeNameEnvVar holds the name of the node in the node Jobs
+	nodeNameEnvVar = "NODE_NAME"
+)
+
+// nodeJob is a Job run for each node of the pool around its drain, e.g. to
+// deregister the node from a service mesh before it is drained or to verify
+// that no volume is still mounted once it is.
+type nodeJob struct {
+	// name describes the Job in its name and the errors
+	name      string
+	namespace string
+	image     string
+	command   []string
+	env       map[string]string
+	// timeout is how long the Job can run before the drain fails
+	timeout time.Duration
+	// onNode binds the pod of the Job to the node, tolerating all the
+	// taints, instead of letting it be scheduled on any node
+	onNode bool
+}
+
+// nodeJobStep runs a nodeJob for each node drained from node pool poolName.
+type nodeJobStep struct {
+	job      *nodeJob
+	client   kubernetes.Interface
+	retry    orchestrate.RetryPolicy
+	poolName string
+}
+
+// Run runs the Job for node and waits for it to succeed.
+func (s nodeJobStep) Run(ctx context.Context, node v1.Node) error {
+	return runJob(ctx, s.client, s.retry, s.job.name, s.job.job(node.Name, s.poolName), s.job.timeout, "node "+node.Name)
+}
+
+// jobInterval is the wait between the checks of the status of a Job.
+var jobInterval = 2 * time.Second
+
+// runJob creates k8sJob, waits up to timeout for it to succeed and deletes
+// it. name describes the Job, and target what it runs for, in the errors.
+func runJob(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, name string, k8sJob *batchv1.Job, timeout time.Duration, target string) error {
+	err := retry.Do(ctx, fmt.Sprintf("creating %s job for %s", name, target), func() error {
+		var err error
+		k8sJob, err = client.BatchV1().Jobs(k8sJob.Namespace).Create(ctx, k8sJob, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create the %s job for %s: %w", name, target, err)
+	}
+
+	// the Job and its pod are deleted even when the drain was cancelled
+	defer func() {
+		propagation := metav1.DeletePropagationBackground
+		err := retry.Do(context.WithoutCancel(ctx), "deleting job "+k8sJob.Name, func() error {
+			return client.BatchV1().Jobs(k8sJob.Namespace).Delete(context.WithoutCancel(ctx), k8sJob.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			tflog.Warn(ctx, fmt.Sprintf("failed to delete %s job %s/%s: %s", name, k8sJob.Namespace, k8sJob.Name, err.Error()))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tflog.Debug(ctx, fmt.Sprintf("waiting for %s job %s/%s for %s", name, k8sJob.Namespace, k8sJob.Name, target))
+	for {
+		var status batchv1.JobStatus
+		err := retry.Do(ctx, "getting job "+k8sJob.Name, func() error {
+			current, err := client.BatchV1().Jobs(k8sJob.Namespace).Get(ctx, k8sJob.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			status = current.Status
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get %s job %s/%s: %w", name, k8sJob.Namespace, k8sJob.Name, err)
+		}
+
+		if status.Succeeded > 0 {
+			return nil
+		}
+		if status.Failed > 0 {
+			return fmt.Errorf("%s job %s/%s failed for %s, check the logs of its pod", name, k8sJob.Namespace, k8sJob.Name, target)
+		}
+
+		if err := orchestrate.Sleep(ctx, jobInterval); err != nil {
+			return fmt.Errorf("%s job %s/%s did not complete for %s: %w", name, k8sJob.Namespace, k8sJob.Name, target, err)
+		}
+	}
+}
+
+// job returns the Job run for nodeName, whose name is in the NODE_NAME
+// environment variable of its container, or for no node when empty.
+func (j nodeJob) job(nodeName, poolName string) *batchv1.Job {
+	backoffLimit := int32(0)
+	ttl := nodeJobTTL
+	activeDeadline := int64(j.timeout.Seconds())
+
+	var env []v1.EnvVar
+	annotations := map[string]string{"k8snp.io/node-pool": poolName}
+	if nodeName != "" {
+		env = append(env, v1.EnvVar{Name: nodeNameEnvVar, Value: nodeName})
+		annotations["k8snp.io/node"] = nodeName
+	}
+	names := make([]string, 0, len(j.env))
+	for name := range j.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, v1.EnvVar{Name: name, Value: j.env[name]})
+	}
+
+	podSpec := v1.PodSpec{
+		RestartPolicy: v1.RestartPolicyNever,
+		Containers: []v1.Container{{
+			Name:    j.name,
+			Image:   j.image,
+			Command: j.command,
+			Env:     env,
+		}},
+	}
+	// binding the pod to the node bypasses the scheduler, and so the cordon
+	if j.onNode {
+		podSpec.NodeName = nodeName
+		podSpec.Tolerations = []v1.Toleration{{Operator: v1.TolerationOpExists}}
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "k8snp-" + j.name + "-",
+			Namespace:    j.namespace,
+			Labels:       map[string]string{"app.kubernetes.io/managed-by": "k8snp"},
+			Annotations:  annotations,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			ActiveDeadlineSeconds:   &activeDeadline,
+			Template:                v1.PodTemplateSpec{Spec: podSpec},
+		},
+	}
+}
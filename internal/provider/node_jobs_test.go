@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// serveJobs makes client name the Jobs it creates after their generated
+// name, and report the status returned by status for the gets-th get of
+// job. It returns the names of the Jobs created, in order.
+func serveJobs(client *fake.Clientset, status func(job *batchv1.Job, gets int) batchv1.JobStatus) *[]string {
+	var mu sync.Mutex
+	var created []string
+	gets := map[string]int{}
+
+	client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job).DeepCopy()
+		job.Name = job.GenerateName + strconv.Itoa(len(created)+1)
+		created = append(created, job.Name)
+		return true, job, client.Tracker().Add(job)
+	})
+	client.PrependReactor("get", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj, err := client.Tracker().Get(batchv1.SchemeGroupVersion.WithResource("jobs"), action.GetNamespace(), action.(k8stesting.GetAction).GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		job := obj.(*batchv1.Job).DeepCopy()
+		gets[job.Name]++
+		job.Status = status(job, gets[job.Name])
+		return true, job, nil
+	})
+	return &created
+}
+
+func TestNodeJobSpec(t *testing.T) {
+	tests := map[string]struct {
+		onNode      bool
+		nodeName    string
+		tolerations []v1.Toleration
+		env         []v1.EnvVar
+	}{
+		"on node": {
+			onNode:      true,
+			nodeName:    "node-1",
+			tolerations: []v1.Toleration{{Operator: v1.TolerationOpExists}},
+			env:         []v1.EnvVar{{Name: nodeNameEnvVar, Value: "node-1"}, {Name: "A", Value: "1"}, {Name: "B", Value: "2"}},
+		},
+		"scheduled": {
+			env: []v1.EnvVar{{Name: nodeNameEnvVar, Value: "node-1"}, {Name: "A", Value: "1"}, {Name: "B", Value: "2"}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			j := nodeJob{
+				name:      "verify",
+				namespace: "jobs",
+				image:     "busybox",
+				command:   []string{"true"},
+				env:       map[string]string{"B": "2", "A": "1"},
+				timeout:   90 * time.Second,
+				onNode:    test.onNode,
+			}
+
+			job := j.job("node-1", "pool")
+			if job.GenerateName != "k8snp-verify-" || job.Namespace != "jobs" {
+				t.Errorf("unexpected job name %s in namespace %s", job.GenerateName, job.Namespace)
+			}
+			if expected := map[string]string{"k8snp.io/node-pool": "pool", "k8snp.io/node": "node-1"}; !reflect.DeepEqual(job.Annotations, expected) {
+				t.Errorf("expected annotations %v, got %v", expected, job.Annotations)
+			}
+			if *job.Spec.BackoffLimit != 0 || *job.Spec.ActiveDeadlineSeconds != 90 || *job.Spec.TTLSecondsAfterFinished != nodeJobTTL {
+				t.Errorf("unexpected job spec %+v", job.Spec)
+			}
+
+			pod := job.Spec.Template.Spec
+			if pod.NodeName != test.nodeName || !reflect.DeepEqual(pod.Tolerations, test.tolerations) {
+				t.Errorf("expected node %q and tolerations %v, got %q and %v", test.nodeName, test.tolerations, pod.NodeName, pod.Tolerations)
+			}
+			if pod.RestartPolicy != v1.RestartPolicyNever {
+				t.Errorf("expected the pod never to be restarted, got %s", pod.RestartPolicy)
+			}
+			container := pod.Containers[0]
+			if container.Image != "busybox" || !reflect.DeepEqual(container.Command, []string{"true"}) || !reflect.DeepEqual(container.Env, test.env) {
+				t.Errorf("unexpected container %+v", container)
+			}
+		})
+	}
+}
+
+func TestRunNodeJob(t *testing.T) {
+	defer func(interval time.Duration) { jobInterval = interval }(jobInterval)
+	jobInterval = time.Millisecond
+
+	tests := map[string]struct {
+		// statuses are the status of the Job at each get, the last
+		// one for all the gets after
+		statuses  []batchv1.JobStatus
+		createErr error
+		// cancelled cancels the drain while the Job is running
+		cancelled bool
+		err       string
+		gets      int
+	}{
+		"succeeded": {
+			statuses: []batchv1.JobStatus{{Active: 1}, {Active: 1}, {Succeeded: 1}},
+			gets:     3,
+		},
+		"failed": {
+			statuses: []batchv1.JobStatus{{Active: 1}, {Failed: 1}},
+			err:      "verify job default/k8snp-verify-1 failed for node node-1, check the logs of its pod",
+			gets:     2,
+		},
+		"timed out": {
+			statuses: []batchv1.JobStatus{{Active: 1}},
+			err:      "verify job default/k8snp-verify-1 did not complete for node node-1",
+		},
+		"cancelled": {
+			statuses:  []batchv1.JobStatus{{Active: 1}},
+			cancelled: true,
+			err:       "verify job default/k8snp-verify-1 did not complete for node node-1: context canceled",
+			gets:      1,
+		},
+		"not created": {
+			createErr: apierrors.NewForbidden(batchv1.Resource("jobs"), "", errors.New("denied")),
+			err:       "failed to create the verify job for node node-1",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := fake.NewSimpleClientset()
+			gets := 0
+			created := serveJobs(client, func(_ *batchv1.Job, get int) batchv1.JobStatus {
+				gets = get
+				if test.cancelled {
+					cancel()
+				}
+				return test.statuses[min(get, len(test.statuses))-1]
+			})
+			if test.createErr != nil {
+				client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, test.createErr
+				})
+			}
+			job := &nodeJob{name: "verify", namespace: defaultNodeJobNamespace, image: "busybox", timeout: 50 * time.Millisecond, onNode: true}
+			step := nodeJobStep{job: job, client: client, retry: orchestrate.DefaultRetryPolicy(), poolName: "pool"}
+
+			err := step.Run(ctx, *newTestNode("node-1", nil, true))
+			if test.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.HasPrefix(err.Error(), test.err)) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+			if test.gets > 0 && gets != test.gets {
+				t.Errorf("expected %d gets of the job, got %d", test.gets, gets)
+			}
+
+			// the job is deleted whatever its outcome
+			jobs, err := client.BatchV1().Jobs(defaultNodeJobNamespace).List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(jobs.Items) != 0 {
+				t.Errorf("expected the jobs to be deleted, got %d", len(jobs.Items))
+			}
+			for _, action := range client.Actions() {
+				if deleteAction, ok := action.(k8stesting.DeleteAction); ok && action.GetResource().Resource == "jobs" {
+					if policy := deleteAction.GetDeleteOptions().PropagationPolicy; policy == nil || *policy != metav1.DeletePropagationBackground {
+						t.Errorf("expected the pods of the job to be deleted with it, got %v", policy)
+					}
+				}
+			}
+			if test.createErr == nil && len(*created) != 1 {
+				t.Errorf("expected one job to be created, got %v", *created)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	clientretry "k8s.io/client-go/util/retry"
+)
+
+// nodeMetadata is the metadata applied by k8snp_node_bootstrap to the nodes
+// matching its selector.
+type nodeMetadata struct {
+	labels      map[string]string
+	annotations map[string]string
+	taints      []v1.Taint
+}
+
+// appliedTo reports whether node carries all of m.
+func (m nodeMetadata) appliedTo(node v1.Node) bool {
+	for key, value := range m.labels {
+		if current, ok := node.Labels[key]; !ok || current != value {
+			return false
+		}
+	}
+	for key, value := range m.annotations {
+		if current, ok := node.Annotations[key]; !ok || current != value {
+			return false
+		}
+	}
+	for _, taint := range m.taints {
+		if !hasTaint(node, taint) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply removes the metadata in removed from node, then sets m on it. It
+// reports whether node changed. The labels, annotations and taints of
+// removed are only removed while they keep the value applied to node, those
+// set since by someone else are left untouched.
+func (m nodeMetadata) apply(node *v1.Node, removed nodeMetadata) bool {
+	changed := false
+
+	for key, value := range removed.labels {
+		if current, ok := node.Labels[key]; ok && current == value {
+			delete(node.Labels, key)
+			changed = true
+		}
+	}
+	for key, value := range removed.annotations {
+		if current, ok := node.Annotations[key]; ok && current == value {
+			delete(node.Annotations, key)
+			changed = true
+		}
+	}
+
+	taints := make([]v1.Taint, 0, len(node.Spec.Taints)+len(m.taints))
+	for _, taint := range node.Spec.Taints {
+		wanted := findTaint(m.taints, taint)
+		previous := findTaint(removed.taints, taint)
+		switch {
+		case wanted != nil && wanted.Value == taint.Value:
+			taints = append(taints, taint)
+		case wanted != nil || (previous != nil && previous.Value == taint.Value):
+			// removed, or replaced below by the taint with the wanted value
+			changed = true
+		default:
+			taints = append(taints, taint)
+		}
+	}
+	for _, taint := range m.taints {
+		if findTaint(taints, taint) == nil {
+			taints = append(taints, taint)
+			changed = true
+		}
+	}
+	node.Spec.Taints = taints
+
+	for key, value := range m.labels {
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+		if current, ok := node.Labels[key]; !ok || current != value {
+			node.Labels[key] = value
+			changed = true
+		}
+	}
+	for key, value := range m.annotations {
+		if node.Annotations == nil {
+			node.Annotations = map[string]string{}
+		}
+		if current, ok := node.Annotations[key]; !ok || current != value {
+			node.Annotations[key] = value
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// hasTaint reports whether node has taint, with the same value.
+func hasTaint(node v1.Node, taint v1.Taint) bool {
+	existing := findTaint(node.Spec.Taints, taint)
+	return existing != nil && existing.Value == taint.Value
+}
+
+// findTaint returns the taint of taints with the key and effect of taint,
+// or nil when there is none.
+func findTaint(taints []v1.Taint, taint v1.Taint) *v1.Taint {
+	for i := range taints {
+		if taints[i].MatchTaint(&taint) {
+			return &taints[i]
+		}
+	}
+	return nil
+}
+
+// applyNodeMetadata applies m to the nodes matching selector, removing the
+// metadata in removed first, and returns the names of the matching nodes.
+// The nodes already carrying m are left untouched. The update of a node
+// changed since it was read is retried on the node read again.
+func applyNodeMetadata(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, selector string, m, removed nodeMetadata) ([]string, error) {
+	nodes, err := orchestrate.ListNodes(ctx, client, retry, orchestrate.NodeQuery{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		tflog.Debug(ctx, fmt.Sprintf("applying the metadata of the nodes matching %s to node %s", selector, node.Name))
+		err := retry.Do(ctx, "updating node "+node.Name, func() error {
+			return clientretry.RetryOnConflict(clientretry.DefaultRetry, func() error {
+				current, err := client.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				if !m.apply(current, removed) {
+					return nil
+				}
+				_, err = client.CoreV1().Nodes().Update(ctx, current, metav1.UpdateOptions{})
+				return err
+			})
+		})
+		// the node may have been removed since it was listed
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to update node %s: %w", node.Name, err)
+		}
+	}
+
+	return nodeNames(nodes), nil
+}
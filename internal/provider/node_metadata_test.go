@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNodeMetadataApplyKeepsChangedValues(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "node-1",
+			Labels:      map[string]string{"applied": "a", "changed": "by-someone-else"},
+			Annotations: map[string]string{"applied": "a", "changed": "by-someone-else"},
+		},
+		Spec: v1.NodeSpec{Taints: []v1.Taint{
+			{Key: "applied", Value: "a", Effect: v1.TaintEffectNoSchedule},
+			{Key: "changed", Value: "by-someone-else", Effect: v1.TaintEffectNoSchedule},
+		}},
+	}
+	removed := nodeMetadata{
+		labels:      map[string]string{"applied": "a", "changed": "b"},
+		annotations: map[string]string{"applied": "a", "changed": "b"},
+		taints: []v1.Taint{
+			{Key: "applied", Value: "a", Effect: v1.TaintEffectNoSchedule},
+			{Key: "changed", Value: "b", Effect: v1.TaintEffectNoSchedule},
+		},
+	}
+
+	if !(nodeMetadata{}).apply(node, removed) {
+		t.Fatalf("expected the node to change")
+	}
+
+	expected := map[string]string{"changed": "by-someone-else"}
+	if !reflect.DeepEqual(node.Labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, node.Labels)
+	}
+	if !reflect.DeepEqual(node.Annotations, expected) {
+		t.Errorf("expected annotations %v, got %v", expected, node.Annotations)
+	}
+	expectedTaints := []v1.Taint{{Key: "changed", Value: "by-someone-else", Effect: v1.TaintEffectNoSchedule}}
+	if !reflect.DeepEqual(node.Spec.Taints, expectedTaints) {
+		t.Errorf("expected taints %v, got %v", expectedTaints, node.Spec.Taints)
+	}
+}
+
+func TestApplyNodeMetadataRetriesConflicts(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(newTestNode("node-1", map[string]string{"pool": "a"}, true))
+	conflicts := 0
+	client.PrependReactor("update", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrors.NewConflict(v1.Resource("nodes"), "node-1", nil)
+	})
+
+	m := nodeMetadata{labels: map[string]string{"bootstrapped": "true"}}
+	if _, err := applyNodeMetadata(ctx, client, orchestrate.DefaultRetryPolicy(), "pool=a", m, nodeMetadata{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	node, err := client.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !m.appliedTo(*node) {
+		t.Errorf("expected the metadata to be applied after the conflict, got labels %v", node.Labels)
+	}
+}
@@ -0,0 +1,903 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"go.opentelemetry.io/otel/attribute"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+)
+
+func (r *NodePoolResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data *NodePoolResourceModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.DeletionProtect.ValueBool() {
+		resp.Diagnostics.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool %s, deletion protection is enabled. Set deletion_protection to false and apply the change before destroying the resource.", data.NodePoolName.ValueString()),
+		)
+		return
+	}
+
+	ctx, span := startSpan(ctx, "delete node pool", attribute.String("node_pool", data.NodePoolName.ValueString()))
+	defer span.End()
+
+	r.resumeAsyncDestroysOnce(ctx, &resp.Diagnostics)
+
+	events := newEventStream(r.eventStream, data.NodePoolName.ValueString())
+	defer events.finish(ctx, &resp.Diagnostics)
+	events.phase(ctx, "started")
+
+	// the wait for the maintenance window is not part of the delete timeout
+	maintenance := waitForMaintenance(ctx, data, events, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	deleteTimeout := data.deleteTimeout()
+	if deleteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deleteTimeout)
+		defer cancel()
+	}
+
+	r.waitForHandles(ctx, data, events, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	tflog.Debug(ctx, fmt.Sprintf("draining node pool %s", data.NodePoolName.ValueString()))
+
+	plannedNodesJSON, diags := req.Private.GetKey(ctx, plannedNodesKey)
+	resp.Diagnostics.Append(diags...)
+	drainedNodesJSON, diags := req.Private.GetKey(ctx, drainedNodesKey)
+	resp.Diagnostics.Append(diags...)
+	query, nodes, drainedNodes := r.nodesToDrain(ctx, data, plannedNodesJSON, drainedNodesJSON, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	metrics := orchestrate.NewMetrics(r.pushgatewayURL, data.NodePoolName.ValueString())
+	defer metrics.Push(ctx)
+
+	observer := &drainObserver{poolName: data.NodePoolName.ValueString(), events: events}
+	drainer := r.newDrainer(ctx, data, observer, metrics, maintenance, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if r.dryRun {
+		// the destroy fails, like with the dry_run argument, so that the
+		// node pool, and the resources depending on it, are kept
+		defer func() {
+			if resp.Diagnostics.HasError() {
+				return
+			}
+			resp.Diagnostics.AddError(
+				"Dry run of safe node pool destroy",
+				fmt.Sprintf("Node pool %s was not destroyed as the provider dry_run is set, its nodes were cordoned and drained with server-side dry runs, leaving the nodes and their pods unchanged. Unset dry_run to destroy it.", data.NodePoolName.ValueString()),
+			)
+		}()
+	}
+
+	if !data.SkipCapacityCheck.ValueBool() {
+		shortfall, err := drainer.CheckCapacity(ctx, nodes)
+		if err != nil {
+			resp.Diagnostics.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool, unexpected error checking the capacity of the other nodes: %s", err.Error()),
+			)
+			return
+		}
+		if shortfall != nil {
+			resp.Diagnostics.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool %s, the pods to evict would not fit on the other nodes, %s. Add capacity to the cluster or set skip_capacity_check to true.", data.NodePoolName.ValueString(), shortfall),
+			)
+			return
+		}
+	}
+
+	if data.DryRun.ValueBool() {
+		// the destroy fails so that the node pool, and
+		// the resources depending on it, are kept
+		resp.Diagnostics.AddError(
+			"Dry run of safe node pool destroy",
+			fmt.Sprintf("Node pool %s was not destroyed as dry_run is set, no node was cordoned and no pod was evicted. Set dry_run to false to destroy it. The destroy would drain %d nodes in this order:\n%s",
+				data.NodePoolName.ValueString(), len(nodes), drainer.DryRunReport(ctx, nodes)),
+		)
+		return
+	}
+
+	if data.Approval != nil {
+		if err := data.Approval.approval().waitForApproval(ctx, data.NodePoolName.ValueString(), len(nodes)); err != nil {
+			resp.Diagnostics.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool %s, %s", data.NodePoolName.ValueString(), err.Error()),
+			)
+			return
+		}
+	}
+
+	if data.Notifications != nil {
+		var diags diag.Diagnostics
+		observer.notifier, diags = data.Notifications.notifier(ctx)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+		observer.notifier.nodePoolName = data.NodePoolName.ValueString()
+		observer.notifier.dryRun = r.dryRun
+		observer.notifier.async = data.AsyncDestroy.ValueBool()
+		// the end of the destroy is notified even when it was cancelled
+		defer observer.notifier.finish(context.WithoutCancel(ctx), &resp.Diagnostics)
+	}
+
+	defer func() {
+		if resp.Diagnostics.HasError() {
+			var undrained []string
+			drained := drainer.DrainedNodes()
+			for _, node := range nodes {
+				if !containsAny(drained, node.Name) {
+					undrained = append(undrained, node.Name)
+				}
+			}
+			collectFailureDump(ctx, r.k8sClient, r.retry, data.NodePoolName.ValueString(), query, diagnosticsDetail(resp.Diagnostics), undrained).
+				report(ctx, data.FailureDumpPath.ValueString())
+		}
+	}()
+
+	if data.DeleteDrained.ValueBool() && r.rbacProfile == rbacProfileEvictOnly {
+		resp.Diagnostics.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool %s, nodes cannot be deleted with the evict_only RBAC profile. Set delete_node_after_drain to false or grant the provider the delete permission on nodes.", data.NodePoolName.ValueString()),
+		)
+		return
+	}
+
+	// the scale down is enabled again, and the Flux objects
+	// resumed, even when the drain was cancelled
+	enableScaleDown := r.pauseScaleDown(ctx, data, query, &resp.Diagnostics)
+	defer enableScaleDown()
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	resumeFlux := r.pauseFlux(ctx, data, &resp.Diagnostics)
+	defer resumeFlux()
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	observer.notifier.started(ctx, len(nodes))
+
+	r.cordonNodes(ctx, data, drainer, nodes, events, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.AsyncDestroy.ValueBool() {
+		// the nodes not drained within the budget are
+		// drained by the next creates and destroys
+		events.phase(ctx, "draining")
+		r.startAsyncDestroy(ctx, data, drainer, nodes, &resp.Diagnostics)
+		return
+	}
+
+	events.phase(ctx, "draining")
+	stopProgress := drainer.ReportProgress(ctx, len(nodes), drainProgressInterval)
+	err := drainNodes(ctx, data, drainer, nodes)
+	stopProgress()
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("the delete timeout of %s was exceeded: %w", deleteTimeout, err)
+		}
+
+		progress := drainProgress{
+			NodePoolName: data.NodePoolName.ValueString(),
+			DrainedNodes: drainedNodes,
+		}
+		// nodes uncordoned after the failure can receive pods again,
+		// so they have to be drained again when resuming, and the
+		// nodes of a dry run were never drained
+		if (!data.UncordonOnFailure.ValueBool() || !uncordonAfterFailure(ctx, drainer, &resp.Diagnostics)) && !r.dryRun {
+			progress.DrainedNodes = append(progress.DrainedNodes, drainer.DrainedNodes()...)
+		}
+
+		// keep track of the drained nodes so that the next destroy skips them
+		// we ignore the error as marshalling a slice of strings cannot fail
+		drainedNodesJSON, _ := json.Marshal(progress.DrainedNodes)
+		resp.Diagnostics.Append(resp.Private.SetKey(ctx, drainedNodesKey, drainedNodesJSON)...)
+
+		resp.Diagnostics.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool %s, %s\n\n"+
+				"%d nodes were drained and will be skipped when destroying the resource again. If the resource is removed from the state, the drain can be resumed without draining them again by importing it with the ID:\n%s",
+				data.NodePoolName.ValueString(), err.Error(), len(progress.DrainedNodes), progress.token()),
+		)
+		return
+	}
+}
+
+// waitForMaintenance waits for the maintenance window of data, when set, and
+// returns its gate so that the drain can pause when the window closes.
+func waitForMaintenance(ctx context.Context, data *NodePoolResourceModel, events *eventStream, diags *diag.Diagnostics) *maintenanceGate {
+	if data.Maintenance == nil {
+		return nil
+	}
+
+	maintenance, gateDiags := data.Maintenance.gate(ctx)
+	diags.Append(gateDiags...)
+	if diags.HasError() {
+		return nil
+	}
+
+	if !maintenance.window.contains(time.Now()) {
+		events.phase(ctx, "waiting_for_maintenance_window")
+	}
+	if err := maintenance.wait(ctx); err != nil {
+		diags.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool %s, %s.", data.NodePoolName.ValueString(), err.Error()),
+		)
+		return nil
+	}
+	return maintenance
+}
+
+// waitForHandles waits for the node pools of the handles in wait_for_handles
+// to have their minimum number of ready nodes before the drain.
+func (r *NodePoolResource) waitForHandles(ctx context.Context, data *NodePoolResourceModel, events *eventStream, diags *diag.Diagnostics) {
+	if data.WaitForHandles.IsNull() {
+		return
+	}
+
+	var handles []string
+	diags.Append(data.WaitForHandles.ElementsAs(ctx, &handles, false)...)
+	if diags.HasError() {
+		return
+	}
+
+	readyTimeout := data.readyTimeout()
+
+	events.phase(ctx, "waiting_for_handles")
+	for _, token := range handles {
+		handle, err := parseReadyHandle(token)
+		if err != nil {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool, invalid handle in wait_for_handles: %s", err.Error()),
+			)
+			return
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for %d nodes to be ready in node pool %s before draining node pool %s", handle.MinReadyNodes, handle.NodePoolName, data.NodePoolName.ValueString()))
+
+		// the nodes of node pools managed by Cluster API are those
+		// of their machines now, which may have been replaced since
+		handleQuery := handle.query()
+		if err := r.findMachineNodes(ctx, &handleQuery); err != nil {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool %s, unexpected error finding the nodes of node pool %s: %s", data.NodePoolName.ValueString(), handle.NodePoolName, err.Error()),
+			)
+			return
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, readyTimeout)
+		numReadyNodes, err := orchestrate.WaitForReadyNodes(waitCtx, r.k8sClient, handleQuery, handle.MinReadyNodes, func(v1.Node) bool { return true }, orchestrate.ReadinessCriteria{})
+		cancel()
+		if err != nil {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool %s, found %d ready nodes in node pool %s instead of %d: %s", data.NodePoolName.ValueString(), numReadyNodes, handle.NodePoolName, handle.MinReadyNodes, err.Error()),
+			)
+			return
+		}
+	}
+}
+
+// nodesToDrain returns the query of the nodes of the node pool and those of
+// its nodes to drain, in the drain order, with the nodes already drained by
+// an interrupted destroy, found in drainedNodesJSON, and the nodes skipped
+// by the configuration left out. The nodes drained before are also returned
+// to be recorded again if the drain fails. plannedNodesJSON holds the nodes
+// listed when the destroy was planned, if any.
+func (r *NodePoolResource) nodesToDrain(ctx context.Context, data *NodePoolResourceModel, plannedNodesJSON, drainedNodesJSON []byte, diags *diag.Diagnostics) (orchestrate.NodeQuery, []v1.Node, []string) {
+	query, queryDiags := data.nodeQuery(ctx)
+	diags.Append(queryDiags...)
+	if diags.HasError() {
+		return query, nil, nil
+	}
+
+	if err := r.findMachineNodes(ctx, &query); err != nil {
+		diags.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool, unexpected error finding the nodes in pool %s: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+		return query, nil, nil
+	}
+
+	nodes, err := orchestrate.ListNodes(ctx, r.k8sClient, r.retry, query)
+	if err != nil {
+		diags.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool, unexpected error listing nodes in pool %s: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+		return query, nil, nil
+	}
+	if len(nodes) == 0 {
+		data.checkEmptyPool(query, "Error deleting safe node pool", diags)
+		if diags.HasError() {
+			return query, nil, nil
+		}
+	}
+
+	// compare the nodes with those listed when the destroy was planned
+	if plannedNodesJSON != nil {
+		var plannedNodes []string
+		if err := json.Unmarshal(plannedNodesJSON, &plannedNodes); err != nil {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool, unexpected error reading the planned nodes of pool %s: %s", data.NodePoolName.ValueString(), err.Error()),
+			)
+			return query, nil, nil
+		}
+
+		added, removed := diffNodeSets(plannedNodes, nodes)
+		if len(added) > 0 || len(removed) > 0 {
+			tflog.Warn(ctx, "nodes in the node pool changed since the destroy was planned", map[string]interface{}{
+				"node_pool":     data.NodePoolName.ValueString(),
+				"added_nodes":   added,
+				"removed_nodes": removed,
+			})
+		}
+		// the attribute is null in the state of resources created before it existed
+		if len(added) > 0 && data.AllowNodeDrift.Equal(types.BoolValue(false)) {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool %s, nodes %s were added to the pool after the destroy was planned. Plan the destroy again or set allow_node_set_drift to drain them.", data.NodePoolName.ValueString(), strings.Join(added, ", ")),
+			)
+			return query, nil, nil
+		}
+	}
+
+	// skip the nodes drained before the drain was interrupted
+	var drainedNodes []string
+	if drainedNodesJSON != nil {
+		if err := json.Unmarshal(drainedNodesJSON, &drainedNodes); err != nil {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool, unexpected error reading the drained nodes of pool %s: %s", data.NodePoolName.ValueString(), err.Error()),
+			)
+			return query, nil, nil
+		}
+
+		nodes = orchestrate.FilterNodes(nodes, func(node v1.Node) bool {
+			if containsAny(drainedNodes, node.Name) {
+				tflog.Debug(ctx, fmt.Sprintf("skipping node %s already drained", node.Name))
+				return false
+			}
+			return true
+		})
+	}
+
+	// the progress of destroys interrupted before it was saved
+	// is found from the annotations of the nodes
+	if data.AnnotateNodes.ValueBool() {
+		nodes = orchestrate.FilterNodes(nodes, func(node v1.Node) bool {
+			if orchestrate.DrainCompletedBy(node, data.NodePoolName.ValueString()) {
+				tflog.Debug(ctx, fmt.Sprintf("skipping node %s whose drain completed before", node.Name))
+				return false
+			}
+			return true
+		})
+	}
+
+	nodes = data.skipNodes(ctx, nodes, diags)
+	if diags.HasError() {
+		return query, nil, nil
+	}
+
+	// skipped nodes set to fail the destroy do so before any node is cordoned
+	*diags = data.overrideDiagnostics(ctx, *diags)
+	if diags.HasError() {
+		return query, nil, nil
+	}
+
+	nodes, err = orchestrate.SortNodesForDrain(ctx, r.k8sClient, r.retry, nodes, data.DrainOrder.ValueString())
+	if err != nil {
+		diags.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool, unexpected error sorting nodes in pool %s: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+		return query, nil, nil
+	}
+
+	return query, nodes, drainedNodes
+}
+
+// skipNodes returns nodes without the control plane nodes, the virtual nodes
+// and the excluded nodes that are not to be drained, warning about each of
+// them.
+func (m *NodePoolResourceModel) skipNodes(ctx context.Context, nodes []v1.Node, diags *diag.Diagnostics) []v1.Node {
+	if !m.IncludeCtrlPlane.ValueBool() {
+		nodes = orchestrate.FilterNodes(nodes, func(node v1.Node) bool {
+			if !orchestrate.IsControlPlaneNode(node) {
+				return true
+			}
+			diags.Append(newNamedWarning(
+				diagControlPlaneNodes,
+				"Skipping control plane node",
+				fmt.Sprintf("Node %s in pool %s is a control plane node and will not be cordoned or drained. Set include_control_plane_nodes to drain it.", node.Name, m.NodePoolName.ValueString()),
+			))
+			return false
+		})
+	}
+
+	if !m.IncludeVirtual.ValueBool() {
+		var virtualNodes []v1.Node
+		nodes, virtualNodes = orchestrate.ExcludeVirtualNodes(nodes)
+		for _, node := range virtualNodes {
+			diags.Append(newNamedWarning(
+				diagVirtualNodes,
+				"Skipping virtual node",
+				fmt.Sprintf("Node %s in pool %s is a virtual node and will not be cordoned or drained. Set include_virtual_nodes to drain it.", node.Name, m.NodePoolName.ValueString()),
+			))
+		}
+	}
+
+	var excludedNames []string
+	if !m.ExcludeNodes.IsNull() {
+		diags.Append(m.ExcludeNodes.ElementsAs(ctx, &excludedNames, false)...)
+		if diags.HasError() {
+			return nil
+		}
+	}
+	// we ignore the error as the validator for the argument in the schema
+	// definition ensures its validity
+	excludeSelector, _ := labels.Parse(m.ExcludeSelector.ValueString())
+	if len(excludedNames) > 0 || !excludeSelector.Empty() {
+		var excludedNodes []string
+		nodes = orchestrate.FilterNodes(nodes, func(node v1.Node) bool {
+			if containsAny(excludedNames, node.Name) || (!excludeSelector.Empty() && excludeSelector.Matches(labels.Set(node.Labels))) {
+				excludedNodes = append(excludedNodes, node.Name)
+				return false
+			}
+			return true
+		})
+
+		if len(excludedNodes) > 0 {
+			diags.Append(newNamedWarning(
+				diagExcludedNodes,
+				"Skipping excluded nodes",
+				fmt.Sprintf("Nodes %s in pool %s are excluded and will not be cordoned or drained.", strings.Join(excludedNodes, ", "), m.NodePoolName.ValueString()),
+			))
+		}
+	}
+
+	return nodes
+}
+
+// newDrainer returns the drainer of the nodes of the node pool configured
+// by data, after checking that the evictions can go through.
+func (r *NodePoolResource) newDrainer(ctx context.Context, data *NodePoolResourceModel, observer *drainObserver, metrics *orchestrate.Metrics, maintenance *maintenanceGate, diags *diag.Diagnostics) *orchestrate.Drainer {
+	drainOptions := data.DrainOptions.options()
+	drainOptions.PodSelector = data.DrainPodSelector.ValueString()
+	if data.RespectSafeEvict.ValueBool() {
+		drainOptions.UnsafeToEvict = data.SafeEvictAction.ValueString()
+	}
+	if !data.IncludeNamespaces.IsNull() {
+		diags.Append(data.IncludeNamespaces.ElementsAs(ctx, &drainOptions.IncludeNamespaces, false)...)
+	}
+	if !data.ExcludeNamespaces.IsNull() {
+		diags.Append(data.ExcludeNamespaces.ElementsAs(ctx, &drainOptions.ExcludeNamespaces, false)...)
+	}
+	var evictionGroupOrder []string
+	if !data.EvictionGroups.IsNull() {
+		diags.Append(data.EvictionGroups.ElementsAs(ctx, &evictionGroupOrder, false)...)
+	}
+	if diags.HasError() {
+		return nil
+	}
+
+	r.checkEvictions(ctx, data, drainOptions, diags)
+	if diags.HasError() {
+		return nil
+	}
+
+	// we ignore the errors as the validators for the arguments in the
+	// schema definition ensure their validity
+	drainTimeout, _ := time.ParseDuration(data.DrainTimeout.ValueString())
+	var evictionTimeout, evictionRequestTimeout, flapTolerance, pdbRetryInterval, pdbBlockTimeout time.Duration
+	if !data.PodEvictTimeout.IsNull() {
+		evictionTimeout, _ = time.ParseDuration(data.PodEvictTimeout.ValueString())
+	}
+	// evictions against overloaded API servers may need a
+	// deadline, without limiting the other requests
+	if !data.EvictionTimeout.IsNull() {
+		evictionRequestTimeout, _ = time.ParseDuration(data.EvictionTimeout.ValueString())
+	}
+	if !data.FlapTolerance.IsNull() {
+		flapTolerance, _ = time.ParseDuration(data.FlapTolerance.ValueString())
+	}
+	if !data.PDBRetryInterval.IsNull() {
+		pdbRetryInterval, _ = time.ParseDuration(data.PDBRetryInterval.ValueString())
+	}
+	if !data.PDBBlockTimeout.IsNull() {
+		pdbBlockTimeout, _ = time.ParseDuration(data.PDBBlockTimeout.ValueString())
+	}
+
+	drainer := &orchestrate.Drainer{
+		Client:      r.k8sClient,
+		DrainClient: orchestrate.EvictionClient{Interface: r.k8sClient, Version: drainOptions.EvictionVersion},
+		Retry:       r.retry,
+		Metrics:     metrics,
+		Timeout:     drainTimeout,
+
+		EvictionTimeout:        evictionTimeout,
+		EvictionRequestTimeout: evictionRequestTimeout,
+		WaitForVolumeDetach:    data.WaitVolumeDetach.ValueBool(),
+		DeleteDrained:          data.DeleteDrained.ValueBool(),
+		Options:                drainOptions,
+		FlapTolerance:          flapTolerance,
+
+		PDBRetryInterval: pdbRetryInterval,
+		PDBBlockTimeout:  pdbBlockTimeout,
+		OrphanedPods:     data.OrphanedPods.ValueString(),
+
+		EvictionGroupOrder: evictionGroupOrder,
+
+		AnnotateWorkloads: data.AnnotateWorkloads.ValueBool(),
+		AnnotateNodes:     data.AnnotateNodes.ValueBool(),
+		DrainedBy:         drainedBy(r.version, r.runID),
+		DryRun:            r.dryRun,
+		WaitRescheduled:   data.WaitRescheduled.ValueBool(),
+		GuardCSI:          data.GuardCSI.ValueBool(),
+		PoolName:          data.NodePoolName.ValueString(),
+		Observer:          observer,
+	}
+	if r.nodeEvents {
+		observer.nodeEvents = &nodeEventRecorder{client: r.k8sClient, runID: r.runID}
+	}
+	if len(r.instances) > 0 {
+		drainer.Instances = goneInstances{checkers: r.instances, retry: r.retry}
+	}
+	// e.g. the maintenance window may have closed while draining the
+	// previous nodes
+	if maintenance != nil {
+		drainer.Gates = append(drainer.Gates, orchestrate.GateFunc(func(ctx context.Context, _ v1.Node) error {
+			return maintenance.wait(ctx)
+		}))
+	}
+	if data.RotationStrategy.ValueString() == rotationStrategyTaint {
+		if r.rbacProfile == rbacProfileEvictOnly {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool %s, nodes cannot be tainted with the evict_only RBAC profile. Set rotation_strategy to drain or grant the provider the update permission on nodes.", data.NodePoolName.ValueString()),
+			)
+			return nil
+		}
+		drainer.RotationTaint = data.RotationTaint.taint()
+	}
+	if data.PreDrainHook != nil {
+		preDrainHook, jobDiags := data.PreDrainHook.job(ctx, "pre-drain", false)
+		diags.Append(jobDiags...)
+		drainer.PreDrain = append(drainer.PreDrain, r.nodeJobStep(preDrainHook, data))
+	}
+	// the drained nodes are verified before the post-drain hook runs
+	// and their instances are removed
+	if data.Verification != nil {
+		verification, jobDiags := data.Verification.job(ctx, "verify", true)
+		diags.Append(jobDiags...)
+		drainer.PostDrain = append(drainer.PostDrain, r.nodeJobStep(verification, data))
+	}
+	if data.PostDrainHook != nil {
+		postDrainHook, jobDiags := data.PostDrainHook.job(ctx, "post-drain", false)
+		diags.Append(jobDiags...)
+		drainer.PostDrain = append(drainer.PostDrain, r.nodeJobStep(postDrainHook, data))
+	}
+	if diags.HasError() {
+		return nil
+	}
+	if data.GKE != nil {
+		nodePool, err := data.GKE.nodePool(data.NodePoolName.ValueString())
+		if err != nil {
+			diags.AddAttributeError(
+				path.Root("gke"),
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool %s, %s.", data.NodePoolName.ValueString(), err.Error()),
+			)
+			return nil
+		}
+		gke := newGKEInstanceDeleter(nodePool, data.GKE.AccessToken.ValueString())
+		drainer.PostDrain = append(drainer.PostDrain, orchestrate.StepFunc(func(ctx context.Context, node v1.Node) error {
+			return gke.deleteInstance(ctx, r.retry, node)
+		}))
+	}
+	if data.AWSAutoScaling != nil {
+		asg := data.AWSAutoScaling.remover()
+		drainer.PostDrain = append(drainer.PostDrain, orchestrate.StepFunc(func(ctx context.Context, node v1.Node) error {
+			return asg.removeInstance(ctx, r.retry, node)
+		}))
+	}
+	if data.DNSHealthCheck != nil {
+		dnsCheck := data.DNSHealthCheck.check(r.k8sClient, r.retry)
+		// the Jobs of server-side dry runs never run
+		if !r.dryRun {
+			dnsCheck.resolver = data.DNSHealthCheck.resolver(r.k8sClient, r.retry, dnsCheck, data.NodePoolName.ValueString())
+		}
+		drainer.Checks = append(drainer.Checks, dnsCheck)
+	}
+	if data.ManagedBy.ValueString() == managedByKarpenter {
+		dynamicClient, err := dynamic.NewForConfig(r.config)
+		if err != nil {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool, unexpected error creating kubernetes client for Karpenter NodeClaims: %s", err.Error()),
+			)
+			return nil
+		}
+
+		drainer.Evicter = &karpenterNodes{
+			client:        dynamicClient,
+			nodes:         r.k8sClient,
+			retry:         r.retry,
+			pollInterval:  defaultKarpenterPollInterval,
+			flapTolerance: flapTolerance,
+			dryRun:        r.dryRun,
+		}
+	}
+	if data.ArgoCDSync != nil {
+		dynamicClient, err := dynamic.NewForConfig(r.config)
+		if err != nil {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool, unexpected error creating kubernetes client for ArgoCD applications: %s", err.Error()),
+			)
+			return nil
+		}
+
+		argoCD := &argoCDSync{client: dynamicClient, namespace: defaultArgoCDNamespace}
+		if !data.ArgoCDSync.Namespace.IsNull() {
+			argoCD.namespace = data.ArgoCDSync.Namespace.ValueString()
+		}
+		if !data.ArgoCDSync.MaxWait.IsNull() {
+			argoCD.maxWait, _ = time.ParseDuration(data.ArgoCDSync.MaxWait.ValueString())
+		}
+		drainer.Gates = append(drainer.Gates, orchestrate.GateFunc(func(ctx context.Context, node v1.Node) error {
+			return argoCD.waitForSyncs(ctx, drainer.DrainClient, r.retry, node.Name)
+		}))
+	}
+
+	return drainer
+}
+
+// nodeJobStep returns the step running job for each drained node of the node
+// pool configured by data.
+func (r *NodePoolResource) nodeJobStep(job *nodeJob, data *NodePoolResourceModel) nodeJobStep {
+	return nodeJobStep{job: job, client: r.k8sClient, retry: r.retry, poolName: data.NodePoolName.ValueString()}
+}
+
+// drainedBy returns the value of the drained-by annotation of the nodes
+// drained by the provider version, during the terraform run runID if known.
+func drainedBy(version, runID string) string {
+	if runID == "" {
+		return "k8snp/" + version
+	}
+	return fmt.Sprintf("k8snp/%s run %s", version, runID)
+}
+
+// checkEvictions fails the destroy when the pod evictions would be rejected,
+// by unavailable admission webhooks or because the API server does not serve
+// the eviction API version of drainOptions.
+func (r *NodePoolResource) checkEvictions(ctx context.Context, data *NodePoolResourceModel, drainOptions orchestrate.DrainOptions, diags *diag.Diagnostics) {
+	if data.CheckWebhooks.ValueBool() {
+		var webhooks []string
+		err := r.retry.Do(ctx, "checking admission webhooks", func() error {
+			var err error
+			webhooks, err = findUnavailableWebhooks(ctx, r.k8sClient)
+			return err
+		})
+		// the check is best effort, e.g. the webhook configurations are
+		// cluster scoped and may not be readable by the provider
+		if err != nil {
+			diags.AddWarning(
+				"Unable to check admission webhooks",
+				fmt.Sprintf("Could not check the admission webhooks intercepting pod evictions before draining node pool %s: %s", data.NodePoolName.ValueString(), err.Error()),
+			)
+		}
+		if len(webhooks) > 0 {
+			diags.AddError(
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool %s, pod evictions would be rejected by unavailable admission webhooks: %s", data.NodePoolName.ValueString(), strings.Join(webhooks, ", ")),
+			)
+			return
+		}
+	}
+
+	if drainOptions.EvictionVersion != "" && !drainOptions.DisableEviction {
+		if err := orchestrate.CheckEvictionVersion(ctx, r.k8sClient, r.retry, drainOptions.EvictionVersion); err != nil {
+			diags.AddAttributeError(
+				path.Root("drain_options").AtName("eviction_api_version"),
+				"Error deleting safe node pool",
+				fmt.Sprintf("Could not delete safe node pool %s, %s.", data.NodePoolName.ValueString(), err.Error()),
+			)
+		}
+	}
+}
+
+// pauseScaleDown disables the scale down of the nodes of disable_scale_down,
+// when set, and returns the function enabling it again, to call even when
+// the scale down could not be disabled on all the nodes.
+func (r *NodePoolResource) pauseScaleDown(ctx context.Context, data *NodePoolResourceModel, query orchestrate.NodeQuery, diags *diag.Diagnostics) func() {
+	if data.ScaleDown == nil {
+		return func() {}
+	}
+
+	if r.rbacProfile == rbacProfileEvictOnly {
+		diags.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool %s, the scale down of nodes cannot be disabled with the evict_only RBAC profile. Remove the disable_scale_down block or grant the provider the patch permission on nodes.", data.NodePoolName.ValueString()),
+		)
+		return func() {}
+	}
+
+	annotated, err := disableScaleDown(ctx, r.k8sClient, r.retry, data.ScaleDown.NodeSelector.ValueString(), query)
+	if err != nil {
+		diags.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool %s, unexpected error disabling the scale down of nodes: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+	}
+	return func() {
+		if err := enableScaleDown(context.WithoutCancel(ctx), r.k8sClient, r.retry, annotated); err != nil {
+			diags.AddWarning(
+				"Error enabling the scale down of nodes",
+				fmt.Sprintf("Could not remove the %s annotation from all the nodes, it must be removed manually: %s", scaleDownDisabledAnnotation, err.Error()),
+			)
+		}
+	}
+}
+
+// pauseFlux suspends the Flux objects of suspend_flux, if any, and returns
+// the function resuming them, to call even when not all of them could be
+// suspended.
+func (r *NodePoolResource) pauseFlux(ctx context.Context, data *NodePoolResourceModel, diags *diag.Diagnostics) func() {
+	if len(data.SuspendFlux) == 0 {
+		return func() {}
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(r.config)
+	if err != nil {
+		diags.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool, unexpected error creating kubernetes client for Flux objects: %s", err.Error()),
+		)
+		return func() {}
+	}
+
+	return r.pauseFluxWith(ctx, dynamicClient, data, diags)
+}
+
+// pauseFluxWith is pauseFlux with the client of the Flux objects.
+func (r *NodePoolResource) pauseFluxWith(ctx context.Context, dynamicClient dynamic.Interface, data *NodePoolResourceModel, diags *diag.Diagnostics) func() {
+	var objects []fluxObject
+	for _, object := range data.SuspendFlux {
+		objects = append(objects, fluxObject{
+			kind:      object.Kind.ValueString(),
+			namespace: object.Namespace.ValueString(),
+			name:      object.Name.ValueString(),
+		})
+	}
+
+	suspended, err := suspendFlux(ctx, dynamicClient, r.retry, data.NodePoolName.ValueString(), objects)
+	if err != nil {
+		diags.AddError(
+			"Error deleting safe node pool",
+			fmt.Sprintf("Could not delete safe node pool %s, unexpected error suspending Flux objects: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+	}
+	return func() {
+		if err := resumeFlux(context.WithoutCancel(ctx), dynamicClient, r.retry, suspended); err != nil {
+			diags.AddWarning(
+				"Error resuming Flux objects",
+				fmt.Sprintf("Could not resume all the Flux objects suspended during the drain, they must be resumed manually: %s", err.Error()),
+			)
+		}
+	}
+}
+
+// cordonNodes cordons all the nodes before any of them is drained so that
+// the evicted pods are not scheduled on nodes about to be drained.
+func (r *NodePoolResource) cordonNodes(ctx context.Context, data *NodePoolResourceModel, drainer *orchestrate.Drainer, nodes []v1.Node, events *eventStream, diags *diag.Diagnostics) {
+	switch {
+	case drainer.Evicter != nil:
+		// Karpenter taints the nodes itself when their NodeClaims are deleted
+	case r.rbacProfile == rbacProfileEvictOnly:
+		// nodes cannot be cordoned without the patch permission, so evicted
+		// pods can only be kept away by taints already set on the nodes
+		for _, node := range nodes {
+			if !orchestrate.RepelsNewPods(node) {
+				diags.AddWarning(
+					"Node not cordoned",
+					fmt.Sprintf("Node %s in pool %s is not cordoned because of the evict_only RBAC profile and has no NoSchedule or NoExecute taint, evicted pods may be rescheduled onto it.", node.Name, data.NodePoolName.ValueString()),
+				)
+			}
+		}
+	default:
+		events.phase(ctx, "cordoning")
+		for _, node := range nodes {
+			if err := drainer.Cordon(ctx, node); err != nil {
+				diags.AddError(
+					"Error deleting safe node pool",
+					fmt.Sprintf("Could not delete safe node pool, unexpected error cordoning node %s: %s", node.Name, err.Error()),
+				)
+				if data.UncordonOnFailure.ValueBool() {
+					uncordonAfterFailure(ctx, drainer, diags)
+				}
+				return
+			}
+		}
+	}
+}
+
+// drainNodes drains the cordoned nodes, sharing total_drain_budget among
+// them, in batches of max_unavailable nodes or up to drain_concurrency at a
+// time, waiting between the drains as configured by data.
+func drainNodes(ctx context.Context, data *NodePoolResourceModel, drainer *orchestrate.Drainer, nodes []v1.Node) error {
+	plan := orchestrate.Plan{
+		Concurrency: int(data.DrainConcurrency.ValueInt64()),
+		Wait:        data.drainWaitSchedule(),
+	}
+	switch {
+	case !data.TotalDrainBudget.IsNull():
+		plan.Budget, _ = time.ParseDuration(data.TotalDrainBudget.ValueString())
+	case !data.MaxUnavailable.IsNull():
+		maxUnavailable := intstr.Parse(data.MaxUnavailable.ValueString())
+		batchSize, _ := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, len(nodes), true)
+		// a percentage rounding down to no node still drains one at a time
+		plan.BatchSize = max(batchSize, 1)
+	}
+
+	return drainer.DrainNodes(ctx, nodes, plan)
+}
+
+// uncordonAfterFailure uncordons the nodes cordoned by drainer, and removes
+// the rotation taint from those it tainted, so that the cluster is left
+// schedulable after a failed drain, and reports whether it succeeded. A
+// failure is only reported as a warning since the drain already failed.
+func uncordonAfterFailure(ctx context.Context, drainer *orchestrate.Drainer, diags *diag.Diagnostics) bool {
+	// the cluster must be left schedulable even when the
+	// drain failed because the operation was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	if err := utilerrors.NewAggregate([]error{drainer.UncordonAll(ctx), drainer.UntaintAll(ctx)}); err != nil {
+		diags.AddWarning(
+			"Error uncordoning nodes",
+			fmt.Sprintf("Could not uncordon all the nodes after the failed drain, they must be uncordoned manually: %s", err.Error()),
+		)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,638 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	emptyPoolSucceed = "succeed"
+	emptyPoolWarn    = "warn"
+	emptyPoolFail    = "fail"
+)
+
+const (
+	// rotationStrategyDrain cordons the nodes and evicts their pods
+	rotationStrategyDrain = "drain"
+	// rotationStrategyTaint sets a NoExecute taint on the nodes, leaving
+	// the eviction of their pods to kubernetes
+	rotationStrategyTaint = "taint"
+
+	defaultRotationTaintKey = "k8snp.io/rotation"
+)
+
+// NodePoolResourceModel describes the resource data model.
+type NodePoolResourceModel struct {
+	NodePoolName      types.String `tfsdk:"node_pool_name"`
+	NodeSelectorKey   types.String `tfsdk:"node_selector_key"`
+	NodeSelectorValue types.String `tfsdk:"node_selector_value"`
+	MinReadyNodes     types.Int64  `tfsdk:"min_ready_nodes"`
+	ReadyTimeout      types.String `tfsdk:"ready_timeout"`
+	DrainTimeout      types.String `tfsdk:"drain_timeout"`
+	DeleteTimeout     types.String `tfsdk:"delete_timeout"`
+	DrainWaitTime     types.String `tfsdk:"drain_wait"`
+	DrainWaitJitter   types.String `tfsdk:"drain_wait_jitter"`
+	DrainWaitStrategy types.String `tfsdk:"drain_wait_strategy"`
+	IncludeVirtual    types.Bool   `tfsdk:"include_virtual_nodes"`
+	CheckWebhooks     types.Bool   `tfsdk:"check_admission_webhooks"`
+	EvictionTimeout   types.String `tfsdk:"eviction_request_timeout"`
+	PodEvictTimeout   types.String `tfsdk:"pod_eviction_timeout"`
+	PollInterval      types.String `tfsdk:"poll_interval"`
+	PollBackoff       types.Bool   `tfsdk:"poll_backoff"`
+	DeletionProtect   types.Bool   `tfsdk:"deletion_protection"`
+	DrainConcurrency  types.Int64  `tfsdk:"drain_concurrency"`
+	WaitVolumeDetach  types.Bool   `tfsdk:"wait_for_volume_detach"`
+	DeleteDrained     types.Bool   `tfsdk:"delete_node_after_drain"`
+	MaxUnavailable    types.String `tfsdk:"max_unavailable"`
+	TotalDrainBudget  types.String `tfsdk:"total_drain_budget"`
+	MinReadyPercent   types.Int64  `tfsdk:"min_ready_percentage"`
+	ExpectedNodes     types.Int64  `tfsdk:"expected_nodes"`
+	RequiredDaemonSet types.List   `tfsdk:"required_daemonsets"`
+	FlapTolerance     types.String `tfsdk:"control_plane_flap_tolerance"`
+	DrainPodSelector  types.String `tfsdk:"drain_pod_selector"`
+	IncludeNamespaces types.List   `tfsdk:"drain_namespace_include"`
+	ExcludeNamespaces types.List   `tfsdk:"drain_namespace_exclude"`
+	AnnotateWorkloads types.Bool   `tfsdk:"annotate_workloads"`
+	AnnotateNodes     types.Bool   `tfsdk:"annotate_nodes"`
+	UncordonOnFailure types.Bool   `tfsdk:"uncordon_on_failure"`
+	IncludeCtrlPlane  types.Bool   `tfsdk:"include_control_plane_nodes"`
+	OrphanedPods      types.String `tfsdk:"orphaned_daemonset_pods"`
+	RespectSafeEvict  types.Bool   `tfsdk:"respect_safe_to_evict"`
+	SafeEvictAction   types.String `tfsdk:"safe_to_evict_action"`
+	RotationStrategy  types.String `tfsdk:"rotation_strategy"`
+	ManagedBy         types.String `tfsdk:"managed_by"`
+	AllowNodeDrift    types.Bool   `tfsdk:"allow_node_set_drift"`
+	DrainOrder        types.String `tfsdk:"drain_order"`
+	ExcludeNodes      types.List   `tfsdk:"exclude_nodes"`
+	ExcludeSelector   types.String `tfsdk:"exclude_node_selector"`
+	ReadyHandle       types.String `tfsdk:"ready_handle"`
+	NodeSelector      types.Map    `tfsdk:"node_selector"`
+	NodeFieldSelector types.String `tfsdk:"node_field_selector"`
+	EvictionGroups    types.List   `tfsdk:"eviction_group_order"`
+	CurrentNodes      types.Int64  `tfsdk:"current_nodes"`
+	ReadyNodes        types.Int64  `tfsdk:"ready_nodes"`
+	NodeNames         types.List   `tfsdk:"node_names"`
+	KubeletVersions   types.List   `tfsdk:"kubelet_versions"`
+	InstanceIDs       types.List   `tfsdk:"instance_ids"`
+	WaitForHandles    types.List   `tfsdk:"wait_for_handles"`
+	PDBRetryInterval  types.String `tfsdk:"pdb_retry_interval"`
+	PDBBlockTimeout   types.String `tfsdk:"pdb_block_timeout"`
+	OnEmptyPool       types.String `tfsdk:"on_empty_pool"`
+	DiagOverrides     types.Map    `tfsdk:"diagnostic_overrides"`
+	MaxCrashLooping   types.Int64  `tfsdk:"max_crashlooping_pods"`
+	FailureDumpPath   types.String `tfsdk:"failure_dump_path"`
+	RotationTrigger   types.Map    `tfsdk:"rotation_trigger"`
+	WaitRescheduled   types.Bool   `tfsdk:"wait_for_rescheduled_pods"`
+	AsyncDestroy      types.Bool   `tfsdk:"async_destroy"`
+	AsyncDrainBudget  types.String `tfsdk:"async_drain_budget"`
+	SkipCapacityCheck types.Bool   `tfsdk:"skip_capacity_check"`
+	DryRun            types.Bool   `tfsdk:"dry_run"`
+	GuardCSI          types.Bool   `tfsdk:"guard_csi_controllers"`
+
+	ReadinessChecks *NodePoolReadinessChecksModel `tfsdk:"readiness_checks"`
+	WaitForPods     []NodePoolWaitForPodsModel    `tfsdk:"wait_for_pods"`
+	DrainOptions    *NodePoolDrainOptionsModel    `tfsdk:"drain_options"`
+	RotationTaint   *NodePoolRotationTaintModel   `tfsdk:"rotation_taint"`
+	Maintenance     *NodePoolMaintenanceModel     `tfsdk:"maintenance_window"`
+	SelectorExprs   []NodePoolSelectorExprModel   `tfsdk:"node_selector_expressions"`
+	Timeouts        *NodePoolTimeoutsModel        `tfsdk:"timeouts"`
+	SuspendFlux     []NodePoolSuspendFluxModel    `tfsdk:"suspend_flux"`
+	ArgoCDSync      *NodePoolArgoCDSyncModel      `tfsdk:"argocd_sync"`
+	Precordon       *NodePoolPrecordonModel       `tfsdk:"precordon_on_replace"`
+	DNSHealthCheck  *NodePoolDNSHealthCheckModel  `tfsdk:"dns_health_check"`
+	ScaleDown       *NodePoolScaleDownModel       `tfsdk:"disable_scale_down"`
+	Verification    *NodePoolNodeJobModel         `tfsdk:"post_drain_verification_job"`
+	PreDrainHook    *NodePoolNodeJobModel         `tfsdk:"pre_drain_hook"`
+	PostDrainHook   *NodePoolNodeJobModel         `tfsdk:"post_drain_hook"`
+	Approval        *NodePoolApprovalModel        `tfsdk:"approval"`
+	Notifications   *NodePoolNotificationsModel   `tfsdk:"notifications"`
+	GKE             *NodePoolGKEModel             `tfsdk:"gke"`
+	ClusterAPI      *NodePoolClusterAPIModel      `tfsdk:"cluster_api"`
+	AWSAutoScaling  *NodePoolAWSAutoScalingModel  `tfsdk:"aws_autoscaling"`
+}
+
+// nodeSelectorValue returns the label value selecting the nodes of the pool:
+// node_selector_value when set, otherwise the node pool name, parsed out of
+// node_pool_name when it holds a full GKE node pool ID.
+func (m *NodePoolResourceModel) nodeSelectorValue(ctx context.Context) string {
+	if !m.NodeSelectorValue.IsUnknown() && !m.NodeSelectorValue.IsNull() {
+		return m.NodeSelectorValue.ValueString()
+	}
+
+	if id, ok := parseGKENodePoolID(m.NodePoolName.ValueString()); ok {
+		tflog.Debug(ctx, fmt.Sprintf("node pool name is the ID of node pool %s of GKE cluster %s in project %s, location %s", id.nodePool, id.cluster, id.project, id.location))
+		return id.nodePool
+	}
+
+	return m.NodePoolName.ValueString()
+}
+
+// readyTimeout returns the maximum time to wait for the nodes to be ready:
+// the create timeout when set, otherwise ready_timeout.
+func (m *NodePoolResourceModel) readyTimeout() time.Duration {
+	// we ignore the errors as the validators for the arguments in the
+	// schema definition will ensure their validity
+	if m.Timeouts != nil && !m.Timeouts.Create.IsNull() {
+		timeout, _ := time.ParseDuration(m.Timeouts.Create.ValueString())
+		return timeout
+	}
+
+	timeout, _ := time.ParseDuration(m.ReadyTimeout.ValueString())
+	return timeout
+}
+
+// deleteTimeout returns the maximum duration of the destroy: the delete
+// timeout or delete_timeout, which conflict, and 0 when neither is set.
+func (m *NodePoolResourceModel) deleteTimeout() time.Duration {
+	// we ignore the errors as the validators for the arguments in the
+	// schema definition will ensure their validity
+	if m.Timeouts != nil && !m.Timeouts.Delete.IsNull() {
+		timeout, _ := time.ParseDuration(m.Timeouts.Delete.ValueString())
+		return timeout
+	}
+
+	timeout, _ := time.ParseDuration(m.DeleteTimeout.ValueString())
+	return timeout
+}
+
+// drainWaitSchedule returns the wait between the drains of the nodes.
+func (m *NodePoolResourceModel) drainWaitSchedule() orchestrate.WaitSchedule {
+	// we ignore the errors as the validators for the arguments in the
+	// schema definition ensure their validity
+	drainWait := orchestrate.WaitSchedule{Strategy: m.DrainWaitStrategy.ValueString()}
+	drainWait.Base, _ = time.ParseDuration(m.DrainWaitTime.ValueString())
+	if !m.DrainWaitJitter.IsNull() {
+		drainWait.Jitter, _ = time.ParseDuration(m.DrainWaitJitter.ValueString())
+	}
+	return drainWait
+}
+
+// nodeQuery returns the query of the nodes of the pool: the node_selector_key
+// label with the value returned by nodeSelectorValue, combined with the
+// node_selector labels and node_selector_expressions, and the
+// node_field_selector.
+func (m *NodePoolResourceModel) nodeQuery(ctx context.Context) (orchestrate.NodeQuery, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	selector := labels.Set{m.NodeSelectorKey.ValueString(): m.nodeSelectorValue(ctx)}.AsSelector()
+
+	if !m.NodeSelector.IsNull() {
+		var matchLabels map[string]string
+		diags.Append(m.NodeSelector.ElementsAs(ctx, &matchLabels, false)...)
+		for key, value := range matchLabels {
+			requirement, err := labels.NewRequirement(key, selection.Equals, []string{value})
+			if err != nil {
+				diags.AddAttributeError(path.Root("node_selector"), "Invalid node selector", fmt.Sprintf("Label %s=%s is not a valid node selector: %s", key, value, err.Error()))
+				continue
+			}
+			selector = selector.Add(*requirement)
+		}
+	}
+
+	for i, expression := range m.SelectorExprs {
+		var values []string
+		if !expression.Values.IsNull() {
+			diags.Append(expression.Values.ElementsAs(ctx, &values, false)...)
+		}
+
+		requirement, err := labels.NewRequirement(expression.Key.ValueString(), selectorOperators[expression.Operator.ValueString()], values)
+		if err != nil {
+			diags.AddAttributeError(path.Root("node_selector_expressions").AtListIndex(i), "Invalid node selector expression", err.Error())
+			continue
+		}
+		selector = selector.Add(*requirement)
+	}
+
+	query := orchestrate.NodeQuery{LabelSelector: selector.String(), FieldSelector: m.NodeFieldSelector.ValueString()}
+	if m.ClusterAPI != nil {
+		query.LabelSelector = ""
+		query.MachineDeployment = m.ClusterAPI.pool(nil).String()
+	}
+
+	return query, diags
+}
+
+// selectorOperators maps the operators of the node selector
+// expressions to those of the label selectors.
+var selectorOperators = map[string]selection.Operator{
+	"In":     selection.In,
+	"NotIn":  selection.NotIn,
+	"Exists": selection.Exists,
+}
+
+// NodePoolSelectorExprModel describes the node selector expressions block data model.
+type NodePoolSelectorExprModel struct {
+	Key      types.String `tfsdk:"key"`
+	Operator types.String `tfsdk:"operator"`
+	Values   types.List   `tfsdk:"values"`
+}
+
+// NodePoolTimeoutsModel describes the timeouts block data model.
+type NodePoolTimeoutsModel struct {
+	Create types.String `tfsdk:"create"`
+	Delete types.String `tfsdk:"delete"`
+}
+
+// NodePoolDrainOptionsModel describes the drain options block data model.
+type NodePoolDrainOptionsModel struct {
+	IgnoreDaemonSets         types.Bool   `tfsdk:"ignore_daemonsets"`
+	DeleteEmptyDirData       types.Bool   `tfsdk:"delete_emptydir_data"`
+	Force                    types.Bool   `tfsdk:"force"`
+	GracePeriodSeconds       types.Int64  `tfsdk:"grace_period_seconds"`
+	SkipWaitForDeleteTimeout types.String `tfsdk:"skip_wait_for_delete_timeout"`
+	DisableEviction          types.Bool   `tfsdk:"disable_eviction"`
+	EvictionVersion          types.String `tfsdk:"eviction_api_version"`
+}
+
+// options returns the drain options set in the block, using the
+// defaults for those not set.
+func (m *NodePoolDrainOptionsModel) options() orchestrate.DrainOptions {
+	options := orchestrate.DefaultDrainOptions()
+	if m == nil {
+		return options
+	}
+
+	if !m.IgnoreDaemonSets.IsNull() {
+		options.IgnoreDaemonSets = m.IgnoreDaemonSets.ValueBool()
+	}
+	if !m.DeleteEmptyDirData.IsNull() {
+		options.DeleteEmptyDirData = m.DeleteEmptyDirData.ValueBool()
+	}
+	if !m.GracePeriodSeconds.IsNull() {
+		options.GracePeriodSeconds = int(m.GracePeriodSeconds.ValueInt64())
+	}
+	if !m.SkipWaitForDeleteTimeout.IsNull() {
+		// we ignore the error as the validator for the argument in the schema
+		// definition will ensure its validity
+		options.SkipWaitForDeleteTimeout, _ = time.ParseDuration(m.SkipWaitForDeleteTimeout.ValueString())
+	}
+	options.Force = m.Force.ValueBool()
+	options.DisableEviction = m.DisableEviction.ValueBool()
+	if version := m.EvictionVersion.ValueString(); version != orchestrate.EvictionVersionAuto {
+		options.EvictionVersion = version
+	}
+
+	return options
+}
+
+// NodePoolRotationTaintModel describes the rotation taint block data model.
+type NodePoolRotationTaintModel struct {
+	Key               types.String `tfsdk:"key"`
+	Value             types.String `tfsdk:"value"`
+	TolerationSeconds types.Int64  `tfsdk:"toleration_seconds"`
+}
+
+// taint returns the rotation taint set in the block, using the
+// defaults for the attributes not set.
+func (m *NodePoolRotationTaintModel) taint() *orchestrate.RotationTaint {
+	taint := &orchestrate.RotationTaint{Key: defaultRotationTaintKey}
+	if m == nil {
+		return taint
+	}
+
+	if !m.Key.IsNull() {
+		taint.Key = m.Key.ValueString()
+	}
+	taint.Value = m.Value.ValueString()
+	taint.TolerationSeconds = m.TolerationSeconds.ValueInt64()
+
+	return taint
+}
+
+// NodePoolMaintenanceModel describes the maintenance window block data model.
+type NodePoolMaintenanceModel struct {
+	Days     types.List   `tfsdk:"days"`
+	Start    types.String `tfsdk:"start"`
+	End      types.String `tfsdk:"end"`
+	Timezone types.String `tfsdk:"timezone"`
+	MaxWait  types.String `tfsdk:"max_wait"`
+}
+
+// gate returns the gate holding the drain outside of the maintenance window.
+func (m *NodePoolMaintenanceModel) gate(ctx context.Context) (*maintenanceGate, diag.Diagnostics) {
+	window, diags := m.window(ctx)
+	// we ignore the error as the validator for the argument in the
+	// schema definition will ensure its validity
+	maxWait, _ := time.ParseDuration(m.MaxWait.ValueString())
+	return &maintenanceGate{window: window, canWait: !m.MaxWait.IsNull(), maxWait: maxWait}, diags
+}
+
+// window returns the maintenance window set in the block.
+func (m *NodePoolMaintenanceModel) window(ctx context.Context) (maintenanceWindow, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	window := maintenanceWindow{location: time.UTC}
+
+	if !m.Days.IsNull() {
+		var days []string
+		diags.Append(m.Days.ElementsAs(ctx, &days, false)...)
+		for _, day := range days {
+			window.days = append(window.days, weekdays[day])
+		}
+	}
+
+	// we ignore the errors as the validators for the arguments in the
+	// schema definition will ensure their validity
+	window.start, _ = parseClock(m.Start.ValueString())
+	window.end, _ = parseClock(m.End.ValueString())
+	if !m.Timezone.IsNull() {
+		window.location, _ = time.LoadLocation(m.Timezone.ValueString())
+	}
+
+	return window, diags
+}
+
+// NodePoolWaitForPodsModel describes the wait for pods block data model.
+type NodePoolWaitForPodsModel struct {
+	Namespace     types.String `tfsdk:"namespace"`
+	LabelSelector types.String `tfsdk:"label_selector"`
+	MinReady      types.Int64  `tfsdk:"min_ready"`
+}
+
+// NodePoolSuspendFluxModel describes the suspend flux block data model.
+type NodePoolSuspendFluxModel struct {
+	Kind      types.String `tfsdk:"kind"`
+	Namespace types.String `tfsdk:"namespace"`
+	Name      types.String `tfsdk:"name"`
+}
+
+// NodePoolArgoCDSyncModel describes the ArgoCD sync block data model.
+type NodePoolArgoCDSyncModel struct {
+	Namespace types.String `tfsdk:"namespace"`
+	MaxWait   types.String `tfsdk:"max_wait"`
+}
+
+// NodePoolPrecordonModel describes the precordon on replace block data model.
+type NodePoolPrecordonModel struct {
+	NodeSelector types.String `tfsdk:"node_selector"`
+}
+
+// NodePoolScaleDownModel describes the disable scale down block data model.
+type NodePoolScaleDownModel struct {
+	NodeSelector types.String `tfsdk:"node_selector"`
+}
+
+// NodePoolNodeJobModel describes the data model of the blocks running a
+// Job for each node: post_drain_verification_job and the drain hooks.
+type NodePoolNodeJobModel struct {
+	Namespace types.String `tfsdk:"namespace"`
+	Image     types.String `tfsdk:"image"`
+	Command   types.List   `tfsdk:"command"`
+	Env       types.Map    `tfsdk:"env"`
+	Timeout   types.String `tfsdk:"timeout"`
+}
+
+// job returns the Job set in the block, named name, using the defaults for
+// the attributes not set. onNode binds the pod of the Job to the node.
+func (m *NodePoolNodeJobModel) job(ctx context.Context, name string, onNode bool) (*nodeJob, diag.Diagnostics) {
+	job := &nodeJob{
+		name:      name,
+		namespace: defaultNodeJobNamespace,
+		image:     m.Image.ValueString(),
+		timeout:   defaultNodeJobTimeout,
+		onNode:    onNode,
+	}
+
+	if !m.Namespace.IsNull() {
+		job.namespace = m.Namespace.ValueString()
+	}
+	if !m.Timeout.IsNull() {
+		// we ignore the error as the validator for the argument in the
+		// schema definition will ensure its validity
+		job.timeout, _ = time.ParseDuration(m.Timeout.ValueString())
+	}
+
+	var diags diag.Diagnostics
+	if !m.Command.IsNull() {
+		diags.Append(m.Command.ElementsAs(ctx, &job.command, false)...)
+	}
+	if !m.Env.IsNull() {
+		diags.Append(m.Env.ElementsAs(ctx, &job.env, false)...)
+	}
+
+	return job, diags
+}
+
+// NodePoolApprovalModel describes the approval block data model.
+type NodePoolApprovalModel struct {
+	URL          types.String `tfsdk:"url"`
+	PollInterval types.String `tfsdk:"poll_interval"`
+	Timeout      types.String `tfsdk:"timeout"`
+}
+
+// approval returns the destroy approval set in the block, using the
+// defaults for the attributes not set.
+func (m *NodePoolApprovalModel) approval() *destroyApproval {
+	approval := &destroyApproval{
+		url:          m.URL.ValueString(),
+		pollInterval: defaultApprovalPollInterval,
+		timeout:      defaultApprovalTimeout,
+	}
+
+	// we ignore the errors as the validators for the arguments in the
+	// schema definition will ensure their validity
+	if !m.PollInterval.IsNull() {
+		approval.pollInterval, _ = time.ParseDuration(m.PollInterval.ValueString())
+	}
+	if !m.Timeout.IsNull() {
+		approval.timeout, _ = time.ParseDuration(m.Timeout.ValueString())
+	}
+
+	return approval
+}
+
+// NodePoolNotificationsModel describes the notifications block data model.
+type NodePoolNotificationsModel struct {
+	WebhookURL types.String `tfsdk:"webhook_url"`
+	Events     types.List   `tfsdk:"events"`
+}
+
+// notifier returns the notifier posting the events set in the block, all
+// of them when not set, to the webhook.
+func (m *NodePoolNotificationsModel) notifier(ctx context.Context) (*rotationNotifier, diag.Diagnostics) {
+	notifier := &rotationNotifier{url: m.WebhookURL.ValueString()}
+
+	var diags diag.Diagnostics
+	if !m.Events.IsNull() {
+		diags = m.Events.ElementsAs(ctx, &notifier.events, false)
+	}
+
+	return notifier, diags
+}
+
+// NodePoolClusterAPIModel describes the cluster_api block data model.
+type NodePoolClusterAPIModel struct {
+	MachineDeployment types.String `tfsdk:"machine_deployment"`
+	Namespace         types.String `tfsdk:"namespace"`
+}
+
+// pool returns the MachineDeployment set in the block, read with client.
+func (m *NodePoolClusterAPIModel) pool(client dynamic.Interface) clusterAPIPool {
+	pool := clusterAPIPool{client: client, namespace: defaultMachineDeploymentNamespace, name: m.MachineDeployment.ValueString()}
+	if !m.Namespace.IsNull() {
+		pool.namespace = m.Namespace.ValueString()
+	}
+	return pool
+}
+
+// NodePoolGKEModel describes the gke block data model.
+type NodePoolGKEModel struct {
+	Project     types.String `tfsdk:"project"`
+	Location    types.String `tfsdk:"location"`
+	Cluster     types.String `tfsdk:"cluster"`
+	AccessToken types.String `tfsdk:"access_token"`
+}
+
+// nodePool returns the GKE node pool nodePoolName, parsed out of it when it
+// is a full GKE node pool ID, in the project, location and cluster set in
+// the block. It fails when they are neither set nor in nodePoolName.
+func (m *NodePoolGKEModel) nodePool(nodePoolName string) (gkeNodePoolID, error) {
+	id, ok := parseGKENodePoolID(nodePoolName)
+	if !ok {
+		id = gkeNodePoolID{nodePool: nodePoolName}
+	}
+
+	if !m.Project.IsNull() {
+		id.project = m.Project.ValueString()
+	}
+	if !m.Location.IsNull() {
+		id.location = m.Location.ValueString()
+	}
+	if !m.Cluster.IsNull() {
+		id.cluster = m.Cluster.ValueString()
+	}
+
+	if id.project == "" || id.location == "" || id.cluster == "" {
+		return id, fmt.Errorf("the project, location and cluster of the GKE node pool must be set in the gke block when node_pool_name is not a full GKE node pool ID")
+	}
+	return id, nil
+}
+
+// NodePoolAWSAutoScalingModel describes the aws_autoscaling block data model.
+type NodePoolAWSAutoScalingModel struct {
+	Action          types.String `tfsdk:"action"`
+	Decrement       types.Bool   `tfsdk:"decrement_desired_capacity"`
+	AccessKeyID     types.String `tfsdk:"access_key_id"`
+	SecretAccessKey types.String `tfsdk:"secret_access_key"`
+	SessionToken    types.String `tfsdk:"session_token"`
+	Region          types.String `tfsdk:"region"`
+}
+
+// remover returns the remover of the instances of the drained nodes
+// configured by the block.
+func (m *NodePoolAWSAutoScalingModel) remover() *asgInstanceRemover {
+	remover := newASGInstanceRemover(m.AccessKeyID.ValueString(), m.SecretAccessKey.ValueString(), m.SessionToken.ValueString(), m.Region.ValueString())
+	if !m.Action.IsNull() {
+		remover.action = m.Action.ValueString()
+	}
+	if !m.Decrement.IsNull() {
+		remover.decrement = m.Decrement.ValueBool()
+	}
+	return remover
+}
+
+// NodePoolDNSHealthCheckModel describes the DNS health check block data model.
+type NodePoolDNSHealthCheckModel struct {
+	Namespace  types.String `tfsdk:"namespace"`
+	Deployment types.String `tfsdk:"deployment"`
+	Service    types.String `tfsdk:"service"`
+	Probe      types.Bool   `tfsdk:"probe"`
+	ProbeName  types.String `tfsdk:"probe_name"`
+	ProbeImage types.String `tfsdk:"probe_image"`
+	Timeout    types.String `tfsdk:"timeout"`
+}
+
+// check returns the DNS health check set in the block, using the
+// defaults for the attributes not set.
+func (m *NodePoolDNSHealthCheckModel) check(client kubernetes.Interface, retry orchestrate.RetryPolicy) *dnsHealthCheck {
+	check := &dnsHealthCheck{
+		client:     client,
+		retry:      retry,
+		namespace:  defaultDNSNamespace,
+		deployment: defaultDNSDeployment,
+		service:    defaultDNSService,
+		name:       defaultDNSProbeName,
+		timeout:    defaultDNSTimeout,
+	}
+
+	if !m.Namespace.IsNull() {
+		check.namespace = m.Namespace.ValueString()
+	}
+	if !m.Deployment.IsNull() {
+		check.deployment = m.Deployment.ValueString()
+	}
+	if !m.Service.IsNull() {
+		check.service = m.Service.ValueString()
+	}
+	if !m.ProbeName.IsNull() {
+		check.name = m.ProbeName.ValueString()
+	}
+	if !m.Timeout.IsNull() {
+		// we ignore the error as the validator for the argument in the
+		// schema definition will ensure its validity
+		check.timeout, _ = time.ParseDuration(m.Timeout.ValueString())
+	}
+
+	return check
+}
+
+// resolver returns the resolver of the probe pod of the check, or nil when
+// the probe is disabled.
+func (m *NodePoolDNSHealthCheckModel) resolver(client kubernetes.Interface, retry orchestrate.RetryPolicy, check *dnsHealthCheck, poolName string) dnsResolver {
+	if !m.Probe.IsNull() && !m.Probe.ValueBool() {
+		return nil
+	}
+
+	resolver := probeDNSResolver{client: client, retry: retry, namespace: check.namespace, image: defaultDNSProbeImage, poolName: poolName}
+	if !m.ProbeImage.IsNull() {
+		resolver.image = m.ProbeImage.ValueString()
+	}
+	return resolver
+}
+
+// NodePoolReadinessChecksModel describes the readiness checks block data model.
+type NodePoolReadinessChecksModel struct {
+	NoMemoryPressure types.Bool   `tfsdk:"no_memory_pressure"`
+	NoDiskPressure   types.Bool   `tfsdk:"no_disk_pressure"`
+	NoPIDPressure    types.Bool   `tfsdk:"no_pid_pressure"`
+	Schedulable      types.Bool   `tfsdk:"schedulable"`
+	NoStartupTaints  types.Bool   `tfsdk:"no_startup_taints"`
+	HeartbeatStale   types.String `tfsdk:"heartbeat_staleness_threshold"`
+}
+
+// criteria returns the readiness criteria enabled in the block, only
+// requiring the NodeReady condition when the block is not set.
+func (m *NodePoolReadinessChecksModel) criteria() orchestrate.ReadinessCriteria {
+	if m == nil {
+		return orchestrate.ReadinessCriteria{}
+	}
+
+	criteria := orchestrate.ReadinessCriteria{
+		NoMemoryPressure: m.NoMemoryPressure.ValueBool(),
+		NoDiskPressure:   m.NoDiskPressure.ValueBool(),
+		NoPIDPressure:    m.NoPIDPressure.ValueBool(),
+		Schedulable:      m.Schedulable.ValueBool(),
+		NoStartupTaints:  m.NoStartupTaints.ValueBool(),
+	}
+	if !m.HeartbeatStale.IsNull() {
+		// we ignore the error as the validator for the argument in the
+		// schema definition will ensure its validity
+		criteria.HeartbeatStaleness, _ = time.ParseDuration(m.HeartbeatStale.ValueString())
+	}
+
+	return criteria
+}
+
+// NodePoolResourceIdentityModel describes the resource identity data model.
+type NodePoolResourceIdentityModel struct {
+	NodePoolName types.String `tfsdk:"node_pool_name"`
+}
@@ -2,32 +2,32 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
-	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
-	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
-	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
-	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
-	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
-	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
-	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
-	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"go.opentelemetry.io/otel/attribute"
 	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
-	"k8s.io/kubectl/pkg/drain"
 )
 
 // Ensure provider defined types fully satisfy framework interfaces.
 var _ resource.Resource = &NodePoolResource{}
 var _ resource.ResourceWithImportState = &NodePoolResource{}
+var _ resource.ResourceWithIdentity = &NodePoolResource{}
+var _ resource.ResourceWithModifyPlan = &NodePoolResource{}
 
 func NewNodePoolResource() resource.Resource {
 	return &NodePoolResource{}
@@ -36,111 +36,33 @@ func NewNodePoolResource() resource.Resource {
 // NodePoolResource defines the resource implementation.
 type NodePoolResource struct {
 	config    *restclient.Config
-	k8sClient *kubernetes.Clientset
-}
-
-// NodePoolResourceModel describes the resource data model.
-type NodePoolResourceModel struct {
-	NodePoolName      types.String `tfsdk:"node_pool_name"`
-	NodeSelectorKey   types.String `tfsdk:"node_selector_key"`
-	NodeSelectorValue types.String `tfsdk:"node_selector_value"`
-	MinReadyNodes     types.Int64  `tfsdk:"min_ready_nodes"`
-	ReadyTimeout      types.String `tfsdk:"ready_timeout"`
-	DrainTimeout      types.String `tfsdk:"drain_timeout"`
-	DrainWaitTime     types.String `tfsdk:"drain_wait"`
+	k8sClient kubernetes.Interface
+	retry     orchestrate.RetryPolicy
+
+	pushgatewayURL string
+	eventStream    string
+	rbacProfile    string
+	nodeEvents     bool
+	dryRun         bool
+	runID          string
+	version        string
+	nodePools      *nodePoolRegistry
+	instances      instanceCheckers
+	asyncDestroys  *sync.Once
+
+	asyncDestroysResumed *atomic.Bool
 }
 
 func (r *NodePoolResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
 	resp.TypeName = req.ProviderTypeName + "_node_pool"
 }
 
-func (r *NodePoolResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
-	resp.Schema = schema.Schema{
-		// This description is used by the documentation generator and the language server.
-		MarkdownDescription: "Node pool",
-
-		Attributes: map[string]schema.Attribute{
-			"node_pool_name": schema.StringAttribute{
-				Required:            true,
-				MarkdownDescription: "Node pool name",
-				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.UseStateForUnknown(),
-					stringplanmodifier.RequiresReplace(),
-				},
-				Validators: []validator.String{
-					stringvalidator.LengthAtLeast(1),
-				},
-			},
-			"min_ready_nodes": schema.Int64Attribute{
-				Optional:            true,
-				Computed:            true,
-				MarkdownDescription: "Minimum number of ready nodes in the new node pool. Defaults to `1`.",
-				PlanModifiers: []planmodifier.Int64{
-					int64planmodifier.UseStateForUnknown(),
-				},
-				Default:    int64default.StaticInt64(1),
-				Validators: []validator.Int64{int64validator.AtLeast(1)},
-			},
-			"node_selector_key": schema.StringAttribute{
-				Optional:            true,
-				Computed:            true,
-				MarkdownDescription: "Label key used to select the nodes affected by this resource. Defaults to `cloud.google.com/gke-nodepool`.",
-				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.UseStateForUnknown(),
-				},
-				Default: stringdefault.StaticString("cloud.google.com/gke-nodepool"),
-				Validators: []validator.String{
-					stringvalidator.LengthAtLeast(1),
-				},
-			},
-			"node_selector_value": schema.StringAttribute{
-				Optional:            true,
-				MarkdownDescription: "Label value used to select the nodes affected by this resource. Defaults to the node pool name.",
-				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.UseStateForUnknown(),
-				},
-				Validators: []validator.String{
-					stringvalidator.LengthAtLeast(1),
-				},
-			},
-			"ready_timeout": schema.StringAttribute{
-				Optional:            true,
-				Computed:            true,
-				MarkdownDescription: "Maximum time for waiting for nodes in a new node pool to be ready. Defaults to `300s`.",
-				Default:             stringdefault.StaticString("300s"),
-				Validators: []validator.String{
-					MinDuration(0),
-				},
-			},
-			"drain_timeout": schema.StringAttribute{
-				Optional:            true,
-				Computed:            true,
-				MarkdownDescription: "Timeout for node drain operations. Defaults to `300s`.",
-				Default:             stringdefault.StaticString("300s"),
-				Validators: []validator.String{
-					MinDuration(0),
-				},
-			},
-			"drain_wait": schema.StringAttribute{
-				Optional:            true,
-				Computed:            true,
-				MarkdownDescription: "Amount of time to wait after each node drain operation. Defaults to `60s`.",
-				Default:             stringdefault.StaticString("60s"),
-				Validators: []validator.String{
-					MinDuration(0),
-				},
-			},
-		},
-	}
-}
-
 func (r *NodePoolResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
 	if req.ProviderData == nil {
 		return
 	}
 
-	var ok bool
-	r.config, ok = req.ProviderData.(*restclient.Config)
+	providerData, ok := req.ProviderData.(*K8sNpProviderData)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unable to get kubernetes config",
@@ -148,8 +70,21 @@ func (r *NodePoolResource) Configure(_ context.Context, req resource.ConfigureRe
 		)
 		return
 	}
-
-	k8sClient, err := kubernetes.NewForConfig(r.config)
+	r.config = providerData.config
+	r.retry = providerData.retry
+	r.pushgatewayURL = providerData.pushgatewayURL
+	r.eventStream = providerData.eventStream
+	r.rbacProfile = providerData.rbacProfile
+	r.nodeEvents = providerData.nodeEvents
+	r.dryRun = providerData.dryRun
+	r.runID = providerData.runID
+	r.version = providerData.version
+	r.nodePools = providerData.nodePools
+	r.instances = providerData.instances
+	r.asyncDestroys = providerData.asyncDestroys
+	r.asyncDestroysResumed = providerData.asyncDestroysResumed
+
+	k8sClient, err := providerData.clients.KubeClient(r.config)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Unable to create kubernetes client",
@@ -160,6 +95,146 @@ func (r *NodePoolResource) Configure(_ context.Context, req resource.ConfigureRe
 	r.k8sClient = k8sClient
 }
 
+func (r *NodePoolResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	destroy := req.Plan.Raw.IsNull()
+	if destroy && req.State.Raw.IsNull() {
+		return
+	}
+
+	var data *NodePoolResourceModel
+	if destroy {
+		resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	} else {
+		resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var state *NodePoolResourceModel
+	if !destroy && !req.State.Raw.IsNull() {
+		resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	// the node selector cannot be known before the values it depends on,
+	// and invalid ones are reported when applying the plan
+	if data.selectorUnknown() {
+		// the selector may change once known, and updates cannot drain
+		// the nodes it would no longer select, so the node pool is
+		// replaced whenever the unknown values may change it
+		if state != nil {
+			resp.RequiresReplace = append(resp.RequiresReplace, changedSelectorPaths(state, data)...)
+		}
+		return
+	}
+	query, diags := data.nodeQuery(ctx)
+	if diags.HasError() {
+		return
+	}
+
+	// the GKE node pool is only needed by the destroy, when it is too late to fix it
+	if !destroy && data.GKE != nil && !data.GKE.Project.IsUnknown() && !data.GKE.Location.IsUnknown() && !data.GKE.Cluster.IsUnknown() {
+		if _, err := data.GKE.nodePool(data.NodePoolName.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("gke"), "Invalid GKE node pool", err.Error()+".")
+		}
+	}
+
+	if r.nodePools != nil {
+		if other, ok := r.nodePools.register(query.String(), data.NodePoolName.ValueString()); ok {
+			var diags diag.Diagnostics
+			diags.Append(newNamedWarning(
+				diagOverlappingNodePools,
+				"Overlapping node pools",
+				fmt.Sprintf("Node pools %s and %s select the same nodes with %s, their drains would interleave unpredictably. Set node_selector_value or node_selector to select distinct nodes.", other, data.NodePoolName.ValueString(), query),
+			))
+			resp.Diagnostics.Append(data.overrideDiagnostics(ctx, diags)...)
+		}
+	}
+
+	// updating the selector would silently orphan the nodes it no longer
+	// selects, so the node pool is replaced instead, draining them
+	if state != nil {
+		if priorQuery, diags := state.nodeQuery(ctx); !diags.HasError() && priorQuery.String() != query.String() {
+			resp.RequiresReplace = append(resp.RequiresReplace, changedSelectorPaths(state, data)...)
+		}
+	}
+
+	// only the destroy plans are modified
+	if !destroy || r.k8sClient == nil {
+		return
+	}
+
+	// record the nodes to be drained so that the destroy can
+	// detect the nodes added to the pool since it was planned
+
+	err := r.findMachineNodes(ctx, &query)
+	var nodes []v1.Node
+	if err == nil {
+		nodes, err = orchestrate.ListNodes(ctx, r.k8sClient, r.retry, query)
+	}
+	if err != nil {
+		resp.Diagnostics.AddWarning(
+			"Unable to list nodes",
+			fmt.Sprintf("Could not list the nodes in pool %s, the nodes added to the pool before the destroy will not be detected: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+		return
+	}
+
+	// we ignore the error as marshalling a slice of strings cannot fail
+	plannedNodesJSON, _ := json.Marshal(nodeNames(nodes))
+	resp.Diagnostics.Append(resp.Private.SetKey(ctx, plannedNodesKey, plannedNodesJSON)...)
+}
+
+// selectorUnknown reports whether any of the values selecting the nodes of the
+// pool is unknown.
+func (m *NodePoolResourceModel) selectorUnknown() bool {
+	if m.NodePoolName.IsUnknown() || m.NodeSelectorKey.IsUnknown() || m.NodeSelectorValue.IsUnknown() || m.NodeSelector.IsUnknown() || m.NodeFieldSelector.IsUnknown() {
+		return true
+	}
+	for _, expression := range m.SelectorExprs {
+		if expression.Key.IsUnknown() || expression.Operator.IsUnknown() || expression.Values.IsUnknown() {
+			return true
+		}
+	}
+	return m.ClusterAPI != nil && (m.ClusterAPI.MachineDeployment.IsUnknown() || m.ClusterAPI.Namespace.IsUnknown())
+}
+
+// changedSelectorPaths returns the paths of the attributes selecting the
+// nodes of the pool that differ between prior and planned.
+func changedSelectorPaths(prior, planned *NodePoolResourceModel) path.Paths {
+	var paths path.Paths
+	if !prior.NodeSelectorKey.Equal(planned.NodeSelectorKey) {
+		paths = append(paths, path.Root("node_selector_key"))
+	}
+	if !prior.NodeSelectorValue.Equal(planned.NodeSelectorValue) {
+		paths = append(paths, path.Root("node_selector_value"))
+	}
+	if !prior.NodeSelector.Equal(planned.NodeSelector) {
+		paths = append(paths, path.Root("node_selector"))
+	}
+	if !prior.NodeFieldSelector.Equal(planned.NodeFieldSelector) {
+		paths = append(paths, path.Root("node_field_selector"))
+	}
+
+	expressionsChanged := len(prior.SelectorExprs) != len(planned.SelectorExprs)
+	for i := 0; !expressionsChanged && i < len(prior.SelectorExprs); i++ {
+		before, after := prior.SelectorExprs[i], planned.SelectorExprs[i]
+		expressionsChanged = !before.Key.Equal(after.Key) || !before.Operator.Equal(after.Operator) || !before.Values.Equal(after.Values)
+	}
+	if expressionsChanged {
+		paths = append(paths, path.Root("node_selector_expressions"))
+	}
+	if (prior.ClusterAPI == nil) != (planned.ClusterAPI == nil) ||
+		(prior.ClusterAPI != nil && prior.ClusterAPI.pool(nil) != planned.ClusterAPI.pool(nil)) {
+		paths = append(paths, path.Root("cluster_api"))
+	}
+
+	return paths
+}
+
 func (r *NodePoolResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
 	var data *NodePoolResourceModel
 
@@ -170,51 +245,222 @@ func (r *NodePoolResource) Create(ctx context.Context, req resource.CreateReques
 		return
 	}
 
-	tflog.Debug(ctx, fmt.Sprintf("waiting for %d nodes to be ready in node pool %s", data.MinReadyNodes.ValueInt64(), data.NodePoolName.ValueString()))
+	ctx, span := startSpan(ctx, "create node pool", attribute.String("node_pool", data.NodePoolName.ValueString()))
+	defer span.End()
+
+	r.resumeAsyncDestroysOnce(ctx, &resp.Diagnostics)
 
-	// we ignore the error as the validator for the argument in the schema
-	// definition above will ensure its validity
-	readyTimeout, _ := time.ParseDuration(data.ReadyTimeout.ValueString())
+	events := newEventStream(r.eventStream, data.NodePoolName.ValueString())
+	defer events.finish(ctx, &resp.Diagnostics)
+	events.phase(ctx, "waiting_for_nodes")
 
-	labelKey := data.NodeSelectorKey.ValueString()
-	labelValue := data.NodePoolName.ValueString()
-	if !data.NodeSelectorValue.IsUnknown() && !data.NodeSelectorValue.IsNull() {
-		labelValue = data.NodeSelectorValue.ValueString()
+	// the handle is only set once the node pool is ready
+	data.ReadyHandle = types.StringNull()
+	data.setNodes(ctx, nil, orchestrate.ReadinessCriteria{})
+
+	minReadyNodes := data.MinReadyNodes.ValueInt64()
+	if !data.MinReadyPercent.IsNull() {
+		minReadyNodes = minReadyNodesForPercentage(data.ExpectedNodes.ValueInt64(), data.MinReadyPercent.ValueInt64())
 	}
 
-	deadline := time.Now().Add(readyTimeout)
-	for time.Now().Before(deadline) {
-		nodes, err := r.listNodes(ctx, labelKey, labelValue)
-		if err != nil {
-			resp.Diagnostics.AddError(
-				"Error creating safe node pool",
-				fmt.Sprintf("Could not create safe node pool, unexpected error listing current nodes in pool %s: %s", data.NodePoolName.ValueString(), err.Error()),
-			)
+	tflog.Debug(ctx, fmt.Sprintf("waiting for %d nodes to be ready in node pool %s", minReadyNodes, data.NodePoolName.ValueString()))
+
+	readyTimeout := data.readyTimeout()
+
+	query, diags := data.nodeQuery(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	defer func() {
+		if resp.Diagnostics.HasError() {
+			collectFailureDump(ctx, r.k8sClient, r.retry, data.NodePoolName.ValueString(), query, diagnosticsDetail(resp.Diagnostics), nil).
+				report(ctx, data.FailureDumpPath.ValueString())
+		}
+	}()
+	// the severities are overridden before checking for errors above
+	defer func() {
+		resp.Diagnostics = data.overrideDiagnostics(ctx, resp.Diagnostics)
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	// the virtual nodes are reported once the wait is over, as the
+	// nodes are filtered on every change while waiting
+	var virtualNodesMu sync.Mutex
+	virtualNodes := map[string]bool{}
+	includeNode := func(node v1.Node) bool {
+		if data.IncludeVirtual.ValueBool() || !orchestrate.IsVirtualNode(node) {
+			return true
+		}
+		virtualNodesMu.Lock()
+		virtualNodes[node.Name] = true
+		virtualNodesMu.Unlock()
+		return false
+	}
+
+	criteria := data.ReadinessChecks.criteria()
+
+	var numReadyNodes int64
+	var err error
+	switch {
+	case data.ClusterAPI != nil:
+		numReadyNodes, err = r.waitForReadyMachines(waitCtx, data, &query, minReadyNodes)
+	case data.PollInterval.IsNull():
+		numReadyNodes, err = orchestrate.WaitForReadyNodes(waitCtx, r.k8sClient, query, minReadyNodes, includeNode, criteria)
+	default:
+		pollInterval, _ := time.ParseDuration(data.PollInterval.ValueString())
+		numReadyNodes, err = orchestrate.PollForReadyNodes(waitCtx, r.k8sClient, r.retry, query, minReadyNodes, includeNode, criteria, pollInterval, data.PollBackoff.ValueBool())
+	}
+
+	virtualNodesMu.Lock()
+	virtualNodeNames := make([]string, 0, len(virtualNodes))
+	for name := range virtualNodes {
+		virtualNodeNames = append(virtualNodeNames, name)
+	}
+	virtualNodesMu.Unlock()
+	sort.Strings(virtualNodeNames)
+	for _, name := range virtualNodeNames {
+		resp.Diagnostics.Append(newNamedWarning(
+			diagVirtualNodes,
+			"Skipping virtual node",
+			fmt.Sprintf("Node %s in pool %s is a virtual node and is not counted as a ready node. Set include_virtual_nodes to count it.", name, data.NodePoolName.ValueString()),
+		))
+	}
+	if err == nil && !data.RequiredDaemonSet.IsNull() {
+		var daemonSets []string
+		resp.Diagnostics.Append(data.RequiredDaemonSet.ElementsAs(ctx, &daemonSets, false)...)
+		if resp.Diagnostics.HasError() {
 			return
 		}
 
-		numReadyNodes := countReadyNodes(nodes)
-		if numReadyNodes >= data.MinReadyNodes.ValueInt64() {
-			tflog.Debug(ctx, fmt.Sprintf("found required number of ready nodes in node pool %s...resource created", data.NodePoolName.ValueString()))
+		tflog.Debug(ctx, fmt.Sprintf("found required number of ready nodes in node pool %s...waiting for DaemonSet pods to be ready", data.NodePoolName.ValueString()))
+		events.phase(ctx, "waiting_for_daemonsets")
+
+		err = orchestrate.WaitForDaemonSetPods(waitCtx, r.k8sClient, r.retry, query, includeNode, criteria, daemonSets)
+		if err != nil && ctx.Err() == nil && waitCtx.Err() != nil {
+			resp.Diagnostics.Append(newNamedError(
+				diagDaemonSetsTimeout,
+				"Error waiting for DaemonSet pods to be ready",
+				fmt.Sprintf("Could not find ready pods of DaemonSets %s on every node in node pool %s in the specified timeout", strings.Join(daemonSets, ", "), data.NodePoolName.ValueString()),
+			))
 
 			// Save data into Terraform state
 			resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+			setNodePoolIdentity(ctx, resp.Identity, data.NodePoolName, &resp.Diagnostics)
 
 			return
 		}
+	}
+
+	if err == nil && len(data.WaitForPods) > 0 {
+		var requirements []orchestrate.PodRequirement
+		for _, pods := range data.WaitForPods {
+			minReady := int64(1)
+			if !pods.MinReady.IsNull() {
+				minReady = pods.MinReady.ValueInt64()
+			}
+			requirements = append(requirements, orchestrate.PodRequirement{
+				Namespace:     pods.Namespace.ValueString(),
+				LabelSelector: pods.LabelSelector.ValueString(),
+				MinReady:      minReady,
+			})
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("waiting for pods to be ready in node pool %s", data.NodePoolName.ValueString()))
+		events.phase(ctx, "waiting_for_pods")
+
+		err = orchestrate.WaitForPods(waitCtx, r.k8sClient, r.retry, query, requirements)
+		if err != nil && ctx.Err() == nil && waitCtx.Err() != nil {
+			resp.Diagnostics.Append(newNamedError(
+				diagPodsTimeout,
+				"Error waiting for pods to be ready",
+				fmt.Sprintf("Could not find the required ready pods in node pool %s in the specified timeout: %s", data.NodePoolName.ValueString(), err.Error()),
+			))
+
+			// Save data into Terraform state
+			resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+			setNodePoolIdentity(ctx, resp.Identity, data.NodePoolName, &resp.Diagnostics)
+
+			return
+		}
+	}
+
+	if err == nil {
+		tflog.Debug(ctx, fmt.Sprintf("found required number of ready nodes in node pool %s...resource created", data.NodePoolName.ValueString()))
+
+		if nodes, err := orchestrate.ListNodes(ctx, r.k8sClient, r.retry, query); err == nil {
+			nodes = orchestrate.FilterNodes(nodes, includeNode)
+			data.setNodes(ctx, nodes, criteria)
+			if len(nodes) == 0 {
+				data.checkEmptyPool(query, "Error creating safe node pool", &resp.Diagnostics)
+			}
+
+			if !data.MaxCrashLooping.IsNull() {
+				crashLooping, err := orchestrate.CrashLoopingPods(ctx, r.k8sClient, r.retry, nodes)
+				switch {
+				case err != nil:
+					tflog.Warn(ctx, fmt.Sprintf("failed to check for crash-looping pods in node pool %s: %s", data.NodePoolName.ValueString(), err.Error()))
+				case int64(len(crashLooping)) > data.MaxCrashLooping.ValueInt64():
+					resp.Diagnostics.Append(newNamedError(
+						diagCrashLoopingPods,
+						"Crashlooping pods in node pool",
+						fmt.Sprintf("Found %d pods in CrashLoopBackOff on the nodes of node pool %s, more than the maximum of %d: %s", len(crashLooping), data.NodePoolName.ValueString(), data.MaxCrashLooping.ValueInt64(), strings.Join(crashLooping, ", ")),
+					))
+				}
+			}
+		} else {
+			tflog.Warn(ctx, fmt.Sprintf("failed to read the nodes of node pool %s: %s", data.NodePoolName.ValueString(), err.Error()))
+		}
+
+		if data.Precordon != nil {
+			r.precordon(ctx, data, query, &resp.Diagnostics)
+		}
+
+		data.ReadyHandle = types.StringValue(readyHandle{
+			NodePoolName:      data.NodePoolName.ValueString(),
+			NodeSelector:      query.LabelSelector,
+			NodeFields:        query.FieldSelector,
+			MachineDeployment: query.MachineDeployment,
+			MinReadyNodes:     minReadyNodes,
+		}.token())
+
+		// Save data into Terraform state
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+		setNodePoolIdentity(ctx, resp.Identity, data.NodePoolName, &resp.Diagnostics)
 
-		tflog.Debug(ctx, fmt.Sprintf("found %d ready nodes in node pool %s...waiting", numReadyNodes, data.NodePoolName.ValueString()))
+		return
+	}
+
+	if ctx.Err() != nil {
+		resp.Diagnostics.AddError(
+			"Error creating safe node pool",
+			fmt.Sprintf("Could not create safe node pool %s, the operation was cancelled while waiting for nodes to be ready", data.NodePoolName.ValueString()),
+		)
+		return
+	}
 
-		time.Sleep(time.Second)
+	if waitCtx.Err() == nil {
+		resp.Diagnostics.AddError(
+			"Error creating safe node pool",
+			fmt.Sprintf("Could not create safe node pool, unexpected error waiting for nodes in pool %s to be ready: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+		return
 	}
 
-	resp.Diagnostics.AddError(
+	tflog.Debug(ctx, fmt.Sprintf("found %d ready nodes in node pool %s before the timeout", numReadyNodes, data.NodePoolName.ValueString()))
+
+	resp.Diagnostics.Append(newNamedError(
+		diagReadyTimeout,
 		"Error waiting for nodes to be ready",
-		fmt.Sprintf("Could not find %d ready nodes in node pool %s in the specified timeout", data.MinReadyNodes.ValueInt64(), data.NodePoolName.ValueString()),
-	)
+		fmt.Sprintf("Could not find %d ready nodes in node pool %s in the specified timeout", minReadyNodes, data.NodePoolName.ValueString()),
+	))
 
 	// Save data into Terraform state
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	setNodePoolIdentity(ctx, resp.Identity, data.NodePoolName, &resp.Diagnostics)
 }
 
 func (r *NodePoolResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
@@ -227,8 +473,103 @@ func (r *NodePoolResource) Read(ctx context.Context, req resource.ReadRequest, r
 		return
 	}
 
+	// resources imported with a drain progress token by
+	// earlier versions of the provider only have a name
+	if !data.NodeSelectorKey.IsNull() && r.k8sClient != nil {
+		r.readNodes(ctx, data, &resp.Diagnostics)
+	}
+
+	// the asynchronous destroys are reported once per refresh
+	if r.k8sClient != nil {
+		r.asyncDestroys.Do(func() {
+			resp.Diagnostics.Append(reportAsyncDestroys(ctx, r.k8sClient, r.retry)...)
+		})
+	}
+	resp.Diagnostics = data.overrideDiagnostics(ctx, resp.Diagnostics)
+
 	// Save updated data into Terraform state
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	setNodePoolIdentity(ctx, resp.Identity, data.NodePoolName, &resp.Diagnostics)
+}
+
+// readNodes refreshes the nodes of the node pool in data, warning when fewer
+// than the minimum number of nodes are ready. A failure to list the nodes is
+// only reported as a warning, keeping the last known nodes.
+func (r *NodePoolResource) readNodes(ctx context.Context, data *NodePoolResourceModel, diags *diag.Diagnostics) {
+	query, queryDiags := data.nodeQuery(ctx)
+	if queryDiags.HasError() {
+		diags.Append(queryDiags...)
+		return
+	}
+
+	err := r.findMachineNodes(ctx, &query)
+	var nodes []v1.Node
+	if err == nil {
+		nodes, err = orchestrate.ListNodes(ctx, r.k8sClient, r.retry, query)
+	}
+	if err != nil {
+		diags.AddWarning(
+			"Unable to read node pool",
+			fmt.Sprintf("Could not list the nodes in pool %s, keeping the last known nodes: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+		return
+	}
+
+	nodes = orchestrate.FilterNodes(nodes, func(node v1.Node) bool {
+		return data.IncludeVirtual.ValueBool() || !orchestrate.IsVirtualNode(node)
+	})
+	data.setNodes(ctx, nodes, data.ReadinessChecks.criteria())
+
+	minReadyNodes := data.MinReadyNodes.ValueInt64()
+	if !data.MinReadyPercent.IsNull() {
+		minReadyNodes = minReadyNodesForPercentage(data.ExpectedNodes.ValueInt64(), data.MinReadyPercent.ValueInt64())
+	}
+	if data.ReadyNodes.ValueInt64() < minReadyNodes {
+		diags.Append(newNamedWarning(
+			diagNodePoolNotReady,
+			"Node pool not ready",
+			fmt.Sprintf("Node pool %s has %d ready nodes out of %d, fewer than the minimum of %d ready nodes.", data.NodePoolName.ValueString(), data.ReadyNodes.ValueInt64(), data.CurrentNodes.ValueInt64(), minReadyNodes),
+		))
+	}
+}
+
+// setNodes sets the computed attributes describing nodes, counting
+// those that are ready as defined by criteria.
+func (m *NodePoolResourceModel) setNodes(ctx context.Context, nodes []v1.Node, criteria orchestrate.ReadinessCriteria) {
+	names := nodeNames(nodes)
+	sort.Strings(names)
+
+	var versions, instanceIDs []string
+	for _, node := range nodes {
+		if version := node.Status.NodeInfo.KubeletVersion; version != "" && !containsAny(versions, version) {
+			versions = append(versions, version)
+		}
+		if id := orchestrate.InstanceID(node); id != "" {
+			instanceIDs = append(instanceIDs, id)
+		}
+	}
+	sort.Strings(versions)
+	sort.Strings(instanceIDs)
+
+	// converting lists of strings cannot fail
+	m.NodeNames, _ = types.ListValueFrom(ctx, types.StringType, names)
+	m.KubeletVersions, _ = types.ListValueFrom(ctx, types.StringType, versions)
+	m.InstanceIDs, _ = types.ListValueFrom(ctx, types.StringType, instanceIDs)
+	m.CurrentNodes = types.Int64Value(int64(len(nodes)))
+	m.ReadyNodes = types.Int64Value(orchestrate.CountReadyNodes(nodes, criteria))
+}
+
+// checkEmptyPool reports that no node matches query as configured by
+// on_empty_pool, as an error with errorSummary when it is fail.
+func (m *NodePoolResourceModel) checkEmptyPool(query orchestrate.NodeQuery, errorSummary string, diags *diag.Diagnostics) {
+	detail := fmt.Sprintf("No node matches the selector %s of node pool %s, check that it is not misspelled.", query, m.NodePoolName.ValueString())
+
+	switch m.OnEmptyPool.ValueString() {
+	case emptyPoolWarn:
+		diags.AddWarning("Empty node pool", detail)
+	case emptyPoolFail:
+		diags.AddError(errorSummary, detail+" Set on_empty_pool to succeed or warn if the node pool can be empty.")
+	}
 }
 
 func (r *NodePoolResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
@@ -243,146 +584,106 @@ func (r *NodePoolResource) Update(ctx context.Context, req resource.UpdateReques
 
 	// Save updated data into Terraform state
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	setNodePoolIdentity(ctx, resp.Identity, data.NodePoolName, &resp.Diagnostics)
 }
 
-func (r *NodePoolResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
-	var data *NodePoolResourceModel
-
-	// Read Terraform prior state data into the model
-	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
-
+func (r *NodePoolResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	var schemaResp resource.SchemaResponse
+	r.Schema(ctx, resource.SchemaRequest{}, &schemaResp)
+	resp.Diagnostics.Append(setDefaults(ctx, schemaResp.Schema, &resp.State)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	tflog.Debug(ctx, fmt.Sprintf("draining node pool %s", data.NodePoolName.ValueString()))
-
-	labelKey := data.NodeSelectorKey.ValueString()
-	labelValue := data.NodePoolName.ValueString()
-	if !data.NodeSelectorValue.IsUnknown() && !data.NodeSelectorValue.IsNull() {
-		labelValue = data.NodeSelectorValue.ValueString()
-	}
-
-	nodes, err := r.listNodes(ctx, labelKey, labelValue)
-	if err != nil {
-		resp.Diagnostics.AddError(
-			"Error deleting safe node pool",
-			fmt.Sprintf("Could not delete safe node pool, unexpected error listing nodes in pool %s: %s", data.NodePoolName.ValueString(), err.Error()),
-		)
-		return
-	}
-
-	// we ignore the error as the validator for the argument in the schema
-	// definition above will ensure its validity
-	drainTimeout, _ := time.ParseDuration(data.DrainTimeout.ValueString())
-	drainWait, _ := time.ParseDuration(data.DrainWaitTime.ValueString())
-
-	// cordon all the old nodes first so that the pods will not
-	// be scheduled on nodes that we are about to delete
-	for _, node := range nodes {
-		drainer := &drain.Helper{
-			Ctx:                 ctx,
-			Client:              r.k8sClient,
-			IgnoreAllDaemonSets: true,
-			DeleteEmptyDirData:  true,
-			GracePeriodSeconds:  -1,
-			Timeout:             drainTimeout,
-			OnPodDeletedOrEvicted: func(pod *v1.Pod, usingEviction bool) {
-				tflog.Debug(ctx, fmt.Sprintf("evicted pod %s from node %s", pod.Name, node.Name))
-			},
-			Out:    drainerWriter{ctx: ctx, nodeName: node.Name},
-			ErrOut: drainerWriter{ctx: ctx, nodeName: node.Name, isErrOut: true},
-		}
-
-		tflog.Debug(ctx, fmt.Sprintf("cordoning node %s", node.Name))
-		if err := drain.RunCordonOrUncordon(drainer, &node, true); err != nil {
+	progress, ok, err := parseDrainProgressToken(req.ID)
+	if ok {
+		if err != nil {
 			resp.Diagnostics.AddError(
-				"Error deleting safe node pool",
-				fmt.Sprintf("Could not delete safe node pool, unexpected error cordoning node %s: %s", node.Name, err.Error()),
+				"Error importing safe node pool",
+				fmt.Sprintf("Could not import safe node pool, invalid drain progress token: %s", err.Error()),
 			)
 			return
 		}
-	}
 
-	// then drain them
-	for _, node := range nodes {
-		drainer := &drain.Helper{
-			Ctx:                 ctx,
-			Client:              r.k8sClient,
-			IgnoreAllDaemonSets: true,
-			DeleteEmptyDirData:  true,
-			GracePeriodSeconds:  -1,
-			Timeout:             drainTimeout,
-			OnPodDeletedOrEvicted: func(pod *v1.Pod, usingEviction bool) {
-				tflog.Debug(ctx, fmt.Sprintf("evicted pod %s from node %s", pod.Name, node.Name))
-			},
-			Out:    drainerWriter{ctx: ctx, nodeName: node.Name},
-			ErrOut: drainerWriter{ctx: ctx, nodeName: node.Name, isErrOut: true},
-		}
+		// we ignore the error as marshalling a slice of strings cannot fail
+		drainedNodesJSON, _ := json.Marshal(progress.DrainedNodes)
 
-		tflog.Debug(ctx, fmt.Sprintf("draining node %s", node.Name))
-		if err := drain.RunNodeDrain(drainer, node.Name); err != nil {
-			resp.Diagnostics.AddError(
-				"Error deleting safe node pool",
-				fmt.Sprintf("Could not delete safe node pool, unexpected error draining node %s: %s", node.Name, err.Error()),
-			)
+		resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("node_pool_name"), progress.NodePoolName)...)
+		resp.Diagnostics.Append(resp.Private.SetKey(ctx, drainedNodesKey, drainedNodesJSON)...)
+		return
+	}
+
+	importID := req.ID
+	if importID == "" && req.Identity != nil {
+		// imported by identity, e.g. in an import block with identity
+		resp.Diagnostics.Append(req.Identity.GetAttribute(ctx, path.Root("node_pool_name"), &importID)...)
+		if resp.Diagnostics.HasError() {
 			return
 		}
-
-		tflog.Debug(ctx, fmt.Sprintf("sleeping after draining node %s", node.Name))
-		time.Sleep(drainWait)
 	}
 
-}
-
-type drainerWriter struct {
-	ctx      context.Context
-	nodeName string
-	isErrOut bool
-}
-
-func (d drainerWriter) Write(p []byte) (n int, err error) {
-	var msg strings.Builder
-	msg.WriteString("drainer - ")
-
-	if d.isErrOut {
-		msg.WriteString("ERROUT - ")
+	id, err := parseNodePoolImportID(importID)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Error importing safe node pool",
+			fmt.Sprintf("Could not import safe node pool: %s", err.Error()),
+		)
+		return
 	}
 
-	msg.WriteString("node: " + d.nodeName + " - ")
-
-	msg.Write(p)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("node_pool_name"), id.nodePoolName)...)
+	if id.labelKey != "" {
+		resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("node_selector_key"), id.labelKey)...)
+		resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("node_selector_value"), id.labelValue)...)
+	}
 
-	tflog.Debug(d.ctx, msg.String())
+	var data *NodePoolResourceModel
+	resp.Diagnostics.Append(resp.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
 
-	return len(p), nil
-}
+	// only existing node pools can be adopted
+	query, diags := data.nodeQuery(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
 
-func (r *NodePoolResource) ImportState(_ context.Context, _ resource.ImportStateRequest, _ *resource.ImportStateResponse) {
-}
+	// the client is not configured while the provider configuration is unknown
+	if r.k8sClient == nil {
+		resp.Diagnostics.AddError(
+			"Error importing safe node pool",
+			fmt.Sprintf("Could not import safe node pool %s, the provider is not configured, e.g. because its configuration depends on values only known after apply. Import the node pool once the provider configuration is known.", id.nodePoolName),
+		)
+		return
+	}
 
-func (r *NodePoolResource) listNodes(ctx context.Context, labelKey, labelValue string) ([]v1.Node, error) {
-	nodeList, err := r.k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=%s", labelKey, labelValue),
-	})
+	nodes, err := orchestrate.ListNodes(ctx, r.k8sClient, r.retry, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list nodes: %w", err)
+		resp.Diagnostics.AddError(
+			"Error importing safe node pool",
+			fmt.Sprintf("Could not import safe node pool, unexpected error listing nodes in pool %s: %s", id.nodePoolName, err.Error()),
+		)
+		return
+	}
+	if len(nodes) == 0 {
+		resp.Diagnostics.AddError(
+			"Error importing safe node pool",
+			fmt.Sprintf("Could not import safe node pool %s, no node matches the selector %s.", id.nodePoolName, query),
+		)
+		return
 	}
 
-	return nodeList.Items, nil
+	setNodePoolIdentity(ctx, resp.Identity, data.NodePoolName, &resp.Diagnostics)
 }
 
-func countReadyNodes(nodes []v1.Node) int64 {
-	var numReadyNodes int64
-	for _, node := range nodes {
-		for _, condition := range node.Status.Conditions {
-			if condition.Type == v1.NodeReady {
-				if condition.Status == v1.ConditionTrue {
-					numReadyNodes += 1
-				}
-				break
-			}
-		}
+// setNodePoolIdentity stores the node pool name as the resource identity
+// when the terraform client supports resource identities.
+func setNodePoolIdentity(ctx context.Context, identity *tfsdk.ResourceIdentity, nodePoolName types.String, diags *diag.Diagnostics) {
+	if identity == nil {
+		return
 	}
-	return numReadyNodes
+
+	diags.Append(identity.Set(ctx, NodePoolResourceIdentityModel{NodePoolName: nodePoolName})...)
 }
@@ -0,0 +1,394 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestNodePoolModifyPlanSelectorChanges(t *testing.T) {
+	ctx := context.Background()
+	r := NewNodePoolResource()
+
+	schemaResp := &resource.SchemaResponse{}
+	r.Schema(ctx, resource.SchemaRequest{}, schemaResp)
+	typ := schemaResp.Schema.Type().TerraformType(ctx)
+
+	state := tfsdk.State{Schema: schemaResp.Schema, Raw: objectValue(t, typ, map[string]tftypes.Value{
+		"node_pool_name":      tftypes.NewValue(tftypes.String, "pool"),
+		"node_selector_key":   tftypes.NewValue(tftypes.String, "pool"),
+		"node_selector_value": tftypes.NewValue(tftypes.String, "a"),
+	})}
+
+	tests := map[string]struct {
+		value    tftypes.Value
+		replaced bool
+	}{
+		"unchanged": {value: tftypes.NewValue(tftypes.String, "a")},
+		"changed":   {value: tftypes.NewValue(tftypes.String, "b"), replaced: true},
+		"unknown":   {value: tftypes.NewValue(tftypes.String, tftypes.UnknownValue), replaced: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plan := tfsdk.Plan{Schema: schemaResp.Schema, Raw: objectValue(t, typ, map[string]tftypes.Value{
+				"node_pool_name":      tftypes.NewValue(tftypes.String, "pool"),
+				"node_selector_key":   tftypes.NewValue(tftypes.String, "pool"),
+				"node_selector_value": test.value,
+			})}
+
+			resp := &resource.ModifyPlanResponse{Plan: plan}
+			r.(resource.ResourceWithModifyPlan).ModifyPlan(ctx, resource.ModifyPlanRequest{State: state, Plan: plan}, resp)
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("unexpected error: %v", resp.Diagnostics)
+			}
+
+			replaced := resp.RequiresReplace.Contains(path.Root("node_selector_value"))
+			if replaced != test.replaced {
+				t.Errorf("expected the node pool to be replaced %t, got %t", test.replaced, replaced)
+			}
+		})
+	}
+}
+
+// validateNodePoolConfig validates the node pool configuration with the given
+// attribute values as Terraform does, and returns the error diagnostics.
+func validateNodePoolConfig(t *testing.T, values func(typ tftypes.Object) map[string]tftypes.Value) []*tfprotov6.Diagnostic {
+	t.Helper()
+	ctx := context.Background()
+
+	server, err := providerserver.NewProtocol6WithError(New("test")())()
+	if err != nil {
+		t.Fatalf("unexpected error creating the provider server: %v", err)
+	}
+	schemas, err := server.GetProviderSchema(ctx, &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error getting the provider schema: %v", err)
+	}
+	typ := schemas.ResourceSchemas["k8snp_node_pool"].ValueType().(tftypes.Object)
+
+	attributes := values(typ)
+	attributes["node_pool_name"] = tftypes.NewValue(tftypes.String, "pool")
+	config, err := tfprotov6.NewDynamicValue(typ, objectValue(t, typ, attributes))
+	if err != nil {
+		t.Fatalf("unexpected error creating the config: %v", err)
+	}
+
+	resp, err := server.ValidateResourceConfig(ctx, &tfprotov6.ValidateResourceConfigRequest{TypeName: "k8snp_node_pool", Config: &config})
+	if err != nil {
+		t.Fatalf("unexpected error validating the config: %v", err)
+	}
+	var errs []*tfprotov6.Diagnostic
+	for _, diagnostic := range resp.Diagnostics {
+		if diagnostic.Severity == tfprotov6.DiagnosticSeverityError {
+			errs = append(errs, diagnostic)
+		}
+	}
+	return errs
+}
+
+func TestNodePoolValidateBlocks(t *testing.T) {
+	tests := map[string]struct {
+		values func(typ tftypes.Object) map[string]tftypes.Value
+		fails  bool
+	}{
+		"no blocks": {
+			values: func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{}
+			},
+		},
+		"block with its required attribute": {
+			values: func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{
+					"approval": objectValue(t, typ.AttributeTypes["approval"], map[string]tftypes.Value{
+						"url": tftypes.NewValue(tftypes.String, "https://approvals.example.com"),
+					}),
+				}
+			},
+		},
+		"block without its required attribute": {
+			values: func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{
+					"approval": objectValue(t, typ.AttributeTypes["approval"], map[string]tftypes.Value{
+						"timeout": tftypes.NewValue(tftypes.String, "1h"),
+					}),
+				}
+			},
+			fails: true,
+		},
+		"aws_autoscaling with the default credentials": {
+			values: func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{
+					"aws_autoscaling": objectValue(t, typ.AttributeTypes["aws_autoscaling"], map[string]tftypes.Value{}),
+				}
+			},
+		},
+		"aws_autoscaling with an access key without secret": {
+			values: func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{
+					"aws_autoscaling": objectValue(t, typ.AttributeTypes["aws_autoscaling"], map[string]tftypes.Value{
+						"access_key_id": tftypes.NewValue(tftypes.String, "AKID"),
+					}),
+				}
+			},
+			fails: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			errs := validateNodePoolConfig(t, test.values)
+			if failed := len(errs) > 0; failed != test.fails {
+				for _, diagnostic := range errs {
+					t.Logf("%s: %s", diagnostic.Summary, diagnostic.Detail)
+				}
+				t.Errorf("expected the validation to fail %t, got %t", test.fails, failed)
+			}
+		})
+	}
+}
+
+func TestNodePoolValidateTimeouts(t *testing.T) {
+	tests := map[string]struct {
+		values func(typ tftypes.Object) map[string]tftypes.Value
+		fails  bool
+	}{
+		"timeouts": {
+			values: func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{
+					"timeouts": objectValue(t, typ.AttributeTypes["timeouts"], map[string]tftypes.Value{
+						"create": tftypes.NewValue(tftypes.String, "10m"),
+						"delete": tftypes.NewValue(tftypes.String, "2h"),
+					}),
+				}
+			},
+		},
+		"deprecated arguments": {
+			values: func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{
+					"ready_timeout":  tftypes.NewValue(tftypes.String, "10m"),
+					"delete_timeout": tftypes.NewValue(tftypes.String, "2h"),
+				}
+			},
+		},
+		"both create timeouts": {
+			values: func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{
+					"ready_timeout": tftypes.NewValue(tftypes.String, "10m"),
+					"timeouts": objectValue(t, typ.AttributeTypes["timeouts"], map[string]tftypes.Value{
+						"create": tftypes.NewValue(tftypes.String, "5m"),
+					}),
+				}
+			},
+			fails: true,
+		},
+		"both delete timeouts": {
+			values: func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{
+					"delete_timeout": tftypes.NewValue(tftypes.String, "2h"),
+					"timeouts": objectValue(t, typ.AttributeTypes["timeouts"], map[string]tftypes.Value{
+						"delete": tftypes.NewValue(tftypes.String, "1h"),
+					}),
+				}
+			},
+			fails: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			errs := validateNodePoolConfig(t, test.values)
+			if failed := len(errs) > 0; failed != test.fails {
+				for _, diagnostic := range errs {
+					t.Logf("%s: %s", diagnostic.Summary, diagnostic.Detail)
+				}
+				t.Errorf("expected the validation to fail %t, got %t", test.fails, failed)
+			}
+		})
+	}
+}
+
+func TestNodePoolValidateHeartbeatStaleness(t *testing.T) {
+	tests := map[string]struct {
+		threshold string
+		fails     bool
+	}{
+		"longer than the status reports":  {threshold: "10m"},
+		"status report frequency":         {threshold: "5m"},
+		"shorter than the status reports": {threshold: "1m", fails: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			errs := validateNodePoolConfig(t, func(typ tftypes.Object) map[string]tftypes.Value {
+				return map[string]tftypes.Value{
+					"readiness_checks": objectValue(t, typ.AttributeTypes["readiness_checks"], map[string]tftypes.Value{
+						"heartbeat_staleness_threshold": tftypes.NewValue(tftypes.String, test.threshold),
+					}),
+				}
+			})
+			if failed := len(errs) > 0; failed != test.fails {
+				for _, diagnostic := range errs {
+					t.Logf("%s: %s", diagnostic.Summary, diagnostic.Detail)
+				}
+				t.Errorf("expected the validation to fail %t, got %t", test.fails, failed)
+			}
+		})
+	}
+}
+
+func FuzzNodeQuery(f *testing.F) {
+	f.Add("cloud.google.com/gke-nodepool", "default-pool", "topology.kubernetes.io/zone", "In", "europe-west1-b")
+	f.Add("pool", "", "spot", "Exists", "")
+	f.Add("pool", "a", "pool", "NotIn", "a")
+	f.Add("example.com/pool", "a,b", "zone", "In", "a b")
+	f.Add("pool", "a", "zone", "Gt", "1")
+
+	f.Fuzz(func(t *testing.T, key, value, expressionKey, operator, expressionValue string) {
+		if _, ok := selectorOperators[operator]; !ok {
+			return
+		}
+		var values []string
+		if operator != "Exists" {
+			values = []string{expressionValue}
+		}
+		// only the values accepted by the validators reach nodeQuery
+		for _, diags := range []diag.Diagnostics{
+			validateString(LabelKey(), key),
+			validateString(LabelValue(), value),
+			validateString(LabelKey(), expressionKey),
+			validateString(LabelValue(), expressionValue),
+		} {
+			if diags.HasError() {
+				return
+			}
+		}
+
+		model := NodePoolResourceModel{
+			NodeSelectorKey:   types.StringValue(key),
+			NodeSelectorValue: types.StringValue(value),
+			NodeSelector:      types.MapNull(types.StringType),
+			SelectorExprs: []NodePoolSelectorExprModel{{
+				Key:      types.StringValue(expressionKey),
+				Operator: types.StringValue(operator),
+				Values:   types.ListValueMust(types.StringType, stringValues(values)),
+			}},
+		}
+		query, diags := model.nodeQuery(context.Background())
+		if diags.HasError() {
+			t.Fatalf("unexpected error for valid selectors: %v", diags)
+		}
+
+		selector, err := labels.Parse(query.LabelSelector)
+		if err != nil {
+			t.Fatalf("unexpected error parsing the label selector %q: %v", query.LabelSelector, err)
+		}
+		if key == expressionKey {
+			return
+		}
+		node := labels.Set{key: value}
+		if operator != "NotIn" {
+			node[expressionKey] = expressionValue
+		}
+		if !selector.Matches(node) {
+			t.Errorf("expected the label selector %q to match the labels %v", query.LabelSelector, node)
+		}
+	})
+}
+
+func stringValues(values []string) []attr.Value {
+	elements := make([]attr.Value, len(values))
+	for i, value := range values {
+		elements[i] = types.StringValue(value)
+	}
+	return elements
+}
+
+func TestNodePoolDeleteProviderDryRun(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(newTestNode("node-1", map[string]string{"pool": "a"}, true))
+	providerData := configureProvider(t, client).(*K8sNpProviderData)
+	providerData.dryRun = true
+
+	r := NewNodePoolResource()
+	configureResp := &resource.ConfigureResponse{}
+	r.(resource.ResourceWithConfigure).Configure(ctx, resource.ConfigureRequest{ProviderData: providerData}, configureResp)
+	if configureResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error configuring the resource: %v", configureResp.Diagnostics)
+	}
+
+	schemaResp := &resource.SchemaResponse{}
+	r.Schema(ctx, resource.SchemaRequest{}, schemaResp)
+	state := tfsdk.State{Schema: schemaResp.Schema, Raw: objectValue(t, schemaResp.Schema.Type().TerraformType(ctx), map[string]tftypes.Value{
+		"node_pool_name":      tftypes.NewValue(tftypes.String, "pool"),
+		"node_selector_key":   tftypes.NewValue(tftypes.String, "pool"),
+		"node_selector_value": tftypes.NewValue(tftypes.String, "a"),
+		"drain_timeout":       tftypes.NewValue(tftypes.String, "10s"),
+		"drain_concurrency":   tftypes.NewValue(tftypes.Number, 1),
+	})}
+
+	resp := &resource.DeleteResponse{State: state}
+	r.Delete(ctx, resource.DeleteRequest{State: state}, resp)
+
+	// the destroy fails so that the node pool is kept in the state
+	if resp.Diagnostics.ErrorsCount() != 1 || resp.Diagnostics.Errors()[0].Summary() != "Dry run of safe node pool destroy" {
+		t.Errorf("expected the dry run to fail the destroy, got %v", resp.Diagnostics)
+	}
+}
+
+func TestNodePoolSkipNodes(t *testing.T) {
+	nodes := []v1.Node{
+		*newTestNode("worker", map[string]string{"pool": "a"}, true),
+		*newTestNode("control-plane", map[string]string{"pool": "a", "node-role.kubernetes.io/control-plane": ""}, true),
+		*newTestNode("fargate", map[string]string{"pool": "a", "eks.amazonaws.com/compute-type": "fargate"}, true),
+		*newTestNode("excluded", map[string]string{"pool": "a"}, true),
+		*newTestNode("canary", map[string]string{"pool": "a", "canary": "true"}, true),
+	}
+	model := NodePoolResourceModel{
+		NodePoolName:     types.StringValue("pool"),
+		IncludeCtrlPlane: types.BoolValue(false),
+		IncludeVirtual:   types.BoolValue(false),
+		ExcludeNodes:     types.ListValueMust(types.StringType, stringValues([]string{"excluded"})),
+		ExcludeSelector:  types.StringValue("canary=true"),
+	}
+
+	var diags diag.Diagnostics
+	included := model.skipNodes(context.Background(), nodes, &diags)
+	if diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if names := nodeNames(included); !reflect.DeepEqual(names, []string{"worker"}) {
+		t.Errorf("expected only the worker node to be drained, got %v", names)
+	}
+	if warnings := diags.WarningsCount(); warnings != 3 {
+		t.Errorf("expected a warning for the control plane, virtual and excluded nodes, got %v", diags)
+	}
+}
+
+func TestNodePoolImportStateUnconfigured(t *testing.T) {
+	ctx := context.Background()
+	r := NewNodePoolResource()
+
+	schemaResp := &resource.SchemaResponse{}
+	r.Schema(ctx, resource.SchemaRequest{}, schemaResp)
+	state := tfsdk.State{Schema: schemaResp.Schema, Raw: tftypes.NewValue(schemaResp.Schema.Type().TerraformType(ctx), nil)}
+
+	resp := &resource.ImportStateResponse{State: state}
+	r.(resource.ResourceWithImportState).ImportState(ctx, resource.ImportStateRequest{ID: "pool"}, resp)
+
+	if resp.Diagnostics.ErrorsCount() != 1 || resp.Diagnostics.Errors()[0].Summary() != "Error importing safe node pool" {
+		t.Errorf("expected the import to fail without a configured provider, got %v", resp.Diagnostics)
+	}
+}
@@ -0,0 +1,1151 @@
+package provider
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/listvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/mapvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/objectvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/identityschema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func (r *NodePoolResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "Node pool",
+
+		Attributes: map[string]schema.Attribute{
+			"node_pool_name": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "Node pool name. A full GKE node pool ID or self-link, e.g. `projects/my-project/locations/us-central1/clusters/my-cluster/nodePools/my-pool`, is accepted and the node pool name parsed out of it.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+					stringplanmodifier.RequiresReplace(),
+				},
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+			},
+			"min_ready_nodes": schema.Int64Attribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Minimum number of ready nodes in the new node pool. Defaults to `1`.",
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+				Default:    int64default.StaticInt64(1),
+				Validators: []validator.Int64{int64validator.AtLeast(1)},
+			},
+			"max_crashlooping_pods": schema.Int64Attribute{
+				Optional: true,
+				MarkdownDescription: "Maximum number of pods with a container in `CrashLoopBackOff` on the nodes of the new node pool once they are ready, as crash-looping pods often indicate that the nodes are not actually usable. " +
+					"The creation fails when there are more, unless downgraded to a warning with the `crashlooping_pods` key of `diagnostic_overrides`. The pods are not checked when not set.",
+				Validators: []validator.Int64{int64validator.AtLeast(0)},
+			},
+			"min_ready_percentage": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "Minimum percentage of `expected_nodes` that must be ready in the new node pool, e.g. `90`. Overrides `min_ready_nodes`.",
+				Validators: []validator.Int64{
+					int64validator.Between(1, 100),
+					int64validator.AlsoRequires(path.MatchRoot("expected_nodes")),
+					int64validator.ConflictsWith(path.MatchRoot("min_ready_nodes")),
+				},
+			},
+			"expected_nodes": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "Expected number of nodes in the new node pool, used with `min_ready_percentage`.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+					int64validator.AlsoRequires(path.MatchRoot("min_ready_percentage")),
+				},
+			},
+			"rotation_trigger": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				MarkdownDescription: "Arbitrary values whose change replaces the resource, draining the nodes of the node pool without renaming it, e.g. " +
+					"`{ image = var.node_image, launch_template_version = aws_launch_template.nodes.latest_version }` to rotate the nodes of a pool updated in place, or a `revision` value bumped to force a rotation.",
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+			},
+			"node_selector_key": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Label key used to select the nodes affected by this resource. Changing the nodes selected by the resource replaces it, draining the nodes selected before. Defaults to `cloud.google.com/gke-nodepool`.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+				Default: stringdefault.StaticString("cloud.google.com/gke-nodepool"),
+				Validators: []validator.String{
+					LabelKey(),
+				},
+			},
+			"node_selector_value": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Label value used to select the nodes affected by this resource. Changing the nodes selected by the resource replaces it, draining the nodes selected before. Defaults to the node pool name.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+					LabelValue(),
+				},
+			},
+			"node_selector": schema.MapAttribute{
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Additional labels, with their values, the nodes affected by this resource must have on top of `node_selector_key`, e.g. `{ \"topology.kubernetes.io/zone\" = \"us-central1-a\" }`.",
+				Validators: []validator.Map{
+					mapvalidator.KeysAre(LabelKey()),
+					mapvalidator.ValueStringsAre(LabelValue()),
+				},
+			},
+			"node_field_selector": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Field selector further restricting the nodes affected by this resource, e.g. `spec.unschedulable=false` to only select the schedulable nodes.",
+				Validators: []validator.String{
+					FieldSelector(),
+				},
+			},
+			"ready_timeout": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Maximum time for waiting for nodes in a new node pool to be ready. Defaults to `300s`.",
+				DeprecationMessage:  "Use the create argument of the timeouts block instead.",
+				Default:             stringdefault.StaticString("300s"),
+				Validators: []validator.String{
+					MinDuration(0),
+					stringvalidator.ConflictsWith(path.MatchRoot("timeouts").AtName("create")),
+				},
+			},
+			"delete_timeout": schema.StringAttribute{
+				Optional: true,
+				MarkdownDescription: "Maximum time for the whole destroy, e.g. `2h`, as opposed to `drain_timeout` bounding the drain of each node. " +
+					"When exceeded the destroy fails, uncordoning the nodes when `uncordon_on_failure` is set and reporting the nodes drained so far. There is no overall limit when not set.",
+				DeprecationMessage: "Use the delete argument of the timeouts block instead.",
+				Validators: []validator.String{
+					MinDuration(0),
+					stringvalidator.ConflictsWith(path.MatchRoot("timeouts").AtName("delete")),
+				},
+			},
+			"drain_timeout": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Timeout for the drain of each node, including the retries, the evictions and the wait for volumes to be detached. Defaults to `300s`.",
+				Default:             stringdefault.StaticString("300s"),
+				Validators: []validator.String{
+					MinDuration(0),
+				},
+			},
+			"pod_eviction_timeout": schema.StringAttribute{
+				Optional: true,
+				MarkdownDescription: "Maximum time to wait for the pods evicted from a node to be deleted, equivalent to the `--timeout` flag of `kubectl drain`. " +
+					"Unlike `eviction_request_timeout`, which bounds each eviction request, it bounds the whole wait. " +
+					"Bounded by the timeout of the drain of the node. Defaults to the timeout of the drain of the node.",
+				Validators: []validator.String{
+					MinDuration(0),
+				},
+			},
+			"drain_wait": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Amount of time to wait after each node drain operation. Defaults to `60s`.",
+				Default:             stringdefault.StaticString("60s"),
+				Validators: []validator.String{
+					MinDuration(0),
+				},
+			},
+			"drain_wait_jitter": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Maximum random time added to each wait after a node drain, e.g. `30s`, so that the rotations of several node pools do not proceed in lockstep.",
+				Validators: []validator.String{
+					MinDuration(0),
+				},
+			},
+			"drain_wait_strategy": schema.StringAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "How the wait after each node drain evolves during the drain of the node pool: `fixed` to always wait `drain_wait`, " +
+					"or `linear-rampdown` to shrink it linearly from `drain_wait` after the first node, or batch, to nothing after the last one. Defaults to `fixed`.",
+				Default: stringdefault.StaticString(orchestrate.WaitFixed),
+				Validators: []validator.String{
+					stringvalidator.OneOf(orchestrate.WaitFixed, orchestrate.WaitLinearRampdown),
+				},
+			},
+			"include_virtual_nodes": schema.BoolAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Include virtual nodes, e.g. EKS Fargate or virtual-kubelet nodes, when counting ready nodes and draining the node pool. Virtual nodes are skipped with a warning by default. Defaults to `false`.",
+				Default:             booldefault.StaticBool(false),
+			},
+			"include_control_plane_nodes": schema.BoolAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Include control plane nodes, labelled with `node-role.kubernetes.io/control-plane` or `node-role.kubernetes.io/master`, when draining the node pool. Control plane nodes are skipped with a warning by default, protecting self-managed clusters from a too broad node selector. Defaults to `false`.",
+				Default:             booldefault.StaticBool(false),
+			},
+			"check_admission_webhooks": schema.BoolAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Verify before draining that no admission webhook with a `Fail` failure policy intercepting pod evictions is unavailable, since it would reject every eviction and stall the drain. Requires permission to list the validating and mutating webhook configurations of the cluster; the check is skipped with a warning when it fails. The `namespaceSelector` and `objectSelector` of the webhooks are not evaluated, so webhooks scoped to other pods are reported too. Defaults to `false`.",
+				Default:             booldefault.StaticBool(false),
+			},
+			"poll_interval": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Poll the node list with this interval while waiting for nodes to be ready instead of watching the nodes, e.g. when long-lived connections to the API server are not possible. Nodes are watched when not set.",
+				Validators: []validator.String{
+					MinDuration(100 * time.Millisecond),
+				},
+			},
+			"poll_backoff": schema.BoolAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Double the `poll_interval`, with jitter and up to a minute, after each poll of the node list. Defaults to `false`.",
+				Default:             booldefault.StaticBool(false),
+			},
+			"deletion_protection": schema.BoolAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Prevent the node pool from being drained and destroyed. It must be set to `false` and applied before the resource can be destroyed. Defaults to `false`.",
+				Default:             booldefault.StaticBool(false),
+			},
+			"drain_concurrency": schema.Int64Attribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Maximum number of nodes drained at the same time. Pod disruption budgets and `drain_timeout` still apply to every node. Defaults to `1`.",
+				Default:             int64default.StaticInt64(1),
+				Validators:          []validator.Int64{int64validator.AtLeast(1)},
+			},
+			"wait_for_volume_detach": schema.BoolAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Wait, within the `drain_timeout`, for the persistent volumes attached to a node to be detached before considering the node drained. Defaults to `false`.",
+				Default:             booldefault.StaticBool(false),
+			},
+			"delete_node_after_drain": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "Delete the Node object of each node once drained, instead of leaving it until its cloud instance is deleted, so that the endpoints and routes of the node are cleaned up sooner. " +
+					"Failures to delete the node are only logged. The kubelet of an instance still running registers the node again when restarted. Defaults to `false`.",
+				Default: booldefault.StaticBool(false),
+			},
+			"max_unavailable": schema.StringAttribute{
+				Optional: true,
+				MarkdownDescription: "Drain the nodes in batches of this size, either a number of nodes or a percentage of the node pool, e.g. `25%`. " +
+					"Before starting the next batch the evicted pods must be rescheduled and ready elsewhere. Conflicts with `drain_concurrency`.",
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(regexp.MustCompile(`^[1-9][0-9]*%?$`), "must be a positive number or percentage, e.g. 2 or 25%"),
+					stringvalidator.ConflictsWith(path.MatchRoot("drain_concurrency")),
+				},
+			},
+			"total_drain_budget": schema.StringAttribute{
+				Optional: true,
+				MarkdownDescription: "Overall time allowed for draining all the nodes one at a time, shared among them proportionally to the number of pods to evict from each node. " +
+					"Time left unused by a node is available to the following ones. Replaces `drain_timeout` and conflicts with `drain_concurrency` and `max_unavailable`.",
+				Validators: []validator.String{
+					MinDuration(time.Second),
+					stringvalidator.ConflictsWith(path.MatchRoot("drain_concurrency"), path.MatchRoot("max_unavailable")),
+				},
+			},
+			"required_daemonsets": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				MarkdownDescription: "DaemonSets, given as `namespace/name`, e.g. CNI, CSI or logging agents, that must have a ready pod on every ready node before the node pool is considered ready. " +
+					"The wait is bounded by the `create` timeout.",
+				Validators: []validator.List{
+					listvalidator.ValueStringsAre(
+						stringvalidator.RegexMatches(regexp.MustCompile(`^[^/]+/[^/]+$`), "must be a DaemonSet in the namespace/name format, e.g. kube-system/calico-node"),
+					),
+				},
+			},
+			"control_plane_flap_tolerance": schema.StringAttribute{
+				Optional: true,
+				MarkdownDescription: "Pause cordons and drains, instead of failing, for up to this long while the kubernetes API server is unavailable, e.g. refusing connections during a control plane upgrade. " +
+					"Drains fail as soon as the API server is unavailable when not set.",
+				Validators: []validator.String{
+					MinDuration(time.Second),
+				},
+			},
+			"drain_pod_selector": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Only evict the pods matching this label selector when draining the nodes, e.g. `app.kubernetes.io/managed-by!=vendor-agent`. All pods are evicted when not set.",
+				Validators: []validator.String{
+					LabelSelector(),
+				},
+			},
+			"drain_namespace_include": schema.ListAttribute{
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Only evict the pods in these namespaces when draining the nodes. Pods in all namespaces are evicted when not set. Conflicts with `drain_namespace_exclude`.",
+				Validators: []validator.List{
+					listvalidator.ValueStringsAre(stringvalidator.LengthAtLeast(1)),
+					listvalidator.ConflictsWith(path.MatchRoot("drain_namespace_exclude")),
+				},
+			},
+			"drain_namespace_exclude": schema.ListAttribute{
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Do not evict the pods in these namespaces, e.g. system namespaces or those managed by another operator, when draining the nodes.",
+				Validators: []validator.List{
+					listvalidator.ValueStringsAre(stringvalidator.LengthAtLeast(1)),
+				},
+			},
+			"annotate_nodes": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "Annotate each drained node with `" + orchestrate.DrainStartedAnnotation + "` and `" + orchestrate.DrainCompletedAnnotation + "`, holding the time of the drain and the node pool name, and with `" + orchestrate.DrainedByAnnotation + "`, holding the provider version and the terraform run ID, as an audit trail of the drains. " +
+					"A destroy interrupted before saving its progress then skips the nodes still cordoned whose drain by the node pool completed. Defaults to `false`.",
+				Default: booldefault.StaticBool(false),
+			},
+			"annotate_workloads": schema.BoolAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Annotate the Deployments and StatefulSets of the evicted pods with `k8snp.io/last-drain`, holding the time of the drain and the node pool name, to correlate their restarts with node pool rotations. Defaults to `false`.",
+				Default:             booldefault.StaticBool(false),
+			},
+			"wait_for_rescheduled_pods": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "After draining each node, wait for the ReplicaSets and StatefulSets of the evicted pods to have all their replicas ready again on other nodes before draining the next node, within `drain_timeout`. " +
+					"Drains in batches of `max_unavailable` nodes always wait between batches. Defaults to `false`.",
+				Default: booldefault.StaticBool(false),
+			},
+			"pdb_retry_interval": schema.StringAttribute{
+				Optional: true,
+				MarkdownDescription: "Initial interval between retries of pod evictions rejected because of a pod disruption budget, doubled after each retry up to a minute. " +
+					"The blocking budgets are logged at each retry. The evictions are retried every `5s` by the drain when neither this nor `pdb_block_timeout` is set.",
+				Validators: []validator.String{
+					MinDuration(100 * time.Millisecond),
+				},
+			},
+			"pdb_block_timeout": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Fail the drain when the eviction of a pod is blocked by a pod disruption budget for longer than this. Blocked evictions are retried until the drain timeout when not set.",
+				Validators: []validator.String{
+					MinDuration(time.Second),
+				},
+			},
+			"uncordon_on_failure": schema.BoolAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Uncordon the nodes cordoned by a destroy when the drain fails, leaving the cluster schedulable. Defaults to `true`.",
+				Default:             booldefault.StaticBool(true),
+			},
+			"async_destroy": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "Return from the destroy once the nodes were drained for `async_drain_budget`, even when nodes are left to drain, e.g. to keep the teardown of very large node pools within CI time limits. " +
+					"The nodes are drained one at a time with evictions respecting the pod disruption budgets, and the progress of the destroy is recorded in a ConfigMap in the `kube-system` namespace after each node. " +
+					"The nodes left are cordoned again if needed and drained, for up to the budget, by the first node pool created or destroyed by each later run of the provider, until all of them are drained. " +
+					"Refreshes only warn about the destroys in progress. Defaults to `false`.",
+				Default: booldefault.StaticBool(false),
+			},
+			"async_drain_budget": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "How long an `async_destroy`, and each create or destroy resuming it, drains the nodes before returning. Defaults to `10m`.",
+				Default:             stringdefault.StaticString("10m"),
+				Validators: []validator.String{
+					MinDuration(time.Second),
+				},
+			},
+			"guard_csi_controllers": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "Before draining each node, wait for the controllers of CSI drivers running on it, found from their well-known labels or `csi-provisioner`, `csi-attacher` and `csi-resizer` sidecars, to have a ready replica on another schedulable node, within `drain_timeout`. " +
+					"Evicting the only replica of a CSI controller stalls the volume operations of the whole cluster until it is rescheduled. Defaults to `false`.",
+				Default: booldefault.StaticBool(false),
+			},
+			"dry_run": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "Make the destroy report the nodes it would drain, in order, with the pods it would evict and the pod disruption budgets currently blocking them, without cordoning or evicting anything. " +
+					"The destroy then fails so that the node pool is kept, to validate a rotation before the real destroy. Defaults to `false`.",
+				Default: booldefault.StaticBool(false),
+			},
+			"skip_capacity_check": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "Skip the check, before any node is cordoned, that the CPU and memory requested by the pods to evict fit in the capacity not yet requested on the other ready and schedulable nodes. " +
+					"The check fails the destroy with the shortfall, rather than leaving a half-drained pool with unschedulable pods. Defaults to `false`.",
+				Default: booldefault.StaticBool(false),
+			},
+			"orphaned_daemonset_pods": schema.StringAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "How pods managed by a DaemonSet that no longer exists are handled when draining a node: " +
+					"`fail` the drain, `delete` them with the other pods or `skip` them, leaving them on the node. " +
+					"Ignored when `drain_options.force` is set, deleting them like `kubectl drain --force`. Defaults to `fail`.",
+				Default: stringdefault.StaticString(orchestrate.OrphanedPodsFail),
+				Validators: []validator.String{
+					stringvalidator.OneOf(orchestrate.OrphanedPodsFail, orchestrate.OrphanedPodsDelete, orchestrate.OrphanedPodsSkip),
+				},
+			},
+			"respect_safe_to_evict": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "Do not evict the pods annotated `" + orchestrate.SafeToEvictAnnotation + ": \"false\"`, which the cluster autoscaler never evicts, handling them as set by `safe_to_evict_action` instead. " +
+					"With the `taint` rotation strategy, which cannot leave pods on the nodes, such pods evicted by the taint always fail the drain. Defaults to `false`.",
+				Default: booldefault.StaticBool(false),
+			},
+			"safe_to_evict_action": schema.StringAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "How the pods not safe to evict are handled when `respect_safe_to_evict` is set: `skip` them with a warning, leaving them on the node, or `fail` the drain. " +
+					"With `fail`, the destroy fails before cordoning any node unless `skip_capacity_check` is set. Defaults to `skip`.",
+				Default: stringdefault.StaticString(orchestrate.UnsafeToEvictSkip),
+				Validators: []validator.String{
+					stringvalidator.OneOf(orchestrate.UnsafeToEvictSkip, orchestrate.UnsafeToEvictFail),
+				},
+			},
+			"failure_dump_path": schema.StringAttribute{
+				Optional: true,
+				MarkdownDescription: "Path of a file where a snapshot of the node pool is written, as JSON, when waiting for its nodes to be ready or draining them fails: " +
+					"the node objects, their recent events and the pods still to be evicted. The snapshot is always logged at the debug level.",
+				Validators: []validator.String{stringvalidator.LengthAtLeast(1)},
+			},
+			"on_empty_pool": schema.StringAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "How a node pool without any node matching its selector, e.g. because of a misspelled label, is handled " +
+					"when created with `min_ready_nodes` set to 0 and when destroyed: `succeed` silently, `warn` or `fail`. Defaults to `succeed`.",
+				Default: stringdefault.StaticString(emptyPoolSucceed),
+				Validators: []validator.String{
+					stringvalidator.OneOf(emptyPoolSucceed, emptyPoolWarn, emptyPoolFail),
+				},
+			},
+			"diagnostic_overrides": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				MarkdownDescription: "Severity, `error` or `warning`, of selected diagnostics of the node pool, by name, e.g. `{ ready_timeout = \"warning\" }` to only warn when the nodes are not ready in time. " +
+					"The diagnostics are `ready_timeout`, `daemonsets_timeout` and `pods_timeout`, errors when the nodes, the pods of `required_daemonsets` or the `wait_for_pods` are not ready in time, " +
+					"`crashlooping_pods`, error when there are more than `max_crashlooping_pods` crash-looping pods on the new nodes, `node_pool_not_ready`, warning when a refresh finds fewer ready nodes than the minimum, `overlapping_node_pools`, warning when node pools select the same nodes, " +
+					"`virtual_nodes`, warning when virtual nodes are skipped by a create or a destroy, and `control_plane_nodes` and `excluded_nodes`, warnings when nodes are skipped by a destroy, which fails before cordoning any node when they are errors.",
+				Validators: []validator.Map{
+					mapvalidator.KeysAre(stringvalidator.OneOf(overridableDiagnosticNames()...)),
+					mapvalidator.ValueStringsAre(stringvalidator.OneOf(severityError, severityWarning)),
+				},
+			},
+			"current_nodes": schema.Int64Attribute{
+				Computed:            true,
+				MarkdownDescription: "Number of nodes in the node pool when it was last read.",
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"ready_nodes": schema.Int64Attribute{
+				Computed:            true,
+				MarkdownDescription: "Number of ready nodes in the node pool when it was last read.",
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"node_names": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Names of the nodes in the node pool when it was last read.",
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"kubelet_versions": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Distinct kubelet versions of the nodes in the node pool when it was last read.",
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"instance_ids": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Cloud provider IDs of the machines backing the nodes in the node pool when it was last read, taken from the last segment of the node `providerID`, e.g. `i-0123456789abcdef0` on AWS. Nodes without a provider ID are omitted.",
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"ready_handle": schema.StringAttribute{
+				Computed: true,
+				MarkdownDescription: "Opaque handle known once the node pool is ready. Referencing it in `wait_for_handles` of another node pool orders the other node pool after this one " +
+					"and makes its destroy wait for this node pool to be ready.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"wait_for_handles": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				MarkdownDescription: "`ready_handle` of other node pools, e.g. the node pool replacing this one, that must have their minimum number of ready nodes before this node pool is drained. " +
+					"The wait is bounded by the `create` timeout.",
+				Validators: []validator.List{
+					listvalidator.ValueStringsAre(
+						stringvalidator.RegexMatches(regexp.MustCompile(`^`+regexp.QuoteMeta(readyHandlePrefix)), "must be the ready_handle of a k8snp_node_pool resource"),
+					),
+				},
+			},
+			"eviction_group_order": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				MarkdownDescription: "Applications, identified by the `app.kubernetes.io/part-of` label of their pods, whose pods are evicted together from each node, one application after the other in this order, " +
+					"e.g. `[\"frontend\", \"backend\", \"database\"]`. The evictions of an application wait for the pods of the previous one to be deleted. The other pods are evicted last.",
+				Validators: []validator.List{
+					listvalidator.UniqueValues(),
+					listvalidator.ValueStringsAre(stringvalidator.LengthAtLeast(1)),
+				},
+			},
+			"exclude_nodes": schema.ListAttribute{
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Names of the nodes of the pool not to cordon and drain, e.g. nodes known to be problematic or pinned by a stateful workload. The skipped nodes are reported in a warning.",
+				Validators: []validator.List{
+					listvalidator.ValueStringsAre(stringvalidator.LengthAtLeast(1)),
+				},
+			},
+			"exclude_node_selector": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Do not cordon and drain the nodes of the pool matching this label selector, e.g. `example.com/pinned=true`. The skipped nodes are reported in a warning.",
+				Validators: []validator.String{
+					LabelSelector(),
+				},
+			},
+			"drain_order": schema.StringAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "Order in which the nodes are drained: by `name`, `oldest_first` or `newest_first` by creation time, " +
+					"or `fewest_pods_first` to minimize the early disruption and validate the capacity of the new node pool incrementally. Defaults to `name`.",
+				Default: stringdefault.StaticString(orchestrate.DrainOrderName),
+				Validators: []validator.String{
+					stringvalidator.OneOf(orchestrate.DrainOrderName, orchestrate.DrainOrderOldestFirst, orchestrate.DrainOrderNewestFirst, orchestrate.DrainOrderFewestPodsFirst),
+				},
+			},
+			"allow_node_set_drift": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "Drain the nodes added to the node pool, e.g. by the cluster autoscaler, after the destroy was planned. " +
+					"When `false` the destroy fails if the pool has nodes that were not listed when it was planned. The nodes added and removed since the plan are logged in both cases. Defaults to `true`.",
+				Default: booldefault.StaticBool(true),
+			},
+			"managed_by": schema.StringAttribute{
+				Optional: true,
+				MarkdownDescription: "Autoscaler managing the nodes of the node pool. With `karpenter` the nodes are not cordoned and drained when the node pool is destroyed: the NodeClaim of each node, or the node itself when it has none, is deleted instead, " +
+					"letting Karpenter drain the node and terminate its instance, and the drain of the node waits, up to `drain_timeout`, for the node to be gone and for the NodeClaims created since in its NodePool, those launched by Karpenter to replace it, to be ready.",
+				Validators: []validator.String{
+					stringvalidator.OneOf(managedByKarpenter),
+					stringvalidator.ConflictsWith(path.MatchRoot("post_drain_verification_job"), path.MatchRoot("gke"), path.MatchRoot("aws_autoscaling")),
+				},
+			},
+			"rotation_strategy": schema.StringAttribute{
+				Optional: true,
+				Computed: true,
+				MarkdownDescription: "How the pods are moved off the nodes of the node pool when it is destroyed: `drain` cordons the nodes and evicts their pods, " +
+					"`taint` sets the NoExecute taint configured in `rotation_taint` on each node in turn, leaving the eviction of the pods to kubernetes, " +
+					"e.g. for workloads relying on `tolerationSeconds` to terminate gracefully. Defaults to `drain`.",
+				Default: stringdefault.StaticString(rotationStrategyDrain),
+				Validators: []validator.String{
+					stringvalidator.OneOf(rotationStrategyDrain, rotationStrategyTaint),
+				},
+			},
+			"eviction_request_timeout": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Timeout of each pod eviction request made while draining a node, for drains against overloaded API servers. The other kubernetes API requests are not affected. No timeout is applied when not set.",
+				Validators: []validator.String{
+					MinDuration(0),
+				},
+			},
+		},
+
+		Blocks: map[string]schema.Block{
+			"timeouts": schema.SingleNestedBlock{
+				MarkdownDescription: "Standard resource operation timeouts.",
+				Attributes: map[string]schema.Attribute{
+					"create": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Maximum time for waiting for nodes in a new node pool to be ready, e.g. `10m`. Conflicts with `ready_timeout`.",
+						Validators: []validator.String{
+							MinDuration(0),
+						},
+					},
+					"delete": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Maximum time for draining the node pool, e.g. `2h`. Conflicts with `delete_timeout`. The drains of the single nodes are still bounded by `drain_timeout`. There is no overall limit when not set.",
+						Validators: []validator.String{
+							MinDuration(0),
+						},
+					},
+				},
+			},
+			"precordon_on_replace": schema.SingleNestedBlock{
+				MarkdownDescription: "Nodes cordoned as soon as the node pool is ready, typically those of the node pool it replaces with `create_before_destroy`, " +
+					"so that pods stop landing on them before they are drained. The nodes of this node pool are never cordoned.",
+				Validators: []validator.Object{
+					objectvalidator.AlsoRequires(path.MatchRelative().AtName("node_selector")),
+				},
+				Attributes: map[string]schema.Attribute{
+					"node_selector": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Label selector of the nodes to cordon, e.g. `cloud.google.com/gke-nodepool=pool-blue`. Required.",
+						Validators: []validator.String{
+							stringvalidator.LengthAtLeast(1),
+							LabelSelector(),
+						},
+					},
+				},
+			},
+			"disable_scale_down": schema.SingleNestedBlock{
+				MarkdownDescription: "Annotate the nodes surviving the node pool, typically those of the node pool replacing it, with `" + scaleDownDisabledAnnotation + "=true` while the node pool is destroyed, " +
+					"so that the cluster autoscaler does not remove them and break the `min_ready_nodes` of their pool while the evicted pods land. The annotation is removed afterwards, except from the nodes annotated before.",
+				Attributes: map[string]schema.Attribute{
+					"node_selector": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Label selector of the nodes to annotate, e.g. `cloud.google.com/gke-nodepool=pool-green`. Defaults to all the nodes outside of this node pool.",
+						Validators: []validator.String{
+							LabelSelector(),
+						},
+					},
+				},
+			},
+			"readiness_checks": schema.SingleNestedBlock{
+				MarkdownDescription: "Additional checks a node must pass, on top of the `Ready` condition, to be counted as ready.",
+				Attributes: map[string]schema.Attribute{
+					"no_memory_pressure": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Require the node not to report the `MemoryPressure` condition. Defaults to `false`.",
+					},
+					"no_disk_pressure": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Require the node not to report the `DiskPressure` condition. Defaults to `false`.",
+					},
+					"no_pid_pressure": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Require the node not to report the `PIDPressure` condition. Defaults to `false`.",
+					},
+					"schedulable": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Require the node not to be marked as unschedulable, e.g. cordoned. Defaults to `false`.",
+					},
+					"no_startup_taints": schema.BoolAttribute{
+						Optional: true,
+						MarkdownDescription: "Require the node not to carry startup taints set while it initializes: " +
+							"`node.cloudprovider.kubernetes.io/uninitialized`, `node.kubernetes.io/network-unavailable` and `node.cilium.io/agent-not-ready`. Defaults to `false`.",
+					},
+					"heartbeat_staleness_threshold": schema.StringAttribute{
+						Optional: true,
+						MarkdownDescription: "Treat the `Ready` condition of a node as stale, and the node as not ready, when its last heartbeat is older than this, e.g. `10m`, as a wedged kubelet leaves the last condition it reported. " +
+							"The kubelet renews the heartbeat of the condition at least every `nodeStatusReportFrequency`, 5 minutes by default, so the threshold must be at least `5m`, and longer to allow for the delay of the reports. The heartbeat is not checked when not set.",
+						// a shorter threshold marks the nodes of a healthy
+						// kubelet reporting its status every 5 minutes stale
+						Validators: []validator.String{MinDuration(5 * time.Minute)},
+					},
+				},
+			},
+			"dns_health_check": schema.SingleNestedBlock{
+				MarkdownDescription: "Wait, after draining each node or batch of nodes, for the cluster DNS to be healthy before proceeding: " +
+					"its Deployment fully available, its Service with ready endpoints and `probe_name` resolved by a probe pod, a Job running `nslookup` in `namespace`. " +
+					"The drain fails when the DNS is not healthy within `timeout`. The probe pod is not run with the provider `dry_run`.",
+				Attributes: map[string]schema.Attribute{
+					"namespace": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Namespace of the cluster DNS. Defaults to `kube-system`.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"deployment": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Name of the Deployment of the cluster DNS, e.g. `kube-dns` on GKE. Defaults to `coredns`.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"service": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Name of the Service of the cluster DNS. Defaults to `kube-dns`.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"probe": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Resolve `probe_name` from a probe pod. Defaults to `true`.",
+					},
+					"probe_name": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Name resolved by the probe pod. Defaults to `kubernetes.default`.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"probe_image": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Image of the probe pod, providing `nslookup`. Defaults to `busybox:1.36`.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"timeout": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Maximum time to wait for the cluster DNS to be healthy. Defaults to `5m`.",
+						Validators:          []validator.String{MinDuration(time.Second)},
+					},
+				},
+			},
+			"post_drain_verification_job": schema.SingleNestedBlock{
+				MarkdownDescription: "Job run on each drained node, e.g. to verify that no volume is still mounted, before the node is considered drained. " +
+					"Its pod is bound to the node and tolerates all the taints, so it runs on the cordoned node. The drain fails when the Job fails or does not complete within `timeout`. Not run with the provider `dry_run`.",
+				Validators: []validator.Object{
+					objectvalidator.AlsoRequires(path.MatchRelative().AtName("image")),
+				},
+				Attributes: nodeJobAttributes(),
+			},
+			"pre_drain_hook": schema.SingleNestedBlock{
+				MarkdownDescription: "Job run before the drain of each node, once cordoned, e.g. to deregister the node from a load balancer or a service mesh. " +
+					"The name of the node is in the `NODE_NAME` environment variable of the container and its pod can be scheduled on any node. " +
+					"The drain fails when the Job fails or does not complete within `timeout`. Not run with the provider `dry_run`.",
+				Validators: []validator.Object{
+					objectvalidator.AlsoRequires(path.MatchRelative().AtName("image")),
+				},
+				Attributes: nodeJobAttributes(),
+			},
+			"post_drain_hook": schema.SingleNestedBlock{
+				MarkdownDescription: "Job run after the drain of each node, e.g. to snapshot its disks or notify an external system. " +
+					"The name of the node is in the `NODE_NAME` environment variable of the container and its pod can be scheduled on any node. " +
+					"The drain fails when the Job fails or does not complete within `timeout`. Not run with the provider `dry_run`.",
+				Validators: []validator.Object{
+					objectvalidator.AlsoRequires(path.MatchRelative().AtName("image")),
+				},
+				Attributes: nodeJobAttributes(),
+			},
+			"drain_options": schema.SingleNestedBlock{
+				MarkdownDescription: "Settings of the node drains, equivalent to the flags of `kubectl drain`.",
+				Attributes: map[string]schema.Attribute{
+					"ignore_daemonsets": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Ignore pods managed by DaemonSets. When `false` nodes running DaemonSet pods cannot be drained. Defaults to `true`.",
+					},
+					"delete_emptydir_data": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Evict pods using `emptyDir` volumes, deleting their data. When `false` nodes running such pods cannot be drained. Defaults to `true`.",
+					},
+					"force": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Delete pods not managed by a controller, which will not be recreated elsewhere. Defaults to `false`.",
+					},
+					"grace_period_seconds": schema.Int64Attribute{
+						Optional:            true,
+						MarkdownDescription: "Period of time in seconds given to each pod to terminate gracefully. A negative value uses the grace period of the pod. Defaults to `-1`.",
+					},
+					"skip_wait_for_delete_timeout": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Stop waiting for the deletion of pods whose deletion was requested longer than this ago, e.g. pods stuck on an unreachable node. Applies to both rotation strategies. Pods are always waited for when not set.",
+						Validators: []validator.String{
+							MinDuration(time.Second),
+						},
+					},
+					"disable_eviction": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Delete pods instead of evicting them, bypassing pod disruption budgets. Defaults to `false`.",
+					},
+					"eviction_api_version": schema.StringAttribute{
+						Optional: true,
+						MarkdownDescription: "Version of the eviction API the pods are evicted with: `policy/v1`, `policy/v1beta1` for clusters older than 1.22, or `auto` to use the version reported by the cluster, " +
+							"falling back to the preferred version it serves when it does not report one. The destroy fails before any node is cordoned when the cluster does not serve the version. Defaults to `auto`.",
+						Validators: []validator.String{
+							stringvalidator.OneOf(orchestrate.EvictionVersionAuto, orchestrate.EvictionVersionV1, orchestrate.EvictionVersionV1beta1),
+						},
+					},
+				},
+			},
+			"rotation_taint": schema.SingleNestedBlock{
+				MarkdownDescription: "Taint set on the nodes when `rotation_strategy` is `taint`. The drain of a node waits, up to `drain_timeout`, " +
+					"for the pods not tolerating the taint to be evicted, ignoring the DaemonSet and static pods.",
+				Attributes: map[string]schema.Attribute{
+					"key": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Key of the taint. Defaults to `k8snp.io/rotation`.",
+						Validators: []validator.String{
+							LabelKey(),
+						},
+					},
+					"value": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Value of the taint. Defaults to an empty value.",
+						Validators: []validator.String{
+							LabelValue(),
+						},
+					},
+					"toleration_seconds": schema.Int64Attribute{
+						Optional: true,
+						MarkdownDescription: "Also wait for the pods tolerating the taint for at most this many seconds, through their `tolerationSeconds`, to be evicted. " +
+							"Pods tolerating the taint for longer are left on the node. Defaults to `0`.",
+						Validators: []validator.Int64{
+							int64validator.AtLeast(0),
+						},
+					},
+				},
+			},
+			"approval": schema.SingleNestedBlock{
+				MarkdownDescription: "HTTP endpoint approving the destroy, e.g. a chat bot asking a human to approve it, polled before any node is cordoned. " +
+					"The endpoint receives GET requests with the `node_pool` name and the number of `nodes` to drain in the query, and answers `200` when the destroy is approved, `202` while the approval is pending, " +
+					"`408` or `429` to throttle the polls, which back off exponentially or for the time in the `Retry-After` header, or another `4xx` status, with the reason in the body, when it is rejected. Other statuses and network errors are retried.",
+				Validators: []validator.Object{
+					objectvalidator.AlsoRequires(path.MatchRelative().AtName("url")),
+				},
+				Attributes: map[string]schema.Attribute{
+					"url": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "URL of the approval endpoint, e.g. `https://approvals.example.com/k8snp`. Required.",
+						Validators: []validator.String{
+							stringvalidator.RegexMatches(regexp.MustCompile(`^https?://[^/]+`), "must be an http or https URL"),
+						},
+					},
+					"poll_interval": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Time between the requests to the approval endpoint. Defaults to `30s`.",
+						Validators:          []validator.String{MinDuration(time.Second)},
+					},
+					"timeout": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Maximum time to wait for the approval before failing the destroy. Defaults to `1h`.",
+						Validators:          []validator.String{MinDuration(time.Second)},
+					},
+				},
+			},
+			"cluster_api": schema.SingleNestedBlock{
+				MarkdownDescription: "Cluster API MachineDeployment managing the node pool, for clusters managed by Cluster API. The nodes of the pool are those of its machines instead of those matching the node selector, " +
+					"and the node pool is ready once `min_ready_nodes` of its machines are ready, as counted in its status, telling the machines still provisioning apart from the ready ones. " +
+					"The MachineDeployment and its machines must be in the cluster of the provider, e.g. a self-managed cluster. The status is polled every `poll_interval`, defaulting to `10s`.",
+				Validators: []validator.Object{
+					objectvalidator.AlsoRequires(path.MatchRelative().AtName("machine_deployment")),
+				},
+				Attributes: map[string]schema.Attribute{
+					"machine_deployment": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Name of the MachineDeployment. Required.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"namespace": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Namespace of the MachineDeployment. Defaults to `default`.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+				},
+			},
+			"gke": schema.SingleNestedBlock{
+				MarkdownDescription: "Delete the GCE instance of each drained node from the managed instance group of the GKE node pool, shrinking the node pool, for rotations driven by the provider instead of the replacement of the node pool. " +
+					"The instance groups of the node pool are found with the GKE API. A failure to delete an instance fails the drain of its node. Not done with the provider `dry_run`.",
+				Attributes: map[string]schema.Attribute{
+					"project": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Project of the GKE cluster. Defaults to the project in `node_pool_name` when it is a full GKE node pool ID.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"location": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Region or zone of the GKE cluster. Defaults to the location in `node_pool_name` when it is a full GKE node pool ID.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"cluster": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Name of the GKE cluster. Defaults to the cluster in `node_pool_name` when it is a full GKE node pool ID.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"access_token": schema.StringAttribute{
+						Optional:  true,
+						Sensitive: true,
+						MarkdownDescription: "Access token allowed to get the node pool and delete the instances of its instance groups. The token is stored in the state and usually expired by the destroy, " +
+							"the application default credentials are used when it is not set: the credentials file in `GOOGLE_APPLICATION_CREDENTIALS`, of a service account, an authorized user or an external account of a workload identity federation, the one of `gcloud auth application-default login` or the service account of the GCE instance the provider runs on.",
+						DeprecationMessage: "The access token is stored in the state and expires before the destroy. Remove it to use the application default credentials.",
+						Validators:         []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+				},
+			},
+			"aws_autoscaling": schema.SingleNestedBlock{
+				MarkdownDescription: "Remove the EC2 instance of each drained node from its auto scaling group, e.g. that of an EKS managed node group, with the Auto Scaling API, so that the drained capacity is not left running. " +
+					"The instance is found with the provider ID of the node. A failure to remove an instance fails the drain of its node. Not done with the provider `dry_run`. " +
+					"The requests are signed with the credentials of the default AWS credential chain: the `AWS_ACCESS_KEY_ID` and `AWS_SECRET_ACCESS_KEY` environment variables, the shared config and credentials files with the profile in `AWS_PROFILE`, including SSO and `credential_process`, the web identity in `AWS_WEB_IDENTITY_TOKEN_FILE` and `AWS_ROLE_ARN`, e.g. of an EKS service account, the ECS task role and the EC2 instance profile. A failed termination or detachment is only retried once the instance is described again and found still in service.",
+				Attributes: map[string]schema.Attribute{
+					"action": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "How the instances are removed: `terminate` them, or `detach` them from their group, leaving them running, e.g. to investigate them before terminating them out of band. Defaults to `terminate`.",
+						Validators:          []validator.String{stringvalidator.OneOf(asgTerminate, asgDetach)},
+					},
+					"decrement_desired_capacity": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Decrement the desired capacity of the group with each removed instance, so that it is not replaced. Defaults to `true`.",
+					},
+					"access_key_id": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Access key ID allowed to describe the auto scaling instances and to terminate or detach them, used instead of the default credential chain.",
+						DeprecationMessage:  "Static credentials are stored in the state. Remove them to use the default credential chain, e.g. the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables or an EKS service account.",
+						Validators: []validator.String{
+							stringvalidator.LengthAtLeast(1),
+							stringvalidator.AlsoRequires(path.MatchRelative().AtParent().AtName("secret_access_key")),
+						},
+					},
+					"secret_access_key": schema.StringAttribute{
+						Optional:            true,
+						Sensitive:           true,
+						MarkdownDescription: "Secret access key of `access_key_id`. Required with `access_key_id`.",
+						DeprecationMessage:  "Static credentials are stored in the state. Remove them to use the default credential chain, e.g. the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables or an EKS service account.",
+						Validators: []validator.String{
+							stringvalidator.LengthAtLeast(1),
+							stringvalidator.AlsoRequires(path.MatchRelative().AtParent().AtName("access_key_id")),
+						},
+					},
+					"session_token": schema.StringAttribute{
+						Optional:            true,
+						Sensitive:           true,
+						MarkdownDescription: "Session token of the temporary credentials of `access_key_id`.",
+						DeprecationMessage:  "Static credentials are stored in the state. Remove them to use the default credential chain, e.g. the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables or an EKS service account.",
+						Validators: []validator.String{
+							stringvalidator.AlsoRequires(path.MatchRelative().AtParent().AtName("access_key_id")),
+						},
+					},
+					"region": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Region of the auto scaling groups. Defaults to the region of the availability zone, Local Zone or Wavelength Zone in the provider ID of the nodes.",
+						Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+				},
+			},
+			"notifications": schema.SingleNestedBlock{
+				MarkdownDescription: "Webhook notified of the progress of the destroy, e.g. a Slack incoming webhook, so that the rotations started by CI are visible to the humans on call. " +
+					"The messages are posted as JSON objects with a `text` field when the drain starts, when each node is drained and when the destroy fails or completes, with the number of drained nodes and the durations. " +
+					"Failures to post the messages are only logged.",
+				Validators: []validator.Object{
+					objectvalidator.AlsoRequires(path.MatchRelative().AtName("webhook_url")),
+				},
+				Attributes: map[string]schema.Attribute{
+					"webhook_url": schema.StringAttribute{
+						Optional:            true,
+						Sensitive:           true,
+						MarkdownDescription: "URL of the webhook, e.g. `https://hooks.slack.com/services/...`. Required.",
+						Validators: []validator.String{
+							stringvalidator.RegexMatches(regexp.MustCompile(`^https?://[^/]+`), "must be an http or https URL"),
+						},
+					},
+					"events": schema.ListAttribute{
+						Optional:    true,
+						ElementType: types.StringType,
+						MarkdownDescription: "Events to notify among `" + notifyStarted + "`, `" + notifyNodeDrained + "`, `" + notifyFailed + "` and `" + notifyCompleted + "`. " +
+							"All the events are notified when not set.",
+						Validators: []validator.List{
+							listvalidator.UniqueValues(),
+							listvalidator.ValueStringsAre(stringvalidator.OneOf(notifyStarted, notifyNodeDrained, notifyFailed, notifyCompleted)),
+						},
+					},
+				},
+			},
+			"argocd_sync": schema.SingleNestedBlock{
+				MarkdownDescription: "Delay the drain of each node while ArgoCD syncs the applications of its pods, found from their tracking ID annotation or instance label, " +
+					"so that evictions do not race with re-deployments.",
+				Attributes: map[string]schema.Attribute{
+					"namespace": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Namespace of the ArgoCD applications, unless their tracking ID says otherwise. Defaults to `argocd`.",
+						Validators: []validator.String{
+							stringvalidator.LengthAtLeast(1),
+						},
+					},
+					"max_wait": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Maximum time to wait for the syncs to end before failing the drain of a node, e.g. `30m`. The wait is only bounded by the destroy timeout when not set.",
+						Validators: []validator.String{
+							MinDuration(0),
+						},
+					},
+				},
+			},
+			"maintenance_window": schema.SingleNestedBlock{
+				MarkdownDescription: "Period of the week during which the nodes can be drained, e.g. to comply with change freezes. " +
+					"Destroying the node pool outside of the window fails, or waits for the window to open when `max_wait` allows it. " +
+					"The window is checked again before draining each node, so a drain still running when the window closes waits for the next one or fails, and can then be resumed. " +
+					"The wait before the destroy starts is not part of the delete timeout. A window ending before it starts ends the next day.",
+				Validators: []validator.Object{
+					objectvalidator.AlsoRequires(path.MatchRelative().AtName("start"), path.MatchRelative().AtName("end")),
+				},
+				Attributes: map[string]schema.Attribute{
+					"days": schema.ListAttribute{
+						Optional:            true,
+						ElementType:         types.StringType,
+						MarkdownDescription: "Days of the week the window starts on, e.g. `[\"Sat\", \"Sun\"]`. Defaults to every day.",
+						Validators: []validator.List{
+							listvalidator.ValueStringsAre(stringvalidator.OneOf("Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun")),
+						},
+					},
+					"start": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Time of the day the window opens, in the `HH:MM` format, e.g. `02:00`. Required.",
+						Validators: []validator.String{
+							stringvalidator.RegexMatches(clockRegexp, "must be a time of the day in the HH:MM format, e.g. 02:00"),
+						},
+					},
+					"end": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Time of the day the window closes, in the `HH:MM` format, e.g. `06:00`. Required.",
+						Validators: []validator.String{
+							stringvalidator.RegexMatches(clockRegexp, "must be a time of the day in the HH:MM format, e.g. 06:00"),
+						},
+					},
+					"timezone": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Time zone of `start` and `end`, e.g. `Australia/Melbourne`. Defaults to `UTC`.",
+						Validators: []validator.String{
+							TimeZone(),
+						},
+					},
+					"max_wait": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Wait for the window to open when it opens within this long, instead of failing the destroy, e.g. `12h`. The destroy fails outside of the window when not set.",
+						Validators: []validator.String{
+							MinDuration(0),
+						},
+					},
+				},
+			},
+			"node_selector_expressions": schema.ListNestedBlock{
+				MarkdownDescription: "Additional label requirements the nodes affected by this resource must meet on top of `node_selector_key`.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"key": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Label key the requirement applies to.",
+							Validators: []validator.String{
+								LabelKey(),
+							},
+						},
+						"operator": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Relation of the label with `values`: `In`, `NotIn` or `Exists`.",
+							Validators: []validator.String{
+								stringvalidator.OneOf("In", "NotIn", "Exists"),
+							},
+						},
+						"values": schema.ListAttribute{
+							Optional:            true,
+							ElementType:         types.StringType,
+							MarkdownDescription: "Values of the label. Required with the `In` and `NotIn` operators and not allowed with `Exists`.",
+							Validators: []validator.List{
+								listvalidator.ValueStringsAre(LabelValue()),
+							},
+						},
+					},
+				},
+			},
+			"wait_for_pods": schema.ListNestedBlock{
+				MarkdownDescription: "Workloads, e.g. ingress controllers or system agents, that must have ready pods running on the nodes of the node pool before it is considered ready. " +
+					"The wait is bounded by the `create` timeout.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"namespace": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Namespace of the pods.",
+							Validators: []validator.String{
+								stringvalidator.LengthAtLeast(1),
+							},
+						},
+						"label_selector": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Label selector of the pods, e.g. `app.kubernetes.io/name=ingress-nginx`.",
+							Validators: []validator.String{
+								stringvalidator.LengthAtLeast(1),
+								LabelSelector(),
+							},
+						},
+						"min_ready": schema.Int64Attribute{
+							Optional:            true,
+							MarkdownDescription: "Minimum number of ready pods on the nodes of the node pool. Defaults to `1`.",
+							Validators:          []validator.Int64{int64validator.AtLeast(1)},
+						},
+					},
+				},
+			},
+			"suspend_flux": schema.ListNestedBlock{
+				MarkdownDescription: "Flux Kustomizations or HelmReleases whose reconciliation is suspended while the node pool is drained on destroy, " +
+					"so that they do not fight the placement of the evicted pods, and resumed afterwards. Objects already suspended are left suspended.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"kind": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Kind of the object, `Kustomization` or `HelmRelease`.",
+							Validators: []validator.String{
+								stringvalidator.OneOf(fluxKindKustomization, fluxKindHelmRelease),
+							},
+						},
+						"namespace": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Namespace of the object.",
+							Validators: []validator.String{
+								stringvalidator.LengthAtLeast(1),
+							},
+						},
+						"name": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Name of the object.",
+							Validators: []validator.String{
+								stringvalidator.LengthAtLeast(1),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// nodeJobAttributes returns the attributes of the blocks running a Job for
+// each node, described by NodePoolNodeJobModel.
+func nodeJobAttributes() map[string]schema.Attribute {
+	return map[string]schema.Attribute{
+		"image": schema.StringAttribute{
+			Optional:            true,
+			MarkdownDescription: "Image of the container of the Job. Required.",
+			Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+		},
+		"command": schema.ListAttribute{
+			Optional:            true,
+			ElementType:         types.StringType,
+			MarkdownDescription: "Command of the container of the Job. Defaults to the entrypoint of the image.",
+		},
+		"env": schema.MapAttribute{
+			Optional:            true,
+			ElementType:         types.StringType,
+			MarkdownDescription: "Environment variables of the container of the Job, in addition to `NODE_NAME` holding the name of the node.",
+			Validators: []validator.Map{
+				mapvalidator.KeysAre(
+					stringvalidator.RegexMatches(regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`), "must be a valid environment variable name"),
+					stringvalidator.NoneOf(nodeNameEnvVar),
+				),
+			},
+		},
+		"namespace": schema.StringAttribute{
+			Optional:            true,
+			MarkdownDescription: "Namespace of the Job. Defaults to `default`.",
+			Validators:          []validator.String{stringvalidator.LengthAtLeast(1)},
+		},
+		"timeout": schema.StringAttribute{
+			Optional:            true,
+			MarkdownDescription: "Maximum time for the Job to complete on each node. Defaults to `5m`.",
+			Validators:          []validator.String{MinDuration(time.Second)},
+		},
+	}
+}
+
+func (r *NodePoolResource) IdentitySchema(_ context.Context, _ resource.IdentitySchemaRequest, resp *resource.IdentitySchemaResponse) {
+	resp.IdentitySchema = identityschema.Schema{
+		Attributes: map[string]identityschema.Attribute{
+			"node_pool_name": identityschema.StringAttribute{
+				RequiredForImport: true,
+				Description:       "Name of the node pool.",
+			},
+		},
+	}
+}
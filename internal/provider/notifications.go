@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	notifyStarted     = "started"
+	notifyNodeDrained = "node_drained"
+	notifyFailed      = "failed"
+	notifyCompleted   = "completed"
+
+	notificationTimeout = 10 * time.Second
+)
+
+// rotationNotifier posts messages about the destroy of a node pool to a
+// Slack compatible webhook, as JSON objects with a text field, so that
+// rotations started by CI are visible to the humans on call. Failures to
+// post are only logged as notifications must never fail the destroy. A nil
+// notifier posts nothing.
+type rotationNotifier struct {
+	url string
+	// events are the notified events, all of them when empty
+	events       []string
+	nodePoolName string
+	dryRun       bool
+	// async is set when nodes can be left to drain, see async_destroy
+	async  bool
+	client *http.Client
+
+	mu      sync.Mutex
+	start   time.Time
+	total   int
+	drained int
+	// pending are the node_drained notifications being posted
+	pending sync.WaitGroup
+}
+
+// started notifies the start of the destroy, draining total nodes.
+func (n *rotationNotifier) started(ctx context.Context, total int) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	n.start = time.Now()
+	n.total = total
+	n.mu.Unlock()
+
+	n.notify(ctx, notifyStarted, fmt.Sprintf("Started destroying node pool %s, draining %d nodes", n.nodePoolName, total))
+}
+
+// nodeDrained notifies the completion of the drain of nodeName, which took
+// duration. The notification is posted in the background so that a slow
+// webhook does not delay the drain of the next nodes.
+func (n *rotationNotifier) nodeDrained(ctx context.Context, nodeName string, duration time.Duration) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	n.drained++
+	drained, total := n.drained, n.total
+	n.mu.Unlock()
+
+	text := fmt.Sprintf("Drained node %s of node pool %s in %s (%d/%d)", nodeName, n.nodePoolName, duration.Round(time.Second), drained, total)
+	n.pending.Add(1)
+	go func() {
+		defer n.pending.Done()
+		n.notify(context.WithoutCancel(ctx), notifyNodeDrained, text)
+	}()
+}
+
+// finish notifies the failure of the destroy, with the errors in diags, or
+// its completion, after the node_drained notifications. It does nothing when
+// the destroy was not started.
+func (n *rotationNotifier) finish(ctx context.Context, diags *diag.Diagnostics) {
+	if n == nil {
+		return
+	}
+	n.pending.Wait()
+
+	n.mu.Lock()
+	start, drained, total := n.start, n.drained, n.total
+	n.mu.Unlock()
+	if start.IsZero() {
+		return
+	}
+	elapsed := time.Since(start).Round(time.Second)
+
+	switch {
+	case diags.HasError():
+		n.notify(ctx, notifyFailed, fmt.Sprintf("Destroy of node pool %s failed after %s, %d/%d nodes drained: %s", n.nodePoolName, elapsed, drained, total, diagnosticsDetail(*diags)))
+	case n.async && drained < total:
+		n.notify(ctx, notifyCompleted, fmt.Sprintf("Destroyed node pool %s in %s, %d/%d nodes drained, the others are drained by the next creates and destroys of node pools", n.nodePoolName, elapsed, drained, total))
+	default:
+		n.notify(ctx, notifyCompleted, fmt.Sprintf("Destroyed node pool %s in %s, %d/%d nodes drained", n.nodePoolName, elapsed, drained, total))
+	}
+}
+
+// notify posts text to the webhook when event is notified.
+func (n *rotationNotifier) notify(ctx context.Context, event, text string) {
+	if len(n.events) > 0 && !containsAny(n.events, event) {
+		return
+	}
+	if n.dryRun {
+		text = "[dry run] " + text
+	}
+
+	// marshalling a map of strings cannot fail
+	body, _ := json.Marshal(map[string]string{"text": text})
+
+	ctx, cancel := context.WithTimeout(ctx, notificationTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to create the %s notification: %s", event, redactWebhookURL(err)))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("failed to post the %s notification: %s", event, redactWebhookURL(err)))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		tflog.Warn(ctx, fmt.Sprintf("unexpected status %s posting the %s notification: %s", resp.Status, event, strings.TrimSpace(string(reply))))
+	}
+}
+
+// redactWebhookURL returns the message of err without the path and query of
+// the webhook URL it holds, as webhook URLs embed their secret, e.g. those of
+// Slack.
+func redactWebhookURL(err error) string {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err.Error()
+	}
+
+	redacted := "<webhook URL>"
+	if u, parseErr := url.Parse(urlErr.URL); parseErr == nil && u.Host != "" {
+		redacted = u.Scheme + "://" + u.Host + "/<redacted>"
+	}
+	return (&url.Error{Op: urlErr.Op, URL: redacted, Err: urlErr.Err}).Error()
+}
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+)
+
+func TestRotationNotifierPostsNodeDrainedInBackground(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var texts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("unexpected error decoding the notification: %v", err)
+		}
+		if strings.HasPrefix(body["text"], "Drained node") {
+			<-release
+		}
+		mu.Lock()
+		texts = append(texts, body["text"])
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	n := &rotationNotifier{url: server.URL, nodePoolName: "pool"}
+	n.started(ctx, 1)
+
+	drained := make(chan struct{})
+	go func() {
+		n.nodeDrained(ctx, "node-1", time.Second)
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the drain not to wait for the node_drained notification")
+	}
+
+	close(release)
+	n.finish(ctx, &diag.Diagnostics{})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(texts) != 3 || !strings.HasPrefix(texts[1], "Drained node node-1") || !strings.HasPrefix(texts[2], "Destroyed node pool pool") {
+		t.Errorf("expected the completion to be notified after the drained node, got %v", texts)
+	}
+}
+
+func TestRedactWebhookURL(t *testing.T) {
+	webhook := "https://hooks.slack.com/services/T000/B000/secret"
+	_, err := http.Get(webhook[:len("https://")] + "\x00" + webhook[len("https://"):])
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	_, postErr := (&http.Client{Transport: failingTransport{}}).Post(webhook, "application/json", nil)
+
+	for _, err := range []error{err, postErr} {
+		message := redactWebhookURL(err)
+		if strings.Contains(message, "secret") || strings.Contains(message, "T000") {
+			t.Errorf("expected the webhook URL to be redacted, got %q", message)
+		}
+	}
+	if message := redactWebhookURL(postErr); !strings.Contains(message, "https://hooks.slack.com/<redacted>") {
+		t.Errorf("expected the host of the webhook to be kept, got %q", message)
+	}
+}
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
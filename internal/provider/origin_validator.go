@@ -39,6 +39,19 @@ func (v originValidator) ValidateString(_ context.Context, request validator.Str
 		return
 	}
 
+	// values without a scheme, e.g. localhost:9091, parse
+	// as an opaque URL whose scheme is the host
+	if parsed.Host == "" || parsed.Opaque != "" {
+		response.Diagnostics.Append(
+			diag.NewAttributeErrorDiagnostic(
+				request.Path,
+				"Invalid Attribute Format",
+				fmt.Sprintf("Attribute %s is not a valid origin, it must have a scheme and a host, got: %s", request.Path, value),
+			),
+		)
+		return
+	}
+
 	if parsed.Path != "" {
 		response.Diagnostics.Append(
 			diag.NewAttributeErrorDiagnostic(
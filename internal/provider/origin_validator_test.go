@@ -0,0 +1,29 @@
+package provider
+
+import (
+	"net/url"
+	"testing"
+)
+
+func FuzzOrigin(f *testing.F) {
+	for _, seed := range []string{"https://example.com", "http://localhost:9091", "localhost:9091", "https://example.com/path", "https://", "://example.com", "https://[::1]:443", "https://user@example.com", "https://example.com?query", "https:example.com", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		if validateString(Origin([]string{"http", "https"}), value).HasError() {
+			return
+		}
+
+		parsed, err := url.Parse(value)
+		if err != nil {
+			t.Fatalf("accepted %q, which does not parse: %v", value, err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			t.Errorf("accepted %q with scheme %q", value, parsed.Scheme)
+		}
+		if parsed.Host == "" || parsed.Opaque != "" || parsed.Path != "" {
+			t.Errorf("accepted %q, which is not an origin", value)
+		}
+	})
+}
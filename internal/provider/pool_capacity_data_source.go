@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &PoolCapacityDataSource{}
+
+func NewPoolCapacityDataSource() datasource.DataSource {
+	return &PoolCapacityDataSource{}
+}
+
+// PoolCapacityDataSource defines the data source implementation.
+type PoolCapacityDataSource struct {
+	k8sClient kubernetes.Interface
+	retry     orchestrate.RetryPolicy
+}
+
+// PoolCapacityDataSourceModel describes the data source data model.
+type PoolCapacityDataSourceModel struct {
+	NodeSelectorKey   types.String `tfsdk:"node_selector_key"`
+	NodeSelectorValue types.String `tfsdk:"node_selector_value"`
+	Nodes             types.Int64  `tfsdk:"nodes"`
+	CPUMillicores     types.Int64  `tfsdk:"cpu_millicores"`
+	MemoryBytes       types.Int64  `tfsdk:"memory_bytes"`
+	Pods              types.Int64  `tfsdk:"pods"`
+}
+
+func (d *PoolCapacityDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_pool_capacity"
+}
+
+func (d *PoolCapacityDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "Total allocatable capacity of the nodes matching a label selector. " +
+			"Useful to assert that a replacement node pool has at least the capacity of the pool it replaces.",
+
+		Attributes: map[string]schema.Attribute{
+			"node_selector_key": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Label key used to select the nodes. Defaults to `cloud.google.com/gke-nodepool`.",
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+			},
+			"node_selector_value": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "Label value used to select the nodes.",
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+			},
+			"nodes": schema.Int64Attribute{
+				Computed:            true,
+				MarkdownDescription: "Number of nodes matching the selector.",
+			},
+			"cpu_millicores": schema.Int64Attribute{
+				Computed:            true,
+				MarkdownDescription: "Total allocatable CPU of the nodes in millicores.",
+			},
+			"memory_bytes": schema.Int64Attribute{
+				Computed:            true,
+				MarkdownDescription: "Total allocatable memory of the nodes in bytes.",
+			},
+			"pods": schema.Int64Attribute{
+				Computed:            true,
+				MarkdownDescription: "Total number of pods that can be scheduled on the nodes.",
+			},
+		},
+	}
+}
+
+func (d *PoolCapacityDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*K8sNpProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unable to get kubernetes config",
+			"Unexpected error while fetching kubernetes config",
+		)
+		return
+	}
+	d.retry = providerData.retry
+
+	k8sClient, err := providerData.clients.KubeClient(providerData.config)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to create kubernetes client",
+			"Unexpected error while creating kubernetes client: "+err.Error(),
+		)
+		return
+	}
+	d.k8sClient = k8sClient
+}
+
+func (d *PoolCapacityDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data PoolCapacityDataSourceModel
+
+	// Read Terraform configuration data into the model
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.NodeSelectorKey.IsNull() {
+		data.NodeSelectorKey = types.StringValue("cloud.google.com/gke-nodepool")
+	}
+
+	labelKey := data.NodeSelectorKey.ValueString()
+	labelValue := data.NodeSelectorValue.ValueString()
+
+	nodes, err := orchestrate.ListNodes(ctx, d.k8sClient, d.retry, orchestrate.NodeQuery{LabelSelector: labelKey + "=" + labelValue})
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Error reading pool capacity",
+			fmt.Sprintf("Could not read pool capacity, unexpected error listing nodes with label %s=%s: %s", labelKey, labelValue, err.Error()),
+		)
+		return
+	}
+
+	cpu := resource.Quantity{}
+	memory := resource.Quantity{}
+	pods := resource.Quantity{}
+	for _, node := range nodes {
+		cpu.Add(node.Status.Allocatable[v1.ResourceCPU])
+		memory.Add(node.Status.Allocatable[v1.ResourceMemory])
+		pods.Add(node.Status.Allocatable[v1.ResourcePods])
+	}
+
+	data.Nodes = types.Int64Value(int64(len(nodes)))
+	data.CPUMillicores = types.Int64Value(cpu.MilliValue())
+	data.MemoryBytes = types.Int64Value(memory.Value())
+	data.Pods = types.Int64Value(pods.Value())
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
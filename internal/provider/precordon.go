@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// precordon cordons the nodes selected by precordon_on_replace, except those
+// of the node pool, so that pods stop landing on the nodes of the node pool it
+// replaces as soon as it is ready. Failures are only reported as warnings as
+// the nodes are cordoned again when the replaced node pool is destroyed.
+func (r *NodePoolResource) precordon(ctx context.Context, data *NodePoolResourceModel, query orchestrate.NodeQuery, diags *diag.Diagnostics) {
+	if r.rbacProfile == rbacProfileEvictOnly {
+		diags.AddWarning(
+			"Nodes not cordoned",
+			fmt.Sprintf("The nodes replaced by node pool %s are not cordoned because of the evict_only RBAC profile.", data.NodePoolName.ValueString()),
+		)
+		return
+	}
+
+	ownNodes, err := orchestrate.ListNodes(ctx, r.k8sClient, r.retry, query)
+	if err == nil {
+		var replacedNodes []string
+		replacedNodes, err = r.cordonReplacedNodes(ctx, data.Precordon.NodeSelector.ValueString(), nodeNames(ownNodes))
+		if len(replacedNodes) > 0 {
+			tflog.Info(ctx, fmt.Sprintf("cordoned nodes %s replaced by node pool %s", strings.Join(replacedNodes, ", "), data.NodePoolName.ValueString()))
+		}
+	}
+	if err != nil {
+		diags.AddWarning(
+			"Error cordoning replaced nodes",
+			fmt.Sprintf("Could not cordon all the nodes replaced by node pool %s, pods may still be scheduled on them until they are drained: %s", data.NodePoolName.ValueString(), err.Error()),
+		)
+	}
+}
+
+// cordonReplacedNodes cordons the schedulable nodes matching selector that
+// are not in ownNodes and returns those it cordoned.
+func (r *NodePoolResource) cordonReplacedNodes(ctx context.Context, selector string, ownNodes []string) ([]string, error) {
+	nodes, err := orchestrate.ListNodes(ctx, r.k8sClient, r.retry, orchestrate.NodeQuery{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	drainer := &orchestrate.Drainer{Client: r.k8sClient, Retry: r.retry}
+	for _, node := range nodes {
+		if node.Spec.Unschedulable || containsAny(ownNodes, node.Name) {
+			continue
+		}
+		if err := drainer.Cordon(ctx, node); err != nil {
+			return drainer.CordonedNodes(), fmt.Errorf("failed to cordon node %s: %w", node.Name, err)
+		}
+	}
+
+	return drainer.CordonedNodes(), nil
+}
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// drainProgressInterval is the interval between the logs of the
+// progress of a drain, so that long drains do not look stuck.
+const drainProgressInterval = 30 * time.Second
+
+// drainedNodesKey is the private state key holding
+// the nodes of the pool that were already drained.
+const drainedNodesKey = "drained_nodes"
+
+// drainProgressTokenPrefix distinguishes drain progress tokens
+// from other import IDs.
+const drainProgressTokenPrefix = "k8snp-progress:"
+
+// drainProgress records the nodes of a node pool drained so far, so that an
+// interrupted drain can be resumed without draining them again.
+type drainProgress struct {
+	NodePoolName string   `json:"node_pool_name"`
+	DrainedNodes []string `json:"drained_nodes"`
+}
+
+// token serializes the progress into an opaque string accepted as import ID.
+func (p drainProgress) token() string {
+	// marshalling a struct of strings cannot fail
+	b, _ := json.Marshal(p)
+	return drainProgressTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parseDrainProgressToken parses a token created by drainProgress.token and
+// reports whether id is one.
+func parseDrainProgressToken(id string) (drainProgress, bool, error) {
+	encoded, ok := strings.CutPrefix(id, drainProgressTokenPrefix)
+	if !ok {
+		return drainProgress{}, false, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return drainProgress{}, true, fmt.Errorf("failed to decode drain progress token: %w", err)
+	}
+
+	var progress drainProgress
+	if err := json.Unmarshal(b, &progress); err != nil {
+		return drainProgress{}, true, fmt.Errorf("failed to decode drain progress token: %w", err)
+	}
+	if progress.NodePoolName == "" {
+		return drainProgress{}, true, fmt.Errorf("drain progress token has no node pool name")
+	}
+
+	return progress, true, nil
+}
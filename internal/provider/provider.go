@@ -1,26 +1,34 @@
 package provider
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"log"
 	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/dedalusj/k8snp/internal/kube"
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/function"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
-	apimachineryschema "k8s.io/apimachinery/pkg/runtime/schema"
 	restclient "k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 // Ensure K8sNpProvider satisfies various provider interfaces.
 var _ provider.Provider = &K8sNpProvider{}
+var _ provider.ProviderWithFunctions = &K8sNpProvider{}
 
 // K8sNpProvider defines the provider implementation.
 type K8sNpProvider struct {
@@ -28,13 +36,90 @@ type K8sNpProvider struct {
 	// provider is built and ran locally, and "test" when running acceptance
 	// testing.
 	version string
+
+	// clients creates the kubernetes clients used by resources and data sources.
+	clients kube.ClientProvider
 }
 
 // K8sNpProviderModel describes the provider data model.
 type K8sNpProviderModel struct {
-	KubeHost             types.String `tfsdk:"kube_host"`
-	ClusterCaCertificate types.String `tfsdk:"cluster_ca_certificate"`
-	Token                types.String `tfsdk:"token"`
+	KubeHost             types.String                `tfsdk:"kube_host"`
+	ClusterCaCertificate types.String                `tfsdk:"cluster_ca_certificate"`
+	Token                types.String                `tfsdk:"token"`
+	ClientCertificate    types.String                `tfsdk:"client_certificate_file"`
+	ClientKey            types.String                `tfsdk:"client_key_file"`
+	MaxApiRetries        types.Int64                 `tfsdk:"max_api_retries"`
+	ApiRetryBackoff      types.String                `tfsdk:"api_retry_backoff"`
+	UseProtobuf          types.Bool                  `tfsdk:"use_protobuf"`
+	ExtraHeaders         types.Map                   `tfsdk:"extra_headers"`
+	OtlpEndpoint         types.String                `tfsdk:"otlp_endpoint"`
+	PushgatewayURL       types.String                `tfsdk:"metrics_pushgateway_url"`
+	EventStreamPath      types.String                `tfsdk:"event_stream_path"`
+	RBACProfile          types.String                `tfsdk:"rbac_profile"`
+	NodeEvents           types.Bool                  `tfsdk:"node_events"`
+	DryRun               types.Bool                  `tfsdk:"dry_run"`
+	RunID                types.String                `tfsdk:"run_id"`
+	Advanced             *K8sNpProviderAdvancedModel `tfsdk:"advanced"`
+	GCE                  *K8sNpProviderGCEModel      `tfsdk:"gce"`
+	EC2                  *K8sNpProviderEC2Model      `tfsdk:"ec2"`
+	Azure                *K8sNpProviderAzureModel    `tfsdk:"azure"`
+}
+
+// K8sNpProviderAdvancedModel describes the advanced provider block data model.
+type K8sNpProviderAdvancedModel struct {
+	DisableCompression  types.Bool   `tfsdk:"disable_compression"`
+	AcceptContentTypes  types.String `tfsdk:"accept_content_types"`
+	DialTimeout         types.String `tfsdk:"dial_timeout"`
+	TLSHandshakeTimeout types.String `tfsdk:"tls_handshake_timeout"`
+}
+
+// K8sNpProviderGCEModel describes the gce provider block data model.
+type K8sNpProviderGCEModel struct {
+	AccessToken types.String `tfsdk:"access_token"`
+}
+
+// K8sNpProviderEC2Model describes the ec2 provider block data model.
+type K8sNpProviderEC2Model struct {
+	AccessKeyID     types.String `tfsdk:"access_key_id"`
+	SecretAccessKey types.String `tfsdk:"secret_access_key"`
+	SessionToken    types.String `tfsdk:"session_token"`
+	Region          types.String `tfsdk:"region"`
+}
+
+// K8sNpProviderAzureModel describes the azure provider block data model.
+type K8sNpProviderAzureModel struct {
+	TenantID     types.String `tfsdk:"tenant_id"`
+	ClientID     types.String `tfsdk:"client_id"`
+	ClientSecret types.String `tfsdk:"client_secret"`
+}
+
+const (
+	// rbacProfileDefault requires the permissions to patch nodes and evict pods
+	rbacProfileDefault = "default"
+	// rbacProfileEvictOnly only requires the permission to evict pods
+	rbacProfileEvictOnly = "evict_only"
+)
+
+// K8sNpProviderData is shared by the provider with its resources and data sources.
+type K8sNpProviderData struct {
+	config         *restclient.Config
+	retry          orchestrate.RetryPolicy
+	pushgatewayURL string
+	eventStream    string
+	rbacProfile    string
+	nodeEvents     bool
+	dryRun         bool
+	runID          string
+	version        string
+	clients        kube.ClientProvider
+	nodePools      *nodePoolRegistry
+	instances      instanceCheckers
+	// asyncDestroys reports the asynchronous destroys of node
+	// pools once, when the first node pool is read
+	asyncDestroys *sync.Once
+	// asyncDestroysResumed is set once the asynchronous destroys were
+	// resumed, by the first node pool created or destroyed
+	asyncDestroysResumed *atomic.Bool
 }
 
 func (p *K8sNpProvider) Metadata(_ context.Context, _ provider.MetadataRequest, resp *provider.MetadataResponse) {
@@ -55,10 +140,164 @@ func (p *K8sNpProvider) Schema(_ context.Context, _ provider.SchemaRequest, resp
 				Description: "PEM-encoded root certificates bundle for TLS authentication.",
 			},
 			"token": schema.StringAttribute{
-				Required:    true,
-				Description: "Token to authenticate an service account",
+				Optional:    true,
+				Description: "Token to authenticate an service account. Either `token` or `client_certificate_file` and `client_key_file` must be set.",
 				Sensitive:   true,
 			},
+			"client_certificate_file": schema.StringAttribute{
+				Optional:    true,
+				Description: "Path to a PEM-encoded client certificate for TLS authentication. The file is reloaded when it changes on disk so that short-lived certificates can be rotated during long operations.",
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+					stringvalidator.AlsoRequires(path.MatchRoot("client_key_file")),
+				},
+			},
+			"client_key_file": schema.StringAttribute{
+				Optional:    true,
+				Description: "Path to a PEM-encoded client certificate key for TLS authentication. The file is reloaded when it changes on disk so that short-lived keys can be rotated during long operations.",
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+					stringvalidator.AlsoRequires(path.MatchRoot("client_certificate_file")),
+				},
+			},
+			"max_api_retries": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Maximum number of retries for kubernetes API calls failing with a transient error. Defaults to `5`.",
+				Validators:  []validator.Int64{int64validator.AtLeast(0)},
+			},
+			"api_retry_backoff": schema.StringAttribute{
+				Optional:    true,
+				Description: "Initial backoff between retries of kubernetes API calls, doubled after each attempt. Defaults to `1s`.",
+				Validators:  []validator.String{MinDuration(0)},
+			},
+			"use_protobuf": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Use the protobuf encoding for kubernetes API requests, falling back to JSON when the server does not support it. Reduces latency and memory usage on large clusters. Defaults to `false`.",
+			},
+			"extra_headers": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Additional HTTP headers added to every request made to the kubernetes API, e.g. for authenticating gateways in front of the API server.",
+			},
+			"otlp_endpoint": schema.StringAttribute{
+				Optional:    true,
+				Description: "Origin of an OTLP/HTTP collector, e.g. `http://localhost:4318`, receiving traces of the operations performed by the provider. Tracing is disabled when not set.",
+				Validators:  []validator.String{Origin([]string{"http", "https"})},
+			},
+			"metrics_pushgateway_url": schema.StringAttribute{
+				Optional:    true,
+				Description: "Origin of a Prometheus Pushgateway, e.g. `http://localhost:9091`, receiving metrics of node pool drains. Metrics are not pushed when not set.",
+				Validators:  []validator.String{Origin([]string{"http", "https"})},
+			},
+			"event_stream_path": schema.StringAttribute{
+				Optional:    true,
+				Description: "Path of a file the provider appends the events of the node pool operations to, as JSON lines, e.g. phase transitions, pod evictions and errors, so that they can be followed while the operations run. Events are not recorded when not set.",
+				Validators:  []validator.String{stringvalidator.LengthAtLeast(1)},
+			},
+			"rbac_profile": schema.StringAttribute{
+				Optional: true,
+				Description: "Permissions granted to the provider in the cluster. With `evict_only` nodes are never patched, so they are not cordoned and pods are only evicted, for clusters where the provider cannot be granted the patch permission on nodes. " +
+					"Defaults to `" + rbacProfileDefault + "`.",
+				Validators: []validator.String{
+					stringvalidator.OneOf(rbacProfileDefault, rbacProfileEvictOnly),
+				},
+			},
+			"node_events": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Create kubernetes Events on the nodes of the node pools as they are cordoned and drained, with the reasons `" + reasonCordoned + "`, `" + reasonDrainStarted + "` and `" + reasonDrainCompleted + "` and the terraform run ID, so that the disruptions can be correlated with terraform runs. Requires the permission to create events. Defaults to `false`.",
+			},
+			"dry_run": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Make every change to the cluster, e.g. cordons, evictions, taints and annotations, a server-side dry run, so that the node pool operations of a whole plan can be rehearsed against a live cluster without disrupting it. The drains do not wait for the pods to be gone, as they never are, and the destroys of node pools fail once rehearsed so that they are kept in the state. Defaults to `false`.",
+			},
+			"run_id": schema.StringAttribute{
+				Optional:    true,
+				Description: "ID of the terraform run, set on the Events created with `node_events`. Defaults to the `" + runIDEnvVar + "` environment variable set by HCP Terraform.",
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"advanced": schema.SingleNestedBlock{
+				Description: "Rarely needed settings of the kubernetes client for edge-case environments.",
+				Attributes: map[string]schema.Attribute{
+					"disable_compression": schema.BoolAttribute{
+						Optional:    true,
+						Description: "Disable response compression for kubernetes API requests.",
+					},
+					"accept_content_types": schema.StringAttribute{
+						Optional:    true,
+						Description: "Comma separated list of content types sent in the Accept header of kubernetes API requests. Overrides `use_protobuf`.",
+						Validators:  []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"dial_timeout": schema.StringAttribute{
+						Optional:    true,
+						Description: "Timeout for establishing connections to the kubernetes API. Defaults to `30s`.",
+						Validators:  []validator.String{MinDuration(0)},
+					},
+					"tls_handshake_timeout": schema.StringAttribute{
+						Optional:    true,
+						Description: "Timeout for the TLS handshake with the kubernetes API. Defaults to `10s`.",
+						Validators:  []validator.String{MinDuration(0)},
+					},
+				},
+			},
+			"gce": schema.SingleNestedBlock{
+				Description: "Checks that the GCE instances of the nodes exist before draining them. The nodes whose instance is found missing by consecutive checks are deleted without being drained.",
+				Attributes: map[string]schema.Attribute{
+					"access_token": schema.StringAttribute{
+						Optional:    true,
+						Sensitive:   true,
+						Description: "Access token allowed to get the instances. Defaults to the application default credentials: the credentials file in `GOOGLE_APPLICATION_CREDENTIALS`, of a service account, an authorized user or an external account of a workload identity federation, the one of `gcloud auth application-default login` or the service account of the GCE instance the provider runs on.",
+						Validators:  []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+				},
+			},
+			"ec2": schema.SingleNestedBlock{
+				Description: "Checks that the EC2 instances of the nodes exist before draining them. The nodes whose instance is found missing, or terminated, by consecutive checks are deleted without being drained.",
+				Attributes: map[string]schema.Attribute{
+					"access_key_id": schema.StringAttribute{
+						Optional:    true,
+						Description: "Access key ID allowed to describe the instances. Defaults to the default AWS credential chain: the `AWS_ACCESS_KEY_ID` and `AWS_SECRET_ACCESS_KEY` environment variables, the shared config and credentials files with the profile in `AWS_PROFILE`, including SSO and `credential_process`, the web identity in `AWS_WEB_IDENTITY_TOKEN_FILE` and `AWS_ROLE_ARN`, e.g. of an EKS service account, the ECS task role and the EC2 instance profile.",
+						Validators:  []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"secret_access_key": schema.StringAttribute{
+						Optional:    true,
+						Sensitive:   true,
+						Description: "Secret access key of `access_key_id`. Required with `access_key_id`.",
+						Validators:  []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"session_token": schema.StringAttribute{
+						Optional:    true,
+						Sensitive:   true,
+						Description: "Session token of temporary credentials.",
+					},
+					"region": schema.StringAttribute{
+						Optional:    true,
+						Description: "Region of the instances. Defaults to the region of the availability zone, Local Zone or Wavelength Zone in the provider ID of the nodes.",
+						Validators:  []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+				},
+			},
+			"azure": schema.SingleNestedBlock{
+				Description: "Checks that the Azure virtual machines of the nodes exist before draining them. The nodes whose virtual machine is found missing by consecutive checks are deleted without being drained.",
+				Attributes: map[string]schema.Attribute{
+					"tenant_id": schema.StringAttribute{
+						Optional:    true,
+						Description: "Tenant of the service principal or workload identity. Defaults to `AZURE_TENANT_ID`.",
+						Validators:  []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"client_id": schema.StringAttribute{
+						Optional:    true,
+						Description: "Client ID of a service principal, workload or user-assigned managed identity allowed to read the virtual machines.",
+						Validators:  []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+					"client_secret": schema.StringAttribute{
+						Optional:    true,
+						Sensitive:   true,
+						Description: "Client secret of the service principal. Without it the workload identity in `AZURE_FEDERATED_TOKEN_FILE`, then the managed identity of the virtual machine the provider runs on, are used with `client_id` and, when `client_id` is not set either, the default Azure credential chain: the service principal in `AZURE_TENANT_ID`, `AZURE_CLIENT_ID` and `AZURE_CLIENT_SECRET`, the workload identity, the managed identity and the Azure CLI.",
+						Validators:  []validator.String{stringvalidator.LengthAtLeast(1)},
+					},
+				},
+			},
 		},
 	}
 }
@@ -72,7 +311,18 @@ func (p *K8sNpProvider) Configure(ctx context.Context, req provider.ConfigureReq
 		return
 	}
 
-	if data.KubeHost.IsUnknown() || data.Token.IsUnknown() || data.ClusterCaCertificate.IsUnknown() {
+	resp.Diagnostics.Append(checkTerraformVersion(req.TerraformVersion)...)
+
+	if data.KubeHost.IsUnknown() || data.Token.IsUnknown() || data.ClusterCaCertificate.IsUnknown() ||
+		data.ClientCertificate.IsUnknown() || data.ClientKey.IsUnknown() || data.ExtraHeaders.IsUnknown() {
+		return
+	}
+
+	if data.Token.IsNull() && data.ClientCertificate.IsNull() {
+		resp.Diagnostics.AddError(
+			"Missing Kube Credentials",
+			"Either token or client_certificate_file and client_key_file must be set to authenticate with the k8s API",
+		)
 		return
 	}
 
@@ -95,7 +345,13 @@ func (p *K8sNpProvider) Configure(ctx context.Context, req provider.ConfigureReq
 		return
 	}
 
-	config, err := initializeConfiguration(&data, req.TerraformVersion)
+	kubeConfig, diags := newKubeConfig(ctx, &data, req.TerraformVersion)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	config, err := kube.NewRESTConfig(kubeConfig)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Unable to create k8s client config",
@@ -104,50 +360,205 @@ func (p *K8sNpProvider) Configure(ctx context.Context, req provider.ConfigureReq
 		return
 	}
 
-	resp.DataSourceData = config
-	resp.ResourceData = config
+	if !data.OtlpEndpoint.IsNull() && !data.OtlpEndpoint.IsUnknown() {
+		if err := configureTracing(ctx, data.OtlpEndpoint.ValueString(), p.version); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("otlp_endpoint"),
+				"Unable to configure tracing",
+				"Unexpected error while configuring the OTLP trace exporter: "+err.Error(),
+			)
+			return
+		}
+	}
+
+	retry := orchestrate.DefaultRetryPolicy()
+	if !data.MaxApiRetries.IsNull() && !data.MaxApiRetries.IsUnknown() {
+		retry.MaxRetries = data.MaxApiRetries.ValueInt64()
+	}
+	if !data.ApiRetryBackoff.IsNull() && !data.ApiRetryBackoff.IsUnknown() {
+		// we ignore the error as the validator for the argument in the schema
+		// definition above will ensure its validity
+		retry.Backoff, _ = time.ParseDuration(data.ApiRetryBackoff.ValueString())
+	}
+
+	rbacProfile := rbacProfileDefault
+	if !data.RBACProfile.IsNull() && !data.RBACProfile.IsUnknown() {
+		rbacProfile = data.RBACProfile.ValueString()
+	}
+
+	runID := os.Getenv(runIDEnvVar)
+	if !data.RunID.IsNull() && !data.RunID.IsUnknown() {
+		runID = data.RunID.ValueString()
+	}
+
+	instances, diags := configureInstanceCheckers(&data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	providerData := &K8sNpProviderData{
+		config:         config,
+		retry:          retry,
+		pushgatewayURL: data.PushgatewayURL.ValueString(),
+		eventStream:    data.EventStreamPath.ValueString(),
+		rbacProfile:    rbacProfile,
+		nodeEvents:     data.NodeEvents.ValueBool(),
+		dryRun:         data.DryRun.ValueBool(),
+		runID:          runID,
+		version:        p.version,
+		clients:        p.clients,
+		nodePools:      newNodePoolRegistry(),
+		instances:      instances,
+		asyncDestroys:  &sync.Once{},
+
+		asyncDestroysResumed: &atomic.Bool{},
+	}
+
+	resp.DataSourceData = providerData
+	resp.ResourceData = providerData
 }
 
 func (p *K8sNpProvider) Resources(_ context.Context) []func() resource.Resource {
 	return []func() resource.Resource{
 		NewNodePoolResource,
+		NewNodeBootstrapResource,
 	}
 }
 
 func (p *K8sNpProvider) DataSources(_ context.Context) []func() datasource.DataSource {
-	return []func() datasource.DataSource{}
+	return []func() datasource.DataSource{
+		NewReadyWhenDataSource,
+		NewPoolCapacityDataSource,
+		NewVersionsDataSource,
+	}
+}
+
+func (p *K8sNpProvider) Functions(_ context.Context) []func() function.Function {
+	return []func() function.Function{
+		NewMinReadyNodesFunction,
+		NewGKESelectorFunction,
+		NewEKSSelectorFunction,
+		NewAKSSelectorFunction,
+	}
 }
 
 func New(version string) func() provider.Provider {
+	return NewWithKubeClientProvider(version, kube.DefaultClientProvider())
+}
+
+// NewWithKubeClientProvider returns a provider factory creating kubernetes
+// clients with the given kube.ClientProvider. It allows tests to inject a
+// fake clientset instead of connecting to a real cluster.
+func NewWithKubeClientProvider(version string, clients kube.ClientProvider) func() provider.Provider {
 	return func() provider.Provider {
 		return &K8sNpProvider{
 			version: version,
+			clients: clients,
 		}
 	}
 }
 
-func initializeConfiguration(m *K8sNpProviderModel, terraformVersion string) (*restclient.Config, error) {
-	overrides := &clientcmd.ConfigOverrides{}
-	loader := &clientcmd.ClientConfigLoadingRules{}
+// minTerraformVersion is the oldest Terraform version supported by the
+// next major release, the first serving only protocol version 6.
+var minTerraformVersion = version.Must(version.NewVersion("1.0.0"))
 
-	overrides.ClusterInfo.CertificateAuthorityData = bytes.NewBufferString(m.ClusterCaCertificate.ValueString()).Bytes()
+// checkTerraformVersion warns when terraformVersion, the version of the
+// Terraform CLI running the provider, is deprecated.
+func checkTerraformVersion(terraformVersion string) diag.Diagnostics {
+	var diags diag.Diagnostics
 
-	host, _, err := restclient.DefaultServerURL(m.KubeHost.ValueString(), "", apimachineryschema.GroupVersion{}, false)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse host: %s", err)
+	// the version is not sent by every Terraform CLI, e.g. in tests
+	v, err := version.NewVersion(terraformVersion)
+	if err != nil || !v.LessThan(minTerraformVersion) {
+		return diags
 	}
-	overrides.ClusterInfo.Server = host.String()
 
-	overrides.AuthInfo.Token = m.Token.ValueString()
+	diags.AddWarning(
+		"Deprecated Terraform version",
+		fmt.Sprintf("Terraform %s is deprecated and will not be supported by the next major release of the provider, which requires Terraform %s or later. "+
+			"Provider functions require Terraform 1.8 and resource identities Terraform 1.12.", terraformVersion, minTerraformVersion),
+	)
+	return diags
+}
 
-	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loader, overrides)
-	cfg, err := cc.ClientConfig()
-	if err != nil {
-		log.Printf("[WARN] Invalid provider configuration was supplied. Provider operations likely to fail: %v", err)
-		return nil, nil
+// newKubeConfig returns the configuration of the kubernetes clients set in m.
+func newKubeConfig(ctx context.Context, m *K8sNpProviderModel, terraformVersion string) (kube.Config, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	c := kube.Config{
+		Host:                 m.KubeHost.ValueString(),
+		ClusterCACertificate: m.ClusterCaCertificate.ValueString(),
+		Token:                m.Token.ValueString(),
+		ClientCertificate:    m.ClientCertificate.ValueString(),
+		ClientKey:            m.ClientKey.ValueString(),
+		UserAgent:            fmt.Sprintf("HashiCorp/1.0 Terraform/%s", terraformVersion),
+		UseProtobuf:          m.UseProtobuf.ValueBool(),
+		DryRun:               m.DryRun.ValueBool(),
+	}
+
+	if !m.ExtraHeaders.IsNull() {
+		diags.Append(m.ExtraHeaders.ElementsAs(ctx, &c.ExtraHeaders, false)...)
+	}
+
+	// we ignore the errors as the validators for the arguments in the schema
+	// definition above will ensure their validity
+	if m.Advanced != nil {
+		c.Advanced = &kube.AdvancedConfig{
+			DisableCompression: m.Advanced.DisableCompression.ValueBool(),
+			AcceptContentTypes: m.Advanced.AcceptContentTypes.ValueString(),
+		}
+		if !m.Advanced.DialTimeout.IsNull() {
+			dialTimeout, _ := time.ParseDuration(m.Advanced.DialTimeout.ValueString())
+			c.Advanced.DialTimeout = &dialTimeout
+		}
+		if !m.Advanced.TLSHandshakeTimeout.IsNull() {
+			tlsHandshakeTimeout, _ := time.ParseDuration(m.Advanced.TLSHandshakeTimeout.ValueString())
+			c.Advanced.TLSHandshakeTimeout = &tlsHandshakeTimeout
+		}
 	}
 
-	cfg.UserAgent = fmt.Sprintf("HashiCorp/1.0 Terraform/%s", terraformVersion)
+	return c, diags
+}
+
+// configureInstanceCheckers returns the checkers of the cloud instances of
+// the nodes configured by the gce, ec2 and azure blocks.
+func configureInstanceCheckers(m *K8sNpProviderModel) (instanceCheckers, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	instances := instanceCheckers{}
+
+	if m.GCE != nil {
+		instances["gce"] = newGCEInstanceChecker(m.GCE.AccessToken.ValueString())
+	}
+
+	if m.EC2 != nil {
+		if (m.EC2.AccessKeyID.ValueString() == "") != (m.EC2.SecretAccessKey.ValueString() == "") {
+			diags.AddAttributeError(
+				path.Root("ec2"),
+				"Incomplete EC2 Credentials",
+				"Both access_key_id and secret_access_key must be set to use static credentials, or neither to use the default credential chain",
+			)
+		} else {
+			instances["aws"] = newEC2InstanceChecker(m.EC2.AccessKeyID.ValueString(), m.EC2.SecretAccessKey.ValueString(), m.EC2.SessionToken.ValueString(), m.EC2.Region.ValueString())
+		}
+	}
+
+	if m.Azure != nil {
+		if m.Azure.ClientSecret.ValueString() != "" && (m.Azure.TenantID.ValueString() == "" || m.Azure.ClientID.ValueString() == "") {
+			diags.AddAttributeError(
+				path.Root("azure"),
+				"Incomplete Azure Credentials",
+				"Both tenant_id and client_id must be set with client_secret",
+			)
+		} else {
+			checker, err := newAzureInstanceChecker(m.Azure.TenantID.ValueString(), m.Azure.ClientID.ValueString(), m.Azure.ClientSecret.ValueString())
+			if err != nil {
+				diags.AddAttributeError(path.Root("azure"), "Invalid Azure Credentials", err.Error())
+			} else {
+				instances["azure"] = checker
+			}
+		}
+	}
 
-	return cfg, nil
+	return instances, diags
 }
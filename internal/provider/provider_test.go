@@ -0,0 +1,315 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/dedalusj/k8snp/internal/kube"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+// objectValue returns a value of typ, an object type, with the given
+// attribute values and all the other attributes null.
+func objectValue(t *testing.T, typ tftypes.Type, values map[string]tftypes.Value) tftypes.Value {
+	t.Helper()
+
+	objectType, ok := typ.(tftypes.Object)
+	if !ok {
+		t.Fatalf("expected an object type, got %s", typ)
+	}
+
+	attributes := map[string]tftypes.Value{}
+	for name, attributeType := range objectType.AttributeTypes {
+		attributes[name] = tftypes.NewValue(attributeType, nil)
+	}
+	for name, value := range values {
+		if _, ok := objectType.AttributeTypes[name]; !ok {
+			t.Fatalf("unknown attribute %s", name)
+		}
+		attributes[name] = value
+	}
+	return tftypes.NewValue(objectType, attributes)
+}
+
+// configureProvider configures a provider whose resources and data
+// sources use client, and returns the data passed to them.
+func configureProvider(t *testing.T, client kubernetes.Interface) any {
+	t.Helper()
+	ctx := context.Background()
+
+	p := NewWithKubeClientProvider("test", kube.StaticClientProvider(client))()
+
+	schemaResp := &provider.SchemaResponse{}
+	p.Schema(ctx, provider.SchemaRequest{}, schemaResp)
+
+	config := tfsdk.Config{
+		Schema: schemaResp.Schema,
+		Raw: objectValue(t, schemaResp.Schema.Type().TerraformType(ctx), map[string]tftypes.Value{
+			"kube_host": tftypes.NewValue(tftypes.String, "https://kubernetes.example.com"),
+			"token":     tftypes.NewValue(tftypes.String, "token"),
+		}),
+	}
+
+	resp := &provider.ConfigureResponse{}
+	p.Configure(ctx, provider.ConfigureRequest{Config: config}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error configuring the provider: %v", resp.Diagnostics)
+	}
+	return resp.DataSourceData
+}
+
+// readDataSource reads d, configured with the provider data and the given
+// configuration values, and returns its state.
+func readDataSource(t *testing.T, d datasource.DataSource, providerData any, values map[string]tftypes.Value) tfsdk.State {
+	t.Helper()
+	ctx := context.Background()
+
+	configureResp := &datasource.ConfigureResponse{}
+	d.(datasource.DataSourceWithConfigure).Configure(ctx, datasource.ConfigureRequest{ProviderData: providerData}, configureResp)
+	if configureResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error configuring the data source: %v", configureResp.Diagnostics)
+	}
+
+	schemaResp := &datasource.SchemaResponse{}
+	d.Schema(ctx, datasource.SchemaRequest{}, schemaResp)
+	typ := schemaResp.Schema.Type().TerraformType(ctx)
+
+	resp := &datasource.ReadResponse{
+		State: tfsdk.State{Schema: schemaResp.Schema, Raw: tftypes.NewValue(typ, nil)},
+	}
+	d.Read(ctx, datasource.ReadRequest{
+		Config: tfsdk.Config{Schema: schemaResp.Schema, Raw: objectValue(t, typ, values)},
+	}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error reading the data source: %v", resp.Diagnostics)
+	}
+	return resp.State
+}
+
+// TestProviderSchema serves the provider as Terraform does, which validates
+// the schemas of the provider, its resources and data sources, e.g. that the
+// attributes with a default are computed.
+func TestProviderSchema(t *testing.T) {
+	server, err := providerserver.NewProtocol6WithError(New("test")())()
+	if err != nil {
+		t.Fatalf("unexpected error creating the provider server: %v", err)
+	}
+
+	resp, err := server.GetProviderSchema(context.Background(), &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error getting the provider schema: %v", err)
+	}
+	for _, diagnostic := range resp.Diagnostics {
+		if diagnostic.Severity == tfprotov6.DiagnosticSeverityError {
+			t.Errorf("%s: %s", diagnostic.Summary, diagnostic.Detail)
+		}
+	}
+
+	for _, name := range []string{"k8snp_node_pool", "k8snp_node_bootstrap"} {
+		if _, ok := resp.ResourceSchemas[name]; !ok {
+			t.Errorf("expected the %s resource", name)
+		}
+	}
+	for _, name := range []string{"k8snp_ready_when", "k8snp_pool_capacity", "k8snp_versions"} {
+		if _, ok := resp.DataSourceSchemas[name]; !ok {
+			t.Errorf("expected the %s data source", name)
+		}
+	}
+}
+
+func TestCheckTerraformVersion(t *testing.T) {
+	tests := []struct {
+		version    string
+		deprecated bool
+	}{
+		{version: "0.15.5", deprecated: true},
+		{version: "1.0.0"},
+		{version: "1.12.1"},
+		{version: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			diags := checkTerraformVersion(test.version)
+			if got := diags.WarningsCount() > 0; got != test.deprecated {
+				t.Errorf("expected deprecated to be %t, got %t", test.deprecated, got)
+			}
+		})
+	}
+}
+
+func newTestNode(name string, labels map[string]string, ready bool) *v1.Node {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}},
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("2"),
+				v1.ResourceMemory: resource.MustParse("4Gi"),
+				v1.ResourcePods:   resource.MustParse("110"),
+			},
+		},
+	}
+}
+
+func newTestClient(objects ...runtime.Object) kubernetes.Interface {
+	return fake.NewSimpleClientset(objects...)
+}
+
+func newTestPod(name, nodeName string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name)},
+		Spec:       v1.PodSpec{NodeName: nodeName},
+	}
+}
+
+// newPodsClient returns a fake clientset whose pod lists honour the
+// spec.nodeName field selector, ignored by the fake object tracker.
+func newPodsClient(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	selectPodsByNode(client)
+	return client
+}
+
+// selectPodsByNode makes the pod lists of client honour the
+// spec.nodeName field selector.
+func selectPodsByNode(client *fake.Clientset) {
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+		if selector == nil || selector.Empty() {
+			return false, nil, nil
+		}
+
+		obj, err := client.Tracker().List(v1.SchemeGroupVersion.WithResource("pods"), v1.SchemeGroupVersion.WithKind("Pod"), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		pods := obj.(*v1.PodList)
+		filtered := &v1.PodList{}
+		for _, pod := range pods.Items {
+			if selector.Matches(fields.Set{"spec.nodeName": pod.Spec.NodeName}) {
+				filtered.Items = append(filtered.Items, pod)
+			}
+		}
+		return true, filtered, nil
+	})
+}
+
+// newEvictionClient returns a fake clientset serving policy/v1 evictions,
+// which delete the evicted pods unless blocked returns an error for them.
+func newEvictionClient(blocked func(pod string) error, objects ...runtime.Object) (*fake.Clientset, *[]string) {
+	client := fake.NewSimpleClientset(objects...)
+	client.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "pods"},
+			{Name: drain.EvictionSubresource, Kind: drain.EvictionKind, Group: "policy", Version: "v1"},
+		},
+	}}
+
+	var mu sync.Mutex
+	var evicted []string
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		if err := blocked(eviction.Name); err != nil {
+			return true, nil, err
+		}
+
+		mu.Lock()
+		evicted = append(evicted, eviction.Name)
+		mu.Unlock()
+		return true, nil, client.Tracker().Delete(v1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name)
+	})
+	return client, &evicted
+}
+
+func disruptionBudgetError() error {
+	err := apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+	err.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: policyv1.DisruptionBudgetCause}}
+	return err
+}
+
+func TestReadyWhenDataSourceRead(t *testing.T) {
+	ctx := context.Background()
+	pool := map[string]string{"cloud.google.com/gke-nodepool": "pool-a"}
+	client := newTestClient(
+		newTestNode("node-1", pool, true),
+		newTestNode("node-2", pool, true),
+		newTestNode("node-3", pool, false),
+		newTestNode("node-4", map[string]string{"cloud.google.com/gke-nodepool": "pool-b"}, true),
+	)
+
+	state := readDataSource(t, NewReadyWhenDataSource(), configureProvider(t, client), map[string]tftypes.Value{
+		"node_selector_value": tftypes.NewValue(tftypes.String, "pool-a"),
+		"min_ready_nodes":     tftypes.NewValue(tftypes.Number, 2),
+		"timeout":             tftypes.NewValue(tftypes.String, "10s"),
+	})
+
+	var data ReadyWhenDataSourceModel
+	if diags := state.Get(ctx, &data); diags.HasError() {
+		t.Fatalf("unexpected error reading the state: %v", diags)
+	}
+	if !data.Ready.ValueBool() {
+		t.Errorf("expected the nodes to be ready")
+	}
+	if got := data.ReadyNodes.ValueInt64(); got != 2 {
+		t.Errorf("expected 2 ready nodes, got %d", got)
+	}
+	if got := data.NodeSelectorKey.ValueString(); got != "cloud.google.com/gke-nodepool" {
+		t.Errorf("expected the default node selector key, got %q", got)
+	}
+}
+
+func TestPoolCapacityDataSourceRead(t *testing.T) {
+	ctx := context.Background()
+	pool := map[string]string{"pool": "a"}
+	client := newTestClient(
+		newTestNode("node-1", pool, true),
+		newTestNode("node-2", pool, false),
+		newTestNode("node-3", map[string]string{"pool": "b"}, true),
+	)
+
+	state := readDataSource(t, NewPoolCapacityDataSource(), configureProvider(t, client), map[string]tftypes.Value{
+		"node_selector_key":   tftypes.NewValue(tftypes.String, "pool"),
+		"node_selector_value": tftypes.NewValue(tftypes.String, "a"),
+	})
+
+	var data PoolCapacityDataSourceModel
+	if diags := state.Get(ctx, &data); diags.HasError() {
+		t.Fatalf("unexpected error reading the state: %v", diags)
+	}
+	if got := data.Nodes.ValueInt64(); got != 2 {
+		t.Errorf("expected 2 nodes, got %d", got)
+	}
+	if got := data.CPUMillicores.ValueInt64(); got != 4000 {
+		t.Errorf("expected 4000 CPU millicores, got %d", got)
+	}
+	if got := data.Pods.ValueInt64(); got != 220 {
+		t.Errorf("expected 220 pods, got %d", got)
+	}
+}
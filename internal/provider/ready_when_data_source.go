@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &ReadyWhenDataSource{}
+
+func NewReadyWhenDataSource() datasource.DataSource {
+	return &ReadyWhenDataSource{}
+}
+
+// ReadyWhenDataSource defines the data source implementation.
+type ReadyWhenDataSource struct {
+	k8sClient kubernetes.Interface
+}
+
+// ReadyWhenDataSourceModel describes the data source data model.
+type ReadyWhenDataSourceModel struct {
+	NodeSelectorKey   types.String `tfsdk:"node_selector_key"`
+	NodeSelectorValue types.String `tfsdk:"node_selector_value"`
+	MinReadyNodes     types.Int64  `tfsdk:"min_ready_nodes"`
+	Timeout           types.String `tfsdk:"timeout"`
+	Ready             types.Bool   `tfsdk:"ready"`
+	ReadyNodes        types.Int64  `tfsdk:"ready_nodes"`
+}
+
+func (d *ReadyWhenDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_ready_when"
+}
+
+func (d *ReadyWhenDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "Waits, up to a timeout, for a minimum number of nodes matching a label selector to be ready. " +
+			"The `ready` attribute can be used in `precondition` blocks of other resources to gate them on node readiness.",
+
+		Attributes: map[string]schema.Attribute{
+			"node_selector_key": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Label key used to select the nodes. Defaults to `cloud.google.com/gke-nodepool`.",
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+			},
+			"node_selector_value": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "Label value used to select the nodes.",
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+			},
+			"min_ready_nodes": schema.Int64Attribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Minimum number of ready nodes for the selection to be considered ready. Defaults to `1`.",
+				Validators:          []validator.Int64{int64validator.AtLeast(1)},
+			},
+			"timeout": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "Maximum time for waiting for the nodes to be ready. Defaults to `300s`.",
+				Validators: []validator.String{
+					MinDuration(0),
+				},
+			},
+			"ready": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "Whether the minimum number of ready nodes was reached within the timeout.",
+			},
+			"ready_nodes": schema.Int64Attribute{
+				Computed:            true,
+				MarkdownDescription: "Number of ready nodes found when the data source was read.",
+			},
+		},
+	}
+}
+
+func (d *ReadyWhenDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*K8sNpProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unable to get kubernetes config",
+			"Unexpected error while fetching kubernetes config",
+		)
+		return
+	}
+
+	k8sClient, err := providerData.clients.KubeClient(providerData.config)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to create kubernetes client",
+			"Unexpected error while creating kubernetes client: "+err.Error(),
+		)
+		return
+	}
+	d.k8sClient = k8sClient
+}
+
+func (d *ReadyWhenDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data ReadyWhenDataSourceModel
+
+	// Read Terraform configuration data into the model
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.NodeSelectorKey.IsNull() {
+		data.NodeSelectorKey = types.StringValue("cloud.google.com/gke-nodepool")
+	}
+	if data.MinReadyNodes.IsNull() {
+		data.MinReadyNodes = types.Int64Value(1)
+	}
+	if data.Timeout.IsNull() {
+		data.Timeout = types.StringValue("300s")
+	}
+
+	// we ignore the error as the validator for the argument in the schema
+	// definition above will ensure its validity
+	timeout, _ := time.ParseDuration(data.Timeout.ValueString())
+
+	labelKey := data.NodeSelectorKey.ValueString()
+	labelValue := data.NodeSelectorValue.ValueString()
+
+	tflog.Debug(ctx, fmt.Sprintf("waiting for %d nodes to be ready with label %s=%s", data.MinReadyNodes.ValueInt64(), labelKey, labelValue))
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	includeNode := func(node v1.Node) bool { return true }
+
+	numReadyNodes, err := orchestrate.WaitForReadyNodes(waitCtx, d.k8sClient, orchestrate.NodeQuery{LabelSelector: labelKey + "=" + labelValue}, data.MinReadyNodes.ValueInt64(), includeNode, orchestrate.ReadinessCriteria{})
+	if ctx.Err() != nil {
+		resp.Diagnostics.AddError(
+			"Error reading node readiness",
+			fmt.Sprintf("Could not read node readiness of nodes with label %s=%s, the operation was cancelled", labelKey, labelValue),
+		)
+		return
+	}
+
+	if err != nil && waitCtx.Err() == nil {
+		resp.Diagnostics.AddError(
+			"Error reading node readiness",
+			fmt.Sprintf("Could not read node readiness, unexpected error watching nodes with label %s=%s: %s", labelKey, labelValue, err.Error()),
+		)
+		return
+	}
+
+	data.ReadyNodes = types.Int64Value(numReadyNodes)
+	data.Ready = types.BoolValue(numReadyNodes >= data.MinReadyNodes.ValueInt64())
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// scaleDownDisabledAnnotation set to "true" prevents the cluster
+// autoscaler from removing a node
+const scaleDownDisabledAnnotation = "cluster-autoscaler.kubernetes.io/scale-down-disabled"
+
+// disableScaleDown annotates the nodes matching selector, all the nodes when
+// empty, with scaleDownDisabledAnnotation so that the cluster autoscaler does
+// not remove them while the node pool is drained. The nodes of the node pool,
+// matching poolQuery, and those already annotated are left alone. It returns
+// the nodes it annotated, to be passed to enableScaleDown.
+func disableScaleDown(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, selector string, poolQuery orchestrate.NodeQuery) ([]string, error) {
+	nodes, err := orchestrate.ListNodes(ctx, client, retry, orchestrate.NodeQuery{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	poolNodes, err := orchestrate.ListNodes(ctx, client, retry, poolQuery)
+	if err != nil {
+		return nil, err
+	}
+	poolNodeNames := nodeNames(poolNodes)
+
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:"true"}}}`, scaleDownDisabledAnnotation))
+
+	var annotated []string
+	for _, node := range nodes {
+		if containsAny(poolNodeNames, node.Name) {
+			continue
+		}
+		if _, ok := node.Annotations[scaleDownDisabledAnnotation]; ok {
+			continue
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("disabling the scale down of node %s", node.Name))
+		err := retry.Do(ctx, "annotating node "+node.Name, func() error {
+			_, err := client.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+			return err
+		})
+		if err != nil {
+			return annotated, fmt.Errorf("failed to disable the scale down of node %s: %w", node.Name, err)
+		}
+		annotated = append(annotated, node.Name)
+	}
+
+	return annotated, nil
+}
+
+// enableScaleDown removes the scaleDownDisabledAnnotation from nodeNames.
+// It tries all the nodes and returns the errors of those that could not be
+// updated.
+func enableScaleDown(ctx context.Context, client kubernetes.Interface, retry orchestrate.RetryPolicy, nodeNames []string) error {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, scaleDownDisabledAnnotation))
+
+	var errs []error
+	for _, nodeName := range nodeNames {
+		tflog.Debug(ctx, fmt.Sprintf("enabling the scale down of node %s", nodeName))
+		err := retry.Do(ctx, "annotating node "+nodeName, func() error {
+			_, err := client.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+			return err
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to enable the scale down of node %s: %w", nodeName, err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
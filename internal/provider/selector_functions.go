@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ function.Function = &SelectorFunction{}
+
+// selectorAttributeTypes are the attributes of the objects returned by the
+// selector functions, named after the node pool arguments they are set to.
+var selectorAttributeTypes = map[string]attr.Type{
+	"node_selector_key":   types.StringType,
+	"node_selector_value": types.StringType,
+}
+
+func NewGKESelectorFunction() function.Function {
+	return &SelectorFunction{
+		name:      "gke_selector",
+		platform:  "GKE node pool",
+		parameter: "pool",
+		labelKey:  "cloud.google.com/gke-nodepool",
+	}
+}
+
+func NewEKSSelectorFunction() function.Function {
+	return &SelectorFunction{
+		name:      "eks_selector",
+		platform:  "EKS managed node group",
+		parameter: "nodegroup",
+		labelKey:  "eks.amazonaws.com/nodegroup",
+	}
+}
+
+func NewAKSSelectorFunction() function.Function {
+	return &SelectorFunction{
+		name:      "aks_selector",
+		platform:  "AKS agent pool",
+		parameter: "agentpool",
+		labelKey:  "kubernetes.azure.com/agentpool",
+	}
+}
+
+// SelectorFunction defines the implementation of the functions returning
+// the node selector of the node pools of a managed kubernetes platform.
+type SelectorFunction struct {
+	name      string
+	platform  string
+	parameter string
+	// labelKey is the label set by the platform on the nodes
+	// to the name of their node pool
+	labelKey string
+}
+
+func (f *SelectorFunction) Metadata(_ context.Context, _ function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = f.name
+}
+
+func (f *SelectorFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary: "Node selector of a " + f.platform,
+		MarkdownDescription: "Returns an object with the `node_selector_key` and `node_selector_value` selecting the nodes of a " + f.platform +
+			" by their `" + f.labelKey + "` label, to be set to the arguments of the same name of a node pool.",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:                f.parameter,
+				MarkdownDescription: "Name of the " + f.platform + ".",
+			},
+		},
+		Return: function.ObjectReturn{
+			AttributeTypes: selectorAttributeTypes,
+		},
+	}
+}
+
+func (f *SelectorFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var name string
+
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &name))
+	if resp.Error != nil {
+		return
+	}
+
+	if name == "" {
+		resp.Error = function.NewArgumentFuncError(0, f.parameter+" must not be empty")
+		return
+	}
+
+	if errs := validation.IsValidLabelValue(name); len(errs) > 0 {
+		resp.Error = function.NewArgumentFuncError(0, f.parameter+" must be a valid label value: "+strings.Join(errs, "; "))
+		return
+	}
+
+	selector, diags := types.ObjectValue(selectorAttributeTypes, map[string]attr.Value{
+		"node_selector_key":   types.StringValue(f.labelKey),
+		"node_selector_value": types.StringValue(name),
+	})
+	resp.Error = function.FuncErrorFromDiags(ctx, diags)
+	if resp.Error != nil {
+		return
+	}
+
+	resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, selector))
+}
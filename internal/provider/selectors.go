@@ -0,0 +1,28 @@
+package provider
+
+import "sync"
+
+// nodePoolRegistry records the node selectors of the node pools planned by
+// the provider, to detect node pools selecting the same nodes whose drains
+// would interleave unpredictably.
+type nodePoolRegistry struct {
+	mu        sync.Mutex
+	selectors map[string]string
+}
+
+func newNodePoolRegistry() *nodePoolRegistry {
+	return &nodePoolRegistry{selectors: map[string]string{}}
+}
+
+// register records selector as the node selector of nodePoolName and
+// returns the name of another node pool already registered with it, if any.
+func (r *nodePoolRegistry) register(selector, nodePoolName string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if other, ok := r.selectors[selector]; ok && other != nodePoolName {
+		return other, true
+	}
+	r.selectors[selector] = nodePoolName
+	return "", false
+}
@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+)
+
+type timeZoneValidator struct{}
+
+func (v timeZoneValidator) Description(_ context.Context) string {
+	return "string must be an IANA time zone name, e.g. Australia/Sydney"
+}
+
+func (v timeZoneValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v timeZoneValidator) ValidateString(_ context.Context, request validator.StringRequest, response *validator.StringResponse) {
+	if request.ConfigValue.IsNull() || request.ConfigValue.IsUnknown() {
+		return
+	}
+
+	value := request.ConfigValue.ValueString()
+	if _, err := time.LoadLocation(value); err != nil {
+		response.Diagnostics.Append(
+			diag.NewAttributeErrorDiagnostic(
+				request.Path,
+				"Invalid Attribute Format",
+				fmt.Sprintf("Attribute %s is not a valid time zone, got: %s: %s", request.Path, value, err.Error()),
+			),
+		)
+	}
+}
+
+// TimeZone returns a validator which ensures that any configured
+// attribute value is a valid IANA time zone name.
+func TimeZone() validator.String {
+	return timeZoneValidator{}
+}
@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/dedalusj/k8snp/internal/orchestrate"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &VersionsDataSource{}
+
+func NewVersionsDataSource() datasource.DataSource {
+	return &VersionsDataSource{}
+}
+
+// VersionsDataSource defines the data source implementation.
+type VersionsDataSource struct {
+	k8sClient       kubernetes.Interface
+	retry           orchestrate.RetryPolicy
+	providerVersion string
+}
+
+// VersionsDataSourceModel describes the data source data model.
+type VersionsDataSourceModel struct {
+	ProviderVersion types.String `tfsdk:"provider_version"`
+	ClientGoVersion types.String `tfsdk:"client_go_version"`
+	ClusterVersion  types.String `tfsdk:"cluster_version"`
+	ClusterMajor    types.String `tfsdk:"cluster_major"`
+	ClusterMinor    types.String `tfsdk:"cluster_minor"`
+}
+
+func (d *VersionsDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_versions"
+}
+
+func (d *VersionsDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "Versions of the provider, of its kubernetes client and of the connected cluster. " +
+			"Useful to assert in `precondition` blocks that a cluster is recent enough for the behavior of the eviction API a module relies on.",
+
+		Attributes: map[string]schema.Attribute{
+			"provider_version": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Version of the provider.",
+			},
+			"client_go_version": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Version of the kubernetes client-go library built into the provider.",
+			},
+			"cluster_version": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Git version of the kubernetes API server, e.g. `v1.27.3-gke.100`.",
+			},
+			"cluster_major": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Major version of the kubernetes API server.",
+			},
+			"cluster_minor": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Minor version of the kubernetes API server, possibly with a `+` suffix on some managed clusters.",
+			},
+		},
+	}
+}
+
+func (d *VersionsDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*K8sNpProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unable to get kubernetes config",
+			"Unexpected error while fetching kubernetes config",
+		)
+		return
+	}
+	d.retry = providerData.retry
+	d.providerVersion = providerData.version
+
+	k8sClient, err := providerData.clients.KubeClient(providerData.config)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to create kubernetes client",
+			"Unexpected error while creating kubernetes client: "+err.Error(),
+		)
+		return
+	}
+	d.k8sClient = k8sClient
+}
+
+func (d *VersionsDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data VersionsDataSourceModel
+
+	// Read Terraform configuration data into the model
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var major, minor, gitVersion string
+	err := d.retry.Do(ctx, "getting the cluster version", func() error {
+		info, err := d.k8sClient.Discovery().ServerVersion()
+		if err != nil {
+			return err
+		}
+		major, minor, gitVersion = info.Major, info.Minor, info.GitVersion
+		return nil
+	})
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Error reading versions",
+			fmt.Sprintf("Could not read versions, unexpected error getting the cluster version: %s", err.Error()),
+		)
+		return
+	}
+
+	data.ProviderVersion = types.StringValue(d.providerVersion)
+	data.ClientGoVersion = types.StringValue(clientGoVersion())
+	data.ClusterVersion = types.StringValue(gitVersion)
+	data.ClusterMajor = types.StringValue(major)
+	data.ClusterMinor = types.StringValue(minor)
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// clientGoVersion returns the version of the client-go module the
+// provider was built with, or "unknown" without build information.
+func clientGoVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path == "k8s.io/client-go" {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+
+	return "unknown"
+}
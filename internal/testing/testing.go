@@ -0,0 +1,65 @@
+// Package testing provides a k8snp provider backed by a fake kubernetes
+// cluster, so that modules using the provider can be tested with
+// `terraform test` without credentials for a live cluster.
+package testing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dedalusj/k8snp/internal/kube"
+	"github.com/dedalusj/k8snp/internal/provider"
+	tfprovider "github.com/hashicorp/terraform-plugin-framework/provider"
+	"k8s.io/apimachinery/pkg/runtime"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// FakeClusterEnvVar is the environment variable holding the path of the
+// manifest file used to seed the fake cluster of the provider binary.
+const FakeClusterEnvVar = "K8SNP_FAKE_CLUSTER"
+
+// NewTesting returns a provider factory whose resources and data sources
+// use the given client, e.g. a fake clientset, instead of connecting to the
+// kubernetes API configured in the provider block.
+func NewTesting(client kubernetes.Interface) func() tfprovider.Provider {
+	return provider.NewWithKubeClientProvider("test", kube.StaticClientProvider(client))
+}
+
+// NewFakeClientFromFile returns a fake clientset seeded with the objects,
+// e.g. nodes and pods, in the YAML or JSON manifest file at path. Multiple
+// objects are separated by `---` as in kubectl manifests.
+func NewFakeClientFromFile(path string) (kubernetes.Interface, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fake cluster manifest: %w", err)
+	}
+	defer f.Close()
+
+	var objects []runtime.Object
+	decoder := yamlutil.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read fake cluster manifest: %w", err)
+		}
+		if len(raw.Raw) == 0 {
+			continue
+		}
+
+		object, _, err := scheme.Codecs.UniversalDeserializer().Decode(raw.Raw, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode object in fake cluster manifest: %w", err)
+		}
+		objects = append(objects, object)
+	}
+
+	return fake.NewSimpleClientset(objects...), nil
+}
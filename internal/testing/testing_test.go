@@ -0,0 +1,193 @@
+package testing
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const manifest = `
+apiVersion: v1
+kind: Node
+metadata:
+  name: node-1
+  labels:
+    pool: a
+status:
+  conditions:
+    - type: Ready
+      status: "True"
+  allocatable:
+    cpu: "2"
+    memory: 4Gi
+    pods: "110"
+---
+apiVersion: v1
+kind: Node
+metadata:
+  name: node-2
+  labels:
+    pool: b
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+  namespace: default
+spec:
+  nodeName: node-1
+  containers:
+    - name: app
+      image: app
+`
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "cluster.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("unexpected error writing the manifest: %v", err)
+	}
+	return path
+}
+
+func TestNewFakeClientFromFile(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := NewFakeClientFromFile(writeManifest(t, manifest))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error listing nodes: %v", err)
+	}
+	if len(nodes.Items) != 2 {
+		t.Errorf("expected 2 nodes, got %d", len(nodes.Items))
+	}
+
+	if _, err := client.CoreV1().Pods("default").Get(ctx, "app", metav1.GetOptions{}); err != nil {
+		t.Errorf("unexpected error getting pod: %v", err)
+	}
+}
+
+func TestNewFakeClientFromFileErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing file":   filepath.Join(t.TempDir(), "missing.yaml"),
+		"invalid object": writeManifest(t, "apiVersion: v1\nkind: Unknown\n"),
+		"invalid yaml":   writeManifest(t, "apiVersion: [v1\n"),
+	}
+
+	for name, path := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewFakeClientFromFile(path); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+// objectValue returns a value of typ, an object type, with the given
+// attribute values and all the other attributes null.
+func objectValue(t *testing.T, typ tftypes.Type, values map[string]tftypes.Value) *tfprotov6.DynamicValue {
+	t.Helper()
+
+	objectType := typ.(tftypes.Object)
+	attributes := map[string]tftypes.Value{}
+	for name, attributeType := range objectType.AttributeTypes {
+		attributes[name] = tftypes.NewValue(attributeType, nil)
+	}
+	for name, value := range values {
+		attributes[name] = value
+	}
+
+	value, err := tfprotov6.NewDynamicValue(objectType, tftypes.NewValue(objectType, attributes))
+	if err != nil {
+		t.Fatalf("unexpected error creating the value: %v", err)
+	}
+	return &value
+}
+
+func checkDiagnostics(t *testing.T, diagnostics []*tfprotov6.Diagnostic) {
+	t.Helper()
+
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == tfprotov6.DiagnosticSeverityError {
+			t.Fatalf("%s: %s", diagnostic.Summary, diagnostic.Detail)
+		}
+	}
+}
+
+// TestNewTesting reads a data source from the provider served as Terraform
+// does, to check that it uses the fake cluster instead of the configured one.
+func TestNewTesting(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := NewFakeClientFromFile(writeManifest(t, manifest))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server, err := providerserver.NewProtocol6WithError(NewTesting(client)())()
+	if err != nil {
+		t.Fatalf("unexpected error creating the provider server: %v", err)
+	}
+
+	schemas, err := server.GetProviderSchema(ctx, &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error getting the schemas: %v", err)
+	}
+	checkDiagnostics(t, schemas.Diagnostics)
+
+	configured, err := server.ConfigureProvider(ctx, &tfprotov6.ConfigureProviderRequest{
+		Config: objectValue(t, schemas.Provider.ValueType(), map[string]tftypes.Value{
+			"kube_host":              tftypes.NewValue(tftypes.String, "https://fake"),
+			"cluster_ca_certificate": tftypes.NewValue(tftypes.String, ""),
+			"token":                  tftypes.NewValue(tftypes.String, "fake"),
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error configuring the provider: %v", err)
+	}
+	checkDiagnostics(t, configured.Diagnostics)
+
+	dataSourceType := schemas.DataSourceSchemas["k8snp_pool_capacity"].ValueType()
+	read, err := server.ReadDataSource(ctx, &tfprotov6.ReadDataSourceRequest{
+		TypeName: "k8snp_pool_capacity",
+		Config: objectValue(t, dataSourceType, map[string]tftypes.Value{
+			"node_selector_key":   tftypes.NewValue(tftypes.String, "pool"),
+			"node_selector_value": tftypes.NewValue(tftypes.String, "a"),
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error reading the data source: %v", err)
+	}
+	checkDiagnostics(t, read.Diagnostics)
+
+	state, err := read.State.Unmarshal(dataSourceType)
+	if err != nil {
+		t.Fatalf("unexpected error reading the state: %v", err)
+	}
+	var attributes map[string]tftypes.Value
+	if err := state.As(&attributes); err != nil {
+		t.Fatalf("unexpected error reading the state: %v", err)
+	}
+	nodes, pods := new(big.Float), new(big.Float)
+	if err := attributes["nodes"].As(&nodes); err != nil {
+		t.Fatalf("unexpected error reading nodes: %v", err)
+	}
+	if err := attributes["pods"].As(&pods); err != nil {
+		t.Fatalf("unexpected error reading pods: %v", err)
+	}
+	if nodes.Cmp(big.NewFloat(1)) != 0 || pods.Cmp(big.NewFloat(110)) != 0 {
+		t.Errorf("expected 1 node with capacity for 110 pods, got %v nodes and %v pods", nodes, pods)
+	}
+}
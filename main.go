@@ -5,7 +5,6 @@ import (
 	"flag"
 	"log"
 
-	"github.com/dedalusj/k8snp/internal/provider"
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
 )
 
@@ -37,9 +36,17 @@ func main() {
 	opts := providerserver.ServeOpts{
 		Address: "registry.terraform.io/dedalusj/k8snp",
 		Debug:   debug,
+		// protocol version 6 is required for provider defined functions
+		// and resource identities.
+		ProtocolVersion: 6,
 	}
 
-	err := providerserver.Serve(context.Background(), provider.New(version), opts)
+	providerFunc, err := newProvider(version)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	err = providerserver.Serve(context.Background(), providerFunc, opts)
 
 	if err != nil {
 		log.Fatal(err.Error())
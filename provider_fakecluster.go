@@ -0,0 +1,28 @@
+//go:build fakecluster
+
+package main
+
+import (
+	"os"
+
+	"github.com/dedalusj/k8snp/internal/provider"
+	k8snptesting "github.com/dedalusj/k8snp/internal/testing"
+	tfprovider "github.com/hashicorp/terraform-plugin-framework/provider"
+)
+
+// newProvider returns the factory of the provider served by the binary. In
+// builds with the fakecluster tag, which release builds do not set, it serves
+// a provider backed by a fake cluster when requested, e.g. to run
+// `terraform test` for modules using the provider.
+func newProvider(version string) (func() tfprovider.Provider, error) {
+	path := os.Getenv(k8snptesting.FakeClusterEnvVar)
+	if path == "" {
+		return provider.New(version), nil
+	}
+
+	client, err := k8snptesting.NewFakeClientFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return k8snptesting.NewTesting(client), nil
+}
@@ -0,0 +1,14 @@
+//go:build !fakecluster
+
+package main
+
+import (
+	"github.com/dedalusj/k8snp/internal/provider"
+	tfprovider "github.com/hashicorp/terraform-plugin-framework/provider"
+)
+
+// newProvider returns the factory of the provider served by the binary,
+// always connecting to the kubernetes API configured in the provider block.
+func newProvider(version string) (func() tfprovider.Provider, error) {
+	return provider.New(version), nil
+}